@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenRenderer keeps the data of the last render so the journey can read
+// the token value shown once after creation
+type tokenRenderer struct {
+	data map[string]interface{}
+}
+
+func (r *tokenRenderer) Render(_ io.Writer, _ string, data interface{}, _ echo.Context) error {
+	r.data, _ = data.(map[string]interface{})
+	return nil
+}
+
+func TestAPITokenJourney(t *testing.T) {
+	// 1. Setup: alice and bob are signed in; alice may create access keys
+	e := echo.New()
+	renderer := &tokenRenderer{}
+	e.Renderer = renderer
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	aliceClient := new(MockMinioClient)
+	bobClient := new(MockMinioClient)
+	tokenClient := new(MockMinioClient)
+
+	aliceCreds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "alice", SecretKey: "password", User: "alice"}
+	bobCreds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "bob", SecretKey: "password", User: "bob"}
+	tokenCreds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "svc-alice", SecretKey: "svc-secret", User: "alice"}
+	mockFactory.On("NewAdminClient", aliceCreds).Return(aliceClient, nil)
+	mockFactory.On("NewAdminClient", bobCreds).Return(bobClient, nil)
+	mockFactory.On("NewClient", tokenCreds).Return(tokenClient, nil)
+	mockFactory.On("NewAdminClient", tokenCreds).Return(tokenClient, nil)
+	aliceClient.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, assert.AnError)
+	bobClient.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, assert.AnError)
+	aliceClient.On("AddServiceAccount", mock.Anything, mock.MatchedBy(func(req madmin.AddServiceAccountReq) bool {
+		return req.Expiration != nil && len(req.Policy) > 0
+	})).Return(madmin.Credentials{AccessKey: "svc-alice", SecretKey: "svc-secret"}, nil)
+	aliceClient.On("DeleteServiceAccount", mock.Anything, "svc-alice").Return(nil)
+	tokenClient.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{{Name: "reports", CreationDate: time.Now()}}, nil)
+	tokenClient.On("DataUsageInfo", mock.Anything).Return(madmin.DataUsageInfo{}, nil)
+	tokenClient.On("GetBucketPolicy", mock.Anything, "reports").Return("", nil)
+
+	aliceSession, _, err := authService.CreateSession(aliceCreds, services.SessionClient{})
+	require.NoError(t, err)
+	bobSession, _, err := authService.CreateSession(bobCreds, services.SessionClient{})
+	require.NoError(t, err)
+
+	tokens := services.NewAPITokenService(services.NewMemoryAPITokenStore(), authService.Keyring(), mockFactory, 90*24*time.Hour)
+	tokensHandler := handlers.NewAPITokensHandler(authService, mockFactory, tokens)
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory)
+	e.Use(middleware.APITokenAuth(tokens))
+	e.Use(middleware.AuthMiddleware(authService))
+	e.GET("/buckets", bucketsHandler.ListBuckets)
+	e.POST("/buckets/create", bucketsHandler.CreateBucket)
+	e.GET("/settings/tokens", tokensHandler.ListTokens)
+	e.POST("/settings/tokens/create", tokensHandler.CreateToken)
+	e.POST("/settings/tokens/revoke", tokensHandler.RevokeToken)
+
+	post := func(path, session string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. Alice creates a read-only token and sees its value once
+	rec := post("/settings/tokens/create", aliceSession, url.Values{"name": {"reports"}, "scope": {"read-only"}, "days": {"30"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	value, _ := renderer.data["Value"].(string)
+	require.True(t, strings.HasPrefix(value, "ibt_"), "token value should be shown after creation")
+	created := renderer.data["Token"].(services.APIToken)
+
+	// 3. A script lists buckets with the token, acting as the service account
+	rec = bearer(http.MethodGet, "/buckets", value)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockFactory.AssertCalled(t, "NewClient", tokenCreds)
+
+	// 4. The read-only token cannot change anything or mint further tokens
+	assert.Equal(t, http.StatusForbidden, bearer(http.MethodPost, "/buckets/create", value).Code)
+	assert.Equal(t, http.StatusForbidden, bearer(http.MethodGet, "/settings/tokens", value).Code)
+
+	// 5. Bob cannot see or revoke alice's token
+	rec = post("/settings/tokens/revoke", bobSession, url.Values{"id": {created.ID}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, http.StatusOK, bearer(http.MethodGet, "/buckets", value).Code)
+
+	// 6. Alice revokes the token, removing its service account
+	rec = post("/settings/tokens/revoke", aliceSession, url.Values{"id": {created.ID}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/settings/tokens", rec.Header().Get("HX-Redirect"))
+	aliceClient.AssertCalled(t, "DeleteServiceAccount", mock.Anything, "svc-alice")
+
+	// 7. The revoked token no longer works
+	rec = bearer(http.MethodGet, "/buckets", value)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApprovalJourney(t *testing.T) {
+	// 1. Setup: bucket deletion needs a second person, alice and bob are both admins
+	approvals := services.NewApprovalService(services.ApprovalConfig{
+		Actions: map[services.ApprovalAction]bool{services.ApprovalDeleteBucket: true},
+		TTL:     time.Hour,
+	}, services.NewMemoryApprovalStore())
+
+	e := echo.New()
+	e.Renderer = &renderer.TemplateRenderer{Templates: map[string]*template.Template{
+		"approvals": template.Must(renderer.ParseFiles(
+			"../../views/layouts/base.html",
+			"../../views/partials/confirm_dialog.html",
+			"../../views/pages/approvals.html",
+		)),
+	}}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	aliceClient := new(MockMinioClient)
+	bobClient := new(MockMinioClient)
+
+	alice := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "alice", SecretKey: "password"}
+	bob := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "bob", SecretKey: "password"}
+	for creds, client := range map[services.Credentials]*MockMinioClient{alice: aliceClient, bob: bobClient} {
+		mockFactory.On("NewAdminClient", creds).Return(client, nil)
+		mockFactory.On("NewClient", creds).Return(client, nil)
+		client.On("AccountInfo", mock.Anything, mock.Anything).Return(madmin.AccountInfo{}, assert.AnError)
+		client.On("RemoveBucket", mock.Anything, "reports").Return(nil)
+	}
+
+	aliceSession, _, err := authService.CreateSession(alice, services.SessionClient{})
+	require.NoError(t, err)
+	bobSession, _, err := authService.CreateSession(bob, services.SessionClient{})
+	require.NoError(t, err)
+
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory).WithApprovals(approvals)
+	usersHandler := handlers.NewUsersHandler(mockFactory).WithApprovals(approvals)
+	settingsHandler := handlers.NewSettingsHandler(mockFactory).WithApprovals(approvals)
+	approvalsHandler := handlers.NewApprovalsHandler(approvals, mockFactory, bucketsHandler, usersHandler, settingsHandler)
+	e.Use(middleware.AuthMiddleware(authService))
+	e.Use(middleware.Permissions(services.NewPermissionService(mockFactory)))
+	e.Use(middleware.Approvals(approvals))
+	e.POST("/buckets/delete", bucketsHandler.DeleteBucket)
+	e.GET("/approvals", approvalsHandler.ListApprovals)
+	e.POST("/approvals/:id/approve", approvalsHandler.Approve)
+	e.POST("/approvals/:id/reject", approvalsHandler.Reject)
+
+	serve := func(session, method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("HX-Request", "true")
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. Alice deletes a bucket: it becomes a request instead of running
+	rec := serve(aliceSession, http.MethodPost, "/buckets/delete", url.Values{"bucketName": {"reports"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/approvals", rec.Header().Get("HX-Redirect"))
+	aliceClient.AssertNotCalled(t, "RemoveBucket", mock.Anything, mock.Anything)
+
+	requests, err := approvals.List(alice.Endpoint)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	id := requests[0].ID
+
+	// 3. Alice sees her request waiting, but cannot approve it herself
+	rec = serve(aliceSession, http.MethodGet, "/approvals", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Delete bucket reports")
+	assert.Contains(t, rec.Body.String(), "Waiting for someone else")
+
+	rec = serve(aliceSession, http.MethodPost, "/approvals/"+id+"/approve", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	aliceClient.AssertNotCalled(t, "RemoveBucket", mock.Anything, mock.Anything)
+
+	// 4. Bob sees it in his queue and approves it
+	rec = serve(bobSession, http.MethodGet, "/approvals", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/approvals/"+id+"/approve")
+
+	rec = serve(bobSession, http.MethodPost, "/approvals/"+id+"/approve", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/approvals", rec.Header().Get("HX-Redirect"))
+
+	// 5. The bucket is deleted with Bob's credentials, and only once
+	bobClient.AssertCalled(t, "RemoveBucket", mock.Anything, "reports")
+	aliceClient.AssertNotCalled(t, "RemoveBucket", mock.Anything, mock.Anything)
+
+	rec = serve(bobSession, http.MethodPost, "/approvals/"+id+"/approve", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	bobClient.AssertNumberOfCalls(t, "RemoveBucket", 1)
+
+	// 6. Alice sees who approved it
+	rec = serve(aliceSession, http.MethodGet, "/approvals", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "approved")
+	assert.Contains(t, rec.Body.String(), "bob")
+	assert.Contains(t, rec.Body.String(), "Nothing is waiting for approval")
+}
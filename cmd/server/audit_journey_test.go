@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditJourney(t *testing.T) {
+	// 1. Setup: an admin working on a cluster with an audit log
+	audit := services.NewAuditLog(services.NewMemoryAuditStore())
+
+	e := echo.New()
+	e.Renderer = &renderer.TemplateRenderer{Templates: map[string]*template.Template{
+		"audit": template.Must(renderer.ParseFiles(
+			"../../views/layouts/base.html",
+			"../../views/partials/confirm_dialog.html",
+			"../../views/pages/audit.html",
+		)),
+	}}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	client := new(MockMinioClient)
+
+	creds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "admin", SecretKey: "password"}
+	mockFactory.On("NewAdminClient", creds).Return(client, nil)
+	mockFactory.On("NewClient", creds).Return(client, nil)
+	client.On("AccountInfo", mock.Anything, mock.Anything).Return(madmin.AccountInfo{}, assert.AnError)
+	client.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, nil)
+	client.On("RemoveBucket", mock.Anything, "reports").Return(nil)
+	client.On("AddUser", mock.Anything, "alice", "alice-secret-key").Return(assert.AnError)
+
+	session, _, err := authService.CreateSession(creds, services.SessionClient{})
+	require.NoError(t, err)
+
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory)
+	usersHandler := handlers.NewUsersHandler(mockFactory)
+	auditHandler := handlers.NewAuditHandler(audit, mockFactory)
+	e.Use(middleware.AuthMiddleware(authService))
+	e.Use(middleware.Permissions(services.NewPermissionService(mockFactory)))
+	e.Use(middleware.Audit(audit))
+	e.POST("/buckets/delete", bucketsHandler.DeleteBucket)
+	e.POST("/users/create", usersHandler.CreateUser)
+	e.GET("/audit", auditHandler.ListEvents)
+	e.GET("/audit/export", auditHandler.Export)
+
+	serve := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("HX-Request", "true")
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. The admin deletes a bucket, and fails to create a user
+	rec := serve(http.MethodPost, "/buckets/delete", url.Values{"bucketName": {"reports"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	serve(http.MethodPost, "/users/create", url.Values{"accessKey": {"alice"}, "secretKey": {"alice-secret-key"}})
+
+	// 3. Both show up on the audit page, without the secret key
+	rec = serve(http.MethodGet, "/audit", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "bucket.delete")
+	assert.Contains(t, body, "user.create")
+	assert.NotContains(t, body, "alice-secret-key")
+
+	// 4. Filtering narrows the list to the bucket deletion
+	rec = serve(http.MethodGet, "/audit?target=reports", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "bucket.delete")
+	assert.NotContains(t, rec.Body.String(), "user.create")
+
+	// 5. CSV export of failures lists the user creation
+	rec = serve(http.MethodGet, "/audit/export?format=csv&result=failure", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), ".csv")
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "actor", rows[0][1])
+	assert.Equal(t, "admin", rows[1][1])
+	assert.Equal(t, "user.create", rows[1][5])
+	assert.Equal(t, "alice", rows[1][10])
+
+	// 6. JSON export includes everything
+	rec = serve(http.MethodGet, "/audit/export?format=json", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var events []services.AuditEvent
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &events))
+	require.Len(t, events, 2)
+	assert.Equal(t, "reports", events[1].Bucket)
+	assert.Equal(t, services.AuditSuccess, events[1].Result)
+}
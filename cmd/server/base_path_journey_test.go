@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasePathJourney(t *testing.T) {
+	// 1. Setup: IronBuckets published at https://tools.example.com/storage/
+	e := echo.New()
+	e.Renderer = renderer.New().WithBasePath("/storage")
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	mockClient := new(MockMinioClient)
+	mockFactory.On("NewClient", mock.Anything).Return(mockClient, nil)
+	mockClient.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{}, nil)
+
+	authHandler := handlers.NewAuthHandler(authService, mockFactory, "minio:9000")
+	e.Pre(middleware.BasePath("/storage"))
+	e.Use(middleware.AuthMiddleware(authService))
+	e.GET("/login", authHandler.LoginPage)
+	e.POST("/login", authHandler.Login)
+	e.GET("/logout", authHandler.Logout)
+	e.GET("/", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "dashboard", map[string]interface{}{"ActiveNav": "overview"})
+	})
+
+	get := func(path string, session *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if session != nil {
+			req.AddCookie(session)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. The prefix itself and anything outside it
+	rec := get("/storage", nil)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/storage/", rec.Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, get("/login", nil).Code)
+
+	// 3. Signed-out visitors are sent to the login page under the prefix
+	rec = get("/storage/", nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/storage/login", rec.Header().Get("Location"))
+
+	rec = get("/storage/login", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `href="/storage/static/css/app.css"`)
+	assert.Contains(t, rec.Body.String(), `hx-post="/storage/login"`)
+
+	// 4. Signing in redirects into the prefix and scopes the cookie to it
+	form := url.Values{"accessKey": {"admin"}, "secretKey": {"password"}}
+	req := httptest.NewRequest(http.MethodPost, "/storage/login", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, "/storage/", rec.Header().Get("HX-Redirect"))
+	var session *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == utils.CookieName {
+			session = cookie
+		}
+	}
+	require.NotNil(t, session)
+	assert.Equal(t, "/storage/", session.Path)
+
+	// 5. Pages link within the prefix
+	rec = get("/storage/", session)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `href="/storage/buckets"`)
+	assert.Contains(t, rec.Body.String(), `href="/storage/logout"`)
+
+	rec = get("/storage/logout", session)
+	assert.Equal(t, "/storage/login", rec.Header().Get("Location"))
+}
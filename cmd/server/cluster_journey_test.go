@@ -0,0 +1,103 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterSwitchJourney(t *testing.T) {
+	// 1. Setup: two clusters that accept the same access key
+	clusters, err := services.NewClusterRegistry([]services.Cluster{
+		{Alias: "prod", Name: "Production", URL: "https://minio.example.com"},
+		{Alias: "staging", Name: "Staging", URL: "http://minio-staging:9000"},
+	})
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Renderer = &renderer.TemplateRenderer{Templates: map[string]*template.Template{
+		"dashboard": template.Must(renderer.ParseFiles(
+			"../../views/layouts/base.html",
+			"../../views/partials/confirm_dialog.html",
+			"../../views/pages/dashboard.html",
+		)),
+	}}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	mockClient := new(MockMinioClient)
+	mockFactory.On("NewClient", mock.Anything).Return(mockClient, nil)
+	mockClient.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{}, nil)
+
+	authHandler := handlers.NewAuthHandler(authService, mockFactory, clusters.Default().Endpoint).WithClusters(clusters)
+	e.POST("/login", authHandler.Login)
+	app := e.Group("")
+	app.Use(middleware.AuthMiddleware(authService))
+	app.Use(middleware.ClusterContext(clusters))
+	app.GET("/", func(c echo.Context) error {
+		return c.Render(http.StatusOK, "dashboard", map[string]interface{}{"ActiveNav": "dashboard"})
+	})
+	app.POST("/clusters/switch", authHandler.SwitchCluster)
+
+	post := func(path string, form url.Values, session *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		if session != nil {
+			req.AddCookie(session)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	dashboard := func(session *http.Cookie) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(session)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+	sessionCookie := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == utils.CookieName {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	// 2. Sign in to production
+	rec := post("/login", url.Values{"accessKey": {"admin"}, "secretKey": {"password"}, "cluster": {"prod"}}, nil)
+	session := sessionCookie(rec)
+	require.NotNil(t, session)
+
+	// 3. Every page names the cluster and offers the others
+	body := dashboard(session)
+	assert.Contains(t, body, "Production")
+	assert.Contains(t, body, `hx-post="/clusters/switch"`)
+	assert.Contains(t, body, `<option value="staging"`)
+
+	// 4. Switch to staging without logging out
+	rec = post("/clusters/switch", url.Values{"cluster": {"staging"}}, session)
+	assert.Equal(t, "/", rec.Header().Get("HX-Redirect"))
+	switched := sessionCookie(rec)
+	require.NotNil(t, switched)
+
+	creds, err := authService.DecryptCredentials(switched.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "minio-staging:9000", creds.Endpoint)
+	assert.Contains(t, dashboard(switched), "Staging")
+}
@@ -1,151 +1,372 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/damacus/iron-buckets/internal/assets"
+	"github.com/damacus/iron-buckets/internal/config"
 	"github.com/damacus/iron-buckets/internal/handlers"
 	customMiddleware "github.com/damacus/iron-buckets/internal/middleware"
 	"github.com/damacus/iron-buckets/internal/renderer"
 	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/damacus/iron-buckets/views"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
-	// Load MinIO endpoint from environment
-	minioEndpoint := os.Getenv("MINIO_ENDPOINT")
-	if minioEndpoint == "" {
-		minioEndpoint = "play.min.io:9000" // Default for development
-		log.Printf("MINIO_ENDPOINT not set, using default: %s", minioEndpoint)
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := flags.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+	cfg, err := config.Load(flags, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Fatalf("Config: %v", err)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Config: %v", err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if *printConfig {
+		return
 	}
 
-	e := newServer(minioEndpoint)
+	e := newServer(cfg)
 
 	// Start Server
-	e.Logger.Fatal(e.Start(":8080"))
+	if cfg.TLS.Enabled() {
+		e.Logger.Fatal(serveTLS(e, cfg))
+	}
+	e.Logger.Fatal(e.Start(cfg.Listen))
 }
 
-func newServer(minioEndpoint string) *echo.Echo {
+// serveTLS serves HTTPS, reloading the certificate when its files change or
+// on SIGHUP, and optionally redirects plain HTTP to it
+func serveTLS(e *echo.Echo, cfg *config.Config) error {
+	tlsConfig, certificates, err := utils.NewServerTLS(cfg.TLS.Options())
+	if err != nil {
+		return err
+	}
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go certificates.Watch(context.Background(), cfg.TLS.ReloadInterval, reload)
+
+	if cfg.TLS.RedirectListen != "" {
+		redirect := &http.Server{
+			Addr:              cfg.TLS.RedirectListen,
+			Handler:           utils.HTTPSRedirect(cfg.Listen),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Fatalf("HTTPS redirect: %v", redirect.ListenAndServe())
+		}()
+	}
+
+	e.TLSServer.Addr = cfg.Listen
+	e.TLSServer.TLSConfig = tlsConfig
+	return e.StartServer(e.TLSServer)
+}
+
+// newServer builds the server from a validated configuration
+func newServer(cfg *config.Config) *echo.Echo {
 	e := echo.New()
 
 	// Services
+	proxies, err := cfg.Proxies()
+	if err != nil {
+		log.Fatalf("Trusted proxies: %v", err)
+	}
+	e.IPExtractor = proxies.ClientIP
+	basePath, err := cfg.Prefix()
+	if err != nil {
+		log.Fatalf("Base path: %v", err)
+	}
+	clusters, err := cfg.MinIO.Clusters()
+	if err != nil {
+		log.Fatalf("Clusters: %v", err)
+	}
+	stsClient := &services.RealSTSClient{Clusters: clusters}
+	keyring, err := cfg.Session.Keyring()
+	if err != nil {
+		log.Fatalf("Session keys: %v", err)
+	}
 	authService := services.NewAuthService()
-	minioFactory := &services.RealMinioFactory{}
-	authHandler := handlers.NewAuthHandler(authService, minioFactory, minioEndpoint)
-	usersHandler := handlers.NewUsersHandler(minioFactory)
-	groupsHandler := handlers.NewGroupsHandler(minioFactory)
-	bucketsHandler := handlers.NewBucketsHandler(minioFactory)
-	settingsHandler := handlers.NewSettingsHandler(minioFactory, minioEndpoint)
+	if keyring != nil {
+		authService = services.NewAuthServiceWithKeyring(keyring)
+	} else {
+		log.Printf("Auth: no session key configured, using an ephemeral key; sessions will not survive a restart")
+	}
+	authService.WithSTS(stsClient).WithSessionPolicy(cfg.Session.Policy())
+	sessionStore, err := services.NewSessionStore(cfg.Session.Store, cfg.Session.File)
+	if err != nil {
+		log.Fatalf("Session store: %v", err)
+	}
+	if sessionStore != nil {
+		authService.WithSessionStore(sessionStore)
+	}
+	minioFactory := &services.RealMinioFactory{Clusters: clusters}
+	authHandler := handlers.NewAuthHandler(authService, minioFactory, clusters.Default().Endpoint).
+		WithClusters(clusters)
+	if oidcConfig := cfg.OIDC.Service(); oidcConfig.Enabled() {
+		authHandler.WithOIDC(services.NewOIDCProvider(oidcConfig), stsClient)
+	}
+	if ldapConfig := cfg.LDAP.Service(); ldapConfig.Enabled {
+		authHandler.WithLDAP(ldapConfig, stsClient)
+	}
+	if certConfig := cfg.CertLogin.Service(); certConfig.Enabled {
+		authHandler.WithCertificateLogin(certConfig, stsClient)
+	}
+	loginLimiter := services.NewLoginLimiter(cfg.Login.Service(), services.NewMemoryLoginAttemptStore())
+	authHandler.WithLoginLimiter(loginLimiter)
+	totpConfig, err := cfg.TOTP.Service()
+	if err != nil {
+		log.Fatalf("TOTP: %v", err)
+	}
+	var mfaHandler *handlers.MFAHandler
+	if totpConfig.Enabled() {
+		totpStore, err := services.NewFileTOTPStore(totpConfig.File)
+		if err != nil {
+			log.Fatalf("TOTP store: %v", err)
+		}
+		totpService := services.NewTOTPService(totpStore, authService.Keyring(), totpConfig.Issuer)
+		authHandler.WithTOTP(totpService, totpConfig.Mode)
+		mfaHandler = handlers.NewMFAHandler(authService, minioFactory, totpService, totpConfig.Mode).
+			WithLoginLimiter(loginLimiter)
+	}
+	var apiTokens *services.APITokenService
+	if apiTokenConfig := cfg.APITokens.Service(); apiTokenConfig.Enabled {
+		apiTokenStore, err := services.NewFileAPITokenStore(apiTokenConfig.File)
+		if err != nil {
+			log.Fatalf("API token store: %v", err)
+		}
+		apiTokens = services.NewAPITokenService(apiTokenStore, authService.Keyring(), minioFactory, apiTokenConfig.MaxLifetime)
+	}
+	var roleConfig *services.RoleConfig
+	if cfg.Roles.File != "" {
+		if roleConfig, err = services.LoadRoleConfig(cfg.Roles.File); err != nil {
+			log.Fatalf("Roles: %v", err)
+		}
+	}
+	approvalConfig, err := cfg.Approvals.Service()
+	if err != nil {
+		log.Fatalf("Approvals: %v", err)
+	}
+	var approvals *services.ApprovalService
+	if approvalConfig.Enabled() {
+		approvalStore, err := services.NewFileApprovalStore(approvalConfig.File)
+		if err != nil {
+			log.Fatalf("Approval store: %v", err)
+		}
+		approvals = services.NewApprovalService(approvalConfig, approvalStore)
+	}
+	var webhooks *services.WebhookService
+	if cfg.Webhooks.File != "" {
+		webhookConfig, err := services.LoadWebhookConfig(cfg.Webhooks.File)
+		if err != nil {
+			log.Fatalf("Webhooks: %v", err)
+		}
+		webhooks = services.NewWebhookService(webhookConfig)
+	}
+	audit := services.NewAuditLog(services.NewFileAuditStore(cfg.Audit.Service()))
+	maintenance := services.NewMaintenanceMode(cfg.ReadOnly.Enabled, cfg.ReadOnly.Message)
+	usersHandler := handlers.NewUsersHandler(minioFactory).WithApprovals(approvals).WithWebhooks(webhooks)
+	groupsHandler := handlers.NewGroupsHandler(minioFactory).WithWebhooks(webhooks)
+	bucketsHandler := handlers.NewBucketsHandler(minioFactory).WithApprovals(approvals).WithWebhooks(webhooks)
+	settingsHandler := handlers.NewSettingsHandler(minioFactory).WithTOTP(totpConfig.Enabled()).
+		WithAPITokens(apiTokens != nil).WithMaintenance(maintenance).WithApprovals(approvals).WithWebhooks(webhooks)
 	drivesHandler := handlers.NewDrivesHandler(minioFactory)
 	dashboardHandler := handlers.NewDashboardHandler(minioFactory)
+	sessionsHandler := handlers.NewSessionsHandler(authService, minioFactory)
+	auditHandler := handlers.NewAuditHandler(audit, minioFactory)
 
 	// Middleware
+	e.Pre(customMiddleware.BasePath(basePath))
+	e.Use(customMiddleware.TrustedProxies(proxies))
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
-		LogStatus: true,
-		LogURI:    true,
+		LogStatus:   true,
+		LogURI:      true,
+		LogRemoteIP: true,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			log.Printf("REQUEST: uri: %v, status: %v\n", v.URI, v.Status)
+			log.Printf("REQUEST: uri: %v, status: %v, client: %v\n", v.URI, v.Status, v.RemoteIP)
 			return nil
 		},
 	}))
 	e.Use(middleware.Recover())
 	e.Use(customMiddleware.SecurityHeaders())
-	e.Use(customMiddleware.CSRF())
+	e.Use(customMiddleware.CSRF(basePath))
+	if apiTokens != nil {
+		e.Use(customMiddleware.APITokenAuth(apiTokens))
+	}
 	// Apply auth middleware globally - it will skip public routes internally
 	e.Use(customMiddleware.AuthMiddleware(authService))
+	e.Use(customMiddleware.ClusterContext(clusters))
+	e.Use(customMiddleware.Permissions(services.NewPermissionService(minioFactory)))
+	if roleConfig != nil {
+		e.Use(customMiddleware.Roles(services.NewRoleService(roleConfig, minioFactory, authService.LongTermCredentials)))
+	}
+	e.Use(customMiddleware.Audit(audit))
+	e.Use(customMiddleware.ReadOnly(maintenance))
+	if approvals != nil {
+		e.Use(customMiddleware.Approvals(approvals))
+	}
+
+	// Route-level role checks; they pass everything when roles are not configured
+	bucketsView := customMiddleware.RequireCapability(services.CapabilityBucketsView)
+	objectsWrite := customMiddleware.RequireCapability(services.CapabilityObjectsWrite)
+	bucketsManage := customMiddleware.RequireCapability(services.CapabilityBucketsManage)
+	iamView := customMiddleware.RequireCapability(services.CapabilityIAMView)
+	iamManage := customMiddleware.RequireCapability(services.CapabilityIAMManage)
+	serverView := customMiddleware.RequireCapability(services.CapabilityServerView)
+	serverRestart := customMiddleware.RequireCapability(services.CapabilityServerRestart)
 
 	// Template Renderer
-	e.Renderer = renderer.New()
+	var templates fs.FS = views.FS
+	if cfg.Templates.Dir != "" {
+		templates = renderer.Overlay(os.DirFS(cfg.Templates.Dir), views.FS)
+	}
+	templateRenderer, err := renderer.Load(templates)
+	if err != nil {
+		log.Fatalf("Templates: %v", err)
+	}
+	e.Renderer = templateRenderer.WithBasePath(basePath).WithReload(cfg.Templates.Reload)
 
 	// Public Routes (auth middleware will skip these)
 	e.GET("/health", func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
+	e.GET("/static/*", echo.WrapHandler(assets.Handler()))
 	e.GET("/login", authHandler.LoginPage)
 	e.POST("/login", authHandler.Login)
 	e.GET("/login/oauth", authHandler.LoginOIDC)
 	e.GET("/oauth/callback", authHandler.CallbackOIDC)
 	e.GET("/logout", authHandler.Logout)
+	if mfaHandler != nil {
+		e.GET("/login/mfa", mfaHandler.ChallengePage)
+		e.POST("/login/mfa", mfaHandler.Challenge)
+		e.GET("/login/mfa/enroll", mfaHandler.EnrollPage)
+		e.POST("/login/mfa/enroll", mfaHandler.Enroll)
+	}
 
 	// Protected Routes
+	e.GET("/session/status", authHandler.SessionStatus)
+	e.POST("/session/extend", authHandler.ExtendSession)
+	e.POST("/clusters/switch", authHandler.SwitchCluster)
 	e.GET("/", func(c echo.Context) error {
 		return c.Render(http.StatusOK, "dashboard", map[string]interface{}{
 			"ActiveNav": "dashboard",
 		})
 	})
-	e.GET("/drives", drivesHandler.ListDrives)
-	e.GET("/api/server/widget", dashboardHandler.GetServerWidget)
-	e.GET("/api/server/version", dashboardHandler.GetServerVersion)
-	e.GET("/api/drives/widget", drivesHandler.GetDrivesWidget)
-	e.GET("/api/storage/widget", dashboardHandler.GetStorageWidget)
-	e.GET("/api/users/widget", dashboardHandler.GetUsersWidget)
-	e.GET("/users", usersHandler.ListUsers)
-	e.GET("/users/create", usersHandler.CreateUserModal)
-	e.POST("/users/create", usersHandler.CreateUser)
-	e.POST("/users/delete", usersHandler.DeleteUser)
-	e.POST("/users/enable", usersHandler.EnableUser)
-	e.POST("/users/disable", usersHandler.DisableUser)
+	e.GET("/drives", drivesHandler.ListDrives, serverView)
+	e.GET("/api/server/widget", dashboardHandler.GetServerWidget, serverView)
+	e.GET("/api/server/version", dashboardHandler.GetServerVersion, serverView)
+	e.GET("/api/drives/widget", drivesHandler.GetDrivesWidget, serverView)
+	e.GET("/api/storage/widget", dashboardHandler.GetStorageWidget, serverView)
+	e.GET("/api/users/widget", dashboardHandler.GetUsersWidget, iamView)
+	e.GET("/users", usersHandler.ListUsers, iamView)
+	e.GET("/users/create", usersHandler.CreateUserModal, iamManage)
+	e.POST("/users/create", usersHandler.CreateUser, iamManage)
+	e.POST("/users/delete", usersHandler.DeleteUser, iamManage)
+	e.POST("/users/enable", usersHandler.EnableUser, iamManage)
+	e.POST("/users/disable", usersHandler.DisableUser, iamManage)
 
 	// Service Accounts
-	e.GET("/users/:accessKey/keys", usersHandler.ListServiceAccounts)
-	e.GET("/users/:accessKey/keys/create", usersHandler.CreateServiceAccountModal)
-	e.POST("/users/:accessKey/keys/create", usersHandler.CreateServiceAccount)
-	e.POST("/users/:accessKey/keys/delete", usersHandler.DeleteServiceAccount)
+	e.GET("/users/:accessKey/keys", usersHandler.ListServiceAccounts, iamView)
+	e.GET("/users/:accessKey/keys/create", usersHandler.CreateServiceAccountModal, iamManage)
+	e.POST("/users/:accessKey/keys/create", usersHandler.CreateServiceAccount, iamManage)
+	e.POST("/users/:accessKey/keys/delete", usersHandler.DeleteServiceAccount, iamManage)
 
 	// Policies
-	e.GET("/policies", usersHandler.ListPolicies)
-	e.GET("/users/:accessKey/policy/modal", usersHandler.PolicyModal)
-	e.POST("/users/:accessKey/policy", usersHandler.AttachPolicy)
+	e.GET("/policies", usersHandler.ListPolicies, iamView)
+	e.GET("/users/:accessKey/policy/modal", usersHandler.PolicyModal, iamManage)
+	e.POST("/users/:accessKey/policy", usersHandler.AttachPolicy, iamManage)
 
 	// Groups
-	e.GET("/groups", groupsHandler.ListGroups)
-	e.GET("/groups/create", groupsHandler.CreateGroupModal)
-	e.POST("/groups/create", groupsHandler.CreateGroup)
-	e.GET("/groups/:groupName", groupsHandler.ViewGroup)
-	e.POST("/groups/:groupName/members/add", groupsHandler.AddMembers)
-	e.POST("/groups/:groupName/members/remove", groupsHandler.RemoveMembers)
-	e.POST("/groups/:groupName/disable", groupsHandler.DisableGroup)
-	e.POST("/groups/:groupName/enable", groupsHandler.EnableGroup)
-	e.POST("/groups/:groupName/policy", groupsHandler.AttachPolicy)
-
-	e.GET("/buckets", bucketsHandler.ListBuckets)
-	e.GET("/buckets/create", bucketsHandler.CreateBucketModal)
-	e.POST("/buckets/create", bucketsHandler.CreateBucket)
-	e.POST("/buckets/delete", bucketsHandler.DeleteBucket)
+	e.GET("/groups", groupsHandler.ListGroups, iamView)
+	e.GET("/groups/create", groupsHandler.CreateGroupModal, iamManage)
+	e.POST("/groups/create", groupsHandler.CreateGroup, iamManage)
+	e.GET("/groups/:groupName", groupsHandler.ViewGroup, iamView)
+	e.POST("/groups/:groupName/members/add", groupsHandler.AddMembers, iamManage)
+	e.POST("/groups/:groupName/members/remove", groupsHandler.RemoveMembers, iamManage)
+	e.POST("/groups/:groupName/disable", groupsHandler.DisableGroup, iamManage)
+	e.POST("/groups/:groupName/enable", groupsHandler.EnableGroup, iamManage)
+	e.POST("/groups/:groupName/policy", groupsHandler.AttachPolicy, iamManage)
+
+	e.GET("/buckets", bucketsHandler.ListBuckets, bucketsView)
+	e.GET("/buckets/create", bucketsHandler.CreateBucketModal, bucketsManage)
+	e.POST("/buckets/create", bucketsHandler.CreateBucket, bucketsManage)
+	e.POST("/buckets/delete", bucketsHandler.DeleteBucket, bucketsManage)
 
 	// Object Browser
-	e.GET("/buckets/:bucketName", bucketsHandler.BrowseBucket)
-	e.POST("/buckets/:bucketName/upload", bucketsHandler.UploadObject)
-	e.POST("/buckets/:bucketName/delete", bucketsHandler.DeleteObject)
-	e.GET("/buckets/:bucketName/download", bucketsHandler.DownloadObject)
-	e.GET("/buckets/:bucketName/zip", bucketsHandler.DownloadZip)
-	e.POST("/buckets/:bucketName/share", bucketsHandler.GenerateShareLink)
-	e.GET("/buckets/:bucketName/folder/create", bucketsHandler.CreateFolderModal)
-	e.POST("/buckets/:bucketName/folder/create", bucketsHandler.CreateFolder)
-	e.POST("/buckets/:bucketName/folder/delete", bucketsHandler.DeleteFolder)
+	e.GET("/buckets/:bucketName", bucketsHandler.BrowseBucket, bucketsView)
+	e.POST("/buckets/:bucketName/upload", bucketsHandler.UploadObject, objectsWrite)
+	e.POST("/buckets/:bucketName/delete", bucketsHandler.DeleteObject, objectsWrite)
+	e.GET("/buckets/:bucketName/download", bucketsHandler.DownloadObject, bucketsView)
+	e.GET("/buckets/:bucketName/zip", bucketsHandler.DownloadZip, bucketsView)
+	e.POST("/buckets/:bucketName/share", bucketsHandler.GenerateShareLink, objectsWrite)
+	e.GET("/buckets/:bucketName/folder/create", bucketsHandler.CreateFolderModal, objectsWrite)
+	e.POST("/buckets/:bucketName/folder/create", bucketsHandler.CreateFolder, objectsWrite)
+	e.POST("/buckets/:bucketName/folder/delete", bucketsHandler.DeleteFolder, objectsWrite)
 
 	// Bucket Settings
-	e.GET("/buckets/:bucketName/settings", bucketsHandler.BucketSettings)
-	e.GET("/buckets/:bucketName/versioning", bucketsHandler.GetVersioningStatus)
-	e.POST("/buckets/:bucketName/versioning/enable", bucketsHandler.EnableVersioning)
-	e.POST("/buckets/:bucketName/versioning/suspend", bucketsHandler.SuspendVersioning)
-	e.GET("/buckets/:bucketName/lifecycle", bucketsHandler.GetLifecycleRules)
-	e.POST("/buckets/:bucketName/lifecycle", bucketsHandler.AddLifecycleRule)
-	e.POST("/buckets/:bucketName/lifecycle/delete", bucketsHandler.DeleteLifecycleRule)
-	e.GET("/buckets/:bucketName/object/info", bucketsHandler.GetObjectInfo)
-	e.POST("/buckets/:bucketName/object/tags", bucketsHandler.SetObjectTags)
-	e.GET("/buckets/:bucketName/notifications", bucketsHandler.GetNotifications)
-	e.GET("/buckets/:bucketName/replication", bucketsHandler.GetReplication)
-	e.GET("/buckets/:bucketName/quota", bucketsHandler.GetBucketQuota)
-	e.POST("/buckets/:bucketName/quota", bucketsHandler.SetBucketQuota)
-	e.GET("/buckets/:bucketName/policy", bucketsHandler.GetBucketPolicy)
-	e.POST("/buckets/:bucketName/policy", bucketsHandler.SetBucketPolicy)
+	e.GET("/buckets/:bucketName/settings", bucketsHandler.BucketSettings, bucketsView)
+	e.GET("/buckets/:bucketName/versioning", bucketsHandler.GetVersioningStatus, bucketsView)
+	e.POST("/buckets/:bucketName/versioning/enable", bucketsHandler.EnableVersioning, bucketsManage)
+	e.POST("/buckets/:bucketName/versioning/suspend", bucketsHandler.SuspendVersioning, bucketsManage)
+	e.GET("/buckets/:bucketName/lifecycle", bucketsHandler.GetLifecycleRules, bucketsView)
+	e.POST("/buckets/:bucketName/lifecycle", bucketsHandler.AddLifecycleRule, bucketsManage)
+	e.POST("/buckets/:bucketName/lifecycle/delete", bucketsHandler.DeleteLifecycleRule, bucketsManage)
+	e.GET("/buckets/:bucketName/object/info", bucketsHandler.GetObjectInfo, bucketsView)
+	e.POST("/buckets/:bucketName/object/tags", bucketsHandler.SetObjectTags, objectsWrite)
+	e.GET("/buckets/:bucketName/notifications", bucketsHandler.GetNotifications, bucketsView)
+	e.GET("/buckets/:bucketName/replication", bucketsHandler.GetReplication, bucketsView)
+	e.GET("/buckets/:bucketName/quota", bucketsHandler.GetBucketQuota, bucketsView)
+	e.POST("/buckets/:bucketName/quota", bucketsHandler.SetBucketQuota, bucketsManage)
+	e.GET("/buckets/:bucketName/policy", bucketsHandler.GetBucketPolicy, bucketsView)
+	e.POST("/buckets/:bucketName/policy", bucketsHandler.SetBucketPolicy, bucketsManage)
 
 	e.GET("/settings", settingsHandler.ShowSettings)
-	e.POST("/settings/restart", settingsHandler.RestartService)
-	e.GET("/settings/logs", settingsHandler.GetLogs)
+	e.POST("/settings/restart", settingsHandler.RestartService, serverRestart)
+	e.POST("/settings/maintenance", settingsHandler.SetMaintenance, serverRestart)
+	e.GET("/settings/logs", settingsHandler.GetLogs, serverView)
+	e.GET("/audit", auditHandler.ListEvents, serverView)
+	e.GET("/audit/export", auditHandler.Export, serverView)
+	e.GET("/settings/sessions", sessionsHandler.ListSessions)
+	e.POST("/settings/sessions/revoke", sessionsHandler.RevokeSession)
+	if mfaHandler != nil {
+		e.GET("/settings/mfa", mfaHandler.Settings)
+		e.POST("/settings/mfa/enroll", mfaHandler.SettingsEnroll)
+		e.POST("/settings/mfa/disable", mfaHandler.Disable)
+		e.POST("/settings/mfa/reset", mfaHandler.Reset)
+	}
+	if apiTokens != nil {
+		apiTokensHandler := handlers.NewAPITokensHandler(authService, minioFactory, apiTokens)
+		e.GET("/settings/tokens", apiTokensHandler.ListTokens)
+		e.POST("/settings/tokens/create", apiTokensHandler.CreateToken)
+		e.POST("/settings/tokens/revoke", apiTokensHandler.RevokeToken)
+	}
+
+	if webhooks != nil {
+		webhooksHandler := handlers.NewWebhooksHandler(webhooks, minioFactory)
+		e.GET("/settings/webhooks", webhooksHandler.ListDeliveries, serverView)
+	}
+
+	if approvals != nil {
+		approvalsHandler := handlers.NewApprovalsHandler(approvals, minioFactory, bucketsHandler, usersHandler, settingsHandler)
+		e.GET("/approvals", approvalsHandler.ListApprovals)
+		e.POST("/approvals/:id/approve", approvalsHandler.Approve)
+		e.POST("/approvals/:id/reject", approvalsHandler.Reject)
+	}
 
 	return e
 }
@@ -18,7 +18,7 @@ func TestRoutes(t *testing.T) {
 	// Setup Templates (Manually mirroring renderer.go logic)
 	templates := make(map[string]*template.Template)
 	parse := func(name, pageFile string) {
-		templates[name] = template.Must(template.ParseFiles(
+		templates[name] = template.Must(renderer.ParseFiles(
 			"../../views/layouts/base.html",
 			"../../views/partials/confirm_dialog.html",
 			"../../views/pages/"+pageFile,
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceJourney(t *testing.T) {
+	// 1. Setup: an admin, with read-only mode off at startup
+	maintenance := services.NewMaintenanceMode(false, "")
+
+	e := echo.New()
+	e.Renderer = &renderer.TemplateRenderer{Templates: map[string]*template.Template{
+		"buckets": template.Must(renderer.ParseFiles(
+			"../../views/layouts/base.html",
+			"../../views/partials/confirm_dialog.html",
+			"../../views/pages/buckets.html",
+		)),
+	}}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	client := new(MockMinioClient)
+
+	creds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "admin", SecretKey: "password"}
+	mockFactory.On("NewAdminClient", creds).Return(client, nil)
+	mockFactory.On("NewClient", creds).Return(client, nil)
+	client.On("AccountInfo", mock.Anything, mock.Anything).Return(madmin.AccountInfo{}, assert.AnError)
+	client.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, nil)
+	client.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{{Name: "reports", CreationDate: time.Now()}}, nil)
+	client.On("DataUsageInfo", mock.Anything).Return(madmin.DataUsageInfo{}, nil)
+	client.On("GetBucketPolicy", mock.Anything, "reports").Return("", nil)
+	client.On("RemoveBucket", mock.Anything, "reports").Return(nil)
+
+	session, _, err := authService.CreateSession(creds, services.SessionClient{})
+	require.NoError(t, err)
+
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory)
+	settingsHandler := handlers.NewSettingsHandler(mockFactory).WithMaintenance(maintenance)
+	e.Use(middleware.AuthMiddleware(authService))
+	e.Use(middleware.Permissions(services.NewPermissionService(mockFactory)))
+	e.Use(middleware.ReadOnly(maintenance))
+	e.GET("/buckets", bucketsHandler.ListBuckets)
+	e.POST("/buckets/delete", bucketsHandler.DeleteBucket)
+	e.POST("/settings/maintenance", settingsHandler.SetMaintenance)
+
+	serve := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("HX-Request", "true")
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. No notice while IronBuckets is writable
+	rec := serve(http.MethodGet, "/buckets", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `class="hidden flex items-center gap-2 px-8 py-2`)
+
+	// 3. The admin turns read-only mode on before a MinIO upgrade
+	rec = serve(http.MethodPost, "/settings/maintenance", url.Values{"enabled": {"true"}, "message": {"Upgrading MinIO until 14:00"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/settings", rec.Header().Get("HX-Redirect"))
+	assert.Equal(t, "admin", maintenance.Status().By)
+
+	// 4. Browsing still works and every page shows the notice
+	rec = serve(http.MethodGet, "/buckets", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Upgrading MinIO until 14:00")
+	assert.NotContains(t, rec.Body.String(), `class="hidden flex items-center gap-2 px-8 py-2`)
+
+	// 5. Changes are refused before MinIO is contacted
+	rec = serve(http.MethodPost, "/buckets/delete", url.Values{"bucketName": {"reports"}})
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "Upgrading MinIO until 14:00", rec.Body.String())
+	client.AssertNotCalled(t, "RemoveBucket", mock.Anything, mock.Anything)
+
+	// 6. Turning it off again allows changes
+	rec = serve(http.MethodPost, "/settings/maintenance", url.Values{"enabled": {"false"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(http.MethodPost, "/buckets/delete", url.Values{"bucketName": {"reports"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertCalled(t, "RemoveBucket", mock.Anything, "reports")
+}
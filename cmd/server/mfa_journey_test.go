@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFAResetJourney(t *testing.T) {
+	// 1. Setup: alice has lost her authenticator; an admin and alice are signed in
+	e := echo.New()
+	e.Renderer = &MockRenderer{}
+	authService := services.NewAuthService()
+	totp := services.NewTOTPService(services.NewMemoryTOTPStore(), authService.Keyring(), "IronBuckets")
+	mockFactory := new(MockMinioFactory)
+	adminClient := new(MockMinioClient)
+	userClient := new(MockMinioClient)
+
+	adminCreds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "admin", SecretKey: "password", User: "admin"}
+	userCreds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "alice", SecretKey: "password", User: "alice"}
+	mockFactory.On("NewAdminClient", adminCreds).Return(adminClient, nil)
+	mockFactory.On("NewAdminClient", userCreds).Return(userClient, nil)
+	adminClient.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, nil)
+	userClient.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, assert.AnError)
+
+	secret, _ := totp.NewSecret()
+	code, _ := services.TOTPCode(secret, time.Now())
+	_, err := totp.Enroll("alice", secret, code)
+	require.NoError(t, err)
+
+	adminSession, _, err := authService.CreateSession(adminCreds, services.SessionClient{})
+	require.NoError(t, err)
+	userSession, _, err := authService.CreateSession(userCreds, services.SessionClient{})
+	require.NoError(t, err)
+
+	mfaHandler := handlers.NewMFAHandler(authService, mockFactory, totp, services.TOTPRequired)
+	app := e.Group("")
+	app.Use(middleware.AuthMiddleware(authService))
+	app.GET("/settings/mfa", mfaHandler.Settings)
+	app.POST("/settings/mfa/reset", mfaHandler.Reset)
+
+	reset := func(session string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("user", "alice")
+		req := httptest.NewRequest(http.MethodPost, "/settings/mfa/reset", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. Both can open their own two-factor settings
+	req := httptest.NewRequest(http.MethodGet, "/settings/mfa", nil)
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: userSession})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// 3. A regular user cannot reset anyone's second factor
+	rec = reset(userSession)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	enrolled, _ := totp.Enrolled("alice")
+	assert.True(t, enrolled)
+
+	// 4. The admin resets alice, who will enroll again at her next sign-in
+	rec = reset(adminSession)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/settings/mfa", rec.Header().Get("HX-Redirect"))
+	enrolled, _ = totp.Enrolled("alice")
+	assert.False(t, enrolled)
+
+	// 5. Resetting again reports that there is nothing to reset
+	rec = reset(adminSession)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -70,6 +70,11 @@ func (m *MockMinioClient) GetConfig(ctx context.Context) ([]byte, error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *MockMinioClient) AccountInfo(ctx context.Context, opts madmin.AccountOpts) (madmin.AccountInfo, error) {
+	args := m.Called(ctx, opts)
+	return args.Get(0).(madmin.AccountInfo), args.Error(1)
+}
+
 func (m *MockMinioClient) ListServiceAccounts(ctx context.Context, user string) (madmin.ListServiceAccountsResp, error) {
 	args := m.Called(ctx, user)
 	return args.Get(0).(madmin.ListServiceAccountsResp), args.Error(1)
@@ -95,6 +100,11 @@ func (m *MockMinioClient) InfoCannedPolicyV2(ctx context.Context, policyName str
 	return args.Get(0).(*madmin.PolicyInfo), args.Error(1)
 }
 
+func (m *MockMinioClient) GetUserInfo(ctx context.Context, name string) (madmin.UserInfo, error) {
+	args := m.Called(ctx, name)
+	return args.Get(0).(madmin.UserInfo), args.Error(1)
+}
+
 func (m *MockMinioClient) ListGroups(ctx context.Context) ([]string, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]string), args.Error(1)
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionAwareUIJourney(t *testing.T) {
+	// 1. Setup: alice can read "reports" and write "uploads", and is not an admin
+	e := echo.New()
+	e.Renderer = &renderer.TemplateRenderer{Templates: map[string]*template.Template{
+		"buckets": template.Must(renderer.ParseFiles(
+			"../../views/layouts/base.html",
+			"../../views/partials/confirm_dialog.html",
+			"../../views/pages/buckets.html",
+		)),
+	}}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	client := new(MockMinioClient)
+
+	creds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "alice", SecretKey: "password", User: "alice"}
+	mockFactory.On("NewAdminClient", creds).Return(client, nil)
+	mockFactory.On("NewClient", creds).Return(client, nil)
+	client.On("AccountInfo", mock.Anything, mock.Anything).Return(madmin.AccountInfo{
+		AccountName: "alice",
+		Policy:      json.RawMessage(`{"Statement": [{"Effect": "Allow", "Action": ["s3:GetObject", "s3:ListBucket", "s3:PutObject"]}]}`),
+		Buckets: []madmin.BucketAccessInfo{
+			{Name: "reports", Access: madmin.AccountAccess{Read: true}},
+			{Name: "uploads", Access: madmin.AccountAccess{Read: true, Write: true}},
+		},
+	}, nil)
+	client.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{
+		{Name: "reports", CreationDate: time.Now()},
+		{Name: "uploads", CreationDate: time.Now()},
+	}, nil)
+	client.On("DataUsageInfo", mock.Anything).Return(madmin.DataUsageInfo{}, nil)
+	client.On("GetBucketPolicy", mock.Anything, mock.Anything).Return("", nil)
+
+	session, _, err := authService.CreateSession(creds, services.SessionClient{})
+	require.NoError(t, err)
+
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory)
+	usersHandler := handlers.NewUsersHandler(mockFactory)
+	e.Use(middleware.AuthMiddleware(authService))
+	e.Use(middleware.Permissions(services.NewPermissionService(mockFactory)))
+	e.GET("/buckets", bucketsHandler.ListBuckets)
+	e.GET("/buckets/:bucketName", bucketsHandler.BrowseBucket)
+	e.POST("/buckets/:bucketName/delete", bucketsHandler.DeleteObject)
+	e.GET("/users", usersHandler.ListUsers)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. The bucket list hides admin navigation and actions alice cannot take
+	rec := serve(http.MethodGet, "/buckets")
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.NotContains(t, body, `href="/users"`)
+	assert.NotContains(t, body, `href="/drives"`)
+	assert.Contains(t, body, `href="/buckets"`)
+	assert.NotContains(t, body, "Create Bucket")
+	assert.Equal(t, 1, strings.Count(body, "Delete Bucket"), "only the writable bucket can be deleted")
+
+	// 3. Admin pages answer with a clear 403 instead of a MinIO failure
+	rec = serve(http.MethodGet, "/users")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "You do not have permission to manage users")
+	client.AssertNotCalled(t, "ListUsers", mock.Anything)
+
+	// 4. Read-only buckets are refused before reaching MinIO
+	rec = serve(http.MethodPost, "/buckets/reports/delete?key=q1.csv")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "read-only access")
+	client.AssertNotCalled(t, "RemoveObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// 5. AccountInfo was asked once for the whole session
+	client.AssertNumberOfCalls(t, "AccountInfo", 1)
+}
+
+func TestNewBucketCanBeBrowsedBeforePermissionsRefresh(t *testing.T) {
+	// 1. Setup: alice may create buckets; AccountInfo is cached without the new one
+	e := echo.New()
+	e.Renderer = &MockRenderer{}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	client := new(MockMinioClient)
+
+	creds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "alice", SecretKey: "password", User: "alice"}
+	mockFactory.On("NewAdminClient", creds).Return(client, nil)
+	mockFactory.On("NewClient", creds).Return(client, nil)
+	client.On("AccountInfo", mock.Anything, mock.Anything).Return(madmin.AccountInfo{
+		AccountName: "alice",
+		Policy:      json.RawMessage(`{"Statement": [{"Effect": "Allow", "Action": ["s3:*"]}]}`),
+		Buckets:     []madmin.BucketAccessInfo{{Name: "reports", Access: madmin.AccountAccess{Read: true, Write: true}}},
+	}, nil)
+	client.On("MakeBucket", mock.Anything, "fresh", mock.Anything).Return(nil)
+	client.On("ListObjectsPaginated", mock.Anything, "fresh", mock.Anything).Return(services.ListObjectsResult{}, nil)
+	client.On("GetBucketPolicy", mock.Anything, "fresh").Return("", nil)
+
+	session, _, err := authService.CreateSession(creds, services.SessionClient{})
+	require.NoError(t, err)
+
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory)
+	e.Use(middleware.AuthMiddleware(authService))
+	e.Use(middleware.Permissions(services.NewPermissionService(mockFactory)))
+	e.POST("/buckets/create", bucketsHandler.CreateBucket)
+	e.GET("/buckets/:bucketName", bucketsHandler.BrowseBucket)
+
+	serve := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. Alice creates a bucket
+	rec := serve(http.MethodPost, "/buckets/create", url.Values{"bucketName": {"fresh"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/buckets", rec.Header().Get("HX-Redirect"))
+
+	// 3. She can open it straight away, although the cached answer predates it
+	rec = serve(http.MethodGet, "/buckets/fresh", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	client.AssertCalled(t, "ListObjectsPaginated", mock.Anything, "fresh", mock.Anything)
+	client.AssertNumberOfCalls(t, "AccountInfo", 1)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleJourney(t *testing.T) {
+	// 1. Setup: bob is in the "oncall" group, which may view but not restart
+	rolesFile := filepath.Join(t.TempDir(), "roles.yaml")
+	require.NoError(t, os.WriteFile(rolesFile, []byte(`
+roles:
+  oncall: [buckets.view, server.view]
+mappings:
+  - group: oncall
+    role: oncall
+`), 0o600))
+	roleConfig, err := services.LoadRoleConfig(rolesFile)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Renderer = &renderer.TemplateRenderer{Templates: map[string]*template.Template{
+		"buckets": template.Must(renderer.ParseFiles(
+			"../../views/layouts/base.html",
+			"../../views/partials/confirm_dialog.html",
+			"../../views/pages/buckets.html",
+		)),
+	}}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	client := new(MockMinioClient)
+
+	creds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "bob", SecretKey: "password", User: "bob"}
+	mockFactory.On("NewAdminClient", creds).Return(client, nil)
+	mockFactory.On("NewClient", creds).Return(client, nil)
+	// bob's MinIO policy would allow everything; only the role holds him back
+	client.On("AccountInfo", mock.Anything, mock.Anything).Return(madmin.AccountInfo{}, assert.AnError)
+	client.On("GetUserInfo", mock.Anything, "bob").Return(madmin.UserInfo{MemberOf: []string{"oncall"}}, nil)
+	client.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{{Name: "reports", CreationDate: time.Now()}}, nil)
+	client.On("DataUsageInfo", mock.Anything).Return(madmin.DataUsageInfo{}, nil)
+	client.On("GetBucketPolicy", mock.Anything, "reports").Return("", nil)
+
+	session, _, err := authService.CreateSession(creds, services.SessionClient{})
+	require.NoError(t, err)
+
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory)
+	settingsHandler := handlers.NewSettingsHandler(mockFactory)
+	usersHandler := handlers.NewUsersHandler(mockFactory)
+	e.Use(middleware.AuthMiddleware(authService))
+	e.Use(middleware.Permissions(services.NewPermissionService(mockFactory)))
+	e.Use(middleware.Roles(services.NewRoleService(roleConfig, mockFactory, authService.LongTermCredentials)))
+	e.GET("/buckets", bucketsHandler.ListBuckets, middleware.RequireCapability(services.CapabilityBucketsView))
+	e.POST("/buckets/delete", bucketsHandler.DeleteBucket, middleware.RequireCapability(services.CapabilityBucketsManage))
+	e.POST("/settings/restart", settingsHandler.RestartService, middleware.RequireCapability(services.CapabilityServerRestart))
+	e.GET("/users", usersHandler.ListUsers, middleware.RequireCapability(services.CapabilityIAMView))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. The bucket list shows drives in the nav but hides IAM and bucket changes
+	rec := serve(http.MethodGet, "/buckets")
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `href="/drives"`)
+	assert.NotContains(t, body, `href="/users"`)
+	assert.NotContains(t, body, "Create Bucket")
+	assert.NotContains(t, body, "Delete Bucket")
+
+	// 3. Restarting MinIO and deleting buckets are refused by the role
+	rec = serve(http.MethodPost, "/settings/restart")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Your role (oncall) does not allow this action")
+	client.AssertNotCalled(t, "ServiceRestart", mock.Anything)
+
+	rec = serve(http.MethodPost, "/buckets/delete?bucketName=reports")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	client.AssertNotCalled(t, "RemoveBucket", mock.Anything, mock.Anything)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/users").Code)
+
+	// 4. Group membership was looked up once for the session
+	client.AssertNumberOfCalls(t, "GetUserInfo", 1)
+}
@@ -4,11 +4,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"testing"
 
+	"github.com/damacus/iron-buckets/internal/config"
 	"github.com/stretchr/testify/assert"
 )
 
+// testConfig is the default configuration for a local MinIO
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.MinIO.Endpoint = "http://localhost:9000"
+	return cfg
+}
+
 func TestServerAddsSecurityHeadersOnHealth(t *testing.T) {
 	originalWD, err := os.Getwd()
 	assert.NoError(t, err)
@@ -17,7 +26,7 @@ func TestServerAddsSecurityHeadersOnHealth(t *testing.T) {
 		_ = os.Chdir(originalWD)
 	})
 
-	e := newServer("localhost:9000")
+	e := newServer(testConfig())
 
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	rec := httptest.NewRecorder()
@@ -36,7 +45,7 @@ func TestServerRejectsProtectedPostWithoutCSRFToken(t *testing.T) {
 		_ = os.Chdir(originalWD)
 	})
 
-	e := newServer("localhost:9000")
+	e := newServer(testConfig())
 
 	req := httptest.NewRequest(http.MethodPost, "/users/create", nil)
 	req.Header.Set("HX-Request", "true")
@@ -45,3 +54,51 @@ func TestServerRejectsProtectedPostWithoutCSRFToken(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
+
+func TestServerRejectsPlainFormPostWithoutCSRFToken(t *testing.T) {
+	originalWD, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir("../.."))
+	t.Cleanup(func() {
+		_ = os.Chdir(originalWD)
+	})
+
+	e := newServer(testConfig())
+
+	// A cross-site form submission carries no HX-Request header
+	for _, path := range []string{"/users/delete", "/buckets/delete"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+	}
+}
+
+func TestServerRendersCSPNonceIntoPages(t *testing.T) {
+	originalWD, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir("../.."))
+	t.Cleanup(func() {
+		_ = os.Chdir(originalWD)
+	})
+
+	e := newServer(testConfig())
+
+	req := httptest.NewRequest(http.MethodGet, "/login", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(rec.Header().Get("Content-Security-Policy"))
+	if assert.Len(t, nonce, 2) {
+		assert.Contains(t, rec.Body.String(), `"inlineScriptNonce": "`+nonce[1]+`"`)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/static/js/app.js", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRevocationJourney(t *testing.T) {
+	// 1. Setup: server-side sessions, an admin and a regular user
+	e := echo.New()
+	e.Renderer = &MockRenderer{}
+	store := services.NewMemorySessionStore()
+	authService := services.NewAuthService().WithSessionStore(store)
+	mockFactory := new(MockMinioFactory)
+	mockClient := new(MockMinioClient)
+
+	adminCreds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "admin", SecretKey: "password", User: "admin"}
+	userCreds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "alice", SecretKey: "password"}
+	mockFactory.On("NewClient", mock.Anything).Return(mockClient, nil)
+	mockClient.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{}, nil)
+	mockFactory.On("NewAdminClient", adminCreds).Return(mockClient, nil)
+	mockClient.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, nil)
+
+	authHandler := handlers.NewAuthHandler(authService, mockFactory, "play.minio.io:9000")
+	sessionsHandler := handlers.NewSessionsHandler(authService, mockFactory)
+	e.POST("/login", authHandler.Login)
+	app := e.Group("")
+	app.Use(middleware.AuthMiddleware(authService))
+	app.GET("/settings/sessions", sessionsHandler.ListSessions)
+	app.POST("/settings/sessions/revoke", sessionsHandler.RevokeSession)
+	app.GET("/", func(c echo.Context) error { return c.String(http.StatusOK, "dashboard") })
+
+	login := func(creds services.Credentials) *http.Cookie {
+		form := url.Values{}
+		form.Set("accessKey", creds.AccessKey)
+		form.Set("secretKey", creds.SecretKey)
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set("User-Agent", "journey-test/"+creds.AccessKey)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == utils.CookieName {
+				return cookie
+			}
+		}
+		t.Fatalf("no session cookie for %s", creds.AccessKey)
+		return nil
+	}
+
+	// 2. Both users log in; cookies carry only opaque IDs
+	adminCookie := login(adminCreds)
+	userCookie := login(userCreds)
+	_, err := authService.DecryptCredentials(userCookie.Value)
+	assert.Error(t, err, "cookie should hold a session ID, not sealed credentials")
+
+	sessions, err := authService.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	var userSession services.Session
+	for _, s := range sessions {
+		if s.AccessKey == "alice" {
+			userSession = s
+		}
+	}
+	assert.Equal(t, "journey-test/alice", userSession.UserAgent)
+	assert.NotEmpty(t, userSession.RemoteIP)
+	assert.NotEqual(t, userCookie.Value, userSession.ID, "listed IDs must not be usable as cookies")
+
+	// 3. Admin opens the sessions page
+	reqList := httptest.NewRequest(http.MethodGet, "/settings/sessions", nil)
+	reqList.AddCookie(adminCookie)
+	recList := httptest.NewRecorder()
+	e.ServeHTTP(recList, reqList)
+	assert.Equal(t, http.StatusOK, recList.Code)
+
+	// 4. Admin revokes alice's session
+	form := url.Values{}
+	form.Set("id", userSession.ID)
+	reqRevoke := httptest.NewRequest(http.MethodPost, "/settings/sessions/revoke", strings.NewReader(form.Encode()))
+	reqRevoke.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	reqRevoke.AddCookie(adminCookie)
+	recRevoke := httptest.NewRecorder()
+	e.ServeHTTP(recRevoke, reqRevoke)
+	assert.Equal(t, http.StatusOK, recRevoke.Code)
+	assert.Equal(t, "/settings/sessions", recRevoke.Header().Get("HX-Redirect"))
+
+	// 5. Alice is signed out on her next request; the admin is not
+	reqUser := httptest.NewRequest(http.MethodGet, "/", nil)
+	reqUser.AddCookie(userCookie)
+	recUser := httptest.NewRecorder()
+	e.ServeHTTP(recUser, reqUser)
+	assert.Equal(t, http.StatusSeeOther, recUser.Code)
+	assert.Equal(t, "/login", recUser.Header().Get("Location"))
+
+	reqAdmin := httptest.NewRequest(http.MethodGet, "/", nil)
+	reqAdmin.AddCookie(adminCookie)
+	recAdmin := httptest.NewRecorder()
+	e.ServeHTTP(recAdmin, reqAdmin)
+	assert.Equal(t, http.StatusOK, recAdmin.Code)
+}
+
+func TestSessionsPageRequiresAdmin(t *testing.T) {
+	e := echo.New()
+	e.Renderer = &MockRenderer{}
+	authService := services.NewAuthService().WithSessionStore(services.NewMemorySessionStore())
+	mockFactory := new(MockMinioFactory)
+	mockClient := new(MockMinioClient)
+
+	creds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "alice", SecretKey: "password"}
+	mockFactory.On("NewAdminClient", creds).Return(mockClient, nil)
+	mockClient.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, assert.AnError)
+
+	value, _, err := authService.CreateSession(creds, services.SessionClient{})
+	require.NoError(t, err)
+
+	sessionsHandler := handlers.NewSessionsHandler(authService, mockFactory)
+	app := e.Group("")
+	app.Use(middleware.AuthMiddleware(authService))
+	app.GET("/settings/sessions", sessionsHandler.ListSessions)
+
+	req := httptest.NewRequest(http.MethodGet, "/settings/sessions", nil)
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: value})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
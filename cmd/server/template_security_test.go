@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -9,23 +11,33 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestTemplatesUsePinnedCDNVersions(t *testing.T) {
-	files := []string{
-		"../../views/layouts/base.html",
-		"../../views/pages/login.html",
-		"../../views/pages/browser.html",
-	}
+func TestTemplatesLoadOnlyBundledAssets(t *testing.T) {
+	files, err := filepath.Glob("../../views/*/*.html")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
 
+	inlineHandler := regexp.MustCompile(`\son[a-z]+=|hx-on|\sstyle="`)
 	for _, file := range files {
 		contentBytes, err := os.ReadFile(file)
 		require.NoError(t, err)
 		content := string(contentBytes)
 
-		assert.NotContains(t, content, "@latest", file)
-		assert.NotContains(t, content, "3.x.x", file)
+		// The CSP only allows scripts and styles from IronBuckets itself
+		assert.NotRegexp(t, `(src|href)="(https?:)?//`, content, file)
+		assert.False(t, inlineHandler.MatchString(content), "%s uses an inline handler or style", file)
+		assert.NotContains(t, content, "<script>", "%s has an inline script without the CSP nonce", file)
 	}
 }
 
+func TestVendoredAssetsArePinned(t *testing.T) {
+	contentBytes, err := os.ReadFile("../../scripts/vendor-assets.sh")
+	require.NoError(t, err)
+	content := string(contentBytes)
+
+	assert.NotContains(t, content, "@latest")
+	assert.Contains(t, content, "@alpinejs/csp@$ALPINE_VERSION")
+}
+
 func TestTemplatesUseCSPCompatibleAlpineBuild(t *testing.T) {
 	files := []string{
 		"../../views/layouts/base.html",
@@ -37,7 +49,7 @@ func TestTemplatesUseCSPCompatibleAlpineBuild(t *testing.T) {
 		require.NoError(t, err)
 		content := string(contentBytes)
 
-		assert.Contains(t, content, "@alpinejs/csp@3.14.8", file)
+		assert.Contains(t, content, `src="{{ url "/static/vendor/alpine-csp.min.js" }}"`, file)
 	}
 }
 
@@ -51,10 +63,24 @@ func TestInteractiveTemplatesAttachCSRFHeaderForHTMX(t *testing.T) {
 	for _, file := range files {
 		contentBytes, err := os.ReadFile(file)
 		require.NoError(t, err)
-		content := string(contentBytes)
 
-		assert.True(t, strings.Contains(content, "htmx:configRequest") && strings.Contains(content, "X-CSRF-Token"), file)
+		assert.Contains(t, string(contentBytes), `src="{{ url "/static/js/app.js" }}"`, file)
 	}
+
+	contentBytes, err := os.ReadFile("../../internal/assets/static/js/app.js")
+	require.NoError(t, err)
+	content := string(contentBytes)
+	assert.True(t, strings.Contains(content, "htmx:configRequest") && strings.Contains(content, "X-CSRF-Token"))
+}
+
+func TestScriptedRequestsSendCSRFToken(t *testing.T) {
+	contentBytes, err := os.ReadFile("../../views/pages/browser.html")
+	require.NoError(t, err)
+	content := string(contentBytes)
+
+	// Bulk delete and uploads bypass HTMX, so they must set the header themselves
+	assert.Contains(t, content, `headers: { 'X-CSRF-Token': getCookieValue('csrf') }`)
+	assert.Contains(t, content, `xhr.setRequestHeader('X-CSRF-Token', getCookieValue('csrf'))`)
 }
 
 func TestBaseLayoutDoesNotGloballyOverrideHTMXTargeting(t *testing.T) {
@@ -72,7 +98,7 @@ func TestBucketsPageHasSingleCreateBucketTrigger(t *testing.T) {
 	require.NoError(t, err)
 	content := string(contentBytes)
 
-	assert.Equal(t, 1, strings.Count(content, `hx-get="/buckets/create"`))
+	assert.Equal(t, 1, strings.Count(content, `hx-get="{{ url "/buckets/create" }}"`))
 }
 
 func TestBucketsDropdownIsHiddenByDefaultAndToggledByButton(t *testing.T) {
@@ -80,8 +106,7 @@ func TestBucketsDropdownIsHiddenByDefaultAndToggledByButton(t *testing.T) {
 	require.NoError(t, err)
 	content := string(contentBytes)
 
-	assert.Contains(t, content, `nextElementSibling`)
-	assert.Contains(t, content, `.classList.toggle('hidden')`)
+	assert.Contains(t, content, `data-toggle-next`)
 	assert.Contains(t, content, `class="hidden absolute`)
 }
 
@@ -90,7 +115,5 @@ func TestBrowserUploadProgressModalIsHiddenByDefault(t *testing.T) {
 	require.NoError(t, err)
 	content := string(contentBytes)
 
-	assert.Contains(t, content, `id="upload-progress-modal"`)
-	assert.Contains(t, content, `style="display: none;"`)
-	assert.Contains(t, content, `:style="uploadProgress.show ? 'display: flex' : 'display: none'"`)
+	assert.Contains(t, content, `id="upload-progress-modal" x-show="uploadProgress.show" x-cloak`)
 }
@@ -102,7 +102,7 @@ func TestUserJourney(t *testing.T) {
 
 	// Setup Mock Behavior
 	minioEndpoint := "play.minio.io:9000"
-	creds := services.Credentials{Endpoint: minioEndpoint, AccessKey: "admin", SecretKey: "password"}
+	creds := services.Credentials{Endpoint: minioEndpoint, AccessKey: "admin", SecretKey: "password", User: "admin"}
 	mockFactory.On("NewClient", creds).Return(mockClient, nil)
 	// Login uses ListBuckets to verify credentials
 	mockClient.On("ListBuckets", mock.Anything).Return([]minio.BucketInfo{}, nil)
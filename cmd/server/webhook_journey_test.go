@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/handlers"
+	"github.com/damacus/iron-buckets/internal/middleware"
+	"github.com/damacus/iron-buckets/internal/renderer"
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookJourney(t *testing.T) {
+	// 1. Setup: a chat-ops endpoint subscribed to bucket creation and public policies
+	var mu sync.Mutex
+	var received []services.WebhookEvent
+	chatops := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-IronBuckets-Signature") != services.SignWebhookPayload("chatops-secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event services.WebhookEvent
+		_ = json.Unmarshal(body, &event)
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}))
+	defer chatops.Close()
+
+	webhooks := services.NewWebhookService(&services.WebhookConfig{
+		Webhooks: []services.Webhook{{
+			Name:   "chatops",
+			URL:    chatops.URL,
+			Secret: "chatops-secret",
+			Events: []string{"bucket.created", "bucket.policy.public"},
+		}},
+		Attempts: 1,
+		Timeout:  time.Second,
+	})
+
+	e := echo.New()
+	e.Renderer = &renderer.TemplateRenderer{Templates: map[string]*template.Template{
+		"webhooks": template.Must(renderer.ParseFiles(
+			"../../views/layouts/base.html",
+			"../../views/partials/confirm_dialog.html",
+			"../../views/pages/webhooks.html",
+		)),
+	}}
+	authService := services.NewAuthService()
+	mockFactory := new(MockMinioFactory)
+	client := new(MockMinioClient)
+
+	creds := services.Credentials{Endpoint: "play.minio.io:9000", AccessKey: "admin", SecretKey: "password"}
+	mockFactory.On("NewAdminClient", creds).Return(client, nil)
+	mockFactory.On("NewClient", creds).Return(client, nil)
+	client.On("AccountInfo", mock.Anything, mock.Anything).Return(madmin.AccountInfo{}, assert.AnError)
+	client.On("ServerInfo", mock.Anything, mock.Anything).Return(madmin.InfoMessage{}, nil)
+	client.On("BucketExists", mock.Anything, "reports").Return(false, nil)
+	client.On("MakeBucket", mock.Anything, "reports", mock.Anything).Return(nil)
+	client.On("SetBucketPolicy", mock.Anything, "reports", mock.Anything).Return(nil)
+
+	session, _, err := authService.CreateSession(creds, services.SessionClient{})
+	require.NoError(t, err)
+
+	bucketsHandler := handlers.NewBucketsHandler(mockFactory).WithWebhooks(webhooks)
+	webhooksHandler := handlers.NewWebhooksHandler(webhooks, mockFactory)
+	e.Use(middleware.AuthMiddleware(authService))
+	e.Use(middleware.Permissions(services.NewPermissionService(mockFactory)))
+	e.POST("/buckets/create", bucketsHandler.CreateBucket)
+	e.POST("/buckets/:bucketName/policy", bucketsHandler.SetBucketPolicy)
+	e.GET("/settings/webhooks", webhooksHandler.ListDeliveries)
+
+	serve := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("HX-Request", "true")
+		req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: session})
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 2. The admin creates a bucket, then makes it private and later public
+	rec := serve(http.MethodPost, "/buckets/create", url.Values{"bucketName": {"reports"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(http.MethodPost, "/buckets/reports/policy", url.Values{"policyType": {"private"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(http.MethodPost, "/buckets/reports/policy", url.Values{"policyType": {"public-read"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	webhooks.Wait()
+
+	// 3. Chat-ops heard about the new bucket and the public policy, but not the private one
+	mu.Lock()
+	require.Len(t, received, 2)
+	byType := map[services.WebhookEventType]services.WebhookEvent{}
+	for _, event := range received {
+		byType[event.Type] = event
+	}
+	assert.Equal(t, "reports", byType[services.WebhookBucketCreated].Data["bucket"])
+	assert.Equal(t, "admin", byType[services.WebhookBucketCreated].Actor)
+	assert.Equal(t, "public-read", byType[services.WebhookBucketPolicyPublic].Data["policyType"])
+	mu.Unlock()
+
+	// 4. The delivery log shows both deliveries arrived
+	rec = serve(http.MethodGet, "/settings/webhooks", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "bucket.policy.public")
+	assert.Equal(t, 2, strings.Count(body, ">delivered<"))
+}
@@ -0,0 +1,32 @@
+// Package assets embeds the scripts, styles and fonts the UI loads, so
+// IronBuckets works without reaching a CDN. Third-party files are vendored
+// into static/ with `task assets`; see tailwind.config.js for the stylesheet.
+package assets
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+//go:embed static
+var files embed.FS
+
+// Handler serves the embedded files under /static/. Directory listings are
+// not served.
+func Handler() http.Handler {
+	static, err := fs.Sub(files, "static")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package assets
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/damacus/iron-buckets/views"
+)
+
+// staticPath matches a /static/... reference in a template or stylesheet
+var staticPath = regexp.MustCompile(`/(static/[A-Za-z0-9_./-]+)`)
+
+func TestEveryReferencedFileIsEmbedded(t *testing.T) {
+	referenced := make(map[string]string)
+	collect := func(name string, data []byte) {
+		for _, match := range staticPath.FindAllSubmatch(data, -1) {
+			referenced[string(match[1])] = name
+		}
+	}
+
+	err := fs.WalkDir(views.FS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(views.FS, path)
+		collect(path, data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stylesheet source names the fonts the built app.css loads
+	stylesheet, err := os.ReadFile("tailwind.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect("tailwind.css", stylesheet)
+
+	if len(referenced) == 0 {
+		t.Fatal("found no /static/ references; has the template layout changed?")
+	}
+	for path, from := range referenced {
+		if _, err := fs.Stat(files, path); err != nil {
+			t.Errorf("%s references /%s, which is not embedded; run `task assets` and commit the result", from, path)
+		}
+	}
+}
+
+func TestHandlerServesEmbeddedFiles(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/js/app.js", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if rec.Header().Get("Cache-Control") == "" {
+		t.Error("expected a Cache-Control header")
+	}
+}
+
+func TestHandlerDoesNotListDirectories(t *testing.T) {
+	for _, path := range []string{"/static/", "/static/js/"} {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
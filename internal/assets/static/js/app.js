@@ -0,0 +1,227 @@
+// Shared behaviour for every IronBuckets page. Inline scripts and event
+// handler attributes are blocked by the Content-Security-Policy, so templates
+// describe behaviour with data attributes and this file wires it up.
+(function () {
+    'use strict';
+
+    function getCookieValue(name) {
+        const match = document.cookie.match(new RegExp('(^| )' + name + '=([^;]+)'));
+        return match ? decodeURIComponent(match[2]) : '';
+    }
+    window.getCookieValue = getCookieValue;
+
+    function createIcons() {
+        if (typeof lucide !== 'undefined') {
+            lucide.createIcons();
+        }
+    }
+
+    // Send the CSRF token with every HTMX request
+    document.body.addEventListener('htmx:configRequest', function (evt) {
+        const csrfToken = getCookieValue('csrf');
+        if (csrfToken) {
+            evt.detail.headers['X-CSRF-Token'] = csrfToken;
+        }
+    });
+
+    // Init icons, and again whenever HTMX swaps in content
+    createIcons();
+    document.body.addEventListener('htmx:afterSwap', createIcons);
+
+    // Reload the page after requests from elements marked data-reload-after-request,
+    // unless the server sent the browser elsewhere
+    document.body.addEventListener('htmx:afterRequest', function (evt) {
+        if (evt.detail.elt && evt.detail.elt.hasAttribute('data-reload-after-request') &&
+            !evt.detail.xhr.getResponseHeader('HX-Redirect')) {
+            window.location.reload();
+        }
+    });
+
+    // Changes refused in read-only mode show the maintenance banner
+    document.body.addEventListener('htmx:responseError', function (evt) {
+        const banner = document.getElementById('maintenance-banner');
+        if (evt.detail.xhr.status === 503 && banner) {
+            banner.querySelector('[data-maintenance-message]').textContent = evt.detail.xhr.responseText;
+            banner.classList.remove('hidden');
+        }
+    });
+
+    // Size bars from data-width, since inline style attributes are not allowed
+    function applyWidths(root) {
+        root.querySelectorAll('[data-width]').forEach(function (el) {
+            el.style.width = el.dataset.width + '%';
+        });
+    }
+    applyWidths(document);
+    document.body.addEventListener('htmx:load', function (evt) {
+        applyWidths(evt.detail.elt);
+    });
+
+    // Close a dialog, then remove it from the page
+    function dismiss(el) {
+        if (!el) {
+            return;
+        }
+        if (typeof el.close === 'function' && el.open) {
+            el.close();
+        }
+        el.remove();
+    }
+
+    // Delegated click handlers
+    document.addEventListener('click', function (evt) {
+        const target = evt.target.closest(
+            '[data-close-dialog], [data-dismiss], [data-copy], [data-copy-from], [data-click], [data-reload], [data-toggle-next], [data-href], [data-dismiss-on-backdrop]'
+        );
+        if (!target) {
+            return;
+        }
+        if (target.hasAttribute('data-dismiss-on-backdrop')) {
+            if (evt.target === target) {
+                dismiss(target);
+            }
+            return;
+        }
+        if (target.dataset.closeDialog) {
+            document.getElementById(target.dataset.closeDialog).close();
+        } else if (target.dataset.dismiss) {
+            dismiss(document.getElementById(target.dataset.dismiss));
+        } else if (target.hasAttribute('data-copy')) {
+            navigator.clipboard.writeText(target.dataset.copy);
+        } else if (target.dataset.copyFrom) {
+            navigator.clipboard.writeText(document.getElementById(target.dataset.copyFrom).value);
+        } else if (target.dataset.click) {
+            document.getElementById(target.dataset.click).click();
+        } else if (target.hasAttribute('data-reload')) {
+            window.location.reload();
+        } else if (target.hasAttribute('data-toggle-next')) {
+            target.nextElementSibling.classList.toggle('hidden');
+        } else if (target.dataset.href && !evt.target.closest('[data-stop-propagation]')) {
+            window.location.href = target.dataset.href;
+        }
+    });
+
+    // Submit a form when a file input marked data-submit-on-change changes
+    document.addEventListener('change', function (evt) {
+        const form = evt.target.dataset && evt.target.dataset.submitOnChange;
+        if (form) {
+            htmx.trigger('#' + form, 'submit');
+        }
+    });
+
+    // Dialogs swapped in by HTMX close and disappear on Escape
+    document.addEventListener('keydown', function (evt) {
+        if (evt.key !== 'Escape') {
+            return;
+        }
+        document.querySelectorAll('dialog[data-dismiss-on-backdrop][open]').forEach(dismiss);
+    });
+
+    // Update sidebar active state on navigation
+    document.body.addEventListener('htmx:pushedIntoHistory', function () {
+        const path = window.location.pathname;
+        document.querySelectorAll('.sidebar-nav-link').forEach(function (link) {
+            const href = link.getAttribute('href');
+            const isActive = link.hasAttribute('data-nav-exact') ? path === href : path.startsWith(href);
+            if (isActive) {
+                link.classList.remove('text-zinc-400', 'hover:text-white', 'hover:bg-white/5');
+                link.classList.add('bg-white/10', 'text-white');
+            } else {
+                link.classList.add('text-zinc-400', 'hover:text-white', 'hover:bg-white/5');
+                link.classList.remove('bg-white/10', 'text-white');
+            }
+        });
+    });
+
+    // Styled confirm dialog for hx-confirm
+    const dialog = document.getElementById('confirm-dialog');
+    if (dialog) {
+        const messageEl = document.getElementById('confirm-dialog-message');
+        const cancelBtn = document.getElementById('confirm-dialog-cancel');
+        const confirmBtn = document.getElementById('confirm-dialog-confirm');
+        let resolvePromise = null;
+
+        const settle = function (confirmed) {
+            dialog.close();
+            if (resolvePromise) {
+                resolvePromise(confirmed);
+                resolvePromise = null;
+            }
+        };
+
+        cancelBtn.addEventListener('click', function () { settle(false); });
+        confirmBtn.addEventListener('click', function () { settle(true); });
+        dialog.addEventListener('click', function (e) {
+            if (e.target === dialog) {
+                settle(false);
+            }
+        });
+        dialog.addEventListener('keydown', function (e) {
+            if (e.key === 'Escape') {
+                settle(false);
+            }
+        });
+
+        // Only intercept elements that actually ask a question
+        document.body.addEventListener('htmx:confirm', function (e) {
+            if (!e.detail.question) {
+                return;
+            }
+            e.preventDefault();
+            messageEl.textContent = e.detail.question;
+            createIcons();
+            dialog.showModal();
+            new Promise(function (resolve) {
+                resolvePromise = resolve;
+            }).then(function (confirmed) {
+                if (confirmed) {
+                    e.detail.issueRequest(true);
+                }
+            });
+        });
+    }
+
+    // Alpine components. The CSP build of Alpine cannot evaluate functions
+    // written inline in x-data, so components with methods are registered here.
+    document.addEventListener('alpine:init', function () {
+        Alpine.data('bucketPolicy', function () {
+            return {
+                policyType: '',
+                customPolicy: '',
+                showEditor: false,
+                init() {
+                    this.policyType = this.$el.dataset.policyType;
+                    this.showEditor = this.policyType === 'custom';
+                    const el = this.$refs.policyData;
+                    if (el && el.value) {
+                        this.customPolicy = el.value;
+                    }
+                }
+            };
+        });
+    });
+
+    // Login page: sign-in method tabs and the SSO link for the chosen cluster
+    document.querySelectorAll('[data-login-tab]').forEach(function (tab) {
+        tab.addEventListener('click', function () {
+            document.querySelectorAll('[data-login-panel]').forEach(function (panel) {
+                panel.classList.toggle('hidden', panel.id !== tab.dataset.loginTab);
+            });
+            document.querySelectorAll('[data-login-tab]').forEach(function (other) {
+                const active = other === tab;
+                other.classList.toggle('text-white', active);
+                other.classList.toggle('border-white', active);
+                other.classList.toggle('text-zinc-400', !active);
+                other.classList.toggle('border-transparent', !active);
+            });
+        });
+    });
+
+    const clusterSelect = document.getElementById('cluster');
+    const ssoLink = document.getElementById('sso-link');
+    if (clusterSelect && ssoLink) {
+        clusterSelect.addEventListener('change', function () {
+            ssoLink.search = '?cluster=' + encodeURIComponent(clusterSelect.value);
+        });
+    }
+})();
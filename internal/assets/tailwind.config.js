@@ -0,0 +1,19 @@
+// Builds static/css/app.css from the classes used in the templates. Run
+// `task assets` after changing templates so new classes are included.
+module.exports = {
+    content: ['./views/**/*.html', './internal/assets/static/js/*.js'],
+    // Drive status colours are chosen by the handler
+    safelist: [{ pattern: /^(bg|text)-(emerald|red)-500(\/10)?$/ }],
+    darkMode: 'class',
+    theme: {
+        extend: {
+            colors: {
+                background: '#09090b', // Zinc 950
+                surface: '#18181b', // Zinc 900
+                border: '#27272a', // Zinc 800
+                accent: '#2563eb', // Blue 600
+            },
+            fontFamily: { sans: ['Inter', 'sans-serif'] }
+        }
+    }
+}
@@ -0,0 +1,316 @@
+// Package config holds the IronBuckets settings. They are read from a YAML
+// file, then the environment, then command-line flags, each overriding the
+// one before, and checked once at startup.
+package config
+
+import (
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+)
+
+// Config is every setting IronBuckets reads at startup. Each setting has a
+// YAML key, an environment variable and a flag named after the key, such as
+// session.idle_timeout, IRON_SESSION_IDLE_TIMEOUT and --session-idle-timeout.
+type Config struct {
+	Listen         string          `yaml:"listen" env:"IRON_LISTEN" usage:"address to serve HTTP, or HTTPS when a certificate is set, on"`
+	BasePath       string          `yaml:"base_path" env:"IRON_BASE_PATH" usage:"path to serve IronBuckets under, such as /storage; empty serves from the root"`
+	TLS            TLSConfig       `yaml:"tls"`
+	Templates      TemplatesConfig `yaml:"templates"`
+	MinIO          MinIOConfig     `yaml:"minio"`
+	TrustedProxies []string        `yaml:"trusted_proxies" env:"IRON_TRUSTED_PROXIES" usage:"CIDR ranges or addresses whose forwarded headers are trusted"`
+	Session        SessionConfig   `yaml:"session"`
+	OIDC           OIDCConfig      `yaml:"oidc"`
+	LDAP           LDAPConfig      `yaml:"ldap"`
+	CertLogin      CertLoginConfig `yaml:"cert_login"`
+	Login          LoginConfig     `yaml:"login"`
+	TOTP           TOTPConfig      `yaml:"totp"`
+	APITokens      APITokensConfig `yaml:"api_tokens"`
+	Roles          RolesConfig     `yaml:"roles"`
+	Approvals      ApprovalsConfig `yaml:"approvals"`
+	Audit          AuditConfig     `yaml:"audit"`
+	Webhooks       WebhooksConfig  `yaml:"webhooks"`
+	ReadOnly       ReadOnlyConfig  `yaml:"read_only"`
+}
+
+// TLSConfig serves HTTPS when a certificate and key are set
+type TLSConfig struct {
+	CertFile       string        `yaml:"cert_file" env:"IRON_TLS_CERT_FILE" usage:"PEM certificate chain to serve HTTPS with"`
+	KeyFile        string        `yaml:"key_file" env:"IRON_TLS_KEY_FILE" usage:"PEM private key for the certificate"`
+	MinVersion     string        `yaml:"min_version" env:"IRON_TLS_MIN_VERSION" usage:"oldest TLS version accepted: 1.0, 1.1, 1.2 or 1.3"`
+	Ciphers        []string      `yaml:"ciphers" env:"IRON_TLS_CIPHERS" usage:"cipher suites for TLS 1.2 and below; empty uses Go's defaults"`
+	ClientAuth     string        `yaml:"client_auth" env:"IRON_TLS_CLIENT_AUTH" usage:"client certificates: none, optional or require"`
+	ClientCAFile   string        `yaml:"client_ca_file" env:"IRON_TLS_CLIENT_CA_FILE" usage:"PEM CA bundle client certificates are verified against"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"IRON_TLS_RELOAD_INTERVAL" usage:"how often to check the certificate files for changes; 0 reloads on SIGHUP only"`
+	RedirectListen string        `yaml:"redirect_listen" env:"IRON_TLS_REDIRECT_LISTEN" usage:"address to redirect plain HTTP to HTTPS from, such as :80"`
+}
+
+// TemplatesConfig customizes the page templates built into the binary
+type TemplatesConfig struct {
+	Dir    string `yaml:"dir" env:"IRON_TEMPLATES_DIR" usage:"directory of templates, laid out like views/, that replace or add to the built-in ones"`
+	Reload bool   `yaml:"reload" env:"IRON_TEMPLATES_RELOAD" usage:"parse templates on every request, for development"`
+}
+
+// MinIOConfig selects the MinIO clusters offered at login. The connection
+// options apply to the single endpoint; a clusters file sets them per cluster.
+type MinIOConfig struct {
+	Endpoint           string `yaml:"endpoint" env:"MINIO_ENDPOINT" usage:"MinIO URL, or host:port with a scheme, when there is no clusters file"`
+	ClustersFile       string `yaml:"clusters_file" env:"IRON_CLUSTERS_FILE" usage:"YAML file of named clusters; replaces the endpoint"`
+	Scheme             string `yaml:"scheme" env:"IRON_MINIO_SCHEME" usage:"http or https, when the endpoint is host:port"`
+	CAFile             string `yaml:"ca_file" env:"IRON_MINIO_CA_FILE" usage:"PEM CA bundle trusted in addition to the system roots"`
+	ServerName         string `yaml:"server_name" env:"IRON_MINIO_SERVER_NAME" usage:"name to check the MinIO certificate against"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"IRON_MINIO_INSECURE_SKIP_VERIFY" usage:"skip MinIO certificate checks; for test clusters only"`
+	CertFile           string `yaml:"cert_file" env:"IRON_MINIO_CERT_FILE" usage:"PEM client certificate for MinIO servers that require mutual TLS"`
+	KeyFile            string `yaml:"key_file" env:"IRON_MINIO_KEY_FILE" usage:"PEM private key for the client certificate"`
+	UserCertDir        string `yaml:"user_cert_dir" env:"IRON_MINIO_USER_CERT_DIR" usage:"directory of <name>.crt and <name>.key certificates held for certificate login"`
+	Region             string `yaml:"region" env:"IRON_MINIO_REGION" usage:"region to sign S3 requests for; empty discovers it"`
+	BucketLookup       string `yaml:"bucket_lookup" env:"IRON_MINIO_BUCKET_LOOKUP" usage:"bucket addressing: auto, path or virtual-host"`
+}
+
+// SessionConfig controls how sessions are sealed, stored and expired
+type SessionConfig struct {
+	Key         string        `yaml:"key" env:"IRON_SESSION_KEY" secret:"true" usage:"single session key, 32 raw characters or 32 base64-encoded bytes"`
+	Keys        []string      `yaml:"keys" env:"IRON_SESSION_KEYS" secret:"true" usage:"id:key session keys, primary first"`
+	KeyStrict   bool          `yaml:"key_strict" env:"IRON_SESSION_KEY_STRICT" usage:"refuse to start without a session key"`
+	Store       string        `yaml:"store" env:"IRON_SESSION_STORE" usage:"server-side session store: memory or file"`
+	File        string        `yaml:"file" env:"IRON_SESSION_FILE" usage:"file for the file session store"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"IRON_SESSION_IDLE_TIMEOUT" usage:"end sessions after this long without activity; 0 disables"`
+	MaxLifetime time.Duration `yaml:"max_lifetime" env:"IRON_SESSION_MAX_LIFETIME" usage:"end sessions this long after login"`
+	WarnBefore  time.Duration `yaml:"warn_before" env:"IRON_SESSION_WARN_BEFORE" usage:"warn this long before a session ends"`
+}
+
+// OIDCConfig enables single sign-on when the issuer, client ID and redirect
+// URL are all set
+type OIDCConfig struct {
+	IssuerURL    string   `yaml:"issuer_url" env:"IRON_OIDC_ISSUER_URL" usage:"OpenID Connect issuer URL"`
+	ClientID     string   `yaml:"client_id" env:"IRON_OIDC_CLIENT_ID" usage:"OpenID Connect client ID"`
+	ClientSecret string   `yaml:"client_secret" env:"IRON_OIDC_CLIENT_SECRET" secret:"true" usage:"OpenID Connect client secret"`
+	RedirectURL  string   `yaml:"redirect_url" env:"IRON_OIDC_REDIRECT_URL" usage:"OpenID Connect redirect URL, ending in /oauth/callback"`
+	RoleARN      string   `yaml:"role_arn" env:"IRON_OIDC_ROLE_ARN" usage:"MinIO role ARN for role policies"`
+	Scopes       []string `yaml:"scopes" env:"IRON_OIDC_SCOPES" usage:"OpenID Connect scopes"`
+}
+
+// LDAPConfig enables sign-in with directory credentials
+type LDAPConfig struct {
+	Enabled         bool          `yaml:"enabled" env:"IRON_LDAP_ENABLED" usage:"offer sign-in with directory credentials"`
+	SessionDuration time.Duration `yaml:"session_duration" env:"IRON_LDAP_SESSION_DURATION" usage:"requested lifetime of directory credentials; 0 lets MinIO decide"`
+}
+
+// CertLoginConfig enables sign-in with a client certificate
+type CertLoginConfig struct {
+	Enabled         bool          `yaml:"enabled" env:"IRON_CERT_LOGIN_ENABLED" usage:"offer sign-in with the client certificate presented over HTTPS"`
+	SessionDuration time.Duration `yaml:"session_duration" env:"IRON_CERT_LOGIN_SESSION_DURATION" usage:"requested lifetime of certificate credentials; 0 requests one hour"`
+}
+
+// LoginConfig limits failed logins
+type LoginConfig struct {
+	MaxFailuresPerIP   int           `yaml:"max_failures_per_ip" env:"IRON_LOGIN_MAX_FAILURES_PER_IP" usage:"lock out a client address after this many failures"`
+	MaxFailuresPerUser int           `yaml:"max_failures_per_user" env:"IRON_LOGIN_MAX_FAILURES_PER_USER" usage:"lock out a user after this many failures"`
+	BackoffBase        time.Duration `yaml:"backoff_base" env:"IRON_LOGIN_BACKOFF_BASE" usage:"wait after the first failure"`
+	BackoffMax         time.Duration `yaml:"backoff_max" env:"IRON_LOGIN_BACKOFF_MAX" usage:"longest wait between failures"`
+	Lockout            time.Duration `yaml:"lockout" env:"IRON_LOGIN_LOCKOUT" usage:"how long a lockout lasts"`
+}
+
+// TOTPConfig controls two-factor authentication
+type TOTPConfig struct {
+	Mode   string `yaml:"mode" env:"IRON_TOTP" usage:"two-factor authentication: off, optional or required"`
+	Issuer string `yaml:"issuer" env:"IRON_TOTP_ISSUER" usage:"account label shown in authenticator apps"`
+	File   string `yaml:"file" env:"IRON_TOTP_FILE" usage:"file enrollments are stored in"`
+}
+
+// APITokensConfig controls personal API tokens
+type APITokensConfig struct {
+	Enabled bool   `yaml:"enabled" env:"IRON_API_TOKENS" usage:"allow personal API tokens"`
+	File    string `yaml:"file" env:"IRON_API_TOKENS_FILE" usage:"file tokens are stored in"`
+	MaxDays int    `yaml:"max_days" env:"IRON_API_TOKEN_MAX_DAYS" usage:"longest token lifetime in days"`
+}
+
+// RolesConfig enables console roles
+type RolesConfig struct {
+	File string `yaml:"file" env:"IRON_ROLES_FILE" usage:"YAML file of roles and group mappings"`
+}
+
+// ApprovalsConfig controls which operations need a second approver
+type ApprovalsConfig struct {
+	Actions []string      `yaml:"actions" env:"IRON_APPROVALS" usage:"operations that need approval, or all"`
+	File    string        `yaml:"file" env:"IRON_APPROVALS_FILE" usage:"file requests are stored in"`
+	TTL     time.Duration `yaml:"ttl" env:"IRON_APPROVAL_TTL" usage:"how long a request waits for approval"`
+}
+
+// AuditConfig controls the audit log
+type AuditConfig struct {
+	File      string `yaml:"file" env:"IRON_AUDIT_FILE" usage:"audit log file"`
+	MaxSizeMB int    `yaml:"max_size_mb" env:"IRON_AUDIT_MAX_SIZE_MB" usage:"rotate the audit log at this size in MB"`
+	MaxFiles  int    `yaml:"max_files" env:"IRON_AUDIT_MAX_FILES" usage:"rotated audit logs to keep"`
+}
+
+// WebhooksConfig enables outgoing webhooks
+type WebhooksConfig struct {
+	File string `yaml:"file" env:"IRON_WEBHOOKS_FILE" usage:"YAML file of webhook endpoints"`
+}
+
+// ReadOnlyConfig starts the console in read-only mode
+type ReadOnlyConfig struct {
+	Enabled bool   `yaml:"enabled" env:"IRON_READ_ONLY" usage:"start in read-only mode"`
+	Message string `yaml:"message" env:"IRON_READ_ONLY_MESSAGE" usage:"banner shown in read-only mode"`
+}
+
+// Default returns the settings used when nothing overrides them
+func Default() *Config {
+	session := services.DefaultSessionPolicy()
+	login := services.DefaultLoginLimitConfig()
+	return &Config{
+		Listen: ":8080",
+		TLS:    TLSConfig{MinVersion: "1.2", ClientAuth: "none", ReloadInterval: time.Minute},
+		Session: SessionConfig{
+			File:        "sessions.json",
+			IdleTimeout: session.IdleTimeout,
+			MaxLifetime: session.MaxLifetime,
+			WarnBefore:  session.WarnBefore,
+		},
+		OIDC: OIDCConfig{Scopes: []string{"openid", "profile", "email"}},
+		Login: LoginConfig{
+			MaxFailuresPerIP:   login.MaxFailuresPerIP,
+			MaxFailuresPerUser: login.MaxFailuresPerUser,
+			BackoffBase:        login.BaseDelay,
+			BackoffMax:         login.MaxDelay,
+			Lockout:            login.Lockout,
+		},
+		TOTP:      TOTPConfig{Mode: string(services.TOTPOff), Issuer: "IronBuckets", File: "totp.json"},
+		APITokens: APITokensConfig{File: "api_tokens.json", MaxDays: 90},
+		Approvals: ApprovalsConfig{File: "approvals.json", TTL: 24 * time.Hour},
+		Audit:     AuditConfig{File: "audit.jsonl", MaxSizeMB: 10, MaxFiles: 5},
+	}
+}
+
+// Enabled reports whether HTTPS is served
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Options returns the settings as utils.TLSOptions
+func (c TLSConfig) Options() utils.TLSOptions {
+	return utils.TLSOptions{
+		CertFile:     c.CertFile,
+		KeyFile:      c.KeyFile,
+		MinVersion:   c.MinVersion,
+		Ciphers:      c.Ciphers,
+		ClientAuth:   c.ClientAuth,
+		ClientCAFile: c.ClientCAFile,
+	}
+}
+
+// Clusters returns the clusters from the clusters file, or the single
+// endpoint when there is none
+func (c MinIOConfig) Clusters() (*services.ClusterRegistry, error) {
+	if c.ClustersFile != "" {
+		return services.LoadClusterRegistry(c.ClustersFile)
+	}
+	return services.NewClusterRegistry([]services.Cluster{c.cluster()})
+}
+
+// cluster describes the single endpoint
+func (c MinIOConfig) cluster() services.Cluster {
+	return services.Cluster{
+		Alias:  "default",
+		Name:   c.Endpoint,
+		URL:    c.Endpoint,
+		Scheme: c.Scheme,
+		TLS: services.ClusterTLS{
+			CAFile:             c.CAFile,
+			ServerName:         c.ServerName,
+			InsecureSkipVerify: c.InsecureSkipVerify,
+			CertFile:           c.CertFile,
+			KeyFile:            c.KeyFile,
+			UserCertDir:        c.UserCertDir,
+		},
+		Region:       c.Region,
+		BucketLookup: c.BucketLookup,
+	}
+}
+
+// Prefix returns the base path without a trailing slash, or "" at the root
+func (c *Config) Prefix() (string, error) {
+	return utils.ParseBasePath(c.BasePath)
+}
+
+// Proxies returns the trusted proxies
+func (c *Config) Proxies() (*utils.TrustedProxies, error) {
+	return utils.NewTrustedProxies(c.TrustedProxies)
+}
+
+// Keyring returns the configured session keys, or nil when there are none
+func (c SessionConfig) Keyring() (*services.Keyring, error) {
+	return services.ParseKeyring(c.Keys, c.Key)
+}
+
+// Policy returns the session expiry policy
+func (c SessionConfig) Policy() services.SessionPolicy {
+	return services.SessionPolicy{IdleTimeout: c.IdleTimeout, MaxLifetime: c.MaxLifetime, WarnBefore: c.WarnBefore}
+}
+
+// Service returns the settings as a services.OIDCConfig
+func (c OIDCConfig) Service() services.OIDCConfig {
+	return services.OIDCConfig{
+		IssuerURL:    c.IssuerURL,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+		Scopes:       c.Scopes,
+		RoleARN:      c.RoleARN,
+	}
+}
+
+// Service returns the settings as a services.LDAPConfig
+func (c LDAPConfig) Service() services.LDAPConfig {
+	return services.LDAPConfig{Enabled: c.Enabled, SessionDuration: c.SessionDuration}
+}
+
+// Service returns the settings as a services.CertificateConfig
+func (c CertLoginConfig) Service() services.CertificateConfig {
+	return services.CertificateConfig{Enabled: c.Enabled, SessionDuration: c.SessionDuration}
+}
+
+// Service returns the settings as a services.LoginLimitConfig
+func (c LoginConfig) Service() services.LoginLimitConfig {
+	return services.LoginLimitConfig{
+		MaxFailuresPerIP:   c.MaxFailuresPerIP,
+		MaxFailuresPerUser: c.MaxFailuresPerUser,
+		BaseDelay:          c.BackoffBase,
+		MaxDelay:           c.BackoffMax,
+		Lockout:            c.Lockout,
+	}
+}
+
+// Service returns the settings as a services.TOTPConfig
+func (c TOTPConfig) Service() (services.TOTPConfig, error) {
+	mode, err := services.ParseTOTPMode(c.Mode)
+	if err != nil {
+		return services.TOTPConfig{}, err
+	}
+	return services.TOTPConfig{Mode: mode, Issuer: c.Issuer, File: c.File}, nil
+}
+
+// Service returns the settings as a services.APITokenConfig
+func (c APITokensConfig) Service() services.APITokenConfig {
+	return services.APITokenConfig{
+		Enabled:     c.Enabled,
+		File:        c.File,
+		MaxLifetime: time.Duration(c.MaxDays) * 24 * time.Hour,
+	}
+}
+
+// Service returns the settings as a services.ApprovalConfig
+func (c ApprovalsConfig) Service() (services.ApprovalConfig, error) {
+	actions, err := services.ParseApprovalActions(c.Actions)
+	if err != nil {
+		return services.ApprovalConfig{}, err
+	}
+	return services.ApprovalConfig{Actions: actions, File: c.File, TTL: c.TTL}, nil
+}
+
+// Service returns the settings as a services.AuditConfig
+func (c AuditConfig) Service() services.AuditConfig {
+	return services.AuditConfig{File: c.File, MaxSize: int64(c.MaxSizeMB) << 20, MaxFiles: c.MaxFiles}
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func load(t *testing.T, args []string, values map[string]string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&bytes.Buffer{})
+	return Load(fs, args, env(values))
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(t, nil, map[string]string{"MINIO_ENDPOINT": "http://minio:9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+	if cfg.Listen != ":8080" || cfg.Session.MaxLifetime != services.SessionLifetime || cfg.Audit.File != "audit.jsonl" {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if totp, _ := cfg.TOTP.Service(); totp.Enabled() {
+		t.Error("two-factor authentication should be off by default")
+	}
+	if approvals, _ := cfg.Approvals.Service(); approvals.Enabled() {
+		t.Error("approvals should be off by default")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, `
+listen: ":9000"
+minio:
+  endpoint: file:9000
+session:
+  idle_timeout: 30m
+  max_lifetime: 4h
+login:
+  lockout: 1h
+`)
+	cfg, err := load(t, []string{"--config", file, "--session-max-lifetime", "2h"}, map[string]string{
+		"IRON_SESSION_IDLE_TIMEOUT": "15m",
+		"IRON_SESSION_MAX_LIFETIME": "12h",
+		"IRON_LOGIN_LOCKOUT":        "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":9000" || cfg.MinIO.Endpoint != "file:9000" {
+		t.Errorf("file values should override the defaults: %+v", cfg)
+	}
+	if cfg.Session.IdleTimeout != 15*time.Minute {
+		t.Errorf("IdleTimeout = %v, the environment should override the file", cfg.Session.IdleTimeout)
+	}
+	if cfg.Session.MaxLifetime != 2*time.Hour {
+		t.Errorf("MaxLifetime = %v, flags should override the environment", cfg.Session.MaxLifetime)
+	}
+	if cfg.Login.Lockout != time.Hour {
+		t.Errorf("Lockout = %v, an empty variable should leave the file value", cfg.Login.Lockout)
+	}
+}
+
+func TestLoadFileFromEnv(t *testing.T) {
+	file := writeFile(t, "ldap:\n  enabled: true\n  session_duration: 4h\n")
+	cfg, err := load(t, []string{"--ldap-enabled=false"}, map[string]string{"IRON_CONFIG_FILE": file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LDAP.Enabled || cfg.LDAP.SessionDuration != 4*time.Hour {
+		t.Errorf("unexpected LDAP settings: %+v", cfg.LDAP)
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	cfg, err := load(t, nil, map[string]string{
+		"IRON_OIDC_SCOPES":                 "openid,groups",
+		"IRON_APPROVALS":                   "delete-bucket, restart-server",
+		"IRON_LOGIN_MAX_FAILURES_PER_USER": "3",
+		"IRON_AUDIT_MAX_SIZE_MB":           "2",
+		"IRON_READ_ONLY":                   "true",
+		"IRON_TOTP":                        "Required",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.OIDC.Scopes, " ") != "openid groups" {
+		t.Errorf("unexpected scopes: %v", cfg.OIDC.Scopes)
+	}
+	approvals, err := cfg.Approvals.Service()
+	if err != nil || !approvals.Actions[services.ApprovalDeleteBucket] || !approvals.Actions[services.ApprovalRestartServer] {
+		t.Errorf("unexpected approvals: %+v, %v", approvals, err)
+	}
+	if login := cfg.Login.Service(); login.MaxFailuresPerUser != 3 || login.MaxFailuresPerIP != 20 {
+		t.Errorf("unexpected login limits: %+v", login)
+	}
+	if audit := cfg.Audit.Service(); audit.MaxSize != 2<<20 || audit.MaxFiles != 5 {
+		t.Errorf("unexpected audit settings: %+v", audit)
+	}
+	if totp, err := cfg.TOTP.Service(); err != nil || totp.Mode != services.TOTPRequired {
+		t.Errorf("unexpected two-factor settings: %+v, %v", totp, err)
+	}
+	if !cfg.ReadOnly.Enabled {
+		t.Error("expected read-only mode")
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	for name, value := range map[string]string{
+		"IRON_SESSION_IDLE_TIMEOUT":      "soon",
+		"IRON_LOGIN_MAX_FAILURES_PER_IP": "many",
+		"IRON_LDAP_ENABLED":              "sometimes",
+		"IRON_SESSION_KEY_STRICT":        "yes please",
+	} {
+		if _, err := load(t, nil, map[string]string{name: value}); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s=%q: expected an error naming the variable, got %v", name, value, err)
+		}
+	}
+	if _, err := load(t, []string{"--audit-max-files", "lots"}, nil); err == nil {
+		t.Error("expected an error for an invalid flag")
+	}
+	if _, err := load(t, []string{"--config", writeFile(t, "sesion:\n  store: file\n")}, nil); err == nil {
+		t.Error("expected an error for an unknown key in the file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		env  map[string]string
+		want string
+	}{
+		"no endpoint":        {map[string]string{}, "MINIO_ENDPOINT"},
+		"bad proxy":          {map[string]string{"IRON_TRUSTED_PROXIES": "proxy.internal"}, "IRON_TRUSTED_PROXIES"},
+		"short key":          {map[string]string{"IRON_SESSION_KEY": "tooshort"}, "IRON_SESSION_KEY"},
+		"strict without":     {map[string]string{"IRON_SESSION_KEY_STRICT": "true"}, "IRON_SESSION_KEY_STRICT"},
+		"unknown store":      {map[string]string{"IRON_SESSION_STORE": "redis"}, "IRON_SESSION_STORE"},
+		"negative duration":  {map[string]string{"IRON_SESSION_WARN_BEFORE": "-1m"}, "IRON_SESSION_WARN_BEFORE"},
+		"zero lockout":       {map[string]string{"IRON_LOGIN_LOCKOUT": "0s"}, "IRON_LOGIN_LOCKOUT"},
+		"unknown totp":       {map[string]string{"IRON_TOTP": "sometimes"}, "IRON_TOTP"},
+		"totp without key":   {map[string]string{"IRON_TOTP": "optional"}, "IRON_SESSION_KEY"},
+		"tokens without key": {map[string]string{"IRON_API_TOKENS": "true"}, "IRON_SESSION_KEY"},
+		"unknown approval":   {map[string]string{"IRON_APPROVALS": "delete-everything"}, "IRON_APPROVALS"},
+		"partial sso":        {map[string]string{"IRON_OIDC_ISSUER_URL": "https://idp.example.com"}, "IRON_OIDC_CLIENT_ID"},
+		"cert without key":   {map[string]string{"IRON_TLS_CERT_FILE": "tls.crt"}, "IRON_TLS_KEY_FILE"},
+		"old tls":            {map[string]string{"IRON_TLS_MIN_VERSION": "1.4"}, "IRON_TLS_MIN_VERSION"},
+		"unknown cipher":     {map[string]string{"IRON_TLS_CIPHERS": "TLS_RSA_WITH_RC4_128_SHA"}, "IRON_TLS_CIPHERS"},
+		"client auth no ca":  {map[string]string{"IRON_TLS_CLIENT_AUTH": "require"}, "IRON_TLS_CLIENT_CA_FILE"},
+		"redirect no tls":    {map[string]string{"IRON_TLS_REDIRECT_LISTEN": ":80"}, "IRON_TLS_REDIRECT_LISTEN"},
+		"missing templates":  {map[string]string{"IRON_TEMPLATES_DIR": "/nonexistent/views"}, "IRON_TEMPLATES_DIR"},
+		"reload built-in":    {map[string]string{"IRON_TEMPLATES_RELOAD": "true"}, "IRON_TEMPLATES_RELOAD"},
+		"bad base path":      {map[string]string{"IRON_BASE_PATH": "storage/../admin"}, "IRON_BASE_PATH"},
+		"no scheme":          {map[string]string{"MINIO_ENDPOINT": "storage-internal:9000"}, "MINIO_ENDPOINT"},
+		"tls over http":      {map[string]string{"IRON_MINIO_INSECURE_SKIP_VERIFY": "true"}, "MINIO_ENDPOINT"},
+		"unknown lookup":     {map[string]string{"IRON_MINIO_BUCKET_LOOKUP": "dns"}, "MINIO_ENDPOINT"},
+		"options with file":  {map[string]string{"IRON_CLUSTERS_FILE": "clusters.yaml", "IRON_MINIO_REGION": "eu-west-1"}, "IRON_CLUSTERS_FILE"},
+		"cert login no tls":  {map[string]string{"IRON_CERT_LOGIN_ENABLED": "true"}, "IRON_TLS_CLIENT_AUTH"},
+		"cert login no dir":  {map[string]string{"IRON_CERT_LOGIN_ENABLED": "true"}, "IRON_MINIO_USER_CERT_DIR"},
+		"user certs on http": {map[string]string{"IRON_MINIO_USER_CERT_DIR": "/etc/ironbuckets/user-certs"}, "MINIO_ENDPOINT"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if name != "no endpoint" && name != "options with file" {
+				if _, ok := tt.env["MINIO_ENDPOINT"]; !ok {
+					tt.env["MINIO_ENDPOINT"] = "http://minio:9000"
+				}
+			}
+			cfg, err := load(t, nil, tt.env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error mentioning %s", err, tt.want)
+			}
+		})
+	}
+
+	cfg, _ := load(t, nil, map[string]string{
+		"IRON_CLUSTERS_FILE":      "clusters.yaml",
+		"IRON_SESSION_KEY_STRICT": "true",
+		"IRON_SESSION_KEYS":       "new:0123456789abcdef0123456789abcdef",
+	})
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("a clusters file and session keys should be valid: %v", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg, err := load(t, []string{"--oidc-client-secret", "s3cret"}, map[string]string{
+		"MINIO_ENDPOINT":    "http://minio:9000",
+		"IRON_SESSION_KEYS": "new:0123456789abcdef0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	if strings.Contains(printed, "s3cret") || strings.Contains(printed, "0123456789abcdef") {
+		t.Errorf("secrets were printed:\n%s", printed)
+	}
+	for _, want := range []string{"endpoint: http://minio:9000", "client_secret: '[redacted]'", "max_lifetime: 24h0m0s"} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("expected %q in:\n%s", want, printed)
+		}
+	}
+	if cfg.OIDC.ClientSecret != "s3cret" || cfg.Session.Keys[0] != "new:0123456789abcdef0123456789abcdef" {
+		t.Error("Print should not change the configuration")
+	}
+
+	var reloaded Config
+	if err := (&reloaded).loadFile(writeFile(t, printed)); err != nil {
+		t.Errorf("printed configuration should load back: %v", err)
+	}
+}
+
+func TestClustersFallBackToEndpoint(t *testing.T) {
+	registry, err := MinIOConfig{Endpoint: "storage-internal:9000", Scheme: "http", Region: "eu-west-1", BucketLookup: "path"}.Clusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters := registry.List()
+	if len(clusters) != 1 || clusters[0].Endpoint != "storage-internal:9000" || clusters[0].Secure || clusters[0].Region != "eu-west-1" {
+		t.Errorf("unexpected clusters: %+v", clusters)
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in printed configuration
+const redacted = "[redacted]"
+
+// setting is one leaf of Config, found by walking its struct tags
+type setting struct {
+	// Key is the dotted YAML path, such as session.idle_timeout
+	Key    string
+	Env    string
+	Flag   string
+	Usage  string
+	Secret bool
+	index  []int
+}
+
+// Name returns the key and environment variable, for error messages
+func (s setting) Name() string {
+	return s.Key + " (" + s.Env + ")"
+}
+
+var settings = collectSettings(reflect.TypeOf(Config{}), "", nil)
+
+func collectSettings(t reflect.Type, prefix string, index []int) []setting {
+	var out []setting
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("yaml")
+		fieldIndex := append(append([]int(nil), index...), i)
+		if field.Type.Kind() == reflect.Struct {
+			out = append(out, collectSettings(field.Type, key+".", fieldIndex)...)
+			continue
+		}
+		out = append(out, setting{
+			Key:    key,
+			Env:    field.Tag.Get("env"),
+			Flag:   strings.NewReplacer(".", "-", "_", "-").Replace(key),
+			Usage:  field.Tag.Get("usage"),
+			Secret: field.Tag.Get("secret") == "true",
+			index:  fieldIndex,
+		})
+	}
+	return out
+}
+
+// lookup finds a setting by key; it panics on a typo, which is a bug
+func lookup(key string) setting {
+	for _, s := range settings {
+		if s.Key == key {
+			return s
+		}
+	}
+	panic("config: unknown setting " + key)
+}
+
+// Load registers every setting as a flag on fs, plus --config, and parses
+// args. It then builds the configuration from the defaults, the YAML file
+// named by --config or IRON_CONFIG_FILE, the environment and the flags, in
+// that order. The result still needs to be validated.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	file := fs.String("config", "", "YAML configuration file (IRON_CONFIG_FILE)")
+	type flagValue struct {
+		setting setting
+		value   reflect.Value
+	}
+	var flags []flagValue
+	for _, s := range settings {
+		s := s
+		parse := func(text string) error {
+			value := reflect.New(reflect.TypeOf(Config{}).FieldByIndex(s.index).Type).Elem()
+			if err := parseValue(value, text); err != nil {
+				return err
+			}
+			flags = append(flags, flagValue{setting: s, value: value})
+			return nil
+		}
+		usage := s.Usage + " (" + s.Env + ")"
+		if reflect.TypeOf(Config{}).FieldByIndex(s.index).Type.Kind() == reflect.Bool {
+			fs.BoolFunc(s.Flag, usage, parse)
+		} else {
+			fs.Func(s.Flag, usage, parse)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *file == "" {
+		*file, _ = lookupEnv("IRON_CONFIG_FILE")
+	}
+	if *file != "" {
+		if err := cfg.loadFile(*file); err != nil {
+			return nil, err
+		}
+	}
+
+	root := reflect.ValueOf(cfg).Elem()
+	for _, s := range settings {
+		text, ok := lookupEnv(s.Env)
+		if !ok || text == "" {
+			continue
+		}
+		if err := parseValue(root.FieldByIndex(s.index), text); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Env, err)
+		}
+	}
+	for _, f := range flags {
+		root.FieldByIndex(f.setting.index).Set(f.value)
+	}
+	return cfg, nil
+}
+
+// loadFile overlays a YAML file. Unknown keys are an error, so typos do not
+// go unnoticed.
+func (c *Config) loadFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// parseValue sets value from an environment variable or flag. Lists are
+// separated by commas or spaces.
+func parseValue(value reflect.Value, text string) error {
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", text)
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", text)
+		}
+		value.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", text)
+		}
+		value.SetInt(int64(n))
+	case reflect.Slice:
+		list := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		value.Set(reflect.ValueOf(list))
+	default:
+		panic("config: unsupported setting type " + value.Type().String())
+	}
+	return nil
+}
+
+// Print writes the configuration as YAML with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	copied := *c
+	root := reflect.ValueOf(&copied).Elem()
+	for _, s := range settings {
+		if !s.Secret {
+			continue
+		}
+		value := root.FieldByIndex(s.index)
+		switch value.Kind() {
+		case reflect.String:
+			if value.String() != "" {
+				value.SetString(redacted)
+			}
+		case reflect.Slice:
+			list := make([]string, value.Len())
+			for i := range list {
+				list[i] = redacted
+			}
+			value.Set(reflect.ValueOf(list))
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&copied); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+)
+
+// Validate checks every setting and returns all problems at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s "+format, append([]any{lookup(key).Name()}, args...)...))
+	}
+
+	root := reflect.ValueOf(c).Elem()
+	for _, s := range settings {
+		if value := root.FieldByIndex(s.index); value.Kind() == reflect.Int || value.Kind() == reflect.Int64 {
+			if value.Int() < 0 {
+				errs = append(errs, fmt.Errorf("%s must not be negative", s.Name()))
+			}
+		}
+	}
+
+	if c.Listen == "" {
+		fail("listen", "must be set")
+	}
+	if _, err := c.Prefix(); err != nil {
+		fail("base_path", "%v", err)
+	}
+	if c.Templates.Dir != "" {
+		if info, err := os.Stat(c.Templates.Dir); err != nil {
+			fail("templates.dir", "%v", err)
+		} else if !info.IsDir() {
+			fail("templates.dir", "must be a directory")
+		}
+	}
+	if c.Templates.Reload && c.Templates.Dir == "" {
+		errs = append(errs, fmt.Errorf("%s needs %s, since the built-in templates cannot change", lookup("templates.reload").Name(), lookup("templates.dir").Name()))
+	}
+	if c.TLS.Enabled() && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("HTTPS needs both %s and %s", lookup("tls.cert_file").Name(), lookup("tls.key_file").Name()))
+	}
+	if _, err := utils.ParseTLSVersion(c.TLS.MinVersion); err != nil {
+		fail("tls.min_version", "%v", err)
+	}
+	if _, err := utils.ParseCipherSuites(c.TLS.Ciphers); err != nil {
+		fail("tls.ciphers", "%v", err)
+	}
+	if auth, err := utils.ParseClientAuth(c.TLS.ClientAuth); err != nil {
+		fail("tls.client_auth", "%v", err)
+	} else if auth != tls.NoClientCert && c.TLS.ClientCAFile == "" {
+		fail("tls.client_ca_file", "must be set to verify client certificates")
+	}
+	if !c.TLS.Enabled() && (c.TLS.RedirectListen != "" || c.TLS.ClientCAFile != "") {
+		errs = append(errs, fmt.Errorf("%s and %s need HTTPS to be enabled", lookup("tls.redirect_listen").Name(), lookup("tls.client_ca_file").Name()))
+	}
+	switch {
+	case c.MinIO.Endpoint == "" && c.MinIO.ClustersFile == "":
+		errs = append(errs, fmt.Errorf("either %s or %s must be set", lookup("minio.endpoint").Name(), lookup("minio.clusters_file").Name()))
+	case c.MinIO.ClustersFile != "":
+		connection := c.MinIO.cluster()
+		connection.Alias, connection.Name, connection.URL = "", "", ""
+		if connection != (services.Cluster{}) {
+			fail("minio.clusters_file", "sets connection options per cluster; the minio connection settings only apply to %s", lookup("minio.endpoint").Name())
+		}
+	default:
+		if _, err := c.MinIO.Clusters(); err != nil {
+			fail("minio.endpoint", "%v", err)
+		}
+	}
+	if c.CertLogin.Enabled {
+		if auth, _ := utils.ParseClientAuth(c.TLS.ClientAuth); !c.TLS.Enabled() || auth == tls.NoClientCert {
+			errs = append(errs, fmt.Errorf("%s needs HTTPS with %s set to optional or require", lookup("cert_login.enabled").Name(), lookup("tls.client_auth").Name()))
+		}
+		if c.MinIO.ClustersFile == "" && c.MinIO.UserCertDir == "" {
+			fail("minio.user_cert_dir", "must be set for certificate login")
+		}
+	}
+	if _, err := c.Proxies(); err != nil {
+		fail("trusted_proxies", "%v", err)
+	}
+
+	keyring, err := c.Session.Keyring()
+	switch {
+	case err != nil && len(c.Session.Keys) > 0:
+		fail("session.keys", "%v", err)
+	case err != nil:
+		fail("session.key", "%v", err)
+	case keyring == nil && c.Session.KeyStrict:
+		errs = append(errs, fmt.Errorf("%s is set but neither %s nor %s is", lookup("session.key_strict").Name(), lookup("session.keys").Name(), lookup("session.key").Name()))
+	}
+	switch c.Session.Store {
+	case "", "memory", "file":
+	default:
+		fail("session.store", "must be memory or file, not %q", c.Session.Store)
+	}
+	if c.Session.MaxLifetime == 0 {
+		fail("session.max_lifetime", "must be positive")
+	}
+
+	oidc := c.OIDC.Service()
+	if (oidc.IssuerURL != "" || oidc.ClientID != "" || oidc.RedirectURL != "") && !oidc.Enabled() {
+		errs = append(errs, fmt.Errorf("single sign-on needs all of %s, %s and %s", lookup("oidc.issuer_url").Name(), lookup("oidc.client_id").Name(), lookup("oidc.redirect_url").Name()))
+	}
+	if oidc.Enabled() && len(oidc.Scopes) == 0 {
+		fail("oidc.scopes", "must not be empty")
+	}
+
+	if c.Login.Lockout == 0 {
+		fail("login.lockout", "must be positive")
+	}
+	if totp, err := c.TOTP.Service(); err != nil {
+		fail("totp.mode", "%v", err)
+	} else if totp.Enabled() && keyring == nil {
+		errs = append(errs, fmt.Errorf("%s needs %s or %s, or enrollments are unreadable after a restart", lookup("totp.mode").Name(), lookup("session.keys").Name(), lookup("session.key").Name()))
+	}
+	if c.APITokens.MaxDays == 0 {
+		fail("api_tokens.max_days", "must be positive")
+	}
+	if c.APITokens.Enabled && keyring == nil {
+		errs = append(errs, fmt.Errorf("%s needs %s or %s, or tokens stop working after a restart", lookup("api_tokens.enabled").Name(), lookup("session.keys").Name(), lookup("session.key").Name()))
+	}
+	if _, err := c.Approvals.Service(); err != nil {
+		fail("approvals.actions", "%v", err)
+	}
+	if c.Approvals.TTL == 0 {
+		fail("approvals.ttl", "must be positive")
+	}
+	if c.Audit.MaxSizeMB == 0 {
+		fail("audit.max_size_mb", "must be positive")
+	}
+
+	return errors.Join(errs...)
+}
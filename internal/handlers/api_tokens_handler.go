@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// maxAPITokenNameLength keeps token names readable in the token list
+const maxAPITokenNameLength = 64
+
+// APITokensHandler lets users mint and revoke personal API tokens
+type APITokensHandler struct {
+	authService  *services.AuthService
+	minioFactory services.MinioClientFactory
+	tokens       *services.APITokenService
+}
+
+func NewAPITokensHandler(authService *services.AuthService, minioFactory services.MinioClientFactory, tokens *services.APITokenService) *APITokensHandler {
+	return &APITokensHandler{
+		authService:  authService,
+		minioFactory: minioFactory,
+		tokens:       tokens,
+	}
+}
+
+// sessionCredentials rejects requests made with an API token, so a token
+// cannot be used to mint or revoke tokens
+func sessionCredentials(c echo.Context) (*services.Credentials, error) {
+	if c.Get(utils.ContextKeyAPIToken) != nil {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "API tokens cannot manage API tokens")
+	}
+	return GetCredentials(c)
+}
+
+// ListTokens shows the user's tokens, and every token to admins
+func (h *APITokensHandler) ListTokens(c echo.Context) error {
+	creds, err := sessionCredentials(c)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"ActiveNav":   "settings",
+		"Now":         time.Now(),
+		"MaxDays":     int(h.tokens.MaxLifetime().Hours() / 24),
+		"DefaultDays": min(30, int(h.tokens.MaxLifetime().Hours()/24)),
+		// Single sign-on sessions have no stable name to own a token
+		"Managed": creds.User == "",
+	}
+	tokens, err := h.tokens.List(creds.Identity())
+	if err != nil {
+		data["Error"] = "Failed to load API tokens"
+	}
+	data["Tokens"] = tokens
+
+	if requireAdmin(c, h.minioFactory) == nil {
+		data["IsAdmin"] = true
+		if all, err := h.tokens.List(""); err == nil {
+			others := make([]services.APIToken, 0, len(all))
+			for _, token := range all {
+				if token.Owner != creds.Identity() {
+					others = append(others, token)
+				}
+			}
+			data["OtherTokens"] = others
+		}
+	}
+
+	return c.Render(http.StatusOK, "api_tokens", data)
+}
+
+// CreateToken mints a token and shows its value once
+func (h *APITokensHandler) CreateToken(c echo.Context) error {
+	creds, err := sessionCredentials(c)
+	if err != nil {
+		return err
+	}
+	if creds.User == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Single sign-on accounts cannot create API tokens")
+	}
+
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" || len(name) > maxAPITokenNameLength {
+		return formError(c, "Name is required (up to 64 characters)")
+	}
+	scope, err := services.ParseAPITokenScope(c.FormValue("scope"))
+	if err != nil {
+		return formError(c, "Choose read-only or read-write")
+	}
+	days, err := strconv.Atoi(c.FormValue("days"))
+	maxDays := int(h.tokens.MaxLifetime().Hours() / 24)
+	if err != nil || days < 1 || days > maxDays {
+		return formError(c, "Expiry must be between 1 and "+strconv.Itoa(maxDays)+" days")
+	}
+
+	// MinIO makes the service account a child of whoever creates it, so use
+	// the long-term key rather than the temporary session credentials
+	owner, ok := h.authService.LongTermCredentials(*creds)
+	if !ok {
+		owner = *creds
+	}
+	owner.User = creds.User
+
+	token, plaintext, err := h.tokens.Create(c.Request().Context(), owner, name, scope, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		log.Printf("API tokens: failed to create token for %q: %v", creds.Identity(), err)
+		return formError(c, "Failed to create token. You may not be allowed to create access keys.")
+	}
+	log.Printf("API tokens: %q created %s token %s (%q), expires %s", token.Owner, token.Scope, token.ID, token.Name, token.ExpiresAt.Format(time.RFC3339))
+
+	c.Response().Header().Set("HX-Retarget", "#api-token-create")
+	return c.Render(http.StatusOK, "api_token_created", map[string]interface{}{
+		"Token": token,
+		"Value": plaintext,
+	})
+}
+
+// RevokeToken deletes one of the user's tokens; admins can revoke any token
+func (h *APITokensHandler) RevokeToken(c echo.Context) error {
+	creds, err := sessionCredentials(c)
+	if err != nil {
+		return err
+	}
+
+	token, err := h.tokens.Get(c.FormValue("id"))
+	if errors.Is(err, services.ErrAPITokenNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Token not found")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to load token")
+	}
+	if token.Owner != creds.Identity() {
+		if err := requireAdmin(c, h.minioFactory); err != nil {
+			// Do not reveal other users' tokens
+			return echo.NewHTTPError(http.StatusNotFound, "Token not found")
+		}
+	}
+
+	by, ok := h.authService.LongTermCredentials(*creds)
+	if !ok {
+		by = *creds
+	}
+	if err := h.tokens.Revoke(c.Request().Context(), by, token.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke token")
+	}
+	log.Printf("API tokens: token %s (%q) of %q revoked by %q", token.ID, token.Name, token.Owner, creds.Identity())
+
+	return HTMXRedirect(c, "/settings/tokens")
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// approvalCapabilities is the role capability needed to approve each action,
+// the same one the route for the action itself requires
+var approvalCapabilities = map[services.ApprovalAction]services.Capability{
+	services.ApprovalDeleteBucket:  services.CapabilityBucketsManage,
+	services.ApprovalDeleteFolder:  services.CapabilityObjectsWrite,
+	services.ApprovalDeleteUser:    services.CapabilityIAMManage,
+	services.ApprovalRestartServer: services.CapabilityServerRestart,
+}
+
+// ApprovalsHandler lists pending requests for protected actions and runs them
+// once a second user approves
+type ApprovalsHandler struct {
+	approvals    *services.ApprovalService
+	minioFactory services.MinioClientFactory
+	buckets      *BucketsHandler
+	users        *UsersHandler
+	settings     *SettingsHandler
+}
+
+func NewApprovalsHandler(approvals *services.ApprovalService, minioFactory services.MinioClientFactory, buckets *BucketsHandler, users *UsersHandler, settings *SettingsHandler) *ApprovalsHandler {
+	return &ApprovalsHandler{
+		approvals:    approvals,
+		minioFactory: minioFactory,
+		buckets:      buckets,
+		users:        users,
+		settings:     settings,
+	}
+}
+
+// submitForApproval records a protected action as a pending request instead
+// of running it, and sends the user to the approvals page
+func submitForApproval(c echo.Context, approvals *services.ApprovalService, creds services.Credentials, action services.ApprovalAction, params map[string]string, summary string) error {
+	request, err := approvals.Submit(creds, action, params, summary)
+	if err != nil {
+		log.Printf("Approvals: failed to record %q for %q: %v", summary, creds.Identity(), err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to request approval")
+	}
+	log.Printf("Approvals: %q requested %q (%s)", request.Requester, request.Summary, request.ID)
+	return HTMXRedirect(c, "/approvals")
+}
+
+// ListApprovals shows the requests the user made or could decide
+func (h *ApprovalsHandler) ListApprovals(c echo.Context) error {
+	creds, err := GetCredentialsOrRedirect(c)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"ActiveNav": "approvals",
+		"Identity":  creds.Identity(),
+		"Now":       time.Now(),
+	}
+	requests, err := h.approvals.List(creds.Endpoint)
+	if err != nil {
+		data["Error"] = "Failed to load approval requests"
+	}
+	var pending, closed []services.ApprovalRequest
+	for _, request := range requests {
+		if request.Requester != creds.Identity() && !role(c).Allows(approvalCapabilities[request.Action]) {
+			continue
+		}
+		if request.Status == services.ApprovalPending {
+			pending = append(pending, request)
+		} else {
+			closed = append(closed, request)
+		}
+	}
+	data["Pending"] = pending
+	data["Closed"] = closed
+
+	return c.Render(http.StatusOK, "approvals", data)
+}
+
+// Approve runs a pending request with the approver's credentials
+func (h *ApprovalsHandler) Approve(c echo.Context) error {
+	creds, err := approverCredentials(c)
+	if err != nil {
+		return err
+	}
+
+	request, err := h.approvals.Get(c.Param("id"))
+	if err != nil {
+		return approvalError(err)
+	}
+	auditApproval(c, request)
+	if err := h.authorize(c, request); err != nil {
+		return err
+	}
+
+	request, err = h.approvals.Approve(request.ID, *creds)
+	if err != nil {
+		return approvalError(err)
+	}
+	log.Printf("Approvals: %q approved %q requested by %q (%s)", request.DecidedBy, request.Summary, request.Requester, request.ID)
+
+	if err := h.run(c.Request().Context(), *creds, request); err != nil {
+		message := err.Error()
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			if text, ok := httpErr.Message.(string); ok {
+				message = text
+			}
+		}
+		log.Printf("Approvals: running %q (%s) failed: %v", request.Summary, request.ID, err)
+		if err := h.approvals.Fail(request.ID, errors.New(message)); err != nil {
+			log.Printf("Approvals: failed to record failure of %s: %v", request.ID, err)
+		}
+	}
+
+	return HTMXRedirect(c, "/approvals")
+}
+
+// Reject closes a pending request without running it; requesters use it to
+// withdraw their own
+func (h *ApprovalsHandler) Reject(c echo.Context) error {
+	creds, err := approverCredentials(c)
+	if err != nil {
+		return err
+	}
+
+	request, err := h.approvals.Get(c.Param("id"))
+	if err != nil {
+		return approvalError(err)
+	}
+	auditApproval(c, request)
+	if request.Requester != creds.Identity() {
+		if err := h.authorize(c, request); err != nil {
+			return err
+		}
+	}
+
+	request, err = h.approvals.Reject(request.ID, *creds)
+	if err != nil {
+		return approvalError(err)
+	}
+	log.Printf("Approvals: %q %s %q requested by %q (%s)", request.DecidedBy, request.Status, request.Summary, request.Requester, request.ID)
+
+	return HTMXRedirect(c, "/approvals")
+}
+
+// auditApproval adds what a request would do to the audit event for
+// deciding it
+func auditApproval(c echo.Context, request services.ApprovalRequest) {
+	utils.SetAuditValue(c, "request", request.Summary)
+	utils.SetAuditValue(c, "requester", request.Requester)
+	for key, value := range request.Params {
+		utils.SetAuditValue(c, key, value)
+	}
+}
+
+// approverCredentials rejects API tokens: approvals are for people
+func approverCredentials(c echo.Context) (*services.Credentials, error) {
+	if c.Get(utils.ContextKeyAPIToken) != nil {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "API tokens cannot decide approval requests")
+	}
+	return GetCredentials(c)
+}
+
+// authorize checks the approver could run the action themselves
+func (h *ApprovalsHandler) authorize(c echo.Context, request services.ApprovalRequest) error {
+	if !role(c).Allows(approvalCapabilities[request.Action]) {
+		return echo.NewHTTPError(http.StatusForbidden, "Your role does not allow deciding this request")
+	}
+	can := permissions(c)
+	switch request.Action {
+	case services.ApprovalDeleteBucket:
+		return requirePermission(can.Write(request.Params["bucket"]), "You do not have permission to delete this bucket")
+	case services.ApprovalDeleteFolder:
+		return requirePermission(can.Write(request.Params["bucket"]), "You have read-only access to this bucket")
+	case services.ApprovalDeleteUser:
+		return requireAdmin(c, h.minioFactory)
+	case services.ApprovalRestartServer:
+		return requirePermission(can.Allowed("admin:ServiceRestart"), "Restarting the server requires admin permissions")
+	}
+	return echo.NewHTTPError(http.StatusBadRequest, "Unknown action")
+}
+
+func (h *ApprovalsHandler) run(ctx context.Context, creds services.Credentials, request services.ApprovalRequest) error {
+	switch request.Action {
+	case services.ApprovalDeleteBucket:
+		return h.buckets.deleteBucket(ctx, creds, request.Params["bucket"])
+	case services.ApprovalDeleteFolder:
+		return h.buckets.deleteFolder(ctx, creds, request.Params["bucket"], request.Params["prefix"])
+	case services.ApprovalDeleteUser:
+		return h.users.deleteUser(ctx, creds, request.Params["accessKey"])
+	case services.ApprovalRestartServer:
+		return h.settings.restartService(ctx, creds)
+	}
+	return errors.New("unknown action")
+}
+
+func approvalError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrApprovalNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Approval request not found")
+	case errors.Is(err, services.ErrApprovalClosed):
+		return echo.NewHTTPError(http.StatusConflict, "This request has already been decided or has expired")
+	case errors.Is(err, services.ErrApprovalSelf):
+		return echo.NewHTTPError(http.StatusForbidden, "Someone else must approve your request")
+	case errors.Is(err, services.ErrApprovalCluster):
+		return echo.NewHTTPError(http.StatusConflict, "Switch to the cluster this request was made on to decide it")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update approval request")
+}
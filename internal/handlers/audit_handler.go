@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// auditPageSize is how many events the audit page shows; exports have no limit
+const auditPageSize = 200
+
+// auditColumns are the CSV export columns
+var auditColumns = []string{
+	"time", "actor", "token", "source_ip", "cluster", "action", "method", "path",
+	"bucket", "object", "user", "group", "policy", "result", "status", "error", "params",
+}
+
+// AuditHandler shows and exports the audit trail
+type AuditHandler struct {
+	audit        *services.AuditLog
+	minioFactory services.MinioClientFactory
+}
+
+func NewAuditHandler(audit *services.AuditLog, minioFactory services.MinioClientFactory) *AuditHandler {
+	return &AuditHandler{
+		audit:        audit,
+		minioFactory: minioFactory,
+	}
+}
+
+// ListEvents renders the most recent audit events matching the filters
+func (h *AuditHandler) ListEvents(c echo.Context) error {
+	if err := requireServerAdmin(c, h.minioFactory); err != nil {
+		return err
+	}
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.Limit = auditPageSize + 1
+
+	data := map[string]interface{}{
+		"ActiveNav": "audit",
+		"Filter":    c.QueryParams(),
+		"Results":   []services.AuditResult{services.AuditSuccess, services.AuditDenied, services.AuditFailure},
+	}
+	events, err := h.audit.Query(filter)
+	if err != nil {
+		data["Error"] = "Failed to read the audit log"
+	}
+	if len(events) > auditPageSize {
+		events = events[:auditPageSize]
+		data["Truncated"] = true
+	}
+	data["Events"] = events
+
+	query := c.QueryParams()
+	query.Set("format", "csv")
+	data["CSVURL"] = "/audit/export?" + query.Encode()
+	query.Set("format", "json")
+	data["JSONURL"] = "/audit/export?" + query.Encode()
+
+	return c.Render(http.StatusOK, "audit", data)
+}
+
+// Export downloads every audit event matching the filters as CSV or JSON
+func (h *AuditHandler) Export(c echo.Context) error {
+	if err := requireServerAdmin(c, h.minioFactory); err != nil {
+		return err
+	}
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+	format := c.QueryParam("format")
+	if format != "csv" && format != "json" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Format must be csv or json")
+	}
+
+	events, err := h.audit.Query(filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read the audit log")
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		if events == nil {
+			events = []services.AuditEvent{}
+		}
+		return c.JSON(http.StatusOK, events)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	w := csv.NewWriter(c.Response())
+	if err := w.Write(auditColumns); err != nil {
+		return err
+	}
+	for _, event := range events {
+		params := ""
+		if len(event.Params) > 0 {
+			encoded, _ := json.Marshal(event.Params)
+			params = string(encoded)
+		}
+		if err := w.Write([]string{
+			event.Time.Format(time.RFC3339), event.Actor, event.Token, event.SourceIP, event.Cluster,
+			event.Action, event.Method, event.Path, event.Bucket, event.Object, event.User, event.Group,
+			event.Policy, string(event.Result), strconv.Itoa(event.Status), event.Error, params,
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// auditFilter reads the actor, action, target, result, since and until query
+// parameters. Dates are YYYY-MM-DD in UTC and include the whole day.
+func auditFilter(c echo.Context) (services.AuditFilter, error) {
+	query := c.QueryParams()
+	filter := services.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+		Result: services.AuditResult(query.Get("result")),
+	}
+	var err error
+	if filter.Since, err = auditDate(query, "since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = auditDate(query, "until"); err != nil {
+		return filter, err
+	}
+	if !filter.Until.IsZero() {
+		filter.Until = filter.Until.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+func auditDate(query url.Values, key string) (time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "Dates must be in YYYY-MM-DD format")
+	}
+	return date, nil
+}
@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/damacus/iron-buckets/internal/services"
@@ -9,10 +16,25 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	oidcStateCookie    = "IronSealOIDCState"
+	oidcVerifierCookie = "IronSealOIDCVerifier"
+	oidcClusterCookie  = "IronSealOIDCCluster"
+	oidcFlowTimeout    = 10 * time.Minute
+)
+
 type AuthHandler struct {
 	authService   *services.AuthService
 	minioFactory  services.MinioClientFactory
 	minioEndpoint string
+	clusters      *services.ClusterRegistry
+	oidc          *services.OIDCProvider
+	ldap          services.LDAPConfig
+	certificate   services.CertificateConfig
+	sts           services.STSClient
+	limiter       *services.LoginLimiter
+	totp          *services.TOTPService
+	totpMode      services.TOTPMode
 }
 
 func NewAuthHandler(authService *services.AuthService, minioFactory services.MinioClientFactory, minioEndpoint string) *AuthHandler {
@@ -23,102 +45,506 @@ func NewAuthHandler(authService *services.AuthService, minioFactory services.Min
 	}
 }
 
+// WithClusters lets users pick which cluster to sign in to, and switch
+// clusters without logging out
+func (h *AuthHandler) WithClusters(registry *services.ClusterRegistry) *AuthHandler {
+	h.clusters = registry
+	return h
+}
+
+// clusterEndpoint resolves the cluster chosen on the login page. Only
+// configured clusters are accepted; the endpoint never comes from the browser.
+func (h *AuthHandler) clusterEndpoint(alias string) (string, bool) {
+	if h.clusters == nil {
+		return h.minioEndpoint, true
+	}
+	if alias == "" {
+		return h.clusters.Default().Endpoint, true
+	}
+	cluster, ok := h.clusters.Get(alias)
+	return cluster.Endpoint, ok
+}
+
+// WithOIDC enables single sign-on through an OpenID Connect provider
+func (h *AuthHandler) WithOIDC(provider *services.OIDCProvider, sts services.STSClient) *AuthHandler {
+	h.oidc = provider
+	h.sts = sts
+	return h
+}
+
+// WithLDAP enables sign-in with directory credentials through MinIO STS
+func (h *AuthHandler) WithLDAP(config services.LDAPConfig, sts services.STSClient) *AuthHandler {
+	h.ldap = config
+	h.sts = sts
+	return h
+}
+
+// WithCertificateLogin enables sign-in with the verified client certificate
+// through MinIO STS
+func (h *AuthHandler) WithCertificateLogin(config services.CertificateConfig, sts services.STSClient) *AuthHandler {
+	h.certificate = config
+	h.sts = sts
+	return h
+}
+
+// WithLoginLimiter throttles repeated failed logins per client address and user
+func (h *AuthHandler) WithLoginLimiter(limiter *services.LoginLimiter) *AuthHandler {
+	h.limiter = limiter
+	return h
+}
+
+// WithTOTP asks enrolled users for a one-time code before the session is
+// created. In required mode, users without a second factor must enroll first.
+func (h *AuthHandler) WithTOTP(totp *services.TOTPService, mode services.TOTPMode) *AuthHandler {
+	h.totp = totp
+	h.totpMode = mode
+	return h
+}
+
 // LoginPage renders the login view
 func (h *AuthHandler) LoginPage(c echo.Context) error {
 	// If already logged in (cookie exists AND is valid), redirect to dashboard
+	// unless the user is switching to another cluster
 	cookie, err := c.Cookie(utils.CookieName)
 	if err == nil {
-		_, err := h.authService.DecryptCredentials(cookie.Value)
+		state, err := h.authService.OpenSession(cookie.Value)
 		if err == nil {
-			return c.Redirect(http.StatusSeeOther, "/")
+			endpoint, ok := h.clusterEndpoint(c.QueryParam("cluster"))
+			if c.QueryParam("cluster") == "" || !ok || endpoint == state.Endpoint {
+				return c.Redirect(http.StatusSeeOther, utils.URL(c, "/"))
+			}
 		}
 		// If invalid, we just ignore it and show login page.
 		// Optionally we could clear it here too, but the login post will overwrite it.
 	}
 	// We use a specific "login" template set that doesn't use the main sidebar layout
-	return c.Render(http.StatusOK, "login", nil)
+	return h.renderLogin(c, "")
+}
+
+func (h *AuthHandler) renderLogin(c echo.Context, errorMessage string) error {
+	data := map[string]interface{}{
+		"OIDCEnabled": h.oidc != nil,
+		"LDAPEnabled": h.ldap.Enabled,
+		"Error":       errorMessage,
+	}
+	if h.certificate.Enabled {
+		name, err := services.CertificateUsername(c.Request().TLS)
+		data["CertificateEnabled"] = true
+		if err == nil {
+			data["CertificateUser"] = name
+		}
+	}
+	if h.clusters != nil && len(h.clusters.List()) > 1 {
+		selected := h.clusters.Default().Alias
+		if cluster, ok := h.clusters.Get(c.QueryParam("cluster")); ok {
+			selected = cluster.Alias
+		}
+		data["Clusters"] = h.clusters.List()
+		data["SelectedCluster"] = selected
+	}
+	return c.Render(http.StatusOK, "login", data)
 }
 
 // Login handles the form submission
 func (h *AuthHandler) Login(c echo.Context) error {
+	switch c.FormValue("mode") {
+	case "ldap":
+		return h.loginLDAP(c)
+	case "certificate":
+		return h.loginCertificate(c)
+	}
+
 	accessKey := c.FormValue("accessKey")
 	secretKey := c.FormValue("secretKey")
+	endpoint, ok := h.clusterEndpoint(c.FormValue("cluster"))
+	if !ok {
+		return loginError(c, "Unknown cluster")
+	}
+
+	if blocked, err := checkLoginLimit(c, h.limiter, accessKey); blocked {
+		return err
+	}
 
 	creds := services.Credentials{
-		Endpoint:  h.minioEndpoint,
+		Endpoint:  endpoint,
 		AccessKey: accessKey,
 		SecretKey: secretKey,
+		User:      accessKey,
 	}
 
 	// 1. Validate Credentials with MinIO
 	// Use S3 client instead of admin client so regular users can login
 	s3Client, err := h.minioFactory.NewClient(creds)
 	if err != nil {
+		loginFailed(c, h.limiter, accessKey)
 		return c.Render(http.StatusOK, "login_error", "Invalid Configuration")
 	}
 
 	// Attempt a lightweight call to verify auth - ListBuckets works for all users
 	_, err = s3Client.ListBuckets(c.Request().Context())
 	if err != nil {
+		loginFailed(c, h.limiter, accessKey)
 		// Return HTML fragment for error div if using HTMX, or re-render page
-		return c.HTML(http.StatusOK, `<div id="error-message" class="text-red-500 text-sm text-center block mb-4">Authentication Failed: Invalid Credentials or Endpoint Unreachable</div>`)
+		return loginError(c, "Authentication Failed: Invalid Credentials or Endpoint Unreachable")
 	}
+	loginSucceeded(c, h.limiter, accessKey)
 
-	// 2. Encrypt Session
-	// creds is already populated above
-	encrypted, err := h.authService.EncryptCredentials(creds)
+	// 2. Swap the long-term key for temporary credentials; the key itself stays server-side
+	sessionCreds, err := h.authService.IssueSessionCredentials(c.Request().Context(), creds)
 	if err != nil {
-		return c.HTML(http.StatusInternalServerError, "Failed to create session")
+		log.Printf("Login: AssumeRole failed for %q: %v", accessKey, err)
+		return loginError(c, "Authentication Failed: Could not obtain temporary credentials")
 	}
 
-	// 3. Set Cookie
-	cookie := new(http.Cookie)
-	cookie.Name = utils.CookieName
-	cookie.Value = encrypted
-	cookie.Expires = time.Now().Add(24 * time.Hour)
-	cookie.Path = "/"
-	cookie.HttpOnly = true
-	cookie.SameSite = http.SameSiteStrictMode
-	cookie.Secure = requestIsSecure(c)
-	c.SetCookie(cookie)
+	// 3. Create the session, or continue to the second factor
+	return h.completeLogin(c, sessionCreds)
+}
+
+// loginLDAP exchanges directory credentials for temporary MinIO credentials
+func (h *AuthHandler) loginLDAP(c echo.Context) error {
+	if !h.ldap.Enabled {
+		return loginError(c, "Directory sign-in is not enabled")
+	}
+
+	username := c.FormValue("username")
+	password := c.FormValue("password")
+	if username == "" || password == "" {
+		return loginError(c, "Username and password are required")
+	}
+	endpoint, ok := h.clusterEndpoint(c.FormValue("cluster"))
+	if !ok {
+		return loginError(c, "Unknown cluster")
+	}
+
+	if blocked, err := checkLoginLimit(c, h.limiter, username); blocked {
+		return err
+	}
+
+	creds, err := h.sts.AssumeRoleWithLDAPIdentity(c.Request().Context(), endpoint, username, password, h.ldap.SessionDuration)
+	if err != nil {
+		log.Printf("LDAP: AssumeRoleWithLDAPIdentity failed for %q: %v", username, err)
+		loginFailed(c, h.limiter, username)
+		return loginError(c, "Authentication Failed: Invalid Username or Password")
+	}
+	loginSucceeded(c, h.limiter, username)
+	creds.User = services.LDAPUsername(username)
+
+	return h.completeLogin(c, creds)
+}
+
+// loginCertificate signs in as the name on the verified client certificate.
+// The browser keeps the private key, so MinIO is shown the certificate held
+// for that name on the chosen cluster.
+func (h *AuthHandler) loginCertificate(c echo.Context) error {
+	if !h.certificate.Enabled {
+		return loginError(c, "Certificate sign-in is not enabled")
+	}
+
+	name, err := services.CertificateUsername(c.Request().TLS)
+	if err != nil {
+		return loginError(c, "Sign-in failed: no verified client certificate was presented")
+	}
+	utils.SetAuditValue(c, "username", name)
+	endpoint, ok := h.clusterEndpoint(c.FormValue("cluster"))
+	if !ok {
+		return loginError(c, "Unknown cluster")
+	}
+
+	creds, err := h.sts.AssumeRoleWithCertificate(c.Request().Context(), endpoint, name, h.certificate.SessionDuration)
+	if err != nil {
+		log.Printf("Certificate: AssumeRoleWithCertificate failed for %q: %v", name, err)
+		return loginError(c, "Authentication Failed: the certificate was not accepted for this cluster")
+	}
+	creds.User = name
+
+	return h.completeLogin(c, creds)
+}
 
-	// 4. Redirect (HTMX handles 200 OK with HX-Redirect)
+// completeLogin creates the session once the password check has passed, or
+// hands over to the second factor step
+func (h *AuthHandler) completeLogin(c echo.Context, creds services.Credentials) error {
+	if h.totp != nil {
+		enrolled, err := h.totp.Enrolled(creds.Identity())
+		if err != nil {
+			log.Printf("Login: failed to look up second factor for %q: %v", creds.Identity(), err)
+			return loginError(c, "Sign-in is temporarily unavailable")
+		}
+		if enrolled || h.totpMode == services.TOTPRequired {
+			value, expires, err := h.authService.SealPendingLogin(creds)
+			if err != nil {
+				return c.HTML(http.StatusInternalServerError, "Failed to create session")
+			}
+			utils.SetPendingLoginCookie(c, value, expires)
+			if enrolled {
+				return HTMXRedirect(c, "/login/mfa")
+			}
+			return HTMXRedirect(c, "/login/mfa/enroll")
+		}
+	}
+
+	if err := startSession(c, h.authService, creds); err != nil {
+		return c.HTML(http.StatusInternalServerError, "Failed to create session")
+	}
+
+	// HTMX handles 200 OK with HX-Redirect
 	return HTMXRedirect(c, "/")
 }
 
-// Logout clears the session
-func (h *AuthHandler) Logout(c echo.Context) error {
-	cookie := new(http.Cookie)
-	cookie.Name = utils.CookieName
-	cookie.Value = ""
-	cookie.Expires = time.Now().Add(-1 * time.Hour)
-	cookie.MaxAge = -1
-	cookie.Path = "/"
-	cookie.HttpOnly = true
-	cookie.SameSite = http.SameSiteStrictMode
-	cookie.Secure = requestIsSecure(c)
-	c.SetCookie(cookie)
-	return c.Redirect(http.StatusSeeOther, "/login")
+// checkLoginLimit reports whether the attempt is throttled, along with the
+// response to send in that case
+func checkLoginLimit(c echo.Context, limiter *services.LoginLimiter, user string) (bool, error) {
+	if limiter == nil {
+		return false, nil
+	}
+	wait, err := limiter.Allow(c.RealIP(), user)
+	if errors.Is(err, services.ErrLoginThrottled) {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+		return true, loginError(c, fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", seconds))
+	}
+	if err != nil {
+		log.Printf("Login: rate limiter unavailable: %v", err)
+		return true, loginError(c, "Sign-in is temporarily unavailable")
+	}
+	return false, nil
 }
 
-func requestIsSecure(c echo.Context) bool {
-	req := c.Request()
-	if req.TLS != nil {
-		return true
+func loginFailed(c echo.Context, limiter *services.LoginLimiter, user string) {
+	if limiter != nil {
+		limiter.Failed(c.RealIP(), user)
 	}
+}
 
-	return req.Header.Get("X-Forwarded-Proto") == "https"
+func loginSucceeded(c echo.Context, limiter *services.LoginLimiter, user string) {
+	if limiter != nil {
+		limiter.Succeeded(c.RealIP(), user)
+	}
+}
+
+// loginError returns the fragment that replaces the login page error box
+func loginError(c echo.Context, message string) error {
+	utils.SetAuditError(c, message)
+	return c.HTML(http.StatusOK, `<div id="error-message" class="text-red-500 text-sm text-center block mb-4">`+html.EscapeString(message)+`</div>`)
+}
+
+// startSession creates the session and its cookie. A session already held by
+// the browser, for example on another cluster, is ended first.
+func startSession(c echo.Context, authService *services.AuthService, creds services.Credentials) error {
+	if cookie, err := c.Cookie(utils.CookieName); err == nil && cookie.Value != "" {
+		authService.EndSession(cookie.Value)
+	}
+	value, expires, err := authService.CreateSession(creds, services.SessionClient{
+		RemoteIP:  c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	})
+	if err != nil {
+		return err
+	}
+	utils.SetSessionCookie(c, value, expires)
+	return nil
+}
+
+// SessionStatus is polled by the layout and returns the "session expiring"
+// warning once the session is within the policy's warning window
+func (h *AuthHandler) SessionStatus(c echo.Context) error {
+	state, ok := c.Get(utils.ContextKeySession).(*services.SessionState)
+	if !ok {
+		return c.NoContent(http.StatusOK)
+	}
+
+	policy := h.authService.SessionPolicy()
+	expires := h.authService.SessionExpiry(*state)
+	remaining := time.Until(expires)
+	if policy.WarnBefore <= 0 || remaining > policy.WarnBefore {
+		return c.NoContent(http.StatusOK)
+	}
+
+	// Activity can only push back the idle deadline, not the absolute one
+	canExtend := policy.IdleTimeout > 0 && expires.Before(state.IssuedAt.Add(policy.MaxLifetime))
+	return c.Render(http.StatusOK, "session_warning", map[string]interface{}{
+		"Minutes":   int(remaining.Minutes()) + 1,
+		"ExpiresAt": expires,
+		"CanExtend": canExtend,
+	})
+}
+
+// ExtendSession is the "stay signed in" action; AuthMiddleware has already
+// recorded the activity, so it only clears the warning
+func (h *AuthHandler) ExtendSession(c echo.Context) error {
+	return c.NoContent(http.StatusOK)
+}
+
+// SwitchCluster moves the session to another cluster. Access-key sessions are
+// moved directly when the same key works there; otherwise the user signs in
+// to the target cluster and keeps the current session until that succeeds.
+func (h *AuthHandler) SwitchCluster(c echo.Context) error {
+	creds, err := GetCredentials(c)
+	if err != nil {
+		return err
+	}
+	if h.clusters == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Cluster switching is not enabled")
+	}
+	cluster, ok := h.clusters.Get(c.FormValue("cluster"))
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "Unknown cluster")
+	}
+	if cluster.Endpoint == creds.Endpoint {
+		return HTMXRedirect(c, "/")
+	}
+
+	signIn := "/login?cluster=" + url.QueryEscape(cluster.Alias)
+	longTerm, ok := h.authService.LongTermCredentials(*creds)
+	if !ok {
+		return HTMXRedirect(c, signIn)
+	}
+	longTerm.Endpoint = cluster.Endpoint
+
+	ctx := c.Request().Context()
+	s3Client, err := h.minioFactory.NewClient(longTerm)
+	if err != nil {
+		return HTMXRedirect(c, signIn)
+	}
+	if _, err := s3Client.ListBuckets(ctx); err != nil {
+		// The key is not valid on the target cluster
+		return HTMXRedirect(c, signIn)
+	}
+	sessionCreds, err := h.authService.IssueSessionCredentials(ctx, longTerm)
+	if err != nil {
+		log.Printf("Clusters: AssumeRole on %s failed for %q: %v", cluster.Alias, creds.Identity(), err)
+		return HTMXRedirect(c, signIn)
+	}
+
+	// The second factor was already checked when this session started
+	if err := startSession(c, h.authService, sessionCreds); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create session")
+	}
+	log.Printf("Clusters: %q switched to %s", creds.Identity(), cluster.Alias)
+	return HTMXRedirect(c, "/")
+}
+
+// Logout clears the session
+func (h *AuthHandler) Logout(c echo.Context) error {
+	if cookie, err := c.Cookie(utils.CookieName); err == nil {
+		h.authService.EndSession(cookie.Value)
+	}
+	utils.ClearSessionCookie(c)
+	return c.Redirect(http.StatusSeeOther, utils.URL(c, "/login"))
 }
 
 // LoginOIDC initiates the OIDC flow
 func (h *AuthHandler) LoginOIDC(c echo.Context) error {
-	// TODO: Generate state, store in cookie, redirect to OIDC provider
-	// For now, just return a message
-	return c.HTML(http.StatusOK, "<h1>OIDC Redirect...</h1><p>(Not fully configured yet)</p>")
+	if h.oidc == nil {
+		return c.Redirect(http.StatusSeeOther, utils.URL(c, "/login"))
+	}
+
+	state, err := services.NewRandomToken(32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to start sign-in")
+	}
+	verifier, err := services.NewRandomToken(32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to start sign-in")
+	}
+
+	authURL, err := h.oidc.AuthCodeURL(c.Request().Context(), state, services.PKCEChallenge(verifier))
+	if err != nil {
+		log.Printf("OIDC: discovery failed: %v", err)
+		return h.renderLogin(c, "Identity provider is unavailable")
+	}
+
+	h.setOIDCCookie(c, oidcStateCookie, state, oidcFlowTimeout)
+	h.setOIDCCookie(c, oidcVerifierCookie, verifier, oidcFlowTimeout)
+	if alias := c.QueryParam("cluster"); alias != "" {
+		h.setOIDCCookie(c, oidcClusterCookie, alias, oidcFlowTimeout)
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
 }
 
 // CallbackOIDC handles the OIDC callback
 func (h *AuthHandler) CallbackOIDC(c echo.Context) error {
-	// TODO: Exchange code for token, assume role with MinIO, set cookie
-	return echo.NewHTTPError(http.StatusNotImplemented, "OIDC Callback not implemented")
+	if h.oidc == nil {
+		return c.Redirect(http.StatusSeeOther, utils.URL(c, "/login"))
+	}
+
+	stateCookie, stateErr := c.Cookie(oidcStateCookie)
+	verifierCookie, verifierErr := c.Cookie(oidcVerifierCookie)
+	var alias string
+	if clusterCookie, err := c.Cookie(oidcClusterCookie); err == nil {
+		alias = clusterCookie.Value
+	}
+	// The flow cookies are single-use
+	h.setOIDCCookie(c, oidcStateCookie, "", -1)
+	h.setOIDCCookie(c, oidcVerifierCookie, "", -1)
+	h.setOIDCCookie(c, oidcClusterCookie, "", -1)
+
+	if idpErr := c.QueryParam("error"); idpErr != "" {
+		log.Printf("OIDC: provider returned error: %s", idpErr)
+		return h.renderLogin(c, "Sign-in was cancelled or rejected by the identity provider")
+	}
+
+	state := c.QueryParam("state")
+	if stateErr != nil || verifierErr != nil || state == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(stateCookie.Value)) != 1 {
+		return h.renderLogin(c, "Sign-in session expired, please try again")
+	}
+
+	code := c.QueryParam("code")
+	if code == "" {
+		return h.renderLogin(c, "Sign-in failed: missing authorization code")
+	}
+
+	endpoint, ok := h.clusterEndpoint(alias)
+	if !ok {
+		return h.renderLogin(c, "Sign-in failed: unknown cluster")
+	}
+
+	ctx := c.Request().Context()
+	token, err := h.oidc.Exchange(ctx, code, verifierCookie.Value)
+	if err != nil {
+		log.Printf("OIDC: code exchange failed: %v", err)
+		return h.renderLogin(c, "Sign-in failed: could not verify with the identity provider")
+	}
+
+	creds, err := h.sts.AssumeRoleWithWebIdentity(ctx, endpoint, *token, h.oidc.RoleARN())
+	if err != nil {
+		log.Printf("OIDC: AssumeRoleWithWebIdentity failed: %v", err)
+		return h.renderLogin(c, "Sign-in failed: MinIO rejected the identity token")
+	}
+	// The STS access key changes on every sign-in; approvals, roles and the
+	// audit log need the user behind it
+	username, err := token.Username()
+	if err != nil {
+		log.Printf("OIDC: cannot identify the user: %v", err)
+		return h.renderLogin(c, "Sign-in failed: the identity token names no user")
+	}
+	creds.User = username
+
+	if err := startSession(c, h.authService, creds); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create session")
+	}
+
+	// The callback is reached through a cross-site redirect, so the browser
+	// would withhold the SameSite=Strict session cookie on an HTTP redirect.
+	// A same-origin refresh makes the next navigation first-party.
+	return c.HTML(http.StatusOK, `<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0;url=`+utils.URL(c, "/")+`"></head><body></body></html>`)
+}
+
+// setOIDCCookie writes a short-lived flow cookie. It must be SameSite=Lax so
+// that it is sent on the top-level redirect back from the identity provider.
+func (h *AuthHandler) setOIDCCookie(c echo.Context, name, value string, maxAge time.Duration) {
+	cookie := new(http.Cookie)
+	cookie.Name = name
+	cookie.Value = value
+	cookie.Path = utils.URL(c, "/")
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.Secure = utils.IsSecureRequest(c)
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge.Seconds())
+	}
+	c.SetCookie(cookie)
 }
@@ -3,6 +3,8 @@ package handlers
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -121,6 +123,14 @@ func (m *authTestMinioClient) GetBucketReplication(_ context.Context, _ string)
 	panic("unexpected test call")
 }
 
+func (m *authTestMinioClient) GetBucketPolicy(_ context.Context, _ string) (string, error) {
+	panic("unexpected test call")
+}
+
+func (m *authTestMinioClient) SetBucketPolicy(_ context.Context, _, _ string) error {
+	panic("unexpected test call")
+}
+
 func TestLoginSetsSecureCookieOverTLS(t *testing.T) {
 	e := echo.New()
 	form := url.Values{}
@@ -183,3 +193,78 @@ func TestLogoutClearsCookieWithMatchingSecurityAttributes(t *testing.T) {
 	assert.True(t, sessionCookie.Secure)
 	assert.Equal(t, "/", sessionCookie.Path)
 }
+
+func TestLoginStoresOnlyTemporaryCredentials(t *testing.T) {
+	e := echo.New()
+	form := url.Values{}
+	form.Set("accessKey", "admin")
+	form.Set("secretKey", "long-term-secret")
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	sts := &fakeSTSClient{}
+	authService := services.NewAuthService().WithSTS(sts)
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "play.min.io:9000")
+
+	require.NoError(t, handler.Login(c))
+
+	session := findCookie(rec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	creds, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "TEMP-admin-1", creds.AccessKey)
+	assert.NotEqual(t, "long-term-secret", creds.SecretKey)
+	assert.Equal(t, "TEMPTOKEN", creds.SessionToken)
+	assert.NotEmpty(t, creds.KeyRef)
+}
+
+func TestLoginFailsWhenAssumeRoleFails(t *testing.T) {
+	e := echo.New()
+	form := url.Values{}
+	form.Set("accessKey", "admin")
+	form.Set("secretKey", "long-term-secret")
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	authService := services.NewAuthService().WithSTS(&fakeSTSClient{err: errors.New("sts unavailable")})
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "play.min.io:9000")
+
+	require.NoError(t, handler.Login(c))
+
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+	assert.Contains(t, rec.Body.String(), "temporary credentials")
+}
+
+func TestLoginKeepsKeyOfIdentityThatCannotAssumeRole(t *testing.T) {
+	e := echo.New()
+	form := url.Values{}
+	form.Set("accessKey", "svcacct")
+	form.Set("secretKey", "service-secret")
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	denied := fmt.Errorf("%w: access denied", services.ErrAssumeRoleDenied)
+	authService := services.NewAuthService().WithSTS(&fakeSTSClient{err: denied})
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "play.min.io:9000")
+
+	require.NoError(t, handler.Login(c))
+
+	session := findCookie(rec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session, "service accounts should still be able to sign in")
+	sealed, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "svcacct", sealed.AccessKey)
+	assert.Empty(t, sealed.SecretKey, "the cookie must not carry the service account secret")
+	assert.NotEmpty(t, sealed.KeyRef)
+
+	// Requests get the key from the server-side vault
+	creds, err := authService.SessionCredentials(*sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "service-secret", creds.SecretKey)
+}
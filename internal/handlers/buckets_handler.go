@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"archive/zip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,12 +27,27 @@ import (
 
 type BucketsHandler struct {
 	minioFactory services.MinioClientFactory
+	approvals    *services.ApprovalService
+	webhooks     *services.WebhookService
 }
 
 func NewBucketsHandler(minioFactory services.MinioClientFactory) *BucketsHandler {
 	return &BucketsHandler{minioFactory: minioFactory}
 }
 
+// WithApprovals sends bucket and folder deletion through the approval workflow
+// when it protects them
+func (h *BucketsHandler) WithApprovals(approvals *services.ApprovalService) *BucketsHandler {
+	h.approvals = approvals
+	return h
+}
+
+// WithWebhooks notifies webhooks of bucket changes
+func (h *BucketsHandler) WithWebhooks(webhooks *services.WebhookService) *BucketsHandler {
+	h.webhooks = webhooks
+	return h
+}
+
 // canonicalJSON re-serializes JSON to a canonical form (sorted keys, no extra whitespace).
 func canonicalJSON(raw string) string {
 	var obj interface{}
@@ -69,6 +85,56 @@ func detectPolicyType(policyJSON string, bucketName string) string {
 	return "custom"
 }
 
+// policyIsPublic reports whether a bucket policy allows anonymous access,
+// that is, has an Allow statement for the "*" principal
+func policyIsPublic(policyJSON string) bool {
+	var policy struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return false
+	}
+	type statement struct {
+		Effect    string
+		Principal json.RawMessage
+	}
+	var statements []statement
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var single statement
+		if err := json.Unmarshal(policy.Statement, &single); err != nil {
+			return false
+		}
+		statements = []statement{single}
+	}
+	for _, st := range statements {
+		if st.Effect != "Allow" {
+			continue
+		}
+		var principal interface{}
+		if err := json.Unmarshal(st.Principal, &principal); err != nil {
+			continue
+		}
+		if principal == "*" {
+			return true
+		}
+		if aws, ok := principal.(map[string]interface{}); ok {
+			switch v := aws["AWS"].(type) {
+			case string:
+				if v == "*" {
+					return true
+				}
+			case []interface{}:
+				for _, p := range v {
+					if p == "*" {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
 // ListBuckets renders the buckets page
 func (h *BucketsHandler) ListBuckets(c echo.Context) error {
 	creds, err := GetCredentialsOrRedirect(c)
@@ -100,6 +166,7 @@ func (h *BucketsHandler) ListBuckets(c echo.Context) error {
 		Size          uint64
 		FormattedSize string
 		PolicyType    string
+		CanWrite      bool
 	}
 
 	// Fetch bucket policies concurrently
@@ -119,6 +186,8 @@ func (h *BucketsHandler) ListBuckets(c echo.Context) error {
 	}
 	wg.Wait()
 
+	can := permissions(c)
+	manage := role(c).Allows(services.CapabilityBucketsManage)
 	bucketsWithStats := make([]BucketWithStats, len(buckets))
 	for i, b := range buckets {
 		size := uint64(0)
@@ -130,12 +199,14 @@ func (h *BucketsHandler) ListBuckets(c echo.Context) error {
 			Size:          size,
 			FormattedSize: utils.FormatBytes(size),
 			PolicyType:    policyTypes[i],
+			CanWrite:      can.Write(b.Name) && manage,
 		}
 	}
 
 	return c.Render(http.StatusOK, "buckets", map[string]interface{}{
-		"ActiveNav": "buckets",
-		"Buckets":   bucketsWithStats,
+		"ActiveNav":       "buckets",
+		"Buckets":         bucketsWithStats,
+		"CanCreateBucket": can.CreateBucket() && manage,
 	})
 }
 
@@ -153,6 +224,12 @@ func (h *BucketsHandler) CreateBucket(c echo.Context) error {
 		})
 	}
 
+	if !permissions(c).CreateBucket() {
+		return c.Render(http.StatusForbidden, "bucket_create_modal", map[string]interface{}{
+			"Error": "You do not have permission to create buckets",
+		})
+	}
+
 	bucketName := c.FormValue("bucketName")
 
 	// Validate bucket name
@@ -184,6 +261,7 @@ func (h *BucketsHandler) CreateBucket(c echo.Context) error {
 			"Error": "Failed to create bucket: " + err.Error(),
 		})
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookBucketCreated, *creds, map[string]string{"bucket": bucketName, "region": region}))
 
 	// Success - close modal and refresh page
 	return HTMXRedirect(c, "/buckets")
@@ -197,17 +275,32 @@ func (h *BucketsHandler) DeleteBucket(c echo.Context) error {
 	}
 
 	bucketName := c.FormValue("bucketName")
+	if err := requirePermission(permissions(c).Write(bucketName), "You do not have permission to delete this bucket"); err != nil {
+		return err
+	}
 
-	client, err := h.minioFactory.NewClient(*creds)
+	if h.approvals.Required(services.ApprovalDeleteBucket) {
+		return submitForApproval(c, h.approvals, *creds, services.ApprovalDeleteBucket,
+			map[string]string{"bucket": bucketName}, "Delete bucket "+bucketName)
+	}
+	if err := h.deleteBucket(c.Request().Context(), *creds, bucketName); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *BucketsHandler) deleteBucket(ctx context.Context, creds services.Credentials, bucketName string) error {
+	client, err := h.minioFactory.NewClient(creds)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
 	}
 
-	if err := client.RemoveBucket(c.Request().Context(), bucketName); err != nil {
+	if err := client.RemoveBucket(ctx, bucketName); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete bucket")
 	}
-
-	return c.NoContent(http.StatusOK)
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookBucketDeleted, creds, map[string]string{"bucket": bucketName}))
+	return nil
 }
 
 // BrowseBucket renders the object browser with folder support and pagination
@@ -218,6 +311,10 @@ func (h *BucketsHandler) BrowseBucket(c echo.Context) error {
 	}
 
 	bucketName := c.Param("bucketName")
+	if err := requirePermission(permissions(c).Read(bucketName), "You do not have access to this bucket"); err != nil {
+		return err
+	}
+
 	prefix := c.QueryParam("prefix")
 	continuationToken := c.QueryParam("continuation")
 
@@ -296,11 +393,10 @@ func (h *BucketsHandler) BrowseBucket(c echo.Context) error {
 	}
 
 	// Construct MinIO endpoint base URL
-	scheme := "https"
-	if !services.ShouldUseSSL(creds.Endpoint) {
-		scheme = "http"
+	endpointURL := "https://" + creds.Endpoint
+	if cluster, ok := utils.LayoutValues(c)["Cluster"].(services.Cluster); ok {
+		endpointURL = cluster.BaseURL()
 	}
-	endpointURL := scheme + "://" + creds.Endpoint
 
 	// Fetch bucket policy
 	policy, _ := client.GetBucketPolicy(c.Request().Context(), bucketName)
@@ -333,6 +429,7 @@ func (h *BucketsHandler) BrowseBucket(c echo.Context) error {
 		"FormattedPolicy":       formattedPolicy,
 		"HasPolicy":             policy != "",
 		"EndpointURL":           endpointURL,
+		"CanWrite":              permissions(c).Write(bucketName) && role(c).Allows(services.CapabilityObjectsWrite),
 	})
 }
 
@@ -344,6 +441,10 @@ func (h *BucketsHandler) UploadObject(c echo.Context) error {
 	}
 
 	bucketName := c.Param("bucketName")
+	if err := requirePermission(permissions(c).Write(bucketName), "You have read-only access to this bucket"); err != nil {
+		return err
+	}
+
 	prefix := c.QueryParam("prefix")
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -386,6 +487,10 @@ func (h *BucketsHandler) DeleteObject(c echo.Context) error {
 	}
 
 	bucketName := c.Param("bucketName")
+	if err := requirePermission(permissions(c).Write(bucketName), "You have read-only access to this bucket"); err != nil {
+		return err
+	}
+
 	objectName := c.QueryParam("key")
 
 	client, err := h.minioFactory.NewClient(*creds)
@@ -451,6 +556,10 @@ func (h *BucketsHandler) CreateFolder(c echo.Context) error {
 	}
 
 	bucketName := c.Param("bucketName")
+	if err := requirePermission(permissions(c).Write(bucketName), "You have read-only access to this bucket"); err != nil {
+		return err
+	}
+
 	prefix := c.QueryParam("prefix")
 	folderName := c.FormValue("folderName")
 
@@ -487,15 +596,31 @@ func (h *BucketsHandler) DeleteFolder(c echo.Context) error {
 	}
 
 	bucketName := c.Param("bucketName")
+	if err := requirePermission(permissions(c).Write(bucketName), "You have read-only access to this bucket"); err != nil {
+		return err
+	}
+
 	prefix := c.QueryParam("prefix")
 
-	client, err := h.minioFactory.NewClient(*creds)
+	if h.approvals.Required(services.ApprovalDeleteFolder) {
+		return submitForApproval(c, h.approvals, *creds, services.ApprovalDeleteFolder,
+			map[string]string{"bucket": bucketName, "prefix": prefix}, "Delete folder "+bucketName+"/"+prefix)
+	}
+	if err := h.deleteFolder(c.Request().Context(), *creds, bucketName, prefix); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *BucketsHandler) deleteFolder(ctx context.Context, creds services.Credentials, bucketName, prefix string) error {
+	client, err := h.minioFactory.NewClient(creds)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
 	}
 
 	// Stream objects and delete one at a time to avoid loading all into memory
-	objectsChan := client.ListObjectsChannel(c.Request().Context(), bucketName, minio.ListObjectsOptions{
+	objectsChan := client.ListObjectsChannel(ctx, bucketName, minio.ListObjectsOptions{
 		Prefix:    prefix,
 		Recursive: true,
 	})
@@ -505,13 +630,12 @@ func (h *BucketsHandler) DeleteFolder(c echo.Context) error {
 		if obj.Err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list objects: "+obj.Err.Error())
 		}
-		err := client.RemoveObject(c.Request().Context(), bucketName, obj.Key, minio.RemoveObjectOptions{})
+		err := client.RemoveObject(ctx, bucketName, obj.Key, minio.RemoveObjectOptions{})
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete object: "+obj.Key)
 		}
 	}
-
-	return c.NoContent(http.StatusOK)
+	return nil
 }
 
 // DownloadZip streams a folder as a ZIP archive using streaming object listing
@@ -1409,6 +1533,11 @@ func (h *BucketsHandler) SetBucketPolicy(c echo.Context) error {
 			"Error":           "Failed to set policy: " + err.Error(),
 		})
 	}
+	event := services.WebhookBucketPolicyChanged
+	if policyIsPublic(policy) {
+		event = services.WebhookBucketPolicyPublic
+	}
+	h.webhooks.Emit(services.NewWebhookEvent(event, *creds, map[string]string{"bucket": bucketName, "policyType": policyType}))
 
 	return HTMXRedirect(c, "/buckets/"+bucketName+"/settings")
 }
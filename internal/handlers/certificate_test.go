@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postCertificateLogin submits the certificate tab over a connection whose
+// client certificate, if any, was verified for name
+func postCertificateLogin(t *testing.T, handler *AuthHandler, name string) *httptest.ResponseRecorder {
+	t.Helper()
+	form := url.Values{}
+	form.Set("mode", "certificate")
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.TLS = &tls.ConnectionState{}
+	if name != "" {
+		req.TLS.VerifiedChains = [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: name}}}}
+	}
+	rec := httptest.NewRecorder()
+	require.NoError(t, handler.Login(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func TestCertificateLoginStoresTemporaryCredentials(t *testing.T) {
+	authService := services.NewAuthService()
+	sts := &fakeSTSClient{}
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithCertificateLogin(services.CertificateConfig{Enabled: true, SessionDuration: 2 * time.Hour}, sts)
+
+	rec := postCertificateLogin(t, handler, "alice")
+
+	assert.Equal(t, "/", rec.Header().Get("HX-Redirect"))
+	assert.Equal(t, "alice", sts.gotName)
+	assert.Equal(t, 2*time.Hour, sts.gotDuration)
+
+	session := findCookie(rec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	creds, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "CERTACCESS", creds.AccessKey)
+	assert.Equal(t, "CERTTOKEN", creds.SessionToken)
+	assert.Equal(t, "alice", creds.Identity())
+}
+
+func TestCertificateLoginNeedsVerifiedCertificate(t *testing.T) {
+	sts := &fakeSTSClient{}
+	handler := NewAuthHandler(services.NewAuthService(), &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithCertificateLogin(services.CertificateConfig{Enabled: true}, sts)
+
+	rec := postCertificateLogin(t, handler, "")
+
+	assert.Contains(t, rec.Body.String(), "no verified client certificate")
+	assert.Empty(t, sts.gotName, "MinIO must not be asked without a certificate")
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+}
+
+func TestCertificateLoginRejectedByMinIO(t *testing.T) {
+	handler := NewAuthHandler(services.NewAuthService(), &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithCertificateLogin(services.CertificateConfig{Enabled: true}, &fakeSTSClient{err: services.ErrAssumeRoleDenied})
+
+	rec := postCertificateLogin(t, handler, "alice")
+
+	assert.Empty(t, rec.Header().Get("HX-Redirect"))
+	assert.Contains(t, rec.Body.String(), "not accepted")
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+}
+
+func TestCertificateLoginRejectedWhenDisabled(t *testing.T) {
+	sts := &fakeSTSClient{}
+	handler := NewAuthHandler(services.NewAuthService(), &authTestFactory{client: &authTestMinioClient{}}, "minio:9000")
+	handler.sts = sts
+
+	rec := postCertificateLogin(t, handler, "alice")
+
+	assert.Contains(t, rec.Body.String(), "not enabled")
+	assert.Empty(t, sts.gotName)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clusterTestFactory accepts keys only on the endpoints listed in valid
+type clusterTestFactory struct {
+	authTestFactory
+	valid map[string]bool
+}
+
+func (f *clusterTestFactory) NewClient(creds services.Credentials) (services.MinioClient, error) {
+	if !f.valid[creds.Endpoint] {
+		return &rejectingMinioClient{}, nil
+	}
+	return &authTestMinioClient{}, nil
+}
+
+type rejectingMinioClient struct {
+	authTestMinioClient
+}
+
+func (m *rejectingMinioClient) ListBuckets(_ context.Context) ([]minio.BucketInfo, error) {
+	return nil, errors.New("access denied")
+}
+
+func newTestClusters(t *testing.T) *services.ClusterRegistry {
+	t.Helper()
+	registry, err := services.NewClusterRegistry([]services.Cluster{
+		{Alias: "prod", URL: "https://minio.example.com"},
+		{Alias: "staging", URL: "http://minio-staging:9000"},
+	})
+	require.NoError(t, err)
+	return registry
+}
+
+func postClusterForm(t *testing.T, handler echo.HandlerFunc, form url.Values, setup func(c echo.Context)) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if setup != nil {
+		setup(c)
+	}
+	require.NoError(t, handler(c))
+	return rec
+}
+
+func TestLoginUsesSelectedCluster(t *testing.T) {
+	authService := services.NewAuthService()
+	factory := &clusterTestFactory{valid: map[string]bool{"minio-staging:9000": true}}
+	handler := NewAuthHandler(authService, factory, "minio.example.com").WithClusters(newTestClusters(t))
+
+	rec := postClusterForm(t, handler.Login, url.Values{
+		"accessKey": {"admin"}, "secretKey": {"secret"}, "cluster": {"staging"},
+	}, nil)
+
+	assert.Equal(t, "/", rec.Header().Get("HX-Redirect"))
+	session := findCookie(rec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	creds, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "minio-staging:9000", creds.Endpoint)
+}
+
+func TestLoginRejectsUnknownCluster(t *testing.T) {
+	factory := &clusterTestFactory{valid: map[string]bool{"attacker:9000": true}}
+	handler := NewAuthHandler(services.NewAuthService(), factory, "minio.example.com").WithClusters(newTestClusters(t))
+
+	rec := postClusterForm(t, handler.Login, url.Values{
+		"accessKey": {"admin"}, "secretKey": {"secret"}, "cluster": {"attacker:9000"},
+	}, nil)
+
+	assert.Contains(t, rec.Body.String(), "Unknown cluster")
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+}
+
+func TestSwitchClusterMovesAccessKeySession(t *testing.T) {
+	authService := services.NewAuthService()
+	factory := &clusterTestFactory{valid: map[string]bool{"minio.example.com": true, "minio-staging:9000": true}}
+	handler := NewAuthHandler(authService, factory, "minio.example.com").WithClusters(newTestClusters(t))
+	current := &services.Credentials{Endpoint: "minio.example.com", AccessKey: "admin", SecretKey: "secret", User: "admin"}
+
+	rec := postClusterForm(t, handler.SwitchCluster, url.Values{"cluster": {"staging"}}, func(c echo.Context) {
+		c.Set(utils.ContextKeyCreds, current)
+	})
+
+	assert.Equal(t, "/", rec.Header().Get("HX-Redirect"))
+	session := findCookie(rec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	creds, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "minio-staging:9000", creds.Endpoint)
+	assert.Equal(t, "admin", creds.User)
+}
+
+func TestSwitchClusterAsksForSignInWhenKeyIsRejected(t *testing.T) {
+	factory := &clusterTestFactory{valid: map[string]bool{"minio.example.com": true}}
+	handler := NewAuthHandler(services.NewAuthService(), factory, "minio.example.com").WithClusters(newTestClusters(t))
+	current := &services.Credentials{Endpoint: "minio.example.com", AccessKey: "admin", SecretKey: "secret"}
+
+	rec := postClusterForm(t, handler.SwitchCluster, url.Values{"cluster": {"staging"}}, func(c echo.Context) {
+		c.Set(utils.ContextKeyCreds, current)
+	})
+
+	assert.Equal(t, "/login?cluster=staging", rec.Header().Get("HX-Redirect"))
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName), "the current session must be kept")
+}
+
+func TestSwitchClusterAsksForSignInForSingleSignOn(t *testing.T) {
+	factory := &clusterTestFactory{valid: map[string]bool{"minio-staging:9000": true}}
+	handler := NewAuthHandler(services.NewAuthService(), factory, "minio.example.com").WithClusters(newTestClusters(t))
+	current := &services.Credentials{Endpoint: "minio.example.com", AccessKey: "STS", SecretKey: "s", SessionToken: "token"}
+
+	rec := postClusterForm(t, handler.SwitchCluster, url.Values{"cluster": {"staging"}}, func(c echo.Context) {
+		c.Set(utils.ContextKeyCreds, current)
+	})
+
+	assert.Equal(t, "/login?cluster=staging", rec.Header().Get("HX-Redirect"))
+}
+
+func TestSwitchClusterRejectsUnknownCluster(t *testing.T) {
+	handler := NewAuthHandler(services.NewAuthService(), &clusterTestFactory{}, "minio.example.com").WithClusters(newTestClusters(t))
+	req := httptest.NewRequest(http.MethodPost, "/clusters/switch", strings.NewReader("cluster=other"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.Set(utils.ContextKeyCreds, &services.Credentials{Endpoint: "minio.example.com"})
+
+	err := handler.SwitchCluster(c)
+
+	var httpErr *echo.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+}
+
+func TestLoginPageShowsClusterPickerWhenSwitching(t *testing.T) {
+	authService := services.NewAuthService()
+	handler := NewAuthHandler(authService, &clusterTestFactory{}, "minio.example.com").WithClusters(newTestClusters(t))
+	value, _, err := authService.CreateSession(services.Credentials{Endpoint: "minio.example.com", AccessKey: "admin", SecretKey: "secret"}, services.SessionClient{})
+	require.NoError(t, err)
+
+	e := echo.New()
+	renderer := &capturingRenderer{}
+	e.Renderer = renderer
+
+	// Without a target cluster a signed-in user goes straight to the dashboard
+	req := httptest.NewRequest(http.MethodGet, "/login", nil)
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: value})
+	rec := httptest.NewRecorder()
+	require.NoError(t, handler.LoginPage(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/login?cluster=staging", nil)
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: value})
+	rec = httptest.NewRecorder()
+	require.NoError(t, handler.LoginPage(e.NewContext(req, rec)))
+
+	assert.Equal(t, "login", renderer.name)
+	data := renderer.data.(map[string]interface{})
+	assert.Equal(t, "staging", data["SelectedCluster"])
+	assert.Len(t, data["Clusters"], 2)
+}
@@ -23,6 +23,10 @@ func (h *DrivesHandler) ListDrives(c echo.Context) error {
 		return err
 	}
 
+	if err := requirePermission(permissions(c).Admin(), "Drive information requires admin permissions"); err != nil {
+		return err
+	}
+
 	// Connect to MinIO Admin
 	mdm, err := h.minioFactory.NewAdminClient(*creds)
 	if err != nil {
@@ -11,12 +11,19 @@ import (
 
 type GroupsHandler struct {
 	minioFactory services.MinioClientFactory
+	webhooks     *services.WebhookService
 }
 
 func NewGroupsHandler(minioFactory services.MinioClientFactory) *GroupsHandler {
 	return &GroupsHandler{minioFactory: minioFactory}
 }
 
+// WithWebhooks notifies webhooks of group changes
+func (h *GroupsHandler) WithWebhooks(webhooks *services.WebhookService) *GroupsHandler {
+	h.webhooks = webhooks
+	return h
+}
+
 // GroupInfo holds group data for templates
 type GroupInfo struct {
 	Name        string
@@ -33,6 +40,10 @@ func (h *GroupsHandler) ListGroups(c echo.Context) error {
 		return err
 	}
 
+	if err := requirePermission(permissions(c).Allowed("admin:ListGroups"), "You do not have permission to manage groups"); err != nil {
+		return err
+	}
+
 	mdm, err := h.minioFactory.NewAdminClient(*creds)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
@@ -153,6 +164,9 @@ func (h *GroupsHandler) CreateGroup(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Group created but failed to assign policy: "+err.Error())
 		}
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookGroupCreated, *creds, map[string]string{
+		"group": groupName, "members": strings.Join(members, ","), "policy": policy,
+	}))
 
 	return HTMXRedirect(c, "/groups")
 }
@@ -247,6 +261,9 @@ func (h *GroupsHandler) AddMembers(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to add members: "+err.Error())
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookGroupMembersAdded, *creds, map[string]string{
+		"group": groupName, "members": strings.Join(members, ","),
+	}))
 
 	return HTMXRedirect(c, "/groups/"+groupName)
 }
@@ -283,6 +300,9 @@ func (h *GroupsHandler) RemoveMembers(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to remove members: "+err.Error())
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookGroupMembersRemoved, *creds, map[string]string{
+		"group": groupName, "members": strings.Join(members, ","),
+	}))
 
 	return HTMXRedirect(c, "/groups/"+groupName)
 }
@@ -304,6 +324,7 @@ func (h *GroupsHandler) DisableGroup(c echo.Context) error {
 	if err := mdm.SetGroupStatus(c.Request().Context(), groupName, madmin.GroupDisabled); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to disable group")
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookGroupDisabled, *creds, map[string]string{"group": groupName}))
 
 	return HTMXRedirect(c, "/groups")
 }
@@ -325,6 +346,7 @@ func (h *GroupsHandler) EnableGroup(c echo.Context) error {
 	if err := mdm.SetGroupStatus(c.Request().Context(), groupName, madmin.GroupEnabled); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to enable group")
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookGroupEnabled, *creds, map[string]string{"group": groupName}))
 
 	return HTMXRedirect(c, "/groups")
 }
@@ -352,6 +374,7 @@ func (h *GroupsHandler) AttachPolicy(c echo.Context) error {
 	if err := mdm.SetPolicy(c.Request().Context(), policy, groupName, true); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to attach policy: "+err.Error())
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookGroupPolicyChanged, *creds, map[string]string{"group": groupName, "policy": policy}))
 
 	return HTMXRedirect(c, "/groups/"+groupName)
 }
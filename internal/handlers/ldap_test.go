@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postLDAPLogin(t *testing.T, handler *AuthHandler, username, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	form := url.Values{}
+	form.Set("mode", "ldap")
+	form.Set("username", username)
+	form.Set("password", password)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	require.NoError(t, handler.Login(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func TestLDAPLoginStoresTemporaryCredentials(t *testing.T) {
+	authService := services.NewAuthService()
+	sts := &fakeSTSClient{}
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithLDAP(services.LDAPConfig{Enabled: true, SessionDuration: 2 * time.Hour}, sts)
+
+	rec := postLDAPLogin(t, handler, "alice", "correct-password")
+
+	assert.Equal(t, "/", rec.Header().Get("HX-Redirect"))
+	assert.Equal(t, "alice", sts.gotUsername)
+	assert.Equal(t, 2*time.Hour, sts.gotDuration)
+
+	session := findCookie(rec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	creds, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "LDAPACCESS", creds.AccessKey)
+	assert.Equal(t, "LDAPTOKEN", creds.SessionToken)
+	assert.False(t, creds.Expiration.IsZero())
+}
+
+func TestLDAPLoginRejectsBadPassword(t *testing.T) {
+	handler := NewAuthHandler(services.NewAuthService(), &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithLDAP(services.LDAPConfig{Enabled: true}, &fakeSTSClient{})
+
+	rec := postLDAPLogin(t, handler, "alice", "wrong")
+
+	assert.Empty(t, rec.Header().Get("HX-Redirect"))
+	assert.Contains(t, rec.Body.String(), "Invalid Username or Password")
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+}
+
+func TestLDAPLoginRejectedWhenDisabled(t *testing.T) {
+	sts := &fakeSTSClient{}
+	handler := NewAuthHandler(services.NewAuthService(), &authTestFactory{client: &authTestMinioClient{}}, "minio:9000")
+	handler.sts = sts
+
+	rec := postLDAPLogin(t, handler, "alice", "correct-password")
+
+	assert.Contains(t, rec.Body.String(), "not enabled")
+	assert.Empty(t, sts.gotUsername)
+}
+
+func TestLoginIsThrottledAfterFailure(t *testing.T) {
+	sts := &fakeSTSClient{}
+	limiter := services.NewLoginLimiter(services.DefaultLoginLimitConfig(), services.NewMemoryLoginAttemptStore())
+	handler := NewAuthHandler(services.NewAuthService(), &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithLDAP(services.LDAPConfig{Enabled: true}, sts).
+		WithLoginLimiter(limiter)
+
+	rec := postLDAPLogin(t, handler, "alice", "wrong")
+	assert.Contains(t, rec.Body.String(), "Invalid Username or Password")
+
+	sts.gotUsername = ""
+	rec = postLDAPLogin(t, handler, "alice", "correct-password")
+	assert.Contains(t, rec.Body.String(), "Too many failed attempts")
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Empty(t, sts.gotUsername, "a throttled attempt must not reach MinIO")
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// MFAHandler serves the TOTP second factor: the code prompt at login,
+// enrollment, and the settings page where admins can reset other users
+type MFAHandler struct {
+	authService  *services.AuthService
+	minioFactory services.MinioClientFactory
+	totp         *services.TOTPService
+	mode         services.TOTPMode
+	limiter      *services.LoginLimiter
+}
+
+func NewMFAHandler(authService *services.AuthService, minioFactory services.MinioClientFactory, totp *services.TOTPService, mode services.TOTPMode) *MFAHandler {
+	return &MFAHandler{
+		authService:  authService,
+		minioFactory: minioFactory,
+		totp:         totp,
+		mode:         mode,
+	}
+}
+
+// WithLoginLimiter throttles repeated wrong codes
+func (h *MFAHandler) WithLoginLimiter(limiter *services.LoginLimiter) *MFAHandler {
+	h.limiter = limiter
+	return h
+}
+
+// pendingLogin returns the login waiting for its second factor
+func (h *MFAHandler) pendingLogin(c echo.Context) (services.Credentials, bool) {
+	cookie, err := c.Cookie(utils.PendingLoginCookieName)
+	if err != nil {
+		return services.Credentials{}, false
+	}
+	creds, err := h.authService.OpenPendingLogin(cookie.Value)
+	if err != nil {
+		utils.ClearPendingLoginCookie(c)
+		return services.Credentials{}, false
+	}
+	return creds, true
+}
+
+// ChallengePage asks for the one-time code
+func (h *MFAHandler) ChallengePage(c echo.Context) error {
+	if _, ok := h.pendingLogin(c); !ok {
+		return c.Redirect(http.StatusSeeOther, utils.URL(c, "/login"))
+	}
+	return c.Render(http.StatusOK, "login_mfa", map[string]interface{}{})
+}
+
+// Challenge verifies the one-time code or a recovery code and creates the session
+func (h *MFAHandler) Challenge(c echo.Context) error {
+	creds, ok := h.pendingLogin(c)
+	if !ok {
+		return HTMXRedirect(c, "/login")
+	}
+	user := creds.Identity()
+
+	limiterKey := "totp:" + user
+	if blocked, err := checkLoginLimit(c, h.limiter, limiterKey); blocked {
+		return err
+	}
+
+	usedRecovery, err := h.totp.Verify(user, c.FormValue("code"))
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidTOTPCode) {
+			log.Printf("MFA: verification failed for %q: %v", user, err)
+		}
+		loginFailed(c, h.limiter, limiterKey)
+		return loginError(c, "Invalid verification code")
+	}
+	loginSucceeded(c, h.limiter, limiterKey)
+	if usedRecovery {
+		log.Printf("MFA: %q signed in with a recovery code", user)
+	}
+
+	utils.ClearPendingLoginCookie(c)
+	if err := startSession(c, h.authService, creds); err != nil {
+		return c.HTML(http.StatusInternalServerError, "Failed to create session")
+	}
+	return HTMXRedirect(c, "/")
+}
+
+// EnrollPage shows a new secret to users who must enroll before signing in
+func (h *MFAHandler) EnrollPage(c echo.Context) error {
+	creds, ok := h.pendingLogin(c)
+	if !ok {
+		return c.Redirect(http.StatusSeeOther, utils.URL(c, "/login"))
+	}
+	if enrolled, _ := h.totp.Enrolled(creds.Identity()); enrolled {
+		return c.Redirect(http.StatusSeeOther, utils.URL(c, "/login/mfa"))
+	}
+
+	data, err := h.enrollmentData(creds.Identity())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate secret")
+	}
+	return c.Render(http.StatusOK, "login_mfa_enroll", data)
+}
+
+// Enroll confirms the new secret, creates the session and shows the recovery codes
+func (h *MFAHandler) Enroll(c echo.Context) error {
+	creds, ok := h.pendingLogin(c)
+	if !ok {
+		return HTMXRedirect(c, "/login")
+	}
+	user := creds.Identity()
+	if enrolled, _ := h.totp.Enrolled(user); enrolled {
+		// Enrolling again here would let a password alone replace the second factor
+		return HTMXRedirect(c, "/login/mfa")
+	}
+
+	codes, err := h.totp.Enroll(user, c.FormValue("secret"), c.FormValue("code"))
+	if err != nil {
+		return loginError(c, "Invalid verification code")
+	}
+
+	utils.ClearPendingLoginCookie(c)
+	if err := startSession(c, h.authService, creds); err != nil {
+		return c.HTML(http.StatusInternalServerError, "Failed to create session")
+	}
+	// Errors go to the error box; the recovery codes replace the enrollment form
+	c.Response().Header().Set("HX-Retarget", "#mfa-enroll")
+	return c.Render(http.StatusOK, "mfa_recovery_codes", map[string]interface{}{
+		"Codes":    codes,
+		"Continue": "/",
+	})
+}
+
+// enrollmentData generates a secret and the QR code for it
+func (h *MFAHandler) enrollmentData(user string) (map[string]interface{}, error) {
+	secret, err := h.totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	png, err := h.totp.QRCode(user, secret)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"User":   user,
+		"Secret": secret,
+		// The image is generated here, so it is safe to mark the data URL as trusted
+		"QRCode": template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)),
+	}, nil
+}
+
+// Settings shows the current user's second factor, and every enrollment to admins
+func (h *MFAHandler) Settings(c echo.Context) error {
+	creds, err := GetCredentials(c)
+	if err != nil {
+		return err
+	}
+	user := creds.Identity()
+
+	data := map[string]interface{}{
+		"ActiveNav":  "settings",
+		"Mode":       string(h.mode),
+		"CanDisable": h.mode != services.TOTPRequired,
+		// Single sign-on sessions have no stable name to enroll under
+		"Managed": creds.User == "",
+	}
+
+	enrolled, err := h.totp.Enrolled(user)
+	if err != nil {
+		data["Error"] = "Failed to load second factor"
+	}
+	data["Enrolled"] = enrolled
+	if enrolled {
+		data["RecoveryCodesLeft"], _ = h.totp.RecoveryCodesLeft(user)
+	} else if creds.User != "" {
+		enrollment, err := h.enrollmentData(user)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate secret")
+		}
+		for key, value := range enrollment {
+			data[key] = value
+		}
+	}
+
+	if requireAdmin(c, h.minioFactory) == nil {
+		data["IsAdmin"] = true
+		if enrollments, err := h.totp.List(); err == nil {
+			data["Enrollments"] = enrollments
+		}
+	}
+
+	return c.Render(http.StatusOK, "mfa", data)
+}
+
+// SettingsEnroll enrolls the signed-in user
+func (h *MFAHandler) SettingsEnroll(c echo.Context) error {
+	creds, err := GetCredentials(c)
+	if err != nil {
+		return err
+	}
+	user := creds.Identity()
+
+	if creds.User == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Single sign-on accounts use their identity provider's second factor")
+	}
+	if enrolled, _ := h.totp.Enrolled(user); enrolled {
+		return formError(c, "A second factor is already enrolled")
+	}
+
+	codes, err := h.totp.Enroll(user, c.FormValue("secret"), c.FormValue("code"))
+	if err != nil {
+		return formError(c, "Invalid verification code")
+	}
+	c.Response().Header().Set("HX-Retarget", "#mfa-enroll")
+	return c.Render(http.StatusOK, "mfa_recovery_codes", map[string]interface{}{
+		"Codes":    codes,
+		"Continue": "/settings/mfa",
+	})
+}
+
+// Disable removes the signed-in user's second factor after checking a current code
+func (h *MFAHandler) Disable(c echo.Context) error {
+	if h.mode == services.TOTPRequired {
+		return echo.NewHTTPError(http.StatusForbidden, "A second factor is required")
+	}
+	creds, err := GetCredentials(c)
+	if err != nil {
+		return err
+	}
+	user := creds.Identity()
+
+	if _, err := h.totp.Verify(user, c.FormValue("code")); err != nil {
+		return formError(c, "Invalid verification code")
+	}
+	if err := h.totp.Reset(user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to remove second factor")
+	}
+	return HTMXRedirect(c, "/settings/mfa")
+}
+
+// Reset removes another user's second factor, for example after a lost phone
+func (h *MFAHandler) Reset(c echo.Context) error {
+	if err := requireAdmin(c, h.minioFactory); err != nil {
+		return err
+	}
+	admin, err := GetCredentials(c)
+	if err != nil {
+		return err
+	}
+
+	user := c.FormValue("user")
+	if user == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "User is required")
+	}
+	if err := h.totp.Reset(user); err != nil {
+		if errors.Is(err, services.ErrTOTPNotEnrolled) {
+			return echo.NewHTTPError(http.StatusNotFound, "User has no second factor")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to reset second factor")
+	}
+	log.Printf("MFA: second factor for %q reset by %q", user, admin.Identity())
+
+	return HTMXRedirect(c, "/settings/mfa")
+}
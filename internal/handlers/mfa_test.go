@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMFATestServer(t *testing.T, mode services.TOTPMode) (*echo.Echo, *services.AuthService, *services.TOTPService, *capturingRenderer) {
+	t.Helper()
+	authService := services.NewAuthService()
+	totp := services.NewTOTPService(services.NewMemoryTOTPStore(), authService.Keyring(), "IronBuckets")
+	authHandler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithTOTP(totp, mode)
+	mfaHandler := NewMFAHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, totp, mode)
+
+	e := echo.New()
+	renderer := &capturingRenderer{}
+	e.Renderer = renderer
+	e.POST("/login", authHandler.Login)
+	e.GET("/login/mfa", mfaHandler.ChallengePage)
+	e.POST("/login/mfa", mfaHandler.Challenge)
+	e.GET("/login/mfa/enroll", mfaHandler.EnrollPage)
+	e.POST("/login/mfa/enroll", mfaHandler.Enroll)
+	return e, authService, totp, renderer
+}
+
+func postForm(e *echo.Echo, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginAsksEnrolledUserForCode(t *testing.T) {
+	e, authService, totp, _ := newMFATestServer(t, services.TOTPOptional)
+	secret, _ := totp.NewSecret()
+	code, _ := services.TOTPCode(secret, time.Now())
+	_, err := totp.Enroll("admin", secret, code)
+	require.NoError(t, err)
+
+	// Step 1: the password is accepted but no session is created yet
+	rec := postForm(e, "/login", url.Values{"accessKey": {"admin"}, "secretKey": {"password"}})
+	assert.Equal(t, "/login/mfa", rec.Header().Get("HX-Redirect"))
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+	pending := findCookie(rec.Result().Cookies(), utils.PendingLoginCookieName)
+	require.NotNil(t, pending)
+	assert.Equal(t, "/login", pending.Path)
+	assert.True(t, pending.HttpOnly)
+
+	// Step 2: a wrong code is rejected
+	rec = postForm(e, "/login/mfa", url.Values{"code": {"000000"}}, pending)
+	assert.Contains(t, rec.Body.String(), "Invalid verification code")
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+
+	// Step 3: the next code from the app completes the login
+	next, _ := services.TOTPCode(secret, time.Now().Add(30*time.Second))
+	rec = postForm(e, "/login/mfa", url.Values{"code": {next}}, pending)
+	assert.Equal(t, "/", rec.Header().Get("HX-Redirect"))
+	session := findCookie(rec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	state, err := authService.OpenSession(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", state.Identity())
+}
+
+func TestLDAPCaseVariantIsAskedForCode(t *testing.T) {
+	authService := services.NewAuthService()
+	totp := services.NewTOTPService(services.NewMemoryTOTPStore(), authService.Keyring(), "IronBuckets")
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithLDAP(services.LDAPConfig{Enabled: true}, &fakeSTSClient{}).
+		WithTOTP(totp, services.TOTPOptional)
+
+	secret, _ := totp.NewSecret()
+	code, _ := services.TOTPCode(secret, time.Now())
+	_, err := totp.Enroll("alice", secret, code)
+	require.NoError(t, err)
+
+	// The directory accepts any spelling of the name, so each must reach the code step
+	for _, username := range []string{"alice", "ALICE", " Alice "} {
+		rec := postLDAPLogin(t, handler, username, "correct-password")
+		assert.Equal(t, "/login/mfa", rec.Header().Get("HX-Redirect"), "username %q", username)
+		assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName), "username %q", username)
+	}
+}
+
+func TestCodeStepRequiresPendingLogin(t *testing.T) {
+	e, _, _, _ := newMFATestServer(t, services.TOTPOptional)
+
+	rec := postForm(e, "/login/mfa", url.Values{"code": {"123456"}})
+	assert.Equal(t, "/login", rec.Header().Get("HX-Redirect"))
+
+	forged := &http.Cookie{Name: utils.PendingLoginCookieName, Value: "forged"}
+	rec = postForm(e, "/login/mfa", url.Values{"code": {"123456"}}, forged)
+	assert.Equal(t, "/login", rec.Header().Get("HX-Redirect"))
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+}
+
+func TestRequiredModeEnrollsBeforeSignIn(t *testing.T) {
+	e, _, totp, renderer := newMFATestServer(t, services.TOTPRequired)
+
+	rec := postForm(e, "/login", url.Values{"accessKey": {"alice"}, "secretKey": {"password"}})
+	assert.Equal(t, "/login/mfa/enroll", rec.Header().Get("HX-Redirect"))
+	pending := findCookie(rec.Result().Cookies(), utils.PendingLoginCookieName)
+	require.NotNil(t, pending)
+
+	req := httptest.NewRequest(http.MethodGet, "/login/mfa/enroll", nil)
+	req.AddCookie(pending)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, "login_mfa_enroll", renderer.name)
+	data := renderer.data.(map[string]interface{})
+	secret := data["Secret"].(string)
+	assert.Contains(t, string(data["QRCode"].(template.URL)), "data:image/png;base64,")
+
+	code, _ := services.TOTPCode(secret, time.Now())
+	rec = postForm(e, "/login/mfa/enroll", url.Values{"secret": {secret}, "code": {code}}, pending)
+	assert.Equal(t, "#mfa-enroll", rec.Header().Get("HX-Retarget"))
+	assert.Equal(t, "mfa_recovery_codes", renderer.name)
+	assert.Len(t, renderer.data.(map[string]interface{})["Codes"], 10)
+	assert.NotNil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+
+	enrolled, _ := totp.Enrolled("alice")
+	assert.True(t, enrolled)
+}
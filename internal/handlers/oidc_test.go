@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockIDToken is an unsigned ID token for "alice"; MinIO verifies real ones
+var mockIDToken = "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"4f1d","preferred_username":"alice"}`)) + ".sig"
+
+// mockIssuer is a minimal OpenID Connect provider that remembers the PKCE
+// challenge of the last authorization request and checks it on exchange.
+type mockIssuer struct {
+	server    *httptest.Server
+	challenge string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	issuer := &mockIssuer{}
+	mux := http.NewServeMux()
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("code") != "good-code" ||
+			services.PKCEChallenge(r.PostForm.Get("code_verifier")) != issuer.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"id_token":     mockIDToken,
+			"access_token": "mock-access-token",
+		})
+	})
+	return issuer
+}
+
+type fakeSTSClient struct {
+	gotToken      services.OIDCToken
+	gotUsername   string
+	gotName       string
+	gotDuration   time.Duration
+	assumeRoles   int
+	webIdentities int
+	err           error
+}
+
+func (f *fakeSTSClient) AssumeRoleWithWebIdentity(_ context.Context, endpoint string, token services.OIDCToken, _ string) (services.Credentials, error) {
+	f.gotToken = token
+	if f.err != nil {
+		return services.Credentials{}, f.err
+	}
+	f.webIdentities++
+	return services.Credentials{
+		Endpoint:     endpoint,
+		AccessKey:    fmt.Sprintf("STSACCESS%d", f.webIdentities),
+		SecretKey:    "STSSECRET",
+		SessionToken: "STSTOKEN",
+		Expiration:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (f *fakeSTSClient) AssumeRoleWithLDAPIdentity(_ context.Context, endpoint, username, password string, duration time.Duration) (services.Credentials, error) {
+	f.gotUsername = username
+	f.gotDuration = duration
+	if f.err != nil || password != "correct-password" {
+		return services.Credentials{}, errors.New("invalid credentials")
+	}
+	return services.Credentials{
+		Endpoint:     endpoint,
+		AccessKey:    "LDAPACCESS",
+		SecretKey:    "LDAPSECRET",
+		SessionToken: "LDAPTOKEN",
+		Expiration:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (f *fakeSTSClient) AssumeRoleWithCertificate(_ context.Context, endpoint, name string, duration time.Duration) (services.Credentials, error) {
+	f.gotName = name
+	f.gotDuration = duration
+	if f.err != nil {
+		return services.Credentials{}, f.err
+	}
+	return services.Credentials{
+		Endpoint:     endpoint,
+		AccessKey:    "CERTACCESS",
+		SecretKey:    "CERTSECRET",
+		SessionToken: "CERTTOKEN",
+		Expiration:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (f *fakeSTSClient) AssumeRole(_ context.Context, creds services.Credentials, _ time.Duration) (services.Credentials, error) {
+	f.assumeRoles++
+	if f.err != nil {
+		return services.Credentials{}, f.err
+	}
+	return services.Credentials{
+		Endpoint:     creds.Endpoint,
+		AccessKey:    fmt.Sprintf("TEMP-%s-%d", creds.AccessKey, f.assumeRoles),
+		SecretKey:    "TEMPSECRET",
+		SessionToken: "TEMPTOKEN",
+		Expiration:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+type capturingRenderer struct {
+	name string
+	data interface{}
+}
+
+func (r *capturingRenderer) Render(_ io.Writer, name string, data interface{}, _ echo.Context) error {
+	r.name = name
+	r.data = data
+	return nil
+}
+
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func newOIDCTestServer(t *testing.T) (*echo.Echo, *services.AuthService, *mockIssuer, *fakeSTSClient, *capturingRenderer) {
+	issuer := newMockIssuer(t)
+	sts := &fakeSTSClient{}
+	authService := services.NewAuthService()
+	provider := services.NewOIDCProvider(services.OIDCConfig{
+		IssuerURL:   issuer.server.URL,
+		ClientID:    "ironbuckets",
+		RedirectURL: "http://localhost:8080/oauth/callback",
+		Scopes:      []string{"openid"},
+	})
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "minio:9000").
+		WithOIDC(provider, sts)
+
+	e := echo.New()
+	renderer := &capturingRenderer{}
+	e.Renderer = renderer
+	e.GET("/login/oauth", handler.LoginOIDC)
+	e.GET("/oauth/callback", handler.CallbackOIDC)
+	return e, authService, issuer, sts, renderer
+}
+
+func TestOIDCLoginFlowEndToEnd(t *testing.T) {
+	e, authService, issuer, sts, _ := newOIDCTestServer(t)
+
+	// Step 1: start the flow and follow the redirect to the issuer
+	startRec := httptest.NewRecorder()
+	e.ServeHTTP(startRec, httptest.NewRequest(http.MethodGet, "/login/oauth", nil))
+	require.Equal(t, http.StatusFound, startRec.Code)
+
+	authURL, err := url.Parse(startRec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, issuer.server.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	issuer.challenge = authURL.Query().Get("code_challenge")
+	state := authURL.Query().Get("state")
+	require.NotEmpty(t, state)
+
+	stateCookie := findCookie(startRec.Result().Cookies(), oidcStateCookie)
+	verifierCookie := findCookie(startRec.Result().Cookies(), oidcVerifierCookie)
+	require.NotNil(t, stateCookie)
+	require.NotNil(t, verifierCookie)
+	assert.Equal(t, http.SameSiteLaxMode, stateCookie.SameSite)
+	assert.True(t, stateCookie.HttpOnly)
+
+	// Step 2: the issuer redirects back with a code
+	cbReq := httptest.NewRequest(http.MethodGet, "/oauth/callback?code=good-code&state="+url.QueryEscape(state), nil)
+	cbReq.AddCookie(stateCookie)
+	cbReq.AddCookie(verifierCookie)
+	cbRec := httptest.NewRecorder()
+	e.ServeHTTP(cbRec, cbReq)
+
+	require.Equal(t, http.StatusOK, cbRec.Code)
+	assert.Contains(t, cbRec.Body.String(), `http-equiv="refresh"`)
+	assert.Equal(t, mockIDToken, sts.gotToken.IDToken)
+
+	session := findCookie(cbRec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	creds, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	assert.Equal(t, "minio:9000", creds.Endpoint)
+	assert.Equal(t, "STSACCESS1", creds.AccessKey)
+	assert.Equal(t, "alice", creds.Identity())
+	assert.Equal(t, "STSTOKEN", creds.SessionToken)
+	assert.True(t, session.Expires.Before(time.Now().Add(2*time.Hour)), "cookie should not outlive STS credentials")
+}
+
+// oidcSignIn runs the whole SSO flow and returns the session's credentials
+func oidcSignIn(t *testing.T, e *echo.Echo, authService *services.AuthService, issuer *mockIssuer) *services.Credentials {
+	t.Helper()
+	startRec := httptest.NewRecorder()
+	e.ServeHTTP(startRec, httptest.NewRequest(http.MethodGet, "/login/oauth", nil))
+	authURL, err := url.Parse(startRec.Header().Get("Location"))
+	require.NoError(t, err)
+	issuer.challenge = authURL.Query().Get("code_challenge")
+
+	cbReq := httptest.NewRequest(http.MethodGet, "/oauth/callback?code=good-code&state="+url.QueryEscape(authURL.Query().Get("state")), nil)
+	cbReq.AddCookie(findCookie(startRec.Result().Cookies(), oidcStateCookie))
+	cbReq.AddCookie(findCookie(startRec.Result().Cookies(), oidcVerifierCookie))
+	cbRec := httptest.NewRecorder()
+	e.ServeHTTP(cbRec, cbReq)
+
+	session := findCookie(cbRec.Result().Cookies(), utils.CookieName)
+	require.NotNil(t, session)
+	creds, err := authService.DecryptCredentials(session.Value)
+	require.NoError(t, err)
+	return creds
+}
+
+func TestOIDCUserCannotApproveOwnRequestFromNewSession(t *testing.T) {
+	e, authService, issuer, _, _ := newOIDCTestServer(t)
+	approvals := services.NewApprovalService(services.ApprovalConfig{TTL: time.Hour}, services.NewMemoryApprovalStore())
+
+	first := oidcSignIn(t, e, authService, issuer)
+	request, err := approvals.Submit(*first, services.ApprovalDeleteBucket, map[string]string{"bucket": "reports"}, "Delete bucket reports")
+	require.NoError(t, err)
+
+	// Signing out and in again yields new STS keys for the same person
+	second := oidcSignIn(t, e, authService, issuer)
+	require.NotEqual(t, first.AccessKey, second.AccessKey)
+	_, err = approvals.Approve(request.ID, *second)
+	assert.ErrorIs(t, err, services.ErrApprovalSelf)
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	e, _, _, sts, renderer := newOIDCTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/callback?code=good-code&state=forged", nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "expected"})
+	req.AddCookie(&http.Cookie{Name: oidcVerifierCookie, Value: "verifier"})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "login", renderer.name)
+	assert.Nil(t, findCookie(rec.Result().Cookies(), utils.CookieName))
+	assert.Empty(t, sts.gotToken.IDToken, "STS must not be called on state mismatch")
+}
+
+func TestOIDCRoutesRedirectWhenNotConfigured(t *testing.T) {
+	handler := NewAuthHandler(services.NewAuthService(), &authTestFactory{client: &authTestMinioClient{}}, "minio:9000")
+	e := echo.New()
+	e.GET("/login/oauth", handler.LoginOIDC)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login/oauth", nil))
+
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/login", rec.Header().Get("Location"))
+}
@@ -177,3 +177,25 @@ func TestDetectPolicyType(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicyIsPublic(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		expected bool
+	}{
+		{"private", "", false},
+		{"invalid json", "not json", false},
+		{"AWS wildcard list", `{"Statement":[{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"]}]}`, true},
+		{"AWS wildcard string", `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"*"}}]}`, true},
+		{"bare wildcard, single statement", `{"Statement":{"Effect":"Allow","Principal":"*"}}`, true},
+		{"deny only", `{"Statement":[{"Effect":"Deny","Principal":"*"}]}`, false},
+		{"named principal", `{"Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::123:user/alice"]}}]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policyIsPublic(tt.policy))
+		})
+	}
+}
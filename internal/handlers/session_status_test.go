@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sessionStatus(t *testing.T, policy services.SessionPolicy, state *services.SessionState) (*httptest.ResponseRecorder, *capturingRenderer) {
+	t.Helper()
+	authService := services.NewAuthService().WithSessionPolicy(policy)
+	handler := NewAuthHandler(authService, &authTestFactory{client: &authTestMinioClient{}}, "minio:9000")
+
+	e := echo.New()
+	renderer := &capturingRenderer{}
+	e.Renderer = renderer
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/session/status", nil), rec)
+	c.Set(utils.ContextKeySession, state)
+
+	require.NoError(t, handler.SessionStatus(c))
+	return rec, renderer
+}
+
+func TestSessionStatusIsEmptyWhileSessionIsFresh(t *testing.T) {
+	now := time.Now()
+	policy := services.SessionPolicy{IdleTimeout: 15 * time.Minute, MaxLifetime: 12 * time.Hour, WarnBefore: 2 * time.Minute}
+
+	rec, renderer := sessionStatus(t, policy, &services.SessionState{IssuedAt: now, LastSeen: now})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, renderer.name)
+}
+
+func TestSessionStatusWarnsBeforeIdleTimeout(t *testing.T) {
+	now := time.Now()
+	policy := services.SessionPolicy{IdleTimeout: 15 * time.Minute, MaxLifetime: 12 * time.Hour, WarnBefore: 2 * time.Minute}
+
+	_, renderer := sessionStatus(t, policy, &services.SessionState{IssuedAt: now.Add(-time.Hour), LastSeen: now.Add(-14 * time.Minute)})
+
+	assert.Equal(t, "session_warning", renderer.name)
+	data := renderer.data.(map[string]interface{})
+	assert.Equal(t, true, data["CanExtend"])
+	assert.Equal(t, 1, data["Minutes"])
+}
+
+func TestSessionStatusCannotExtendPastAbsoluteLifetime(t *testing.T) {
+	now := time.Now()
+	policy := services.SessionPolicy{IdleTimeout: 15 * time.Minute, MaxLifetime: 12 * time.Hour, WarnBefore: 2 * time.Minute}
+
+	_, renderer := sessionStatus(t, policy, &services.SessionState{IssuedAt: now.Add(-12*time.Hour + time.Minute), LastSeen: now})
+
+	assert.Equal(t, "session_warning", renderer.name)
+	assert.Equal(t, false, renderer.data.(map[string]interface{})["CanExtend"])
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type SessionsHandler struct {
+	authService  *services.AuthService
+	minioFactory services.MinioClientFactory
+}
+
+func NewSessionsHandler(authService *services.AuthService, minioFactory services.MinioClientFactory) *SessionsHandler {
+	return &SessionsHandler{
+		authService:  authService,
+		minioFactory: minioFactory,
+	}
+}
+
+// ListSessions renders the active sessions page
+func (h *SessionsHandler) ListSessions(c echo.Context) error {
+	if err := requireAdmin(c, h.minioFactory); err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"ActiveNav": "settings",
+		"Enabled":   h.authService.HasSessionStore(),
+	}
+
+	sessions, err := h.authService.ListSessions()
+	if err != nil {
+		data["Error"] = "Failed to load sessions"
+	}
+	data["Sessions"] = sessions
+
+	if cookie, err := c.Cookie(utils.CookieName); err == nil {
+		data["CurrentSessionID"] = services.SessionHandle(cookie.Value)
+	}
+
+	return c.Render(http.StatusOK, "sessions", data)
+}
+
+// RevokeSession ends another user's session
+func (h *SessionsHandler) RevokeSession(c echo.Context) error {
+	if err := requireAdmin(c, h.minioFactory); err != nil {
+		return err
+	}
+
+	id := c.FormValue("id")
+	if id == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Session ID is required")
+	}
+
+	if err := h.authService.RevokeSession(id); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Session not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke session")
+	}
+
+	return HTMXRedirect(c, "/settings/sessions")
+}
@@ -1,24 +1,61 @@
 package handlers
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/damacus/iron-buckets/internal/services"
 	"github.com/labstack/echo/v4"
 )
 
 type SettingsHandler struct {
-	minioFactory  services.MinioClientFactory
-	minioEndpoint string
+	minioFactory services.MinioClientFactory
+	totpEnabled  bool
+	apiTokens    bool
+	maintenance  *services.MaintenanceMode
+	approvals    *services.ApprovalService
+	webhooks     *services.WebhookService
 }
 
-func NewSettingsHandler(minioFactory services.MinioClientFactory, minioEndpoint string) *SettingsHandler {
+func NewSettingsHandler(minioFactory services.MinioClientFactory) *SettingsHandler {
 	return &SettingsHandler{
-		minioFactory:  minioFactory,
-		minioEndpoint: minioEndpoint,
+		minioFactory: minioFactory,
 	}
 }
 
+// WithTOTP links the two-factor settings from the settings page
+func (h *SettingsHandler) WithTOTP(enabled bool) *SettingsHandler {
+	h.totpEnabled = enabled
+	return h
+}
+
+// WithAPITokens links the API token page from the settings page
+func (h *SettingsHandler) WithAPITokens(enabled bool) *SettingsHandler {
+	h.apiTokens = enabled
+	return h
+}
+
+// WithMaintenance lets admins turn read-only mode on and off from the settings page
+func (h *SettingsHandler) WithMaintenance(mode *services.MaintenanceMode) *SettingsHandler {
+	h.maintenance = mode
+	return h
+}
+
+// WithApprovals sends restarts through the approval workflow when it protects them
+func (h *SettingsHandler) WithApprovals(approvals *services.ApprovalService) *SettingsHandler {
+	h.approvals = approvals
+	return h
+}
+
+// WithWebhooks notifies webhooks of restarts and links the delivery log from
+// the settings page
+func (h *SettingsHandler) WithWebhooks(webhooks *services.WebhookService) *SettingsHandler {
+	h.webhooks = webhooks
+	return h
+}
+
 // ShowSettings renders the settings page with server information
 func (h *SettingsHandler) ShowSettings(c echo.Context) error {
 	creds, err := GetCredentialsOrRedirect(c)
@@ -31,15 +68,24 @@ func (h *SettingsHandler) ShowSettings(c echo.Context) error {
 	if err != nil {
 		// If we can't connect, show settings page with error
 		return c.Render(http.StatusOK, "settings", map[string]interface{}{
-			"ActiveNav": "settings",
-			"Error":     "Failed to connect to MinIO",
-			"Endpoint":  h.minioEndpoint,
+			"ActiveNav":   "settings",
+			"Error":       "Failed to connect to MinIO",
+			"Endpoint":    creds.Endpoint,
+			"TOTPEnabled": h.totpEnabled,
+			"APITokens":   h.apiTokens,
 		})
 	}
 
 	data := map[string]interface{}{
-		"ActiveNav": "settings",
-		"Endpoint":  h.minioEndpoint,
+		"ActiveNav":   "settings",
+		"Endpoint":    creds.Endpoint,
+		"TOTPEnabled": h.totpEnabled,
+		"APITokens":   h.apiTokens,
+	}
+
+	if !permissions(c).Admin() || !role(c).Allows(services.CapabilityServerView) {
+		data["Error"] = "Server information and actions require admin permissions"
+		return c.Render(http.StatusOK, "settings", data)
 	}
 
 	// Fetch Server Info
@@ -50,6 +96,12 @@ func (h *SettingsHandler) ShowSettings(c echo.Context) error {
 		return c.Render(http.StatusOK, "settings", data)
 	}
 	data["ServerInfo"] = serverInfo
+	data["CanRestart"] = permissions(c).Allowed("admin:ServiceRestart") && role(c).Allows(services.CapabilityServerRestart)
+	data["CanManageSessions"] = role(c).Allows(services.CapabilityIAMManage)
+	data["Webhooks"] = h.webhooks != nil
+	if h.maintenance != nil && role(c).Allows(services.CapabilityServerRestart) {
+		data["ReadOnly"] = h.maintenance.Status()
+	}
 
 	// Fetch Storage Info (DataUsageInfo)
 	storageInfo, err := mdm.DataUsageInfo(c.Request().Context())
@@ -73,16 +125,53 @@ func (h *SettingsHandler) RestartService(c echo.Context) error {
 		return err
 	}
 
-	mdm, err := h.minioFactory.NewAdminClient(*creds)
+	if err := requirePermission(permissions(c).Allowed("admin:ServiceRestart"), "Restarting the server requires admin permissions"); err != nil {
+		return err
+	}
+
+	if h.approvals.Required(services.ApprovalRestartServer) {
+		return submitForApproval(c, h.approvals, *creds, services.ApprovalRestartServer, nil, "Restart MinIO")
+	}
+	if err := h.restartService(c.Request().Context(), *creds); err != nil {
+		return err
+	}
+
+	return HTMXRedirect(c, "/settings")
+}
+
+func (h *SettingsHandler) restartService(ctx context.Context, creds services.Credentials) error {
+	mdm, err := h.minioFactory.NewAdminClient(creds)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
 	}
 
-	// Restart the service
-	if err := mdm.ServiceRestart(c.Request().Context()); err != nil {
+	if err := mdm.ServiceRestart(ctx); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to restart service: "+err.Error())
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookServerRestarted, creds, nil))
+	return nil
+}
 
+// SetMaintenance turns read-only mode on or off
+func (h *SettingsHandler) SetMaintenance(c echo.Context) error {
+	creds, err := GetCredentials(c)
+	if err != nil {
+		return err
+	}
+	if h.maintenance == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Read-only mode is not available")
+	}
+	if err := requireServerAdmin(c, h.minioFactory); err != nil {
+		return err
+	}
+
+	if c.FormValue("enabled") == "true" {
+		h.maintenance.Enable(creds.Identity(), strings.TrimSpace(c.FormValue("message")))
+		log.Printf("Maintenance: read-only mode enabled by %q", creds.Identity())
+	} else {
+		h.maintenance.Disable()
+		log.Printf("Maintenance: read-only mode disabled by %q", creds.Identity())
+	}
 	return HTMXRedirect(c, "/settings")
 }
 
@@ -93,6 +182,10 @@ func (h *SettingsHandler) GetLogs(c echo.Context) error {
 		return err
 	}
 
+	if err := requirePermission(permissions(c).Allowed("admin:ConsoleLog"), "Server logs require admin permissions"); err != nil {
+		return err
+	}
+
 	mdm, err := h.minioFactory.NewAdminClient(*creds)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -11,12 +12,27 @@ import (
 
 type UsersHandler struct {
 	minioFactory services.MinioClientFactory
+	approvals    *services.ApprovalService
+	webhooks     *services.WebhookService
 }
 
 func NewUsersHandler(minioFactory services.MinioClientFactory) *UsersHandler {
 	return &UsersHandler{minioFactory: minioFactory}
 }
 
+// WithApprovals sends user deletion through the approval workflow when it
+// protects it
+func (h *UsersHandler) WithApprovals(approvals *services.ApprovalService) *UsersHandler {
+	h.approvals = approvals
+	return h
+}
+
+// WithWebhooks notifies webhooks of user changes
+func (h *UsersHandler) WithWebhooks(webhooks *services.WebhookService) *UsersHandler {
+	h.webhooks = webhooks
+	return h
+}
+
 // UserWithGroups extends user info with group membership
 type UserWithGroups struct {
 	madmin.UserInfo
@@ -31,6 +47,10 @@ func (h *UsersHandler) ListUsers(c echo.Context) error {
 		return err
 	}
 
+	if err := requirePermission(permissions(c).Allowed("admin:ListUsers"), "You do not have permission to manage users"); err != nil {
+		return err
+	}
+
 	// Connect to MinIO
 	mdm, err := h.minioFactory.NewAdminClient(*creds)
 	if err != nil {
@@ -107,6 +127,7 @@ func (h *UsersHandler) CreateUser(c echo.Context) error {
 			return echo.NewHTTPError(http.StatusInternalServerError, "User created but failed to assign policy: "+err.Error())
 		}
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookUserCreated, *creds, map[string]string{"user": accessKey, "policy": policy}))
 
 	// Use HX-Redirect to close modal and refresh the users page
 	return HTMXRedirect(c, "/users")
@@ -121,16 +142,28 @@ func (h *UsersHandler) DeleteUser(c echo.Context) error {
 
 	accessKey := c.FormValue("accessKey")
 
-	mdm, err := h.minioFactory.NewAdminClient(*creds)
+	if h.approvals.Required(services.ApprovalDeleteUser) {
+		return submitForApproval(c, h.approvals, *creds, services.ApprovalDeleteUser,
+			map[string]string{"accessKey": accessKey}, "Delete user "+accessKey)
+	}
+	if err := h.deleteUser(c.Request().Context(), *creds, accessKey); err != nil {
+		return err
+	}
+
+	return HTMXRedirect(c, "/users")
+}
+
+func (h *UsersHandler) deleteUser(ctx context.Context, creds services.Credentials, accessKey string) error {
+	mdm, err := h.minioFactory.NewAdminClient(creds)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
 	}
 
-	if err := mdm.RemoveUser(c.Request().Context(), accessKey); err != nil {
+	if err := mdm.RemoveUser(ctx, accessKey); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete user")
 	}
-
-	return HTMXRedirect(c, "/users")
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookUserDeleted, creds, map[string]string{"user": accessKey}))
+	return nil
 }
 
 // EnableUser handles enabling a user account
@@ -150,6 +183,7 @@ func (h *UsersHandler) EnableUser(c echo.Context) error {
 	if err := mdm.SetUserStatus(c.Request().Context(), accessKey, madmin.AccountEnabled); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to enable user")
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookUserEnabled, *creds, map[string]string{"user": accessKey}))
 
 	return HTMXRedirect(c, "/users")
 }
@@ -171,6 +205,7 @@ func (h *UsersHandler) DisableUser(c echo.Context) error {
 	if err := mdm.SetUserStatus(c.Request().Context(), accessKey, madmin.AccountDisabled); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to disable user")
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookUserDisabled, *creds, map[string]string{"user": accessKey}))
 
 	return HTMXRedirect(c, "/users")
 }
@@ -282,6 +317,10 @@ func (h *UsersHandler) ListPolicies(c echo.Context) error {
 		return err
 	}
 
+	if err := requirePermission(permissions(c).Allowed("admin:ListUserPolicies"), "You do not have permission to view policies"); err != nil {
+		return err
+	}
+
 	mdm, err := h.minioFactory.NewAdminClient(*creds)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
@@ -352,6 +391,7 @@ func (h *UsersHandler) AttachPolicy(c echo.Context) error {
 	if err := mdm.SetPolicy(c.Request().Context(), policy, accessKey, false); err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to attach policy: "+err.Error())
 	}
+	h.webhooks.Emit(services.NewWebhookEvent(services.WebhookUserPolicyChanged, *creds, map[string]string{"user": accessKey, "policy": policy}))
 
 	return HTMXRedirect(c, "/users")
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"html"
 	"net/http"
 
 	"github.com/damacus/iron-buckets/internal/services"
@@ -25,14 +26,76 @@ func GetCredentials(c echo.Context) (*services.Credentials, error) {
 func GetCredentialsOrRedirect(c echo.Context) (*services.Credentials, error) {
 	creds, err := GetCredentials(c)
 	if err != nil {
-		return nil, c.Redirect(http.StatusSeeOther, "/login")
+		return nil, c.Redirect(http.StatusSeeOther, utils.URL(c, "/login"))
 	}
 	return creds, nil
 }
 
 // HTMXRedirect sets the HX-Redirect header and returns a 200 OK response.
 // This is used for HTMX requests that should trigger a client-side redirect.
-func HTMXRedirect(c echo.Context, url string) error {
-	c.Response().Header().Set("HX-Redirect", url)
+// path is an application path such as /buckets; the base path is added.
+func HTMXRedirect(c echo.Context, path string) error {
+	c.Response().Header().Set("HX-Redirect", utils.URL(c, path))
 	return c.NoContent(http.StatusOK)
 }
+
+// formError returns the fragment that replaces the error box of a settings
+// form. The request still succeeds, so the message is recorded for the audit log.
+func formError(c echo.Context, message string) error {
+	utils.SetAuditError(c, message)
+	return c.HTML(http.StatusOK, `<div id="error-message" class="text-red-500 text-sm block">`+html.EscapeString(message)+`</div>`)
+}
+
+// requireAdmin allows only users who can read MinIO server information,
+// which is how the settings page already tells admins apart
+func requireAdmin(c echo.Context, minioFactory services.MinioClientFactory) error {
+	if !role(c).Allows(services.CapabilityIAMManage) {
+		return echo.NewHTTPError(http.StatusForbidden, "Your role does not allow managing other users")
+	}
+	return requireServerAdmin(c, minioFactory)
+}
+
+// requireServerAdmin is requireAdmin without the role check, for admin
+// actions that are not about users. Unlike permissions(c).Admin() it asks
+// MinIO when the account's permissions are unknown.
+func requireServerAdmin(c echo.Context, minioFactory services.MinioClientFactory) error {
+	creds, err := GetCredentials(c)
+	if err != nil {
+		return err
+	}
+	if can := permissions(c); can.Known() {
+		return requirePermission(can.Admin(), "Admin permissions required")
+	}
+	mdm, err := minioFactory.NewAdminClient(*creds)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to connect to MinIO")
+	}
+	if _, err := mdm.ServerInfo(c.Request().Context()); err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, "Admin permissions required")
+	}
+	return nil
+}
+
+// permissions returns what the signed-in account may do, as resolved by the
+// Permissions middleware. It is nil without the middleware, which allows
+// everything and leaves the decision to MinIO.
+func permissions(c echo.Context) *services.Permissions {
+	can, _ := c.Get(utils.ContextKeyPermissions).(*services.Permissions)
+	return can
+}
+
+// requirePermission turns a permission check into a 403 with a message the
+// user can act on, instead of the error MinIO would return
+func requirePermission(allowed bool, message string) error {
+	if allowed {
+		return nil
+	}
+	return echo.NewHTTPError(http.StatusForbidden, message)
+}
+
+// role returns the IronBuckets role resolved by the Roles middleware. It is
+// nil when roles are not configured, which allows everything.
+func role(c echo.Context) *services.Role {
+	r, _ := c.Get(utils.ContextKeyRole).(*services.Role)
+	return r
+}
@@ -128,3 +128,19 @@ func TestHTMXRedirect_WithQueryParams(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.Equal(t, "/buckets/my-bucket?prefix=folder/", rec.Header().Get("HX-Redirect"))
 }
+
+func TestFormError(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/settings/tokens/create", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := formError(c, "Name is <required>")
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `id="error-message"`)
+	assert.Contains(t, rec.Body.String(), "Name is &lt;required&gt;")
+	assert.NotContains(t, rec.Body.String(), "text-center", "settings forms do not use the login page error box")
+	assert.Equal(t, "Name is <required>", utils.AuditDetailsOf(c).Error)
+}
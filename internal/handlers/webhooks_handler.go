@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// WebhooksHandler shows the configured webhooks and their delivery log
+type WebhooksHandler struct {
+	webhooks     *services.WebhookService
+	minioFactory services.MinioClientFactory
+}
+
+func NewWebhooksHandler(webhooks *services.WebhookService, minioFactory services.MinioClientFactory) *WebhooksHandler {
+	return &WebhooksHandler{
+		webhooks:     webhooks,
+		minioFactory: minioFactory,
+	}
+}
+
+// ListDeliveries renders the webhooks and their recent deliveries
+func (h *WebhooksHandler) ListDeliveries(c echo.Context) error {
+	if err := requireServerAdmin(c, h.minioFactory); err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "webhooks", map[string]interface{}{
+		"ActiveNav":  "settings",
+		"Webhooks":   h.webhooks.Webhooks(),
+		"Deliveries": h.webhooks.Deliveries(),
+	})
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// APITokenAuth authenticates requests that carry an Authorization: Bearer
+// header with a personal API token. It must run before AuthMiddleware, which
+// leaves token-authenticated requests alone. Read-only tokens are limited to
+// safe methods, and every use is logged.
+func APITokenAuth(tokens *services.APITokenService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			raw, ok := bearerToken(c.Request())
+			if !ok {
+				return next(c)
+			}
+
+			req := c.Request()
+			token, creds, err := tokens.Authenticate(raw, c.RealIP())
+			if err != nil {
+				if !errors.Is(err, services.ErrAPITokenInvalid) {
+					log.Printf("API tokens: %v", err)
+				}
+				c.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API token")
+			}
+			if token.Scope == services.APITokenReadOnly && !isSafeMethod(req.Method) {
+				log.Printf("API tokens: read-only token %s (%q) refused %s %s from %s", token.ID, token.Owner, req.Method, req.URL.Path, c.RealIP())
+				return echo.NewHTTPError(http.StatusForbidden, "API token is read-only")
+			}
+			log.Printf("API tokens: token %s (%q) used for %s %s from %s", token.ID, token.Owner, req.Method, req.URL.Path, c.RealIP())
+
+			c.Set(utils.ContextKeyCreds, &creds)
+			c.Set(utils.ContextKeyAPIToken, &token)
+			return next(c)
+		}
+	}
+}
+
+// bearerToken returns the token from an Authorization: Bearer header
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(req.Header.Get(echo.HeaderAuthorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tokenAccounts struct {
+	services.MinioAdminClient
+}
+
+func (tokenAccounts) AddServiceAccount(context.Context, madmin.AddServiceAccountReq) (madmin.Credentials, error) {
+	return madmin.Credentials{AccessKey: "svc-key", SecretKey: "svc-secret"}, nil
+}
+
+type tokenFactory struct{}
+
+func (tokenFactory) NewAdminClient(services.Credentials) (services.MinioAdminClient, error) {
+	return tokenAccounts{}, nil
+}
+
+func (tokenFactory) NewClient(services.Credentials) (services.MinioClient, error) {
+	return nil, errors.New("not used")
+}
+
+// apiTokenTestServer serves /whoami behind APITokenAuth and AuthMiddleware
+func apiTokenTestServer(t *testing.T) (*echo.Echo, *services.APITokenService) {
+	t.Helper()
+	authService := services.NewAuthService()
+	tokens := services.NewAPITokenService(services.NewMemoryAPITokenStore(), authService.Keyring(), tokenFactory{}, 24*time.Hour)
+
+	e := echo.New()
+	e.Use(APITokenAuth(tokens))
+	e.Use(AuthMiddleware(authService))
+	whoami := func(c echo.Context) error {
+		creds := c.Get(utils.ContextKeyCreds).(*services.Credentials)
+		return c.String(http.StatusOK, creds.AccessKey+" "+creds.User)
+	}
+	e.GET("/whoami", whoami)
+	e.POST("/whoami", whoami)
+	return e, tokens
+}
+
+func mintToken(t *testing.T, tokens *services.APITokenService, scope services.APITokenScope) string {
+	t.Helper()
+	owner := services.Credentials{Endpoint: "minio:9000", AccessKey: "alice-key", SecretKey: "alice-secret", User: "alice"}
+	_, plaintext, err := tokens.Create(context.Background(), owner, "script", scope, time.Hour)
+	require.NoError(t, err)
+	return plaintext
+}
+
+func serveBearer(e *echo.Echo, method, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/whoami", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPITokenAuthResolvesTokenToServiceAccount(t *testing.T) {
+	e, tokens := apiTokenTestServer(t)
+	token := mintToken(t, tokens, services.APITokenReadWrite)
+
+	rec := serveBearer(e, http.MethodGet, token)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "svc-key alice", rec.Body.String())
+}
+
+func TestAPITokenAuthRejectsInvalidToken(t *testing.T) {
+	e, _ := apiTokenTestServer(t)
+
+	rec := serveBearer(e, http.MethodGet, "ibt_0000000000000000.nope")
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "invalid_token")
+}
+
+func TestAPITokenAuthLimitsReadOnlyTokensToSafeMethods(t *testing.T) {
+	e, tokens := apiTokenTestServer(t)
+	token := mintToken(t, tokens, services.APITokenReadOnly)
+
+	assert.Equal(t, http.StatusOK, serveBearer(e, http.MethodGet, token).Code)
+	assert.Equal(t, http.StatusForbidden, serveBearer(e, http.MethodPost, token).Code)
+}
+
+func TestAPITokenAuthLeavesSessionRequestsToAuthMiddleware(t *testing.T) {
+	e, _ := apiTokenTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/login", rec.Header().Get("Location"))
+}
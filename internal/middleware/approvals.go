@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Approvals links the approvals page from the layout, as .ApprovalsEnabled,
+// with the number of requests waiting for someone else as .PendingApprovals.
+// It must run after AuthMiddleware.
+func Approvals(approvals *services.ApprovalService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			creds, ok := c.Get(utils.ContextKeyCreds).(*services.Credentials)
+			if !ok {
+				return next(c)
+			}
+			utils.SetLayoutValue(c, "ApprovalsEnabled", true)
+			utils.SetLayoutValue(c, "PendingApprovals", approvals.Waiting(creds.Identity(), creds.Endpoint))
+			return next(c)
+		}
+	}
+}
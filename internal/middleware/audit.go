@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// auditActions names the change each route makes. Routes missing here are
+// still audited, under their path.
+var auditActions = map[string]string{
+	"/login":                                  "auth.login",
+	"/login/mfa":                              "auth.mfa",
+	"/login/mfa/enroll":                       "auth.mfa.enroll",
+	"/session/extend":                         "session.extend",
+	"/clusters/switch":                        "cluster.switch",
+	"/users/create":                           "user.create",
+	"/users/delete":                           "user.delete",
+	"/users/enable":                           "user.enable",
+	"/users/disable":                          "user.disable",
+	"/users/:accessKey/keys/create":           "user.key.create",
+	"/users/:accessKey/keys/delete":           "user.key.delete",
+	"/users/:accessKey/policy":                "user.policy.attach",
+	"/groups/create":                          "group.create",
+	"/groups/:groupName/members/add":          "group.members.add",
+	"/groups/:groupName/members/remove":       "group.members.remove",
+	"/groups/:groupName/disable":              "group.disable",
+	"/groups/:groupName/enable":               "group.enable",
+	"/groups/:groupName/policy":               "group.policy.attach",
+	"/buckets/create":                         "bucket.create",
+	"/buckets/delete":                         "bucket.delete",
+	"/buckets/:bucketName/upload":             "object.upload",
+	"/buckets/:bucketName/delete":             "object.delete",
+	"/buckets/:bucketName/share":              "object.share",
+	"/buckets/:bucketName/folder/create":      "folder.create",
+	"/buckets/:bucketName/folder/delete":      "folder.delete",
+	"/buckets/:bucketName/versioning/enable":  "bucket.versioning.enable",
+	"/buckets/:bucketName/versioning/suspend": "bucket.versioning.suspend",
+	"/buckets/:bucketName/lifecycle":          "bucket.lifecycle.add",
+	"/buckets/:bucketName/lifecycle/delete":   "bucket.lifecycle.delete",
+	"/buckets/:bucketName/object/tags":        "object.tags.set",
+	"/buckets/:bucketName/quota":              "bucket.quota.set",
+	"/buckets/:bucketName/policy":             "bucket.policy.set",
+	"/settings/restart":                       "server.restart",
+	"/settings/maintenance":                   "server.maintenance",
+	"/settings/sessions/revoke":               "session.revoke",
+	"/settings/mfa/enroll":                    "mfa.enroll",
+	"/settings/mfa/disable":                   "mfa.disable",
+	"/settings/mfa/reset":                     "mfa.reset",
+	"/settings/tokens/create":                 "token.create",
+	"/settings/tokens/revoke":                 "token.revoke",
+	"/approvals/:id/approve":                  "approval.approve",
+	"/approvals/:id/reject":                   "approval.reject",
+}
+
+// auditValueLimit caps each recorded parameter, so pasted policies and tag
+// lists do not bloat the log
+const auditValueLimit = 512
+
+// Audit records an audit event for every POST, PUT, PATCH and DELETE: who
+// made it, from where, what it changed and how it ended. It must run after
+// AuthMiddleware, and before the middleware that can refuse changes so those
+// refusals are recorded too.
+func Audit(audit *services.AuditLog) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+
+			// Credentials are read before the handler runs, since logging in
+			// or switching cluster replaces them
+			creds, _ := c.Get(utils.ContextKeyCreds).(*services.Credentials)
+			token, _ := c.Get(utils.ContextKeyAPIToken).(*services.APIToken)
+
+			err := next(c)
+			if errors.Is(err, echo.ErrNotFound) || errors.Is(err, echo.ErrMethodNotAllowed) {
+				return err
+			}
+
+			event := auditEvent(c, creds, token, err)
+			if recordErr := audit.Record(event); recordErr != nil {
+				log.Printf("Audit: failed to record %s by %q: %v", event.Action, event.Actor, recordErr)
+			}
+			return err
+		}
+	}
+}
+
+func auditEvent(c echo.Context, creds *services.Credentials, token *services.APIToken, err error) services.AuditEvent {
+	params := auditParams(c)
+	event := services.AuditEvent{
+		SourceIP: c.RealIP(),
+		Action:   auditActions[c.Path()],
+		Method:   c.Request().Method,
+		Path:     c.Request().URL.Path,
+		Params:   params,
+	}
+	if event.Action == "" {
+		event.Action = c.Path()
+	}
+	if creds != nil {
+		event.Actor = creds.Identity()
+		event.Cluster = creds.Endpoint
+		event.User = first(params, "accessKey", "user")
+	} else {
+		// Signing in: the access key or username is who is signing in
+		event.Actor = first(params, "accessKey", "username")
+	}
+	if token != nil {
+		event.Token = token.ID
+	}
+
+	event.Bucket = first(params, "bucketName", "bucket")
+	event.Object = first(params, "key", "object")
+	if event.Object == "" && params["folderName"] != "" {
+		event.Object = params["prefix"] + params["folderName"]
+	} else if event.Object == "" && params["file"] != "" {
+		event.Object = params["prefix"] + params["file"]
+	} else if event.Object == "" {
+		event.Object = params["prefix"]
+	}
+	event.Group = first(params, "groupName")
+	event.Policy = first(params, "policyType")
+	if event.Policy == "" && event.Bucket == "" {
+		event.Policy = params["policy"]
+	}
+
+	event.Status = c.Response().Status
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		event.Status = httpErr.Code
+		event.Error = fmt.Sprint(httpErr.Message)
+	case err != nil:
+		event.Status = http.StatusInternalServerError
+		event.Error = err.Error()
+	}
+	if details := utils.AuditDetailsOf(c); details != nil && event.Error == "" {
+		event.Error = details.Error
+	}
+
+	switch {
+	case event.Status == http.StatusUnauthorized || event.Status == http.StatusForbidden || event.Status == http.StatusServiceUnavailable:
+		event.Result = services.AuditDenied
+	case event.Status >= http.StatusBadRequest || event.Error != "":
+		event.Result = services.AuditFailure
+	default:
+		event.Result = services.AuditSuccess
+	}
+	return event
+}
+
+// auditParams collects the route, query and form values of a request, and
+// the values its handler added. Secrets are redacted and the CSRF token left
+// out. Multipart bodies are only read if the handler already parsed them.
+func auditParams(c echo.Context) map[string]string {
+	params := make(map[string]string)
+	for i, name := range c.ParamNames() {
+		if i < len(c.ParamValues()) {
+			params[name] = c.ParamValues()[i]
+		}
+	}
+	req := c.Request()
+	add := func(values map[string][]string) {
+		for key, value := range values {
+			if len(value) > 0 {
+				params[key] = strings.Join(value, ",")
+			}
+		}
+	}
+	add(req.URL.Query())
+	if strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		if form := req.MultipartForm; form != nil {
+			add(form.Value)
+			for _, files := range form.File {
+				names := make([]string, 0, len(files))
+				for _, file := range files {
+					names = append(names, file.Filename)
+				}
+				params["file"] = strings.Join(names, ",")
+			}
+		}
+	} else if req.ParseForm() == nil {
+		add(req.PostForm)
+	}
+	if details := utils.AuditDetailsOf(c); details != nil {
+		for key, value := range details.Values {
+			params[key] = value
+		}
+	}
+
+	delete(params, "_csrf")
+	for key, value := range params {
+		if auditSecret(key) {
+			params[key] = "[redacted]"
+		} else if len(value) > auditValueLimit {
+			params[key] = value[:auditValueLimit] + "…"
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// auditSecret reports whether a parameter holds a secret, such as a secret
+// key, password or one-time code
+func auditSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range []string{"secret", "password", "token", "code", "recovery"} {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the first non-empty value among keys
+func first(params map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := params[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
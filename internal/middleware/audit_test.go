@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAuditTestServer(t *testing.T) (*echo.Echo, *services.AuditLog) {
+	t.Helper()
+	audit := services.NewAuditLog(services.NewMemoryAuditStore())
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Path() != "/login" {
+				c.Set(utils.ContextKeyCreds, &services.Credentials{Endpoint: "minio:9000", AccessKey: "admin"})
+			}
+			return next(c)
+		}
+	})
+	e.Use(Audit(audit))
+	return e, audit
+}
+
+func postForm(e *echo.Echo, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.RemoteAddr = "192.0.2.10:41000"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuditRecordsChangesWithSecretsRedacted(t *testing.T) {
+	e, audit := newAuditTestServer(t)
+	e.POST("/users/create", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/users", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	postForm(e, "/users/create", url.Values{"accessKey": {"alice"}, "secretKey": {"hunter22"}, "policy": {"readwrite"}, "_csrf": {"x"}})
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	events, err := audit.Query(services.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1, "only changes are audited")
+	event := events[0]
+	assert.Equal(t, "user.create", event.Action)
+	assert.Equal(t, "admin", event.Actor)
+	assert.Equal(t, "minio:9000", event.Cluster)
+	assert.Equal(t, "192.0.2.10", event.SourceIP)
+	assert.Equal(t, "alice", event.User)
+	assert.Equal(t, "readwrite", event.Policy)
+	assert.Equal(t, services.AuditSuccess, event.Result)
+	assert.Equal(t, "[redacted]", event.Params["secretKey"])
+	assert.NotContains(t, event.Params, "_csrf")
+}
+
+func TestAuditRecordsRefusalsAndFailures(t *testing.T) {
+	e, audit := newAuditTestServer(t)
+	e.POST("/buckets/:bucketName/delete", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusForbidden, "You have read-only access to this bucket")
+	})
+	e.POST("/buckets/create", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create bucket")
+	})
+	e.POST("/login", func(c echo.Context) error {
+		utils.SetAuditError(c, "Authentication Failed")
+		return c.HTML(http.StatusOK, "Authentication Failed")
+	})
+
+	postForm(e, "/buckets/reports/delete", url.Values{"key": {"2024/q1.csv"}})
+	postForm(e, "/buckets/create", url.Values{"bucketName": {"archive"}})
+	postForm(e, "/login", url.Values{"accessKey": {"mallory"}, "secretKey": {"guess"}})
+
+	events, err := audit.Query(services.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	login, create, remove := events[0], events[1], events[2]
+	assert.Equal(t, services.AuditDenied, remove.Result)
+	assert.Equal(t, http.StatusForbidden, remove.Status)
+	assert.Equal(t, "reports", remove.Bucket)
+	assert.Equal(t, "2024/q1.csv", remove.Object)
+	assert.Equal(t, "You have read-only access to this bucket", remove.Error)
+
+	assert.Equal(t, services.AuditFailure, create.Result)
+	assert.Equal(t, "archive", create.Bucket)
+
+	assert.Equal(t, "auth.login", login.Action)
+	assert.Equal(t, "mallory", login.Actor)
+	assert.Equal(t, services.AuditFailure, login.Result)
+	assert.Equal(t, "Authentication Failed", login.Error)
+}
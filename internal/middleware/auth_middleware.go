@@ -1,43 +1,112 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/damacus/iron-buckets/internal/services"
 	"github.com/damacus/iron-buckets/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
+// passivePaths are polled by the UI in the background, so requests to them
+// must not count as user activity for the idle timeout
+var passivePaths = map[string]bool{
+	"/session/status": true,
+}
+
 // AuthMiddleware checks for the IronSeal cookie and validates it
 func AuthMiddleware(authService *services.AuthService) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			// Requests authenticated by APITokenAuth carry no session
+			if c.Get(utils.ContextKeyAPIToken) != nil {
+				return next(c)
+			}
+
 			// Skip for public routes
 			path := c.Request().URL.Path
 			if path == "/login" || path == "/health" || path == "/logout" ||
-				path == "/login/oauth" || path == "/oauth/callback" {
+				path == "/login/oauth" || path == "/oauth/callback" ||
+				path == "/login/mfa" || path == "/login/mfa/enroll" ||
+				strings.HasPrefix(path, "/static/") {
 				return next(c)
 			}
 
 			// Get Cookie
 			cookie, err := c.Cookie(utils.CookieName)
 			if err != nil {
-				return c.Redirect(http.StatusSeeOther, "/login")
+				return redirectToLogin(c)
 			}
 
-			// Decrypt
-			creds, err := authService.DecryptCredentials(cookie.Value)
+			// Resolve the session and enforce the idle and absolute limits
+			state, err := authService.OpenSession(cookie.Value)
 			if err != nil {
-				// Invalid cookie - Clear it to prevent loop
-				cookie.MaxAge = -1
-				c.SetCookie(cookie)
-				return c.Redirect(http.StatusSeeOther, "/login")
+				// Invalid or expired cookie - Clear it to prevent loop
+				utils.ClearSessionCookie(c)
+				return redirectToLogin(c)
 			}
 
-			// Store creds in context for handlers to use
-			c.Set(utils.ContextKeyCreds, creds)
+			now := time.Now()
+			changed := false
+
+			// Renew temporary credentials shortly before they lapse
+			if authService.NeedsRefresh(state.Credentials, now) {
+				refreshed, err := authService.RefreshCredentials(c.Request().Context(), state.Credentials)
+				if err == nil {
+					state.Credentials = refreshed
+					changed = true
+				} else if !errors.Is(err, services.ErrNotRefreshable) {
+					log.Printf("Auth: failed to refresh credentials for %s: %v", state.AccessKey, err)
+				}
+			}
+
+			// Temporary STS credentials cannot be used past their expiry
+			if state.IsExpired(now) {
+				authService.EndSession(cookie.Value)
+				utils.ClearSessionCookie(c)
+				return redirectToLogin(c)
+			}
+
+			// Sliding renewal: activity pushes the idle deadline back
+			if !passivePaths[path] && authService.TouchSession(state, now) {
+				changed = true
+			}
+
+			if changed {
+				value, expires, err := authService.SaveSession(cookie.Value, *state)
+				if err != nil {
+					log.Printf("Auth: failed to save session for %s: %v", state.AccessKey, err)
+				} else {
+					utils.SetSessionCookie(c, value, expires)
+				}
+			}
+
+			// Store creds in context for handlers to use; a held key never
+			// goes back into the session
+			creds, err := authService.SessionCredentials(state.Credentials)
+			if err != nil {
+				authService.EndSession(cookie.Value)
+				utils.ClearSessionCookie(c)
+				return redirectToLogin(c)
+			}
+			c.Set(utils.ContextKeyCreds, &creds)
+			c.Set(utils.ContextKeySession, state)
 
 			return next(c)
 		}
 	}
 }
+
+// redirectToLogin sends the browser to the login page. HTMX requests get an
+// HX-Redirect so the login page is not swapped into a fragment target.
+func redirectToLogin(c echo.Context) error {
+	if c.Request().Header.Get("HX-Request") == "true" {
+		c.Response().Header().Set("HX-Redirect", utils.URL(c, "/login"))
+		return c.NoContent(http.StatusUnauthorized)
+	}
+	return c.Redirect(http.StatusSeeOther, utils.URL(c, "/login"))
+}
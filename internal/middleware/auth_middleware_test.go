@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/damacus/iron-buckets/internal/services"
 	"github.com/damacus/iron-buckets/internal/utils"
@@ -164,3 +168,211 @@ func TestAuthMiddleware_ClearsInvalidCookie(t *testing.T) {
 	}
 	assert.True(t, foundClearCookie, "should set cookie with MaxAge=-1 to clear it")
 }
+
+func TestAuthMiddleware_RejectsExpiredTemporaryCredentials(t *testing.T) {
+	e := echo.New()
+	authService := services.NewAuthService()
+
+	encrypted, err := authService.EncryptCredentials(services.Credentials{
+		Endpoint:     "localhost:9000",
+		AccessKey:    "STSACCESS",
+		SecretKey:    "STSSECRET",
+		SessionToken: "STSTOKEN",
+		Expiration:   time.Now().Add(-time.Minute),
+	})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: encrypted})
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	handlerCalled := false
+	handler := func(c echo.Context) error {
+		handlerCalled = true
+		return c.String(http.StatusOK, "OK")
+	}
+
+	err = AuthMiddleware(authService)(handler)(c)
+
+	assert.NoError(t, err)
+	assert.False(t, handlerCalled, "handler should not be called with expired credentials")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/login", rec.Header().Get("Location"))
+}
+
+func TestAuthMiddleware_HTMXRequestsGetHXRedirect(t *testing.T) {
+	e := echo.New()
+	authService := services.NewAuthService()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/server/widget", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := AuthMiddleware(authService)(func(c echo.Context) error {
+		return c.String(http.StatusOK, "OK")
+	})(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "/login", rec.Header().Get("HX-Redirect"))
+}
+
+type refreshingSTS struct {
+	calls int
+}
+
+func (s *refreshingSTS) AssumeRoleWithWebIdentity(context.Context, string, services.OIDCToken, string) (services.Credentials, error) {
+	return services.Credentials{}, errors.New("not implemented")
+}
+
+func (s *refreshingSTS) AssumeRoleWithLDAPIdentity(context.Context, string, string, string, time.Duration) (services.Credentials, error) {
+	return services.Credentials{}, errors.New("not implemented")
+}
+
+func (s *refreshingSTS) AssumeRoleWithCertificate(context.Context, string, string, time.Duration) (services.Credentials, error) {
+	return services.Credentials{}, errors.New("not implemented")
+}
+
+func (s *refreshingSTS) AssumeRole(_ context.Context, creds services.Credentials, _ time.Duration) (services.Credentials, error) {
+	s.calls++
+	lifetime := time.Hour
+	if s.calls == 1 {
+		// The first set of credentials is about to expire
+		lifetime = time.Minute
+	}
+	return services.Credentials{
+		Endpoint:     creds.Endpoint,
+		AccessKey:    fmt.Sprintf("TEMP%d", s.calls),
+		SecretKey:    "temp-secret",
+		SessionToken: "token",
+		Expiration:   time.Now().Add(lifetime),
+	}, nil
+}
+
+func TestAuthMiddleware_RefreshesExpiringCredentials(t *testing.T) {
+	e := echo.New()
+	sts := &refreshingSTS{}
+	authService := services.NewAuthService().WithSTS(sts)
+
+	creds, err := authService.IssueSessionCredentials(context.Background(), services.Credentials{
+		Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "long-term-secret",
+	})
+	assert.NoError(t, err)
+	encrypted, err := authService.EncryptCredentials(creds)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: encrypted})
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	var contextCreds *services.Credentials
+	err = AuthMiddleware(authService)(func(c echo.Context) error {
+		contextCreds = c.Get(utils.ContextKeyCreds).(*services.Credentials)
+		return c.String(http.StatusOK, "OK")
+	})(c)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sts.calls)
+	assert.Equal(t, "TEMP2", contextCreds.AccessKey)
+
+	var renewed *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == utils.CookieName {
+			renewed = cookie
+		}
+	}
+	if assert.NotNil(t, renewed, "refreshed credentials should be written back to the cookie") {
+		stored, err := authService.DecryptCredentials(renewed.Value)
+		assert.NoError(t, err)
+		assert.Equal(t, "TEMP2", stored.AccessKey)
+		assert.Equal(t, creds.KeyRef, stored.KeyRef)
+	}
+}
+
+func newIdleTestService(t *testing.T) *services.AuthService {
+	t.Helper()
+	keyring, err := services.NewKeyring(services.SessionKey{ID: "test", Key: []byte("0123456789abcdef0123456789abcdef")})
+	assert.NoError(t, err)
+	return services.NewAuthServiceWithKeyring(keyring).WithSessionPolicy(services.SessionPolicy{
+		IdleTimeout: 15 * time.Minute,
+		MaxLifetime: 12 * time.Hour,
+	})
+}
+
+func serveWithSession(authService *services.AuthService, path, value string) (*httptest.ResponseRecorder, bool) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: value})
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	handlerCalled := false
+	_ = AuthMiddleware(authService)(func(c echo.Context) error {
+		handlerCalled = true
+		return c.String(http.StatusOK, "OK")
+	})(c)
+	return rec, handlerCalled
+}
+
+func TestAuthMiddleware_SlidingRenewalOnActivity(t *testing.T) {
+	authService := newIdleTestService(t)
+	now := time.Now()
+	value, err := authService.SealSession(services.SessionState{
+		Credentials: services.Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "password"},
+		IssuedAt:    now.Add(-time.Hour),
+		LastSeen:    now.Add(-10 * time.Minute),
+	})
+	assert.NoError(t, err)
+
+	rec, handlerCalled := serveWithSession(authService, "/dashboard", value)
+
+	assert.True(t, handlerCalled)
+	var renewed *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == utils.CookieName {
+			renewed = cookie
+		}
+	}
+	if assert.NotNil(t, renewed, "activity should re-issue the cookie") {
+		state, err := authService.OpenSession(renewed.Value)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, now, state.LastSeen, 5*time.Second)
+		assert.WithinDuration(t, now.Add(-time.Hour), state.IssuedAt, time.Second, "issued-at must not slide")
+		assert.WithinDuration(t, now.Add(15*time.Minute), renewed.Expires, 5*time.Second)
+	}
+}
+
+func TestAuthMiddleware_IdleSessionIsRejected(t *testing.T) {
+	authService := newIdleTestService(t)
+	now := time.Now()
+	value, _ := authService.SealSession(services.SessionState{
+		Credentials: services.Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "password"},
+		IssuedAt:    now.Add(-time.Hour),
+		LastSeen:    now.Add(-20 * time.Minute),
+	})
+
+	rec, handlerCalled := serveWithSession(authService, "/dashboard", value)
+
+	assert.False(t, handlerCalled)
+	assert.Equal(t, "/login", rec.Header().Get("Location"))
+}
+
+func TestAuthMiddleware_StatusPollingIsNotActivity(t *testing.T) {
+	authService := newIdleTestService(t)
+	now := time.Now()
+	value, _ := authService.SealSession(services.SessionState{
+		Credentials: services.Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "password"},
+		IssuedAt:    now.Add(-time.Hour),
+		LastSeen:    now.Add(-10 * time.Minute),
+	})
+
+	rec, handlerCalled := serveWithSession(authService, "/session/status", value)
+
+	assert.True(t, handlerCalled)
+	for _, cookie := range rec.Result().Cookies() {
+		assert.NotEqual(t, utils.CookieName, cookie.Name, "polling must not extend the session")
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// BasePath serves IronBuckets under prefix, such as /storage. Requests below
+// it are routed as if they were made at the root, the prefix itself
+// redirects to prefix/, and any other path is not found. It must be
+// registered with e.Pre so routing sees the path without the prefix.
+func BasePath(prefix string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if prefix == "" {
+				return next(c)
+			}
+			req := c.Request()
+			if req.URL.Path == prefix {
+				target := prefix + "/"
+				if req.URL.RawQuery != "" {
+					target += "?" + req.URL.RawQuery
+				}
+				return c.Redirect(http.StatusMovedPermanently, target)
+			}
+			if !strings.HasPrefix(req.URL.Path, prefix+"/") {
+				return echo.ErrNotFound
+			}
+			c.Set(utils.ContextKeyBasePath, prefix)
+			req.URL.Path = strings.TrimPrefix(req.URL.Path, prefix)
+			req.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, prefix)
+			return next(c)
+		}
+	}
+}
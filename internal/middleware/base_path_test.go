@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasePathRoutesBelowThePrefix(t *testing.T) {
+	e := echo.New()
+	e.Pre(BasePath("/storage"))
+	e.GET("/buckets/:bucketName", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Param("bucketName")+" "+utils.URL(c, "/login"))
+	})
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := serve("/storage/buckets/reports")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "reports /storage/login", rec.Body.String())
+
+	rec = serve("/storage?page=2")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/storage/?page=2", rec.Header().Get("Location"))
+
+	for _, target := range []string{"/buckets/reports", "/storagebuckets/reports"} {
+		assert.Equal(t, http.StatusNotFound, serve(target).Code, target)
+	}
+}
+
+func TestBasePathAtRootChangesNothing(t *testing.T) {
+	e := echo.New()
+	e.Pre(BasePath(""))
+	e.GET("/buckets", func(c echo.Context) error {
+		return c.String(http.StatusOK, utils.URL(c, "/login"))
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/buckets", nil))
+	assert.Equal(t, "/login", rec.Body.String())
+}
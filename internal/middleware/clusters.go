@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// ClusterContext tells the layout which cluster the session belongs to and,
+// when there are several, which others the header switcher can offer
+func ClusterContext(registry *services.ClusterRegistry) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			creds, ok := c.Get(utils.ContextKeyCreds).(*services.Credentials)
+			if !ok {
+				return next(c)
+			}
+			if cluster, ok := registry.ForEndpoint(creds.Endpoint); ok {
+				utils.SetLayoutValue(c, "Cluster", cluster)
+			}
+			if clusters := registry.List(); len(clusters) > 1 {
+				utils.SetLayoutValue(c, "Clusters", clusters)
+			}
+			return next(c)
+		}
+	}
+}
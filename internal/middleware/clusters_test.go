@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterContextExposesCurrentCluster(t *testing.T) {
+	registry, err := services.NewClusterRegistry([]services.Cluster{
+		{Alias: "prod", Name: "Production", URL: "https://minio.example.com"},
+		{Alias: "dev", URL: "http://minio-dev:9000"},
+	})
+	require.NoError(t, err)
+
+	var layout map[string]interface{}
+	handler := ClusterContext(registry)(func(c echo.Context) error {
+		layout = utils.LayoutValues(c)
+		return c.NoContent(http.StatusOK)
+	})
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.Set(utils.ContextKeyCreds, &services.Credentials{Endpoint: "minio-dev:9000"})
+	require.NoError(t, handler(c))
+
+	cluster, ok := layout["Cluster"].(services.Cluster)
+	require.True(t, ok)
+	assert.Equal(t, "dev", cluster.Alias)
+	assert.Len(t, layout["Clusters"], 2)
+}
+
+func TestClusterContextSkipsAnonymousRequests(t *testing.T) {
+	registry, err := services.NewClusterRegistry([]services.Cluster{{Alias: "prod", URL: "http://minio:9000"}})
+	require.NoError(t, err)
+
+	handler := ClusterContext(registry)(func(c echo.Context) error {
+		assert.Nil(t, utils.LayoutValues(c))
+		return nil
+	})
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/login", nil), httptest.NewRecorder())
+	require.NoError(t, handler(c))
+}
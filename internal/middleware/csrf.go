@@ -3,23 +3,48 @@ package middleware
 import (
 	"net/http"
 
+	"github.com/damacus/iron-buckets/internal/utils"
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 )
 
-func CSRF() echo.MiddlewareFunc {
-	return echoMiddleware.CSRFWithConfig(echoMiddleware.CSRFConfig{
-		TokenLookup:    "header:X-CSRF-Token",
+// CSRFFormField is the hidden form field that carries the CSRF token for
+// forms submitted without JavaScript
+const CSRFFormField = "_csrf"
+
+// CSRF validates a token on every unsafe request. The token is read from the
+// X-CSRF-Token header (set for all HTMX requests by the layout) or from the
+// _csrf form field, and is exposed to templates as .CSRFToken.
+//
+// The only exemption is bearer-token authentication: a request that carries
+// an Authorization: Bearer header and no session cookie cannot have been
+// forged by a browser, since browsers never add that header on their own.
+// The cookie is scoped to basePath, the path IronBuckets is served under.
+func CSRF(basePath string) echo.MiddlewareFunc {
+	csrf := echoMiddleware.CSRFWithConfig(echoMiddleware.CSRFConfig{
+		TokenLookup:    "header:X-CSRF-Token,form:" + CSRFFormField,
 		CookieName:     "csrf",
-		CookiePath:     "/",
+		CookiePath:     basePath + "/",
 		CookieSameSite: http.SameSiteStrictMode,
-		Skipper: func(c echo.Context) bool {
-			switch c.Request().Method {
-			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
-				return false
+		Skipper:        isBearerRequest,
+	})
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return csrf(func(c echo.Context) error {
+			if token, ok := c.Get(echoMiddleware.DefaultCSRFConfig.ContextKey).(string); ok {
+				utils.SetLayoutValue(c, "CSRFToken", token)
 			}
+			return next(c)
+		})
+	}
+}
 
-			return c.Request().Header.Get("HX-Request") != "true"
-		},
-	})
+// isBearerRequest reports whether the request authenticates with a bearer
+// token instead of the session cookie
+func isBearerRequest(c echo.Context) bool {
+	req := c.Request()
+	if _, ok := bearerToken(req); !ok {
+		return false
+	}
+	_, err := req.Cookie(utils.CookieName)
+	return err != nil
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/damacus/iron-buckets/internal/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,7 +14,7 @@ import (
 
 func TestCSRFMiddlewareRejectsPostWithoutToken(t *testing.T) {
 	e := echo.New()
-	e.Use(CSRF())
+	e.Use(CSRF(""))
 	e.POST("/submit", func(c echo.Context) error {
 		return c.String(http.StatusOK, "ok")
 	})
@@ -29,7 +30,7 @@ func TestCSRFMiddlewareRejectsPostWithoutToken(t *testing.T) {
 
 func TestCSRFMiddlewareAllowsPostWithTokenHeaderAndCookie(t *testing.T) {
 	e := echo.New()
-	e.Use(CSRF())
+	e.Use(CSRF(""))
 	e.GET("/csrf", func(c echo.Context) error {
 		token, _ := c.Get("csrf").(string)
 		return c.String(http.StatusOK, token)
@@ -65,3 +66,93 @@ func TestCSRFMiddlewareAllowsPostWithTokenHeaderAndCookie(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, postRec.Code)
 }
+
+// csrfTestServer returns a server with a POST endpoint and a fresh token and cookie
+func csrfTestServer(t *testing.T) (*echo.Echo, string, *http.Cookie) {
+	t.Helper()
+	e := echo.New()
+	e.Use(CSRF(""))
+	e.GET("/csrf", func(c echo.Context) error {
+		token, _ := utils.LayoutValues(c)["CSRFToken"].(string)
+		return c.String(http.StatusOK, token)
+	})
+	e.POST("/submit", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/csrf", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	token := rec.Body.String()
+	require.NotEmpty(t, token, "token must be exposed to templates")
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "csrf" {
+			return e, token, cookie
+		}
+	}
+	t.Fatal("csrf cookie not set")
+	return nil, "", nil
+}
+
+func TestCSRFMiddlewareRejectsPlainFormPostWithoutToken(t *testing.T) {
+	e, _, cookie := csrfTestServer(t)
+
+	// No HX-Request header: a cross-site form post looks exactly like this
+	req := httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader("accessKey=victim"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCSRFMiddlewareRejectsWrongToken(t *testing.T) {
+	e, _, cookie := csrfTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader("_csrf=forged"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestCSRFMiddlewareAcceptsTokenFromFormField(t *testing.T) {
+	e, token, cookie := csrfTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader("_csrf="+token))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestCSRFMiddlewareExemptsBearerRequestsOnly(t *testing.T) {
+	e, _, _ := csrfTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/submit", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer some-token")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A bearer header does not exempt a request that also carries a session
+	req = httptest.NewRequest(http.MethodPost, "/submit", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer some-token")
+	req.AddCookie(&http.Cookie{Name: utils.CookieName, Value: "session"})
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Other schemes are not exempt
+	req = httptest.NewRequest(http.MethodPost, "/submit", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Basic YWRtaW46cGFzcw==")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// readOnlyExempt lists the unsafe routes that keep working in read-only mode:
+// signing in, keeping a session alive, switching cluster and leaving
+// read-only mode again. None of them change anything in MinIO.
+var readOnlyExempt = map[string]bool{
+	"/login":                true,
+	"/login/mfa":            true,
+	"/login/mfa/enroll":     true,
+	"/session/extend":       true,
+	"/clusters/switch":      true,
+	"/settings/maintenance": true,
+}
+
+// ReadOnly refuses every POST, PUT, PATCH and DELETE with 503 while
+// maintenance mode is on, and shows the maintenance notice on every page as
+// .Maintenance. Browsing and downloads are unaffected.
+func ReadOnly(mode *services.MaintenanceMode) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			status := mode.Status()
+			if !status.Enabled {
+				return next(c)
+			}
+			utils.SetLayoutValue(c, "Maintenance", &status)
+
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+			if readOnlyExempt[c.Path()] {
+				return next(c)
+			}
+			// HTMX does not swap error responses; the layout shows this text in
+			// its maintenance banner instead
+			if c.Request().Header.Get("HX-Request") == "true" {
+				utils.SetAuditError(c, status.Message)
+				return c.String(http.StatusServiceUnavailable, status.Message)
+			}
+			return echo.NewHTTPError(http.StatusServiceUnavailable, status.Message)
+		}
+	}
+}
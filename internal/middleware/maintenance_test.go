@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyAllowsSignInAndSafeMethods(t *testing.T) {
+	e := echo.New()
+	e.Use(ReadOnly(services.NewMaintenanceMode(true, "")))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/buckets", ok)
+	e.POST("/login", ok)
+	e.POST("/settings/maintenance", ok)
+	e.POST("/users/create", ok)
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/buckets", http.StatusOK},
+		{http.MethodPost, "/login", http.StatusOK},
+		{http.MethodPost, "/settings/maintenance", http.StatusOK},
+		{http.MethodPost, "/users/create", http.StatusServiceUnavailable},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, tt.want, rec.Code, tt.method+" "+tt.path)
+	}
+}
+
+func TestReadOnlyPassesWhenDisabled(t *testing.T) {
+	e := echo.New()
+	e.Use(ReadOnly(services.NewMaintenanceMode(false, "")))
+	e.POST("/users/create", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users/create", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
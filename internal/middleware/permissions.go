@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Permissions resolves what the signed-in account may do and exposes it to
+// handlers and, as .Can, to templates. AccountInfo is called once per session
+// and cached; it must run after AuthMiddleware.
+func Permissions(permissions *services.PermissionService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			creds, ok := c.Get(utils.ContextKeyCreds).(*services.Credentials)
+			if !ok {
+				return next(c)
+			}
+			can := permissions.Lookup(c.Request().Context(), sessionKey(c, creds), *creds)
+			c.Set(utils.ContextKeyPermissions, can)
+			utils.SetLayoutValue(c, "Can", can)
+			return next(c)
+		}
+	}
+}
+
+// sessionKey identifies the session, or API token, that permissions and
+// roles are cached for. Temporary credentials change on every renewal, so
+// sessions are keyed by who signed in and when instead.
+func sessionKey(c echo.Context, creds *services.Credentials) string {
+	if token, ok := c.Get(utils.ContextKeyAPIToken).(*services.APIToken); ok {
+		return "token:" + token.ID
+	}
+	if state, ok := c.Get(utils.ContextKeySession).(*services.SessionState); ok {
+		return "session:" + creds.Endpoint + "|" + creds.Identity() + "|" + state.IssuedAt.Format(time.RFC3339Nano)
+	}
+	return "creds:" + creds.Endpoint + "|" + creds.AccessKey
+}
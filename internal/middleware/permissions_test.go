@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/minio/madmin-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type accountInfoClient struct {
+	services.MinioAdminClient
+	calls *int
+}
+
+func (a accountInfoClient) AccountInfo(context.Context, madmin.AccountOpts) (madmin.AccountInfo, error) {
+	*a.calls++
+	return madmin.AccountInfo{
+		Policy:  json.RawMessage(`{"Statement": [{"Effect": "Allow", "Action": ["s3:*"]}]}`),
+		Buckets: []madmin.BucketAccessInfo{{Name: "reports", Access: madmin.AccountAccess{Read: true}}},
+	}, nil
+}
+
+type accountInfoFactory struct {
+	calls *int
+}
+
+func (f accountInfoFactory) NewAdminClient(services.Credentials) (services.MinioAdminClient, error) {
+	return accountInfoClient{calls: f.calls}, nil
+}
+
+func (accountInfoFactory) NewClient(services.Credentials) (services.MinioClient, error) {
+	return nil, errors.New("not used")
+}
+
+func TestPermissionsExposesAccountToHandlersAndLayout(t *testing.T) {
+	calls := 0
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			creds := &services.Credentials{Endpoint: "minio:9000", AccessKey: "temp-key", User: "alice"}
+			c.Set(utils.ContextKeyCreds, creds)
+			c.Set(utils.ContextKeySession, &services.SessionState{Credentials: *creds, IssuedAt: time.Unix(100, 0)})
+			return next(c)
+		}
+	})
+	e.Use(Permissions(services.NewPermissionService(accountInfoFactory{calls: &calls})))
+
+	var can *services.Permissions
+	e.GET("/", func(c echo.Context) error {
+		can, _ = c.Get(utils.ContextKeyPermissions).(*services.Permissions)
+		assert.Same(t, can, utils.LayoutValues(c)["Can"])
+		return c.NoContent(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	require.NotNil(t, can)
+	assert.True(t, can.Read("reports"))
+	assert.False(t, can.Write("reports"))
+	assert.False(t, can.Admin())
+	assert.Equal(t, 1, calls, "AccountInfo should be called once per session")
+}
+
+func TestPermissionsSkipsAnonymousRequests(t *testing.T) {
+	calls := 0
+	e := echo.New()
+	e.Use(Permissions(services.NewPermissionService(accountInfoFactory{calls: &calls})))
+	e.GET("/login", func(c echo.Context) error {
+		assert.Nil(t, c.Get(utils.ContextKeyPermissions))
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Zero(t, calls)
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// TrustedProxies resolves the client address, scheme and host of each
+// request from forwarded headers sent by trusted proxies, so HSTS, Secure
+// cookies and logging agree. It should be the first middleware, and the
+// server's IPExtractor should be proxies.ClientIP so c.RealIP() matches.
+// A forwarded host that is not a valid host[:port] is ignored.
+func TrustedProxies(proxies *utils.TrustedProxies) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			origin := proxies.Resolve(c.Request())
+			if !utils.ValidHost(origin.Host) {
+				origin.Host = c.Request().Host
+			}
+			c.Set(utils.ContextKeyOrigin, origin)
+			c.Request().Host = origin.Host
+			return next(c)
+		}
+	}
+}
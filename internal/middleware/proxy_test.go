@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxiesForwardedHost(t *testing.T) {
+	proxies, err := utils.NewTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	e := echo.New()
+	e.Use(TrustedProxies(proxies))
+	e.GET("/", func(c echo.Context) error {
+		origin := c.Get(utils.ContextKeyOrigin).(utils.Origin)
+		return c.String(http.StatusOK, c.Request().Host+" "+origin.Host)
+	})
+
+	serve := func(forwardedHost string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = "console.internal"
+		req.RemoteAddr = "10.0.0.2:5000"
+		req.Header.Set("X-Forwarded-Host", forwardedHost)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "console.example.com:8443 console.example.com:8443", serve("console.example.com:8443"))
+	for _, host := range []string{"evil.example/login", "evil.example:443@x", `"><script>`} {
+		assert.Equal(t, "console.internal console.internal", serve(host), host)
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Roles resolves the IronBuckets role of the signed-in user and exposes it to
+// handlers and, as .Role, to templates. It must run after AuthMiddleware.
+func Roles(roles *services.RoleService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			creds, ok := c.Get(utils.ContextKeyCreds).(*services.Credentials)
+			if !ok {
+				return next(c)
+			}
+			role := roles.Lookup(c.Request().Context(), sessionKey(c, creds), *creds)
+			c.Set(utils.ContextKeyRole, role)
+			utils.SetLayoutValue(c, "Role", role)
+			return next(c)
+		}
+	}
+}
+
+// RequireCapability is route-level middleware refusing users whose role lacks
+// capability. Requests without a role, because roles are not configured,
+// pass through.
+func RequireCapability(capability services.Capability) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get(utils.ContextKeyRole).(*services.Role)
+			if !role.Allows(capability) {
+				return echo.NewHTTPError(http.StatusForbidden,
+					fmt.Sprintf("Your role (%s) does not allow this action", role.Name))
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/damacus/iron-buckets/internal/services"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireCapabilityPassesWithoutRoles(t *testing.T) {
+	e := echo.New()
+	e.POST("/settings/restart", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, RequireCapability(services.CapabilityServerRestart))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/settings/restart", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/damacus/iron-buckets/internal/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -46,3 +47,51 @@ func TestSecurityHeadersAddsHSTSForSecureRequests(t *testing.T) {
 	require.Equal(t, http.StatusOK, rec.Code)
 	assert.Equal(t, "max-age=31536000; includeSubDomains", rec.Header().Get("Strict-Transport-Security"))
 }
+
+func TestSecurityHeadersTrustsForwardedProtoOnlyFromProxies(t *testing.T) {
+	proxies, err := utils.NewTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	e := echo.New()
+	e.Use(TrustedProxies(proxies))
+	e.Use(SecurityHeaders())
+	e.GET("/health", func(c echo.Context) error {
+		return c.String(http.StatusOK, "OK")
+	})
+
+	for remote, want := range map[string]string{
+		"10.0.0.2:5000":    "max-age=31536000; includeSubDomains",
+		"203.0.113.9:5000": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, want, rec.Header().Get("Strict-Transport-Security"), remote)
+	}
+}
+
+func TestSecurityHeadersUsesPerRequestNonce(t *testing.T) {
+	e := echo.New()
+	e.Use(SecurityHeaders())
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, utils.LayoutValues(c)["CSPNonce"].(string))
+	})
+
+	var nonces []string
+	for range 2 {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		nonce := rec.Body.String()
+		require.NotEmpty(t, nonce)
+		policy := rec.Header().Get("Content-Security-Policy")
+		assert.Contains(t, policy, "script-src 'self' 'nonce-"+nonce+"'")
+		assert.Contains(t, policy, "style-src 'self' 'nonce-"+nonce+"'")
+		assert.NotContains(t, policy, "unsafe-inline")
+		assert.NotContains(t, policy, "https:")
+		nonces = append(nonces, nonce)
+	}
+	assert.NotEqual(t, nonces[0], nonces[1])
+}
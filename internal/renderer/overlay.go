@@ -0,0 +1,50 @@
+package renderer
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+// Overlay returns a file system that serves files from dir where they exist
+// and from base otherwise, so a directory of customized templates only needs
+// the files it changes or adds
+func Overlay(dir, base fs.FS) fs.FS {
+	return overlay{dir: dir, base: base}
+}
+
+type overlay struct {
+	dir  fs.FS
+	base fs.FS
+}
+
+func (o overlay) Open(name string) (fs.File, error) {
+	file, err := o.dir.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return file, err
+	}
+	return o.base.Open(name)
+}
+
+// ReadDir lists both directories, so globs find files from either
+func (o overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := make(map[string]fs.DirEntry)
+	baseEntries, baseErr := fs.ReadDir(o.base, name)
+	for _, entry := range baseEntries {
+		entries[entry.Name()] = entry
+	}
+	dirEntries, dirErr := fs.ReadDir(o.dir, name)
+	for _, entry := range dirEntries {
+		entries[entry.Name()] = entry
+	}
+	if baseErr != nil && dirErr != nil {
+		return nil, baseErr
+	}
+
+	merged := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		merged = append(merged, entry)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
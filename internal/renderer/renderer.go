@@ -1,111 +1,191 @@
 package renderer
 
 import (
+	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
 
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/damacus/iron-buckets/views"
 	"github.com/labstack/echo/v4"
 )
 
 // TemplateRenderer implements echo.Renderer
 type TemplateRenderer struct {
+	// Templates maps a page or partial name to its template set. A set that
+	// defines "base" renders as a page; any other executes the block named
+	// after the template.
 	Templates map[string]*template.Template
+
+	fsys     fs.FS
+	reload   bool
+	basePath string
 }
 
-// New creates a new TemplateRenderer with pre-parsed templates
+// New parses the templates embedded in the binary
 func New() *TemplateRenderer {
-	r := &TemplateRenderer{
-		Templates: make(map[string]*template.Template),
+	r, err := Load(views.FS)
+	if err != nil {
+		panic(err)
 	}
-	r.parseTemplates()
 	return r
 }
 
-func (t *TemplateRenderer) parseTemplates() {
-	// Helper to parse layout + page + confirm dialog partial
-	parse := func(name, pageFile string) {
-		t.Templates[name] = template.Must(template.ParseFiles(
-			"views/layouts/base.html",
-			"views/partials/confirm_dialog.html",
-			"views/pages/"+pageFile,
-		))
-	}
-
-	parse("dashboard", "dashboard.html")
-	parse("drives", "drives.html")
-	parse("users", "users.html")
-	parse("groups", "groups.html")
-	parse("group_detail", "group_detail.html")
-	parse("buckets", "buckets.html")
-	parse("browser", "browser.html")
-	parse("settings", "settings.html")
-	parse("bucket_settings", "bucket_settings.html")
-	parse("policies", "policies.html")
-	parse("service_accounts", "service_accounts.html")
-
-	// Login is standalone
-	t.Templates["login"] = template.Must(template.ParseFiles("views/pages/login.html"))
+// Load parses the templates in fsys, which is laid out like the views
+// directory: every file in pages/ becomes a page and every file in
+// partials/ a partial, both named after the file
+func Load(fsys fs.FS) (*TemplateRenderer, error) {
+	r := &TemplateRenderer{fsys: fsys}
+	templates, err := r.parse()
+	if err != nil {
+		return nil, err
+	}
+	r.Templates = templates
+	return r, nil
+}
+
+// WithBasePath makes the url template function add basePath, the path
+// IronBuckets is served under, to application paths
+func (t *TemplateRenderer) WithBasePath(basePath string) *TemplateRenderer {
+	if t != nil {
+		t.basePath = basePath
+	}
+	return t
+}
+
+// WithReload parses the templates again on every render, so edits to an
+// override directory show without a restart. Meant for development.
+func (t *TemplateRenderer) WithReload(reload bool) *TemplateRenderer {
+	if t != nil {
+		t.reload = reload
+	}
+	return t
+}
+
+// funcs are the functions every template can call. url turns an
+// application path such as /buckets into the URL the browser uses.
+func (t *TemplateRenderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"url": func(path string) string {
+			return t.basePath + path
+		},
+	}
+}
+
+// parseFiles is template.ParseFiles with funcs available
+func (t *TemplateRenderer) parseFiles(files ...string) (*template.Template, error) {
+	return template.New(filepath.Base(files[0])).Funcs(t.funcs()).ParseFiles(files...)
+}
+
+// ParseFiles is template.ParseFiles with the template functions available,
+// for renderers built by hand. URLs are served from the root.
+func ParseFiles(files ...string) (*template.Template, error) {
+	return (&TemplateRenderer{}).parseFiles(files...)
+}
+
+// parse discovers and parses every page and partial. Pages can use the
+// layouts and every partial; partials can use each other.
+func (t *TemplateRenderer) parse() (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+
+	partialFiles, err := fs.Glob(t.fsys, "partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if len(partialFiles) > 0 {
+		partials, err := template.New("partials").Funcs(t.funcs()).ParseFS(t.fsys, partialFiles...)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range partialFiles {
+			templates[templateName(file)] = partials
+		}
+	}
+
+	pageFiles, err := fs.Glob(t.fsys, "pages/*.html")
+	if err != nil {
+		return nil, err
+	}
+	layoutFiles, err := fs.Glob(t.fsys, "layouts/*.html")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range pageFiles {
+		name := templateName(file)
+		if _, ok := templates[name]; ok {
+			return nil, fmt.Errorf("%s: a partial is already named %q", file, name)
+		}
+		files := append(append(append([]string(nil), layoutFiles...), partialFiles...), file)
+		page, err := template.New(name).Funcs(t.funcs()).ParseFS(t.fsys, files...)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = page
+	}
+
 	// Error fragment
-	t.Templates["login_error"] = template.Must(template.New("error").Parse(`{{.}}`))
-	// Partials
-	t.Templates["user_create_modal"] = template.Must(template.ParseFiles("views/partials/user_create_modal.html"))
-	t.Templates["group_create_modal"] = template.Must(template.ParseFiles("views/partials/group_create_modal.html"))
-	t.Templates["bucket_create_modal"] = template.Must(template.ParseFiles("views/partials/bucket_create_modal.html"))
-	t.Templates["folder_create_modal"] = template.Must(template.ParseFiles("views/partials/folder_create_modal.html"))
-	t.Templates["drives_widget"] = template.Must(template.ParseFiles("views/partials/drives_widget.html"))
-	t.Templates["storage_widget"] = template.Must(template.ParseFiles("views/partials/storage_widget.html"))
-	t.Templates["users_widget"] = template.Must(template.ParseFiles("views/partials/users_widget.html"))
-	t.Templates["server_widget"] = template.Must(template.ParseFiles("views/partials/server_widget.html"))
-	t.Templates["share_link"] = template.Must(template.ParseFiles("views/partials/share_link.html"))
-	t.Templates["policy_modal"] = template.Must(template.ParseFiles("views/partials/policy_modal.html"))
-	t.Templates["service_account_create_modal"] = template.Must(template.ParseFiles("views/partials/service_account_create_modal.html"))
-	t.Templates["service_account_created"] = template.Must(template.ParseFiles("views/partials/service_account_created.html"))
-	t.Templates["lifecycle_rules"] = template.Must(template.ParseFiles("views/partials/lifecycle_rules.html"))
-	t.Templates["notifications"] = template.Must(template.ParseFiles("views/partials/notifications.html"))
-	t.Templates["object_info"] = template.Must(template.ParseFiles("views/partials/object_info.html"))
-	t.Templates["replication"] = template.Must(template.ParseFiles("views/partials/replication.html"))
-	t.Templates["versioning_status"] = template.Must(template.ParseFiles("views/partials/versioning_status.html"))
-	t.Templates["bucket_quota"] = template.Must(template.ParseFiles("views/partials/bucket_quota.html"))
-	t.Templates["bucket_policy"] = template.Must(template.ParseFiles("views/partials/bucket_policy.html"))
-	t.Templates["logs"] = template.Must(template.ParseFiles("views/partials/logs.html"))
+	templates["login_error"] = template.Must(template.New("login_error").Parse(`{{.}}`))
+	return templates, nil
 }
 
-// selfExecutingTemplates lists templates that execute their own named block instead of "base"
-var selfExecutingTemplates = map[string]bool{
-	"user_create_modal":            true,
-	"bucket_create_modal":          true,
-	"folder_create_modal":          true,
-	"group_create_modal":           true,
-	"drives_widget":                true,
-	"storage_widget":               true,
-	"users_widget":                 true,
-	"server_widget":                true,
-	"share_link":                   true,
-	"policy_modal":                 true,
-	"service_account_create_modal": true,
-	"service_account_created":      true,
-	"lifecycle_rules":              true,
-	"notifications":                true,
-	"object_info":                  true,
-	"replication":                  true,
-	"versioning_status":            true,
-	"bucket_quota":                 true,
-	"bucket_policy":                true,
-	"logs":                         true,
+// templateName is the file name without its directory and extension
+func templateName(file string) string {
+	return strings.TrimSuffix(path.Base(file), path.Ext(file))
 }
 
 // Render renders a template document
 func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
-	tmpl, ok := t.Templates[name]
+	templates := t.Templates
+	if t.reload {
+		var err error
+		if templates, err = t.parse(); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Parsing templates: "+err.Error())
+		}
+	}
+	tmpl, ok := templates[name]
 	if !ok {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Template not found: "+name)
 	}
 
-	// Templates that define their own named block execute that block directly
-	if selfExecutingTemplates[name] {
+	data = withLayoutValues(data, c)
+
+	// Pages execute the "base" block of their layout; partials and other
+	// fragments execute their own named block
+	if tmpl.Lookup("base") == nil {
 		return tmpl.ExecuteTemplate(w, name, data)
 	}
-	// All other templates (pages with layout) execute the "base" block
 	return tmpl.ExecuteTemplate(w, "base", data)
 }
+
+// withLayoutValues adds the values middleware set for the layout, such as
+// the CSRF token, to template data without overriding anything the handler
+// set itself
+func withLayoutValues(data interface{}, c echo.Context) interface{} {
+	if c == nil {
+		return data
+	}
+	values := utils.LayoutValues(c)
+	if len(values) == 0 {
+		return data
+	}
+	page, ok := data.(map[string]interface{})
+	if !ok {
+		if data != nil {
+			return data
+		}
+		page = make(map[string]interface{})
+	}
+	merged := make(map[string]interface{}, len(page)+len(values))
+	for key, value := range values {
+		merged[key] = value
+	}
+	for key, value := range page {
+		merged[key] = value
+	}
+	return merged
+}
@@ -5,10 +5,15 @@ import (
 	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/damacus/iron-buckets/internal/utils"
+	"github.com/damacus/iron-buckets/views"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTemplateRenderer_RenderUnknownTemplate(t *testing.T) {
@@ -30,7 +35,7 @@ func TestTemplateRenderer_RenderUnknownTemplate(t *testing.T) {
 	assert.Contains(t, httpErr.Message, "Template not found")
 }
 
-func TestSelfExecutingTemplates_ContainsExpectedTemplates(t *testing.T) {
+func TestNewDiscoversPartials(t *testing.T) {
 	expectedTemplates := []string{
 		"user_create_modal",
 		"bucket_create_modal",
@@ -51,18 +56,23 @@ func TestSelfExecutingTemplates_ContainsExpectedTemplates(t *testing.T) {
 		"versioning_status",
 		"bucket_quota",
 		"logs",
+		"session_warning",
+		"mfa_recovery_codes",
+		"api_token_created",
 	}
 
-	for _, tmpl := range expectedTemplates {
-		t.Run(tmpl, func(t *testing.T) {
-			if !selfExecutingTemplates[tmpl] {
-				t.Errorf("expected %q to be in selfExecutingTemplates", tmpl)
+	r := New()
+	for _, name := range expectedTemplates {
+		t.Run(name, func(t *testing.T) {
+			tmpl, ok := r.Templates[name]
+			if !ok || tmpl.Lookup(name) == nil || tmpl.Lookup("base") != nil {
+				t.Errorf("expected %q to be a partial that executes its own block", name)
 			}
 		})
 	}
 }
 
-func TestSelfExecutingTemplates_DoesNotContainPageTemplates(t *testing.T) {
+func TestNewDiscoversPages(t *testing.T) {
 	pageTemplates := []string{
 		"dashboard",
 		"drives",
@@ -72,12 +82,18 @@ func TestSelfExecutingTemplates_DoesNotContainPageTemplates(t *testing.T) {
 		"browser",
 		"settings",
 		"login",
+		"login_mfa",
+		"login_mfa_enroll",
+		"mfa",
+		"api_tokens",
 	}
 
-	for _, tmpl := range pageTemplates {
-		t.Run(tmpl, func(t *testing.T) {
-			if selfExecutingTemplates[tmpl] {
-				t.Errorf("page template %q should not be in selfExecutingTemplates", tmpl)
+	r := New()
+	for _, name := range pageTemplates {
+		t.Run(name, func(t *testing.T) {
+			tmpl, ok := r.Templates[name]
+			if !ok || tmpl.Lookup("base") == nil {
+				t.Errorf("expected %q to be a page with a base layout", name)
 			}
 		})
 	}
@@ -93,17 +109,6 @@ func TestTemplateRenderer_RenderSelfExecutingTemplate(t *testing.T) {
 		},
 	}
 
-	// Temporarily add to selfExecutingTemplates for test
-	originalValue := selfExecutingTemplates["test_widget"]
-	selfExecutingTemplates["test_widget"] = true
-	defer func() {
-		if originalValue {
-			selfExecutingTemplates["test_widget"] = true
-		} else {
-			delete(selfExecutingTemplates, "test_widget")
-		}
-	}()
-
 	e := echo.New()
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rec := httptest.NewRecorder()
@@ -115,3 +120,72 @@ func TestTemplateRenderer_RenderSelfExecutingTemplate(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Hello World", buf.String())
 }
+
+func TestTemplateRenderer_RenderPageAddsLayoutValues(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`{{ define "base" }}{{ .Cluster }}/{{ .Title }}{{ end }}`))
+	r := &TemplateRenderer{
+		Templates: map[string]*template.Template{"page": tmpl},
+	}
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	utils.SetLayoutValue(c, "Cluster", "prod")
+	utils.SetLayoutValue(c, "Title", "from layout")
+
+	var buf bytes.Buffer
+	err := r.Render(&buf, "page", map[string]interface{}{"Title": "from handler"}, c)
+
+	assert.NoError(t, err)
+	// Handler data wins over layout values of the same name
+	assert.Equal(t, "prod/from handler", buf.String())
+}
+
+func TestTemplateRenderer_URLAddsBasePath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "link.html")
+	require.NoError(t, os.WriteFile(file, []byte(`{{ define "base" }}<a href="{{ url "/buckets/" }}{{ .Name }}">{{ end }}`), 0o600))
+
+	r := (&TemplateRenderer{Templates: map[string]*template.Template{}}).WithBasePath("/storage")
+	tmpl, err := r.parseFiles(file)
+	require.NoError(t, err)
+	r.Templates["link"] = tmpl
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(&buf, "link", map[string]interface{}{"Name": "a b"}, c))
+	assert.Equal(t, `<a href="/storage/buckets/a%20b">`, buf.String())
+}
+
+func TestLoadUsesOverridesAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "partials"), 0o755))
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "partials", name), []byte(content), 0o600))
+	}
+	write("share_link.html", `{{ define "share_link" }}custom {{ .URL }}{{ end }}`)
+	write("banner.html", `{{ define "banner" }}new partial{{ end }}`)
+
+	r, err := Load(Overlay(os.DirFS(dir), views.FS))
+	require.NoError(t, err)
+	r.WithReload(true)
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	render := func(name string, data interface{}) string {
+		var buf bytes.Buffer
+		require.NoError(t, r.Render(&buf, name, data, c))
+		return buf.String()
+	}
+
+	// Overridden and added files are used; the rest still comes from the binary
+	assert.Equal(t, "custom https://example.com", render("share_link", map[string]interface{}{"URL": "https://example.com"}))
+	assert.Equal(t, "new partial", render("banner", nil))
+	assert.Contains(t, r.Templates, "dashboard")
+
+	// With reload on, edits show on the next render
+	write("banner.html", `{{ define "banner" }}edited{{ end }}`)
+	assert.Equal(t, "edited", render("banner", nil))
+
+	write("banner.html", `{{ define "banner" }}{{ end `)
+	var buf bytes.Buffer
+	assert.Error(t, r.Render(&buf, "banner", nil, c))
+}
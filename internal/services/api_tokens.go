@@ -0,0 +1,420 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+const (
+	apiTokenPrefix      = "ibt_"
+	apiTokenIDBytes     = 8
+	apiTokenSealPurpose = "api-token"
+	// apiTokenUseInterval limits how often a token's last use is written to the store
+	apiTokenUseInterval = time.Minute
+)
+
+var (
+	// ErrAPITokenInvalid is returned for a malformed, unknown, revoked or expired token
+	ErrAPITokenInvalid = errors.New("invalid API token")
+	// ErrAPITokenNotFound is returned when a token ID does not exist
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+// APITokenScope limits what a token may do
+type APITokenScope string
+
+const (
+	APITokenReadOnly  APITokenScope = "read-only"
+	APITokenReadWrite APITokenScope = "read-write"
+)
+
+// ParseAPITokenScope validates a scope from a form
+func ParseAPITokenScope(value string) (APITokenScope, error) {
+	switch scope := APITokenScope(value); scope {
+	case APITokenReadOnly, APITokenReadWrite:
+		return scope, nil
+	}
+	return "", fmt.Errorf("unknown scope %q", value)
+}
+
+// readOnlyTokenPolicy is attached to the service account of read-only tokens,
+// so MinIO enforces the scope as well as IronBuckets
+var readOnlyTokenPolicy = json.RawMessage(`{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Effect": "Allow", "Action": ["s3:GetBucket*", "s3:GetObject*", "s3:ListBucket*", "s3:ListAllMyBuckets"], "Resource": ["arn:aws:s3:::*"]},
+    {"Effect": "Allow", "Action": ["admin:ServerInfo", "admin:DataUsageInfo", "admin:ListUsers", "admin:ListGroups", "admin:GetGroup", "admin:GetPolicy", "admin:ListServiceAccounts", "admin:GetBucketQuota"]}
+  ]
+}`)
+
+// APITokenConfig configures personal API tokens
+type APITokenConfig struct {
+	Enabled bool
+	// File is where tokens are stored
+	File string
+	// MaxLifetime caps the expiry users can choose
+	MaxLifetime time.Duration
+}
+
+// APIToken is a personal token for scripted access. Each token is backed by
+// its own MinIO service account, which expires with the token; the service
+// account secret is sealed with the session keyring and the token itself is
+// stored only as a SHA-256 hash.
+type APIToken struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name"`
+	Owner     string        `json:"owner"`
+	Scope     APITokenScope `json:"scope"`
+	Hash      string        `json:"hash"`
+	Endpoint  string        `json:"endpoint"`
+	AccessKey string        `json:"accessKey"`
+	SecretKey string        `json:"secretKey"`
+	CreatedAt time.Time     `json:"createdAt"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	// LastUsedAt and LastUsedIP record the most recent request made with the token
+	LastUsedAt time.Time `json:"lastUsedAt,omitzero"`
+	LastUsedIP string    `json:"lastUsedIp,omitempty"`
+}
+
+// Expired reports whether the token can no longer be used
+func (t APIToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// APITokenStore persists tokens
+type APITokenStore interface {
+	// Get returns ErrAPITokenNotFound when the token does not exist
+	Get(id string) (APIToken, error)
+	Save(token APIToken) error
+	Delete(id string) error
+	// List returns tokens ordered by creation time
+	List() ([]APIToken, error)
+}
+
+// MemoryAPITokenStore keeps tokens in process memory
+type MemoryAPITokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]APIToken
+}
+
+// NewMemoryAPITokenStore creates an empty in-memory store
+func NewMemoryAPITokenStore() *MemoryAPITokenStore {
+	return &MemoryAPITokenStore{tokens: make(map[string]APIToken)}
+}
+
+func (m *MemoryAPITokenStore) Get(id string) (APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	token, ok := m.tokens[id]
+	if !ok {
+		return APIToken{}, ErrAPITokenNotFound
+	}
+	return token, nil
+}
+
+func (m *MemoryAPITokenStore) Save(token APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token.ID] = token
+	return nil
+}
+
+func (m *MemoryAPITokenStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, id)
+	return nil
+}
+
+func (m *MemoryAPITokenStore) List() ([]APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tokens := make([]APIToken, 0, len(m.tokens))
+	for _, token := range m.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// FileAPITokenStore keeps tokens in memory and writes them to a JSON file
+// with 0600 permissions on every change
+type FileAPITokenStore struct {
+	*MemoryAPITokenStore
+	path    string
+	writeMu sync.Mutex
+}
+
+// NewFileAPITokenStore loads tokens from path, which is created on first write
+func NewFileAPITokenStore(path string) (*FileAPITokenStore, error) {
+	store := &FileAPITokenStore{MemoryAPITokenStore: NewMemoryAPITokenStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading API token file: %w", err)
+	}
+
+	var tokens []APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("parsing API token file: %w", err)
+	}
+	for _, token := range tokens {
+		store.tokens[token.ID] = token
+	}
+	return store, nil
+}
+
+func (f *FileAPITokenStore) Save(token APIToken) error {
+	if err := f.MemoryAPITokenStore.Save(token); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileAPITokenStore) Delete(id string) error {
+	if err := f.MemoryAPITokenStore.Delete(id); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileAPITokenStore) flush() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	tokens, err := f.List()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// APITokenService mints, resolves and revokes personal API tokens
+type APITokenService struct {
+	mu           sync.Mutex
+	store        APITokenStore
+	keyring      *Keyring
+	minioFactory MinioClientFactory
+	maxLifetime  time.Duration
+	now          func() time.Time
+}
+
+// NewAPITokenService creates a token service. Service accounts are created
+// through minioFactory and their secrets sealed with keyring.
+func NewAPITokenService(store APITokenStore, keyring *Keyring, minioFactory MinioClientFactory, maxLifetime time.Duration) *APITokenService {
+	return &APITokenService{
+		store:        store,
+		keyring:      keyring,
+		minioFactory: minioFactory,
+		maxLifetime:  maxLifetime,
+		now:          time.Now,
+	}
+}
+
+// MaxLifetime is the longest expiry a token can have
+func (s *APITokenService) MaxLifetime() time.Duration {
+	return s.maxLifetime
+}
+
+// Create mints a token for owner and returns it with the only copy of its
+// plaintext value. owner should hold a long-term key where one is available,
+// since MinIO makes the service account a child of the requesting identity.
+func (s *APITokenService) Create(ctx context.Context, owner Credentials, name string, scope APITokenScope, lifetime time.Duration) (APIToken, string, error) {
+	if lifetime <= 0 || lifetime > s.maxLifetime {
+		return APIToken{}, "", fmt.Errorf("lifetime must be between 1 day and %d days", int(s.maxLifetime.Hours()/24))
+	}
+
+	idBytes := make([]byte, apiTokenIDBytes)
+	if _, err := rand.Read(idBytes); err != nil {
+		return APIToken{}, "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret, err := NewRandomToken(32)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	plaintext := apiTokenPrefix + id + "." + secret
+
+	now := s.now()
+	expires := now.Add(lifetime)
+	req := madmin.AddServiceAccountReq{
+		Description: "IronBuckets API token: " + name,
+		Expiration:  &expires,
+	}
+	if scope == APITokenReadOnly {
+		req.Policy = readOnlyTokenPolicy
+	}
+	mdm, err := s.minioFactory.NewAdminClient(owner)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	account, err := mdm.AddServiceAccount(ctx, req)
+	if err != nil {
+		return APIToken{}, "", fmt.Errorf("creating service account: %w", err)
+	}
+
+	sealed, err := s.keyring.seal([]byte(account.SecretKey), apiTokenSealPurpose)
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	token := APIToken{
+		ID:        id,
+		Name:      name,
+		Owner:     owner.Identity(),
+		Scope:     scope,
+		Hash:      hashAPITokenSecret(secret),
+		Endpoint:  owner.Endpoint,
+		AccessKey: account.AccessKey,
+		SecretKey: sealed,
+		CreatedAt: now,
+		ExpiresAt: expires,
+	}
+	if err := s.store.Save(token); err != nil {
+		_ = mdm.DeleteServiceAccount(ctx, account.AccessKey)
+		return APIToken{}, "", err
+	}
+	return token, plaintext, nil
+}
+
+// List returns the tokens owned by owner, or every token when owner is empty
+func (s *APITokenService) List(owner string) ([]APIToken, error) {
+	tokens, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	if owner == "" {
+		return tokens, nil
+	}
+	owned := tokens[:0]
+	for _, token := range tokens {
+		if token.Owner == owner {
+			owned = append(owned, token)
+		}
+	}
+	return owned, nil
+}
+
+// Get returns a token by ID
+func (s *APITokenService) Get(id string) (APIToken, error) {
+	return s.store.Get(id)
+}
+
+// Revoke deletes a token and its service account, using by to talk to MinIO.
+// The token stops working even if the service account cannot be removed,
+// since its secret exists nowhere else.
+func (s *APITokenService) Revoke(ctx context.Context, by Credentials, id string) error {
+	token, err := s.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Delete(id); err != nil {
+		return err
+	}
+
+	mdm, err := s.minioFactory.NewAdminClient(by)
+	if err == nil {
+		err = mdm.DeleteServiceAccount(ctx, token.AccessKey)
+	}
+	if err != nil {
+		log.Printf("API tokens: token %s revoked but service account %s could not be removed: %v", token.ID, token.AccessKey, err)
+	}
+	return nil
+}
+
+// Authenticate resolves a presented token to its service account credentials.
+// The last use is written to the store at most once a minute per address.
+func (s *APITokenService) Authenticate(raw, remoteIP string) (APIToken, Credentials, error) {
+	id, secret, ok := parseAPIToken(raw)
+	if !ok {
+		return APIToken{}, Credentials{}, ErrAPITokenInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.store.Get(id)
+	if errors.Is(err, ErrAPITokenNotFound) {
+		return APIToken{}, Credentials{}, ErrAPITokenInvalid
+	}
+	if err != nil {
+		return APIToken{}, Credentials{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(secret)), []byte(token.Hash)) != 1 {
+		return APIToken{}, Credentials{}, ErrAPITokenInvalid
+	}
+	now := s.now()
+	if token.Expired(now) {
+		return APIToken{}, Credentials{}, ErrAPITokenInvalid
+	}
+
+	secretKey, err := s.keyring.open(token.SecretKey, apiTokenSealPurpose)
+	if err != nil {
+		return APIToken{}, Credentials{}, fmt.Errorf("opening API token %s: %w", token.ID, err)
+	}
+
+	changed := false
+	// Move secrets sealed with a retired key onto the current primary key
+	if !strings.HasPrefix(token.SecretKey, s.keyring.Primary().ID+".") {
+		if resealed, err := s.keyring.seal(secretKey, apiTokenSealPurpose); err == nil {
+			token.SecretKey = resealed
+			changed = true
+		}
+	}
+	if now.Sub(token.LastUsedAt) >= apiTokenUseInterval || token.LastUsedIP != remoteIP {
+		token.LastUsedAt = now
+		token.LastUsedIP = remoteIP
+		changed = true
+	}
+	if changed {
+		if err := s.store.Save(token); err != nil {
+			log.Printf("API tokens: failed to record use of %s: %v", token.ID, err)
+		}
+	}
+
+	return token, Credentials{
+		Endpoint:  token.Endpoint,
+		AccessKey: token.AccessKey,
+		SecretKey: string(secretKey),
+		User:      token.Owner,
+	}, nil
+}
+
+func parseAPIToken(raw string) (id, secret string, ok bool) {
+	rest, found := strings.CutPrefix(raw, apiTokenPrefix)
+	if !found {
+		return "", "", false
+	}
+	id, secret, found = strings.Cut(rest, ".")
+	if !found || len(id) != 2*apiTokenIDBytes || secret == "" {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// fakeServiceAccounts records the service accounts created for tokens
+type fakeServiceAccounts struct {
+	MinioAdminClient
+	created []madmin.AddServiceAccountReq
+	deleted []string
+	addErr  error
+}
+
+func (f *fakeServiceAccounts) AddServiceAccount(_ context.Context, req madmin.AddServiceAccountReq) (madmin.Credentials, error) {
+	if f.addErr != nil {
+		return madmin.Credentials{}, f.addErr
+	}
+	f.created = append(f.created, req)
+	return madmin.Credentials{AccessKey: fmt.Sprintf("svc-%d", len(f.created)), SecretKey: "svc-secret"}, nil
+}
+
+func (f *fakeServiceAccounts) DeleteServiceAccount(_ context.Context, accessKey string) error {
+	f.deleted = append(f.deleted, accessKey)
+	return nil
+}
+
+type fakeServiceAccountFactory struct {
+	admin *fakeServiceAccounts
+}
+
+func (f *fakeServiceAccountFactory) NewAdminClient(Credentials) (MinioAdminClient, error) {
+	return f.admin, nil
+}
+
+func (f *fakeServiceAccountFactory) NewClient(Credentials) (MinioClient, error) {
+	return nil, errors.New("not used")
+}
+
+func newTestAPITokenService(t *testing.T, store APITokenStore, keyring *Keyring) (*APITokenService, *fakeServiceAccountFactory, *time.Time) {
+	t.Helper()
+	if keyring == nil {
+		var err error
+		keyring, err = NewKeyring(SessionKey{ID: "test", Key: []byte("0123456789abcdef0123456789abcdef")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	factory := &fakeServiceAccountFactory{admin: &fakeServiceAccounts{}}
+	svc := NewAPITokenService(store, keyring, factory, 90*24*time.Hour)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	return svc, factory, &now
+}
+
+var tokenOwner = Credentials{Endpoint: "minio:9000", AccessKey: "alice-key", SecretKey: "alice-secret", User: "alice"}
+
+func TestAPITokenService_CreateAndAuthenticate(t *testing.T) {
+	svc, factory, _ := newTestAPITokenService(t, NewMemoryAPITokenStore(), nil)
+
+	token, plaintext, err := svc.Create(context.Background(), tokenOwner, "backup", APITokenReadWrite, 7*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plaintext, "ibt_"+token.ID+".") {
+		t.Errorf("plaintext %q does not carry the token ID", plaintext)
+	}
+	if strings.Contains(token.Hash, plaintext) || token.SecretKey == "svc-secret" {
+		t.Error("token record must not hold the plaintext token or service account secret")
+	}
+	if len(factory.admin.created) != 1 {
+		t.Fatalf("expected one service account, got %d", len(factory.admin.created))
+	}
+	req := factory.admin.created[0]
+	if req.Expiration == nil || !req.Expiration.Equal(token.ExpiresAt) {
+		t.Errorf("service account should expire with the token, got %v", req.Expiration)
+	}
+	if len(req.Policy) != 0 {
+		t.Error("read-write tokens should inherit the owner's policy")
+	}
+
+	got, creds, err := svc.Authenticate(plaintext, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != token.ID || creds.AccessKey != token.AccessKey || creds.SecretKey != "svc-secret" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+	if creds.User != "alice" || creds.Endpoint != "minio:9000" {
+		t.Errorf("credentials should name the owner and endpoint, got %+v", creds)
+	}
+	if got.LastUsedIP != "10.0.0.1" {
+		t.Errorf("last use not recorded: %+v", got)
+	}
+}
+
+func TestAPITokenService_ReadOnlyAttachesPolicy(t *testing.T) {
+	svc, factory, _ := newTestAPITokenService(t, NewMemoryAPITokenStore(), nil)
+
+	if _, _, err := svc.Create(context.Background(), tokenOwner, "reports", APITokenReadOnly, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if len(factory.admin.created[0].Policy) == 0 {
+		t.Error("read-only tokens should be limited by a session policy")
+	}
+}
+
+func TestAPITokenService_RejectsBadTokens(t *testing.T) {
+	svc, _, now := newTestAPITokenService(t, NewMemoryAPITokenStore(), nil)
+	token, plaintext, err := svc.Create(context.Background(), tokenOwner, "backup", APITokenReadWrite, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, raw := range map[string]string{
+		"empty":        "",
+		"no prefix":    strings.TrimPrefix(plaintext, "ibt_"),
+		"wrong secret": "ibt_" + token.ID + ".wrong",
+		"unknown id":   "ibt_0000000000000000.secret",
+	} {
+		if _, _, err := svc.Authenticate(raw, "10.0.0.1"); !errors.Is(err, ErrAPITokenInvalid) {
+			t.Errorf("%s: expected ErrAPITokenInvalid, got %v", name, err)
+		}
+	}
+
+	*now = now.Add(24 * time.Hour)
+	if _, _, err := svc.Authenticate(plaintext, "10.0.0.1"); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Errorf("expired token: expected ErrAPITokenInvalid, got %v", err)
+	}
+}
+
+func TestAPITokenService_CreateRejectsLongLifetime(t *testing.T) {
+	svc, factory, _ := newTestAPITokenService(t, NewMemoryAPITokenStore(), nil)
+
+	if _, _, err := svc.Create(context.Background(), tokenOwner, "backup", APITokenReadWrite, 91*24*time.Hour); err == nil {
+		t.Fatal("expected an error for a lifetime over the maximum")
+	}
+	if len(factory.admin.created) != 0 {
+		t.Error("no service account should be created")
+	}
+}
+
+func TestAPITokenService_CreateFailsWithoutServiceAccount(t *testing.T) {
+	store := NewMemoryAPITokenStore()
+	svc, factory, _ := newTestAPITokenService(t, store, nil)
+	factory.admin.addErr = errors.New("access denied")
+
+	if _, _, err := svc.Create(context.Background(), tokenOwner, "backup", APITokenReadWrite, 24*time.Hour); err == nil {
+		t.Fatal("expected an error when MinIO refuses the service account")
+	}
+	if tokens, _ := store.List(); len(tokens) != 0 {
+		t.Errorf("no token should be stored, got %d", len(tokens))
+	}
+}
+
+func TestAPITokenService_Revoke(t *testing.T) {
+	svc, factory, _ := newTestAPITokenService(t, NewMemoryAPITokenStore(), nil)
+	token, plaintext, err := svc.Create(context.Background(), tokenOwner, "backup", APITokenReadWrite, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.Revoke(context.Background(), tokenOwner, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(factory.admin.deleted) != 1 || factory.admin.deleted[0] != token.AccessKey {
+		t.Errorf("service account not removed: %v", factory.admin.deleted)
+	}
+	if _, _, err := svc.Authenticate(plaintext, "10.0.0.1"); !errors.Is(err, ErrAPITokenInvalid) {
+		t.Errorf("revoked token: expected ErrAPITokenInvalid, got %v", err)
+	}
+	if err := svc.Revoke(context.Background(), tokenOwner, token.ID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("expected ErrAPITokenNotFound, got %v", err)
+	}
+}
+
+func TestAPITokenService_ListByOwner(t *testing.T) {
+	svc, _, _ := newTestAPITokenService(t, NewMemoryAPITokenStore(), nil)
+	bob := tokenOwner
+	bob.User = "bob"
+	for _, owner := range []Credentials{tokenOwner, bob, tokenOwner} {
+		if _, _, err := svc.Create(context.Background(), owner, "t", APITokenReadOnly, 24*time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mine, err := svc.List("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 2 {
+		t.Errorf("expected 2 tokens for alice, got %d", len(mine))
+	}
+	all, err := svc.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("expected 3 tokens in total, got %d", len(all))
+	}
+}
+
+func TestAPITokenService_ReplacesRetiredKey(t *testing.T) {
+	oldKey := SessionKey{ID: "old", Key: []byte("0123456789abcdef0123456789abcdef")}
+	newKey := SessionKey{ID: "new", Key: []byte("abcdef0123456789abcdef0123456789")}
+	oldRing, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryAPITokenStore()
+	svc, _, _ := newTestAPITokenService(t, store, oldRing)
+	token, plaintext, err := svc.Create(context.Background(), tokenOwner, "backup", APITokenReadWrite, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewKeyring(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, _, _ = newTestAPITokenService(t, store, rotated)
+	if _, _, err := svc.Authenticate(plaintext, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.Get(token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored.SecretKey, "new.") {
+		t.Errorf("secret should be resealed with the primary key, got %q", stored.SecretKey)
+	}
+}
+
+func TestFileAPITokenStore_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewFileAPITokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, _, _ := newTestAPITokenService(t, store, nil)
+	token, plaintext, err := svc.Create(context.Background(), tokenOwner, "backup", APITokenReadWrite, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileAPITokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get(token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != token.Hash || got.AccessKey != token.AccessKey {
+		t.Errorf("token not persisted: %+v", got)
+	}
+	svc, _, _ = newTestAPITokenService(t, reopened, nil)
+	if _, _, err := svc.Authenticate(plaintext, "10.0.0.1"); err != nil {
+		t.Errorf("token should still work after a restart: %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApprovalAction names a destructive operation that can require a second
+// person's approval
+type ApprovalAction string
+
+const (
+	ApprovalDeleteBucket  ApprovalAction = "delete-bucket"
+	ApprovalDeleteFolder  ApprovalAction = "delete-folder"
+	ApprovalDeleteUser    ApprovalAction = "delete-user"
+	ApprovalRestartServer ApprovalAction = "restart-server"
+)
+
+// ApprovalActions lists every action that can be protected
+var ApprovalActions = []ApprovalAction{
+	ApprovalDeleteBucket,
+	ApprovalDeleteFolder,
+	ApprovalDeleteUser,
+	ApprovalRestartServer,
+}
+
+// ApprovalStatus is where a request is in its life
+type ApprovalStatus string
+
+const (
+	ApprovalPending   ApprovalStatus = "pending"
+	ApprovalApproved  ApprovalStatus = "approved"
+	ApprovalRejected  ApprovalStatus = "rejected"
+	ApprovalCancelled ApprovalStatus = "cancelled"
+	ApprovalExpired   ApprovalStatus = "expired"
+	// ApprovalFailed means the request was approved but running it failed
+	ApprovalFailed ApprovalStatus = "failed"
+)
+
+// approvalHistory is how long closed requests stay listed
+const approvalHistory = 7 * 24 * time.Hour
+
+var (
+	// ErrApprovalNotFound is returned when a request ID does not exist
+	ErrApprovalNotFound = errors.New("approval request not found")
+	// ErrApprovalClosed is returned when a request was already decided or has expired
+	ErrApprovalClosed = errors.New("approval request is no longer pending")
+	// ErrApprovalSelf is returned when someone tries to approve their own request
+	ErrApprovalSelf = errors.New("requests must be approved by someone else")
+	// ErrApprovalCluster is returned when the approver is signed in to another cluster
+	ErrApprovalCluster = errors.New("approval request belongs to another cluster")
+)
+
+// ApprovalConfig configures the four-eyes approval workflow
+type ApprovalConfig struct {
+	// Actions that need approval; empty turns the workflow off
+	Actions map[ApprovalAction]bool
+	// File is where requests are stored
+	File string
+	// TTL is how long a request waits for approval
+	TTL time.Duration
+}
+
+// Enabled reports whether any action needs approval
+func (c ApprovalConfig) Enabled() bool {
+	return len(c.Actions) > 0
+}
+
+// ParseApprovalActions reads a list of actions, where "all" stands for
+// every action that can require approval
+func ParseApprovalActions(values []string) (map[ApprovalAction]bool, error) {
+	actions := make(map[ApprovalAction]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if value == "all" {
+			for _, action := range ApprovalActions {
+				actions[action] = true
+			}
+			continue
+		}
+		action, err := ParseApprovalAction(value)
+		if err != nil {
+			return nil, err
+		}
+		actions[action] = true
+	}
+	return actions, nil
+}
+
+// ParseApprovalAction validates an action name
+func ParseApprovalAction(value string) (ApprovalAction, error) {
+	for _, action := range ApprovalActions {
+		if ApprovalAction(value) == action {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("unknown action %q", value)
+}
+
+// ApprovalRequest is a protected action waiting for, or past, a decision
+type ApprovalRequest struct {
+	ID     string         `json:"id"`
+	Action ApprovalAction `json:"action"`
+	// Params hold what the action works on, such as the bucket name
+	Params map[string]string `json:"params"`
+	// Summary describes the action for people, e.g. "Delete bucket reports"
+	Summary   string         `json:"summary"`
+	Requester string         `json:"requester"`
+	Endpoint  string         `json:"endpoint"`
+	Status    ApprovalStatus `json:"status"`
+	CreatedAt time.Time      `json:"createdAt"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	DecidedBy string         `json:"decidedBy,omitempty"`
+	DecidedAt time.Time      `json:"decidedAt,omitzero"`
+	// Error is why running an approved request failed
+	Error string `json:"error,omitempty"`
+}
+
+// StatusAt returns the status, reporting pending requests past their expiry
+// as expired
+func (r ApprovalRequest) StatusAt(now time.Time) ApprovalStatus {
+	if r.Status == ApprovalPending && !now.Before(r.ExpiresAt) {
+		return ApprovalExpired
+	}
+	return r.Status
+}
+
+// ApprovalStore persists approval requests
+type ApprovalStore interface {
+	// Get returns ErrApprovalNotFound when the request does not exist
+	Get(id string) (ApprovalRequest, error)
+	Save(request ApprovalRequest) error
+	Delete(id string) error
+	// List returns requests ordered by creation time
+	List() ([]ApprovalRequest, error)
+}
+
+// MemoryApprovalStore keeps requests in process memory
+type MemoryApprovalStore struct {
+	mu       sync.RWMutex
+	requests map[string]ApprovalRequest
+}
+
+// NewMemoryApprovalStore creates an empty in-memory store
+func NewMemoryApprovalStore() *MemoryApprovalStore {
+	return &MemoryApprovalStore{requests: make(map[string]ApprovalRequest)}
+}
+
+func (m *MemoryApprovalStore) Get(id string) (ApprovalRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	request, ok := m.requests[id]
+	if !ok {
+		return ApprovalRequest{}, ErrApprovalNotFound
+	}
+	return request, nil
+}
+
+func (m *MemoryApprovalStore) Save(request ApprovalRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[request.ID] = request
+	return nil
+}
+
+func (m *MemoryApprovalStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.requests, id)
+	return nil
+}
+
+func (m *MemoryApprovalStore) List() ([]ApprovalRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	requests := make([]ApprovalRequest, 0, len(m.requests))
+	for _, request := range m.requests {
+		requests = append(requests, request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests, nil
+}
+
+// FileApprovalStore keeps requests in memory and writes them to a JSON file
+// with 0600 permissions on every change
+type FileApprovalStore struct {
+	*MemoryApprovalStore
+	path    string
+	writeMu sync.Mutex
+}
+
+// NewFileApprovalStore loads requests from path, which is created on first write
+func NewFileApprovalStore(path string) (*FileApprovalStore, error) {
+	store := &FileApprovalStore{MemoryApprovalStore: NewMemoryApprovalStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading approvals file: %w", err)
+	}
+
+	var requests []ApprovalRequest
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return nil, fmt.Errorf("parsing approvals file: %w", err)
+	}
+	for _, request := range requests {
+		store.requests[request.ID] = request
+	}
+	return store, nil
+}
+
+func (f *FileApprovalStore) Save(request ApprovalRequest) error {
+	if err := f.MemoryApprovalStore.Save(request); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileApprovalStore) Delete(id string) error {
+	if err := f.MemoryApprovalStore.Delete(id); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileApprovalStore) flush() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	requests, err := f.List()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(requests)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// ApprovalService runs the four-eyes workflow: a protected action becomes a
+// pending request, and a different user must approve it before it runs with
+// the approver's credentials. A nil service protects nothing.
+type ApprovalService struct {
+	mu      sync.Mutex
+	store   ApprovalStore
+	actions map[ApprovalAction]bool
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// NewApprovalService creates the workflow for the actions in config
+func NewApprovalService(config ApprovalConfig, store ApprovalStore) *ApprovalService {
+	return &ApprovalService{
+		store:   store,
+		actions: config.Actions,
+		ttl:     config.TTL,
+		now:     time.Now,
+	}
+}
+
+// Required reports whether action needs approval
+func (s *ApprovalService) Required(action ApprovalAction) bool {
+	return s != nil && s.actions[action]
+}
+
+// Submit records a pending request for requester
+func (s *ApprovalService) Submit(requester Credentials, action ApprovalAction, params map[string]string, summary string) (ApprovalRequest, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return ApprovalRequest{}, err
+	}
+	now := s.now()
+	request := ApprovalRequest{
+		ID:        hex.EncodeToString(idBytes),
+		Action:    action,
+		Params:    params,
+		Summary:   summary,
+		Requester: requester.Identity(),
+		Endpoint:  requester.Endpoint,
+		Status:    ApprovalPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	if err := s.store.Save(request); err != nil {
+		return ApprovalRequest{}, err
+	}
+	return request, nil
+}
+
+// List returns the requests for a cluster endpoint, newest first, with
+// expired requests marked as such. Requests closed longer than a week ago
+// are dropped.
+func (s *ApprovalService) List(endpoint string) ([]ApprovalRequest, error) {
+	requests, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	var listed []ApprovalRequest
+	for _, request := range requests {
+		request.Status = request.StatusAt(now)
+		closedAt := request.DecidedAt
+		if request.Status == ApprovalExpired {
+			closedAt = request.ExpiresAt
+		}
+		if request.Status != ApprovalPending && now.Sub(closedAt) > approvalHistory {
+			_ = s.store.Delete(request.ID)
+			continue
+		}
+		if request.Endpoint == endpoint {
+			listed = append(listed, request)
+		}
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		return listed[i].CreatedAt.After(listed[j].CreatedAt)
+	})
+	return listed, nil
+}
+
+// Waiting counts the pending requests on endpoint that identity could decide,
+// that is, everyone else's
+func (s *ApprovalService) Waiting(identity, endpoint string) int {
+	requests, err := s.store.List()
+	if err != nil {
+		return 0
+	}
+	now := s.now()
+	count := 0
+	for _, request := range requests {
+		if request.Endpoint == endpoint && request.Requester != identity && request.StatusAt(now) == ApprovalPending {
+			count++
+		}
+	}
+	return count
+}
+
+// Get returns a request by ID
+func (s *ApprovalService) Get(id string) (ApprovalRequest, error) {
+	return s.store.Get(id)
+}
+
+// Approve marks a pending request approved by approver and returns it so the
+// caller can run it with the approver's credentials. A request is only ever
+// handed out once.
+func (s *ApprovalService) Approve(id string, approver Credentials) (ApprovalRequest, error) {
+	return s.decide(id, approver, ApprovalApproved)
+}
+
+// Reject closes a pending request without running it. Requesters can
+// withdraw their own requests, which records them as cancelled.
+func (s *ApprovalService) Reject(id string, by Credentials) (ApprovalRequest, error) {
+	return s.decide(id, by, ApprovalRejected)
+}
+
+// Fail records that running an approved request failed
+func (s *ApprovalService) Fail(id string, cause error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, err := s.store.Get(id)
+	if err != nil {
+		return err
+	}
+	request.Status = ApprovalFailed
+	request.Error = cause.Error()
+	return s.store.Save(request)
+}
+
+func (s *ApprovalService) decide(id string, by Credentials, status ApprovalStatus) (ApprovalRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.store.Get(id)
+	if err != nil {
+		return ApprovalRequest{}, err
+	}
+	now := s.now()
+	if request.StatusAt(now) != ApprovalPending {
+		return ApprovalRequest{}, ErrApprovalClosed
+	}
+	if request.Endpoint != by.Endpoint {
+		return ApprovalRequest{}, ErrApprovalCluster
+	}
+	if request.Requester == by.Identity() {
+		if status == ApprovalApproved {
+			return ApprovalRequest{}, ErrApprovalSelf
+		}
+		status = ApprovalCancelled
+	}
+	request.Status = status
+	request.DecidedBy = by.Identity()
+	request.DecidedAt = now
+	if err := s.store.Save(request); err != nil {
+		return ApprovalRequest{}, err
+	}
+	return request, nil
+}
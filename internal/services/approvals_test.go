@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestApprovalService(t *testing.T, store ApprovalStore) (*ApprovalService, *time.Time) {
+	t.Helper()
+	svc := NewApprovalService(ApprovalConfig{
+		Actions: map[ApprovalAction]bool{ApprovalDeleteBucket: true},
+		TTL:     time.Hour,
+	}, store)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	return svc, &now
+}
+
+func TestParseApprovalActions(t *testing.T) {
+	actions, err := ParseApprovalActions([]string{"delete-bucket", " restart-server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !actions[ApprovalDeleteBucket] || !actions[ApprovalRestartServer] || actions[ApprovalDeleteUser] {
+		t.Errorf("actions = %v", actions)
+	}
+
+	if actions, _ := ParseApprovalActions([]string{"all"}); len(actions) != len(ApprovalActions) {
+		t.Errorf("all should protect every action, got %v", actions)
+	}
+
+	if _, err := ParseApprovalActions([]string{"delete-everything"}); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+
+	if actions, _ := ParseApprovalActions(nil); (ApprovalConfig{Actions: actions}).Enabled() {
+		t.Error("approvals should be off without actions")
+	}
+}
+
+func TestApprovalServiceRequiresASecondPerson(t *testing.T) {
+	svc, _ := newTestApprovalService(t, NewMemoryApprovalStore())
+	alice := Credentials{Endpoint: "minio:9000", AccessKey: "alice"}
+	bob := Credentials{Endpoint: "minio:9000", AccessKey: "bob"}
+
+	if !svc.Required(ApprovalDeleteBucket) || svc.Required(ApprovalDeleteUser) {
+		t.Fatal("only bucket deletion should need approval")
+	}
+	var none *ApprovalService
+	if none.Required(ApprovalDeleteBucket) {
+		t.Error("a nil service should protect nothing")
+	}
+
+	request, err := svc.Submit(alice, ApprovalDeleteBucket, map[string]string{"bucket": "reports"}, "Delete bucket reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waiting := svc.Waiting("bob", "minio:9000"); waiting != 1 {
+		t.Errorf("Waiting(bob) = %d, want 1", waiting)
+	}
+	if waiting := svc.Waiting("alice", "minio:9000"); waiting != 0 {
+		t.Errorf("Waiting(alice) = %d, want 0", waiting)
+	}
+
+	if _, err := svc.Approve(request.ID, alice); !errors.Is(err, ErrApprovalSelf) {
+		t.Errorf("self-approval error = %v, want ErrApprovalSelf", err)
+	}
+	other := Credentials{Endpoint: "other:9000", AccessKey: "bob"}
+	if _, err := svc.Approve(request.ID, other); !errors.Is(err, ErrApprovalCluster) {
+		t.Errorf("approval from another cluster error = %v, want ErrApprovalCluster", err)
+	}
+
+	approved, err := svc.Approve(request.ID, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != ApprovalApproved || approved.DecidedBy != "bob" || approved.Params["bucket"] != "reports" {
+		t.Errorf("approved = %+v", approved)
+	}
+	if _, err := svc.Approve(request.ID, bob); !errors.Is(err, ErrApprovalClosed) {
+		t.Errorf("second approval error = %v, want ErrApprovalClosed", err)
+	}
+}
+
+func TestApprovalServiceRejectAndWithdraw(t *testing.T) {
+	svc, _ := newTestApprovalService(t, NewMemoryApprovalStore())
+	alice := Credentials{Endpoint: "minio:9000", AccessKey: "alice"}
+	bob := Credentials{Endpoint: "minio:9000", AccessKey: "bob"}
+
+	first, _ := svc.Submit(alice, ApprovalDeleteBucket, nil, "Delete bucket a")
+	second, _ := svc.Submit(alice, ApprovalDeleteBucket, nil, "Delete bucket b")
+
+	if rejected, err := svc.Reject(first.ID, bob); err != nil || rejected.Status != ApprovalRejected {
+		t.Errorf("Reject by bob = %+v, %v", rejected, err)
+	}
+	if withdrawn, err := svc.Reject(second.ID, alice); err != nil || withdrawn.Status != ApprovalCancelled {
+		t.Errorf("Reject by requester = %+v, %v", withdrawn, err)
+	}
+}
+
+func TestApprovalServiceExpiresAndPrunes(t *testing.T) {
+	svc, now := newTestApprovalService(t, NewMemoryApprovalStore())
+	alice := Credentials{Endpoint: "minio:9000", AccessKey: "alice"}
+	bob := Credentials{Endpoint: "minio:9000", AccessKey: "bob"}
+
+	request, _ := svc.Submit(alice, ApprovalDeleteBucket, nil, "Delete bucket reports")
+	*now = now.Add(2 * time.Hour)
+
+	if _, err := svc.Approve(request.ID, bob); !errors.Is(err, ErrApprovalClosed) {
+		t.Errorf("approving an expired request error = %v, want ErrApprovalClosed", err)
+	}
+	listed, err := svc.List("minio:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Status != ApprovalExpired {
+		t.Fatalf("List() = %+v, want one expired request", listed)
+	}
+	if listed, _ := svc.List("other:9000"); len(listed) != 0 {
+		t.Errorf("List(other) = %+v, want requests of that cluster only", listed)
+	}
+
+	*now = now.Add(approvalHistory + time.Hour)
+	if listed, _ := svc.List("minio:9000"); len(listed) != 0 {
+		t.Errorf("List() = %+v, want old requests pruned", listed)
+	}
+}
+
+func TestFileApprovalStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "approvals.json")
+	store, err := NewFileApprovalStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, _ := newTestApprovalService(t, store)
+	request, err := svc.Submit(Credentials{Endpoint: "minio:9000", AccessKey: "alice"}, ApprovalDeleteBucket,
+		map[string]string{"bucket": "reports"}, "Delete bucket reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileApprovalStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := reopened.Get(request.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Params["bucket"] != "reports" || loaded.Status != ApprovalPending {
+		t.Errorf("loaded = %+v", loaded)
+	}
+}
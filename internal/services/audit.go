@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditResult is the outcome of an audited request
+type AuditResult string
+
+const (
+	AuditSuccess AuditResult = "success"
+	// AuditDenied means IronBuckets or MinIO refused the request
+	AuditDenied  AuditResult = "denied"
+	AuditFailure AuditResult = "failure"
+)
+
+// AuditEvent records one change made through IronBuckets
+type AuditEvent struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Actor is who made the change, as Credentials.Identity
+	Actor string `json:"actor"`
+	// Token is the ID of the API token the request was made with, if any
+	Token    string `json:"token,omitempty"`
+	SourceIP string `json:"sourceIp"`
+	Cluster  string `json:"cluster,omitempty"`
+	// Action names what was done, e.g. "bucket.delete"
+	Action string `json:"action"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Bucket string `json:"bucket,omitempty"`
+	Object string `json:"object,omitempty"`
+	User   string `json:"user,omitempty"`
+	Group  string `json:"group,omitempty"`
+	Policy string `json:"policy,omitempty"`
+	// Params are the submitted form and query values, with secrets redacted
+	Params map[string]string `json:"params,omitempty"`
+	Result AuditResult       `json:"result"`
+	Status int               `json:"status"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// AuditFilter selects audit events; empty fields match everything
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Result AuditResult
+	// Target matches the bucket, object, user, group or policy
+	Target string
+	Since  time.Time
+	Until  time.Time
+	// Limit caps the number of events returned; 0 means no limit
+	Limit int
+}
+
+// Matches reports whether event passes the filter
+func (f AuditFilter) Matches(event AuditEvent) bool {
+	if f.Actor != "" && !strings.EqualFold(event.Actor, f.Actor) {
+		return false
+	}
+	if f.Action != "" && !strings.HasPrefix(event.Action, f.Action) {
+		return false
+	}
+	if f.Result != "" && event.Result != f.Result {
+		return false
+	}
+	if !f.Since.IsZero() && event.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !event.Time.Before(f.Until) {
+		return false
+	}
+	if f.Target != "" {
+		target := strings.ToLower(f.Target)
+		for _, value := range []string{event.Bucket, event.Object, event.User, event.Group, event.Policy} {
+			if strings.Contains(strings.ToLower(value), target) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// AuditConfig configures where audit events are kept
+type AuditConfig struct {
+	// File is the current log; rotated logs get a .1, .2, ... suffix
+	File string
+	// MaxSize is the size in bytes at which the log is rotated
+	MaxSize int64
+	// MaxFiles is how many rotated logs are kept
+	MaxFiles int
+}
+
+// AuditStore keeps audit events. Events are only ever appended.
+type AuditStore interface {
+	Append(event AuditEvent) error
+	// Events returns every stored event, oldest first
+	Events() ([]AuditEvent, error)
+}
+
+// MemoryAuditStore keeps events in process memory
+type MemoryAuditStore struct {
+	mu     sync.RWMutex
+	events []AuditEvent
+}
+
+// NewMemoryAuditStore creates an empty in-memory store
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{}
+}
+
+func (m *MemoryAuditStore) Append(event AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *MemoryAuditStore) Events() ([]AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]AuditEvent(nil), m.events...), nil
+}
+
+// FileAuditStore appends events as JSON lines to a file with 0600
+// permissions. When the file would grow past MaxSize it is renamed to
+// <file>.1, older logs move up by one, and logs beyond MaxFiles are deleted.
+type FileAuditStore struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// NewFileAuditStore creates a store for config.File, which is created on
+// first write
+func NewFileAuditStore(config AuditConfig) *FileAuditStore {
+	return &FileAuditStore{path: config.File, maxSize: config.MaxSize, maxFiles: config.MaxFiles}
+}
+
+func (f *FileAuditStore) Append(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.open(); err != nil {
+		return err
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+func (f *FileAuditStore) open() error {
+	if f.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *FileAuditStore) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if f.maxFiles == 0 {
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+		return f.open()
+	}
+	_ = os.Remove(f.rotated(f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(f.rotated(i), f.rotated(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.rotated(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *FileAuditStore) rotated(n int) string {
+	return f.path + "." + strconv.Itoa(n)
+}
+
+func (f *FileAuditStore) Events() ([]AuditEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var events []AuditEvent
+	for i := f.maxFiles; i >= 0; i-- {
+		path := f.path
+		if i > 0 {
+			path = f.rotated(i)
+		}
+		read, err := readAuditFile(path)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, read...)
+	}
+	return events, nil
+}
+
+// readAuditFile decodes one log, skipping lines it cannot parse, such as a
+// line cut short by a crash
+func readAuditFile(path string) ([]AuditEvent, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var events []AuditEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	return events, nil
+}
+
+// AuditLog records and searches audit events
+type AuditLog struct {
+	store AuditStore
+	now   func() time.Time
+}
+
+// NewAuditLog creates an audit log backed by store
+func NewAuditLog(store AuditStore) *AuditLog {
+	return &AuditLog{store: store, now: time.Now}
+}
+
+// Record stores event, filling in its ID and time
+func (a *AuditLog) Record(event AuditEvent) error {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return err
+	}
+	event.ID = hex.EncodeToString(idBytes)
+	if event.Time.IsZero() {
+		event.Time = a.now().UTC()
+	}
+	return a.store.Append(event)
+}
+
+// Query returns the events matching filter, newest first
+func (a *AuditLog) Query(filter AuditFilter) ([]AuditEvent, error) {
+	events, err := a.store.Events()
+	if err != nil {
+		return nil, err
+	}
+	var matched []AuditEvent
+	for i := len(events) - 1; i >= 0; i-- {
+		if !filter.Matches(events[i]) {
+			continue
+		}
+		matched = append(matched, events[i])
+		if filter.Limit > 0 && len(matched) == filter.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLogQueryFilters(t *testing.T) {
+	audit := NewAuditLog(NewMemoryAuditStore())
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, event := range []AuditEvent{
+		{Actor: "alice", Action: "bucket.create", Bucket: "reports", Result: AuditSuccess},
+		{Actor: "bob", Action: "bucket.delete", Bucket: "reports", Result: AuditDenied},
+		{Actor: "alice", Action: "user.create", User: "carol", Result: AuditSuccess},
+	} {
+		event.Time = start.Add(time.Duration(i) * 24 * time.Hour)
+		if err := audit.Record(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		filter AuditFilter
+		want   []string
+	}{
+		{"everything, newest first", AuditFilter{}, []string{"user.create", "bucket.delete", "bucket.create"}},
+		{"actor", AuditFilter{Actor: "ALICE"}, []string{"user.create", "bucket.create"}},
+		{"action prefix", AuditFilter{Action: "bucket."}, []string{"bucket.delete", "bucket.create"}},
+		{"result", AuditFilter{Result: AuditDenied}, []string{"bucket.delete"}},
+		{"target", AuditFilter{Target: "car"}, []string{"user.create"}},
+		{"time range", AuditFilter{Since: start.Add(time.Hour), Until: start.Add(48 * time.Hour)}, []string{"bucket.delete"}},
+		{"limit", AuditFilter{Limit: 1}, []string{"user.create"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := audit.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.Action)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Query() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Query() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileAuditStoreRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	store := NewFileAuditStore(AuditConfig{File: path, MaxSize: 400, MaxFiles: 2})
+	audit := NewAuditLog(store)
+
+	for i := 0; i < 20; i++ {
+		if err := audit.Record(AuditEvent{Actor: "admin", Action: "object.upload", Object: "file.txt"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+		if info.Size() > 400 {
+			t.Errorf("%s is %d bytes, want at most 400", name, info.Size())
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("%s has mode %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 rotated logs, found %s.3", path)
+	}
+
+	// A fresh store reads the current and rotated logs, oldest first
+	events, err := NewFileAuditStore(AuditConfig{File: path, MaxSize: 400, MaxFiles: 2}).Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || len(events) >= 20 {
+		t.Fatalf("read %d events, want the retained subset", len(events))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Fatal("events are not oldest first")
+		}
+	}
+}
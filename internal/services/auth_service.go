@@ -3,12 +3,10 @@ package services
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"io"
-	"os"
+	"time"
 )
 
 // Credentials represents the MinIO login details
@@ -17,26 +15,51 @@ type Credentials struct {
 	AccessKey    string `json:"accessKey"`
 	SecretKey    string `json:"secretKey"`
 	SessionToken string `json:"sessionToken,omitempty"` // For STS/OIDC
+	// Expiration is set for temporary (STS) credentials
+	Expiration time.Time `json:"expiration,omitzero"`
+	// KeyRef points at the long-term key held server-side for refreshing
+	KeyRef string `json:"keyRef,omitempty"`
+	// User is the name the user signed in with, which differs from AccessKey
+	// once long-term keys or directory logins are swapped for STS credentials
+	User string `json:"user,omitempty"`
+}
+
+// Identity returns the name the user signed in with
+func (c Credentials) Identity() string {
+	if c.User != "" {
+		return c.User
+	}
+	return c.AccessKey
+}
+
+// IsExpired reports whether temporary credentials have lapsed.
+// Static credentials (zero Expiration) never expire.
+func (c Credentials) IsExpired(now time.Time) bool {
+	return !c.Expiration.IsZero() && !now.Before(c.Expiration)
 }
 
 type AuthService struct {
-	encryptionKey []byte
+	keyring *Keyring
+	policy  SessionPolicy
+	sts     STSClient
+	vault   *credentialVault
+	store   SessionStore
 }
 
-// NewAuthService creates a new auth service with a key from env or generates one (ephemeral)
+// NewAuthService creates an auth service with an ephemeral key, which means
+// sessions do not survive a restart. Use NewAuthServiceWithKeyring to keep them.
 func NewAuthService() *AuthService {
-	key := os.Getenv("IRON_SESSION_KEY")
-	if len(key) != 32 {
-		// In production, this should be enforced. For now, we'll warn or generate.
-		// For "The Iron Monolith" simplicity, if not set, we generate one at startup.
-		// This means sessions invalidate on restart, which is acceptable for this architecture.
-		newKey := make([]byte, 32)
-		if _, err := io.ReadFull(rand.Reader, newKey); err != nil {
-			panic("failed to generate random key")
-		}
-		return &AuthService{encryptionKey: newKey}
-	}
-	return &AuthService{encryptionKey: []byte(key)}
+	return NewAuthServiceWithKeyring(newEphemeralKeyring())
+}
+
+// Keyring returns the keys sessions are sealed with
+func (s *AuthService) Keyring() *Keyring {
+	return s.keyring
+}
+
+// NewAuthServiceWithKeyring creates an auth service that seals sessions with the given keys
+func NewAuthServiceWithKeyring(keyring *Keyring) *AuthService {
+	return &AuthService{keyring: keyring, policy: DefaultSessionPolicy(), vault: newCredentialVault()}
 }
 
 // EncryptCredentials serializes and encrypts credentials into a string (for the cookie)
@@ -45,39 +68,49 @@ func (s *AuthService) EncryptCredentials(creds Credentials) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	return s.seal(data)
+}
 
-	block, err := aes.NewCipher(s.encryptionKey)
+// DecryptCredentials decodes the cookie value back into Credentials
+func (s *AuthService) DecryptCredentials(encrypted string) (*Credentials, error) {
+	plaintext, err := s.open(encrypted)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+	var creds Credentials
+	if err := json.Unmarshal(plaintext, &creds); err != nil {
+		return nil, err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
+	return &creds, nil
+}
 
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-	return base64.URLEncoding.EncodeToString(ciphertext), nil
+// seal encrypts session data with the keyring's primary key
+func (s *AuthService) seal(data []byte) (string, error) {
+	return s.keyring.seal(data, "")
 }
 
-// DecryptCredentials decodes the cookie value back into Credentials
-func (s *AuthService) DecryptCredentials(encrypted string) (*Credentials, error) {
-	ciphertext, err := base64.URLEncoding.DecodeString(encrypted)
+// open reverses seal with whichever keyring key sealed the value
+func (s *AuthService) open(sealed string) ([]byte, error) {
+	return s.keyring.open(sealed, "")
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	block, err := aes.NewCipher(s.encryptionKey)
+func openSealed(key []byte, encoded string, additionalData []byte) ([]byte, error) {
+	ciphertext, err := base64.URLEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
 		return nil, err
 	}
@@ -87,15 +120,5 @@ func (s *AuthService) DecryptCredentials(encrypted string) (*Credentials, error)
 	}
 
 	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var creds Credentials
-	if err := json.Unmarshal(plaintext, &creds); err != nil {
-		return nil, err
-	}
-
-	return &creds, nil
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
 }
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"encoding/base64"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -11,35 +13,8 @@ func TestNewAuthService_GeneratesKey(t *testing.T) {
 
 	svc := NewAuthService()
 
-	if len(svc.encryptionKey) != 32 {
-		t.Errorf("expected 32-byte key, got %d bytes", len(svc.encryptionKey))
-	}
-}
-
-func TestNewAuthService_UsesEnvKey(t *testing.T) {
-	testKey := "12345678901234567890123456789012" // 32 bytes
-	_ = os.Setenv("IRON_SESSION_KEY", testKey)
-	defer func() { _ = os.Unsetenv("IRON_SESSION_KEY") }()
-
-	svc := NewAuthService()
-
-	if string(svc.encryptionKey) != testKey {
-		t.Errorf("expected key %q, got %q", testKey, string(svc.encryptionKey))
-	}
-}
-
-func TestNewAuthService_IgnoresShortEnvKey(t *testing.T) {
-	_ = os.Setenv("IRON_SESSION_KEY", "tooshort")
-	defer func() { _ = os.Unsetenv("IRON_SESSION_KEY") }()
-
-	svc := NewAuthService()
-
-	// Should generate a new key since env key is too short
-	if len(svc.encryptionKey) != 32 {
-		t.Errorf("expected 32-byte generated key, got %d bytes", len(svc.encryptionKey))
-	}
-	if string(svc.encryptionKey) == "tooshort" {
-		t.Error("should not use short key")
+	if len(svc.keyring.Primary().Key) != 32 {
+		t.Errorf("expected 32-byte key, got %d bytes", len(svc.keyring.Primary().Key))
 	}
 }
 
@@ -146,3 +121,73 @@ func TestEncryptCredentials_ProducesDifferentOutput(t *testing.T) {
 		t.Error("expected different encrypted outputs due to random nonce")
 	}
 }
+
+func TestKeyringRotation_OldKeysStillOpenSessions(t *testing.T) {
+	oldKey := SessionKey{ID: "2024", Key: []byte("0123456789abcdef0123456789abcdef")}
+	newKey := SessionKey{ID: "2025", Key: []byte("fedcba9876543210fedcba9876543210")}
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "password"}
+
+	before, _ := NewKeyring(oldKey)
+	sealedBefore, err := NewAuthServiceWithKeyring(before).EncryptCredentials(creds)
+	if err != nil {
+		t.Fatalf("EncryptCredentials failed: %v", err)
+	}
+
+	rotated, _ := NewKeyring(newKey, oldKey)
+	svc := NewAuthServiceWithKeyring(rotated)
+
+	opened, err := svc.DecryptCredentials(sealedBefore)
+	if err != nil || opened.AccessKey != "admin" {
+		t.Fatalf("expected old session to open after rotation, got %+v, %v", opened, err)
+	}
+
+	sealedAfter, _ := svc.EncryptCredentials(creds)
+	if !strings.HasPrefix(sealedAfter, "2025.") {
+		t.Errorf("expected new sessions to use the primary key, got %q", sealedAfter)
+	}
+
+	retired, _ := NewKeyring(newKey)
+	if _, err := NewAuthServiceWithKeyring(retired).DecryptCredentials(sealedBefore); err == nil {
+		t.Error("expected sessions sealed with a removed key to be rejected")
+	}
+}
+
+func TestDecryptCredentials_RejectsSwappedKeyID(t *testing.T) {
+	keyA := SessionKey{ID: "a", Key: []byte("0123456789abcdef0123456789abcdef")}
+	keyB := SessionKey{ID: "b", Key: []byte("0123456789abcdef0123456789abcdef")}
+	keyring, _ := NewKeyring(keyA, keyB)
+	svc := NewAuthServiceWithKeyring(keyring)
+
+	sealed, _ := svc.EncryptCredentials(Credentials{AccessKey: "admin"})
+	if _, err := svc.DecryptCredentials("b" + strings.TrimPrefix(sealed, "a")); err == nil {
+		t.Error("expected key ID to be bound to the ciphertext")
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	keyring, err := ParseKeyring([]string{"new:" + base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")), " old:0123456789abcdef0123456789abcdef"}, "")
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+	if keyring.Primary().ID != "new" || len(keyring.Keys()) != 2 {
+		t.Errorf("unexpected keyring: %+v", keyring.Keys())
+	}
+
+	keyring, err = ParseKeyring(nil, "12345678901234567890123456789012")
+	if err != nil || keyring.Primary().ID != "default" || string(keyring.Primary().Key) != "12345678901234567890123456789012" {
+		t.Errorf("expected the single key to be used, got %v", err)
+	}
+	if keyring, err := ParseKeyring(nil, ""); keyring != nil || err != nil {
+		t.Errorf("expected no keyring without keys, got %v, %v", keyring, err)
+	}
+
+	if _, err := ParseKeyring(nil, "tooshort"); err == nil {
+		t.Error("expected error for short key")
+	}
+	if _, err := ParseKeyring([]string{"bad:short"}, ""); err == nil {
+		t.Error("expected error for short key")
+	}
+	if _, err := ParseKeyring([]string{"dup:0123456789abcdef0123456789abcdef", "dup:0123456789abcdef0123456789abcdef"}, ""); err == nil {
+		t.Error("expected error for duplicate key IDs")
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNoClientCertificate is returned when a request did not present a client
+// certificate that the HTTPS listener verified
+var ErrNoClientCertificate = errors.New("no verified client certificate")
+
+// CertificateConfig controls sign-in with the client certificate a browser
+// presents over HTTPS. MinIO's AssumeRoleWithCertificate needs the private
+// key, which never leaves the browser or smart card, so IronBuckets presents
+// the certificate it holds for the same name on the chosen cluster.
+type CertificateConfig struct {
+	Enabled bool
+	// SessionDuration is the requested STS credential lifetime; zero requests one hour
+	SessionDuration time.Duration
+}
+
+// CertificateUsername returns the common name of the verified client
+// certificate on a connection
+func CertificateUsername(state *tls.ConnectionState) (string, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", ErrNoClientCertificate
+	}
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	if !validCertificateName(name) {
+		return "", errors.New("client certificate has no usable common name")
+	}
+	return name, nil
+}
+
+// validCertificateName reports whether name can be used as a file name in the
+// user certificate directory
+func validCertificateName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, "/\\\x00")
+}
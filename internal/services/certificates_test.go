@@ -0,0 +1,32 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+)
+
+func verifiedAs(name string) *tls.ConnectionState {
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: name}}}}}
+}
+
+func TestCertificateUsername(t *testing.T) {
+	name, err := CertificateUsername(verifiedAs("alice"))
+	if err != nil || name != "alice" {
+		t.Errorf("CertificateUsername = %q, %v; want alice", name, err)
+	}
+	// A certificate that was presented but not verified is ignored
+	unverified := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "alice"}}}}
+	for _, state := range []*tls.ConnectionState{nil, {}, unverified} {
+		if _, err := CertificateUsername(state); !errors.Is(err, ErrNoClientCertificate) {
+			t.Errorf("CertificateUsername(%+v) = %v, want ErrNoClientCertificate", state, err)
+		}
+	}
+	for _, name := range []string{"", "../alice", "alice/admin", ".alice"} {
+		if _, err := CertificateUsername(verifiedAs(name)); err == nil {
+			t.Errorf("CertificateUsername should reject %q", name)
+		}
+	}
+}
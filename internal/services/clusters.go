@@ -0,0 +1,284 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"gopkg.in/yaml.v3"
+)
+
+// ClusterTLS holds the TLS options for one cluster
+type ClusterTLS struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots
+	CAFile string `yaml:"caFile"`
+	// ServerName overrides the name checked against the certificate
+	ServerName string `yaml:"serverName"`
+	// InsecureSkipVerify disables certificate checks; for test clusters only
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+	// CertFile and KeyFile are a client certificate for clusters that
+	// require mutual TLS
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// UserCertDir holds a <name>.crt and <name>.key pair for each user who
+	// signs in with a client certificate
+	UserCertDir string `yaml:"userCertDir"`
+}
+
+// Cluster is a named MinIO endpoint users can sign in to
+type Cluster struct {
+	// Alias identifies the cluster in forms and URLs, for example "prod"
+	Alias string `yaml:"alias"`
+	// Name is shown in the UI; the alias is used when it is empty
+	Name string `yaml:"name"`
+	// URL is http(s)://host:port, or host:port together with Scheme
+	URL string `yaml:"url"`
+	// Scheme is http or https when the URL does not include one
+	Scheme string     `yaml:"scheme"`
+	TLS    ClusterTLS `yaml:"tls"`
+	// Region is signed into S3 requests; empty lets the client discover it
+	Region string `yaml:"region"`
+	// BucketLookup is auto, path or virtual-host
+	BucketLookup string `yaml:"bucketLookup"`
+
+	// Endpoint is the host:port credentials are issued for
+	Endpoint string `yaml:"-"`
+	// Secure is true when the cluster is reached over HTTPS
+	Secure bool `yaml:"-"`
+
+	transport http.RoundTripper
+	lookup    minio.BucketLookupType
+}
+
+// BaseURL returns scheme://host:port for the cluster
+func (c Cluster) BaseURL() string {
+	if c.Secure {
+		return "https://" + c.Endpoint
+	}
+	return "http://" + c.Endpoint
+}
+
+// Label returns the display name of the cluster
+func (c Cluster) Label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Alias
+}
+
+// ClusterRegistry is the set of clusters offered at login. The first cluster
+// is the default.
+type ClusterRegistry struct {
+	clusters []Cluster
+}
+
+// NewClusterRegistry validates the clusters and prepares their connections
+func NewClusterRegistry(clusters []Cluster) (*ClusterRegistry, error) {
+	if len(clusters) == 0 {
+		return nil, errors.New("no clusters configured")
+	}
+	aliases := make(map[string]bool)
+	endpoints := make(map[string]string)
+	resolved := make([]Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		if cluster.Alias == "" {
+			return nil, errors.New("cluster alias is required")
+		}
+		if aliases[cluster.Alias] {
+			return nil, fmt.Errorf("duplicate cluster alias %q", cluster.Alias)
+		}
+		aliases[cluster.Alias] = true
+
+		if err := cluster.resolve(); err != nil {
+			return nil, fmt.Errorf("cluster %q: %w", cluster.Alias, err)
+		}
+		// Sessions only record the endpoint, so it must identify one cluster
+		if other, ok := endpoints[cluster.Endpoint]; ok {
+			return nil, fmt.Errorf("clusters %q and %q share endpoint %s", other, cluster.Alias, cluster.Endpoint)
+		}
+		endpoints[cluster.Endpoint] = cluster.Alias
+		resolved = append(resolved, cluster)
+	}
+	return &ClusterRegistry{clusters: resolved}, nil
+}
+
+var bucketLookups = map[string]minio.BucketLookupType{
+	"":             minio.BucketLookupAuto,
+	"auto":         minio.BucketLookupAuto,
+	"path":         minio.BucketLookupPath,
+	"virtual-host": minio.BucketLookupDNS,
+}
+
+// resolve splits the URL into endpoint and scheme and builds the transport
+func (c *Cluster) resolve() error {
+	if c.URL == "" {
+		return errors.New("url is required")
+	}
+	scheme := c.Scheme
+	if strings.Contains(c.URL, "://") {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url: %w", err)
+		}
+		if u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("url must be scheme://host:port, got %q", c.URL)
+		}
+		if scheme != "" && scheme != u.Scheme {
+			return fmt.Errorf("scheme %q does not match url %q", scheme, c.URL)
+		}
+		c.Endpoint = u.Host
+		scheme = u.Scheme
+	} else {
+		c.Endpoint = c.URL
+	}
+	switch scheme {
+	case "http", "https":
+	case "":
+		return fmt.Errorf("url %q needs a scheme: use http:// or https://, or set scheme", c.URL)
+	default:
+		return fmt.Errorf("unsupported scheme %q", scheme)
+	}
+	c.Secure = scheme == "https"
+
+	lookup, ok := bucketLookups[c.BucketLookup]
+	if !ok {
+		return fmt.Errorf("unknown bucketLookup %q (want auto, path or virtual-host)", c.BucketLookup)
+	}
+	c.lookup = lookup
+
+	if c.TLS == (ClusterTLS{}) {
+		return nil
+	}
+	if !c.Secure {
+		return errors.New("tls options need an https url")
+	}
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.TLS.ServerName,
+		InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+	}
+	if c.TLS.CAFile != "" {
+		pem, err := os.ReadFile(c.TLS.CAFile)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", c.TLS.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("a client certificate needs both certFile and keyFile")
+	}
+	if c.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	c.transport = transport
+	return nil
+}
+
+// heldCertificate loads the certificate held for name from the user
+// certificate directory. MinIO maps its common name to a policy, so that must
+// be name too.
+func (c Cluster) heldCertificate(name string) (tls.Certificate, error) {
+	if c.TLS.UserCertDir == "" {
+		return tls.Certificate{}, fmt.Errorf("no user certificates are held for %s", c.Endpoint)
+	}
+	if !validCertificateName(name) {
+		return tls.Certificate{}, fmt.Errorf("%q cannot name a held certificate", name)
+	}
+	base := filepath.Join(c.TLS.UserCertDir, name)
+	cert, err := tls.LoadX509KeyPair(base+".crt", base+".key")
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("certificate held for %q: %w", name, err)
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != name {
+		return tls.Certificate{}, fmt.Errorf("certificate held for %q names a different user", name)
+	}
+	return cert, nil
+}
+
+// List returns every cluster in configuration order
+func (r *ClusterRegistry) List() []Cluster {
+	return append([]Cluster(nil), r.clusters...)
+}
+
+// Default returns the cluster preselected at login
+func (r *ClusterRegistry) Default() Cluster {
+	return r.clusters[0]
+}
+
+// Get looks a cluster up by alias
+func (r *ClusterRegistry) Get(alias string) (Cluster, bool) {
+	for _, cluster := range r.clusters {
+		if cluster.Alias == alias {
+			return cluster, true
+		}
+	}
+	return Cluster{}, false
+}
+
+// ForEndpoint returns the cluster that credentials for endpoint belong to
+func (r *ClusterRegistry) ForEndpoint(endpoint string) (Cluster, bool) {
+	if r == nil {
+		return Cluster{}, false
+	}
+	for _, cluster := range r.clusters {
+		if cluster.Endpoint == endpoint {
+			return cluster, true
+		}
+	}
+	return Cluster{}, false
+}
+
+// connection returns the connection settings for an endpoint. Endpoints
+// outside the registry are reached over HTTPS with the default transport.
+func (r *ClusterRegistry) connection(endpoint string) Cluster {
+	if cluster, ok := r.ForEndpoint(endpoint); ok {
+		return cluster
+	}
+	return Cluster{Endpoint: endpoint, Secure: true}
+}
+
+type clustersFile struct {
+	Clusters []Cluster `yaml:"clusters"`
+}
+
+// LoadClusterRegistry reads clusters from a YAML file of the form
+//
+//	clusters:
+//	  - alias: prod
+//	    name: Production
+//	    url: https://minio.example.com
+//	  - alias: lab
+//	    url: http://storage-internal:9000
+//	    region: eu-west-1
+//	    bucketLookup: path
+func LoadClusterRegistry(path string) (*ClusterRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file clustersFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewClusterRegistry(file.Clusters)
+}
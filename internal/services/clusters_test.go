@@ -0,0 +1,219 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestNewClusterRegistryResolvesURLs(t *testing.T) {
+	registry, err := NewClusterRegistry([]Cluster{
+		{Alias: "prod", Name: "Production", URL: "https://minio.example.com"},
+		{Alias: "staging", URL: "http://minio-staging.internal:9000"},
+		{Alias: "dev", URL: "storage-internal:9000", Scheme: "http"},
+	})
+	if err != nil {
+		t.Fatalf("NewClusterRegistry: %v", err)
+	}
+
+	tests := []struct {
+		alias    string
+		endpoint string
+		secure   bool
+		label    string
+	}{
+		{"prod", "minio.example.com", true, "Production"},
+		{"staging", "minio-staging.internal:9000", false, "staging"},
+		{"dev", "storage-internal:9000", false, "dev"},
+	}
+	for _, tt := range tests {
+		cluster, ok := registry.Get(tt.alias)
+		if !ok {
+			t.Fatalf("Get(%q) not found", tt.alias)
+		}
+		if cluster.Endpoint != tt.endpoint || cluster.Secure != tt.secure || cluster.Label() != tt.label {
+			t.Errorf("%s = {%s %v %s}, want {%s %v %s}", tt.alias,
+				cluster.Endpoint, cluster.Secure, cluster.Label(), tt.endpoint, tt.secure, tt.label)
+		}
+	}
+
+	if registry.Default().Alias != "prod" {
+		t.Errorf("Default() = %q, want the first cluster", registry.Default().Alias)
+	}
+	if cluster, ok := registry.ForEndpoint("storage-internal:9000"); !ok || cluster.Alias != "dev" || cluster.BaseURL() != "http://storage-internal:9000" {
+		t.Errorf("ForEndpoint(storage-internal:9000) = %+v, %v", cluster, ok)
+	}
+	if _, ok := registry.Get("missing"); ok {
+		t.Error("Get found an unknown alias")
+	}
+}
+
+func TestNewClusterRegistryRejectsInvalidClusters(t *testing.T) {
+	tests := map[string][]Cluster{
+		"empty":             nil,
+		"missing alias":     {{URL: "http://minio:9000"}},
+		"missing url":       {{Alias: "a"}},
+		"missing scheme":    {{Alias: "a", URL: "minio:9000"}},
+		"scheme conflict":   {{Alias: "a", URL: "http://minio:9000", Scheme: "https"}},
+		"duplicate alias":   {{Alias: "a", URL: "http://a:9000"}, {Alias: "a", URL: "http://b:9000"}},
+		"shared endpoint":   {{Alias: "a", URL: "http://minio:9000"}, {Alias: "b", URL: "https://minio:9000"}},
+		"bad scheme":        {{Alias: "a", URL: "ftp://minio:9000"}},
+		"path":              {{Alias: "a", URL: "https://minio.example.com/s3"}},
+		"tls without https": {{Alias: "a", URL: "http://minio:9000", TLS: ClusterTLS{InsecureSkipVerify: true}}},
+		"missing ca file":   {{Alias: "a", URL: "https://minio:9000", TLS: ClusterTLS{CAFile: "/nonexistent/ca.pem"}}},
+		"cert without key":  {{Alias: "a", URL: "https://minio:9000", TLS: ClusterTLS{CertFile: "client.crt"}}},
+		"bad lookup":        {{Alias: "a", URL: "https://minio:9000", BucketLookup: "dns"}},
+	}
+	for name, clusters := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewClusterRegistry(clusters); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestClusterConnectionUsesClusterTLS(t *testing.T) {
+	certFile, keyFile := writeClientCertificate(t, t.TempDir(), "ironbuckets")
+	registry, err := NewClusterRegistry([]Cluster{
+		{Alias: "lab", URL: "https://minio.lab:9000", TLS: ClusterTLS{InsecureSkipVerify: true}},
+		{Alias: "mtls", URL: "https://minio.secure:9000", TLS: ClusterTLS{CertFile: certFile, KeyFile: keyFile}},
+		{Alias: "plain", URL: "http://minio.example.com:9000", Region: "eu-west-1", BucketLookup: "path"},
+	})
+	if err != nil {
+		t.Fatalf("NewClusterRegistry: %v", err)
+	}
+
+	lab := registry.connection("minio.lab:9000")
+	if !lab.Secure || lab.transport == nil {
+		t.Errorf("lab connection = %+v; want https with its own transport", lab)
+	}
+	mtls := registry.connection("minio.secure:9000")
+	if transport, ok := mtls.transport.(*http.Transport); !ok || len(transport.TLSClientConfig.Certificates) != 1 {
+		t.Errorf("mtls connection should present the client certificate: %+v", mtls)
+	}
+	plain := registry.connection("minio.example.com:9000")
+	if plain.Secure || plain.Region != "eu-west-1" || plain.lookup != minio.BucketLookupPath {
+		t.Errorf("plain connection = %+v", plain)
+	}
+	// Endpoints outside the registry, and a nil registry, default to https
+	if unknown := registry.connection("localhost:9000"); !unknown.Secure || unknown.transport != nil {
+		t.Errorf("unknown endpoint = %+v, want https with the default transport", unknown)
+	}
+	var none *ClusterRegistry
+	if cluster := none.connection("localhost:9000"); !cluster.Secure {
+		t.Error("nil registry should default to https")
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate for name to
+// dir as name.crt and name.key
+func writeClientCertificate(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestClusterHeldCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeClientCertificate(t, dir, "alice")
+	certFile, keyFile := writeClientCertificate(t, t.TempDir(), "mallory")
+	for from, to := range map[string]string{certFile: "bob.crt", keyFile: "bob.key"} {
+		data, err := os.ReadFile(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, to), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry, err := NewClusterRegistry([]Cluster{
+		{Alias: "prod", URL: "https://minio.example.com", TLS: ClusterTLS{UserCertDir: dir}},
+		{Alias: "lab", URL: "https://minio.lab:9000"},
+	})
+	if err != nil {
+		t.Fatalf("NewClusterRegistry: %v", err)
+	}
+	prod := registry.connection("minio.example.com")
+
+	cert, err := prod.heldCertificate("alice")
+	if err != nil {
+		t.Fatalf("heldCertificate: %v", err)
+	}
+	if cert.Leaf.Subject.CommonName != "alice" {
+		t.Errorf("held certificate names %q", cert.Leaf.Subject.CommonName)
+	}
+	for _, name := range []string{"carol", "bob", "../alice", ".hidden", ""} {
+		if _, err := prod.heldCertificate(name); err == nil {
+			t.Errorf("heldCertificate(%q) should fail", name)
+		}
+	}
+	if _, err := registry.connection("minio.lab:9000").heldCertificate("alice"); err == nil {
+		t.Error("a cluster without a user certificate directory holds no certificates")
+	}
+	if _, err := NewClusterRegistry([]Cluster{{Alias: "a", URL: "http://minio:9000", TLS: ClusterTLS{UserCertDir: dir}}}); err == nil {
+		t.Error("certificate login needs an https cluster")
+	}
+}
+
+func TestLoadClusterRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	config := strings.Join([]string{
+		"clusters:",
+		"  - alias: prod",
+		"    name: Production",
+		"    url: https://minio.example.com",
+		"  - alias: dev",
+		"    url: http://localhost:9000",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadClusterRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadClusterRegistry: %v", err)
+	}
+	clusters := registry.List()
+	if len(clusters) != 2 || clusters[0].Label() != "Production" || clusters[1].Endpoint != "localhost:9000" {
+		t.Errorf("unexpected clusters: %+v", clusters)
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionLifetime is the default absolute session lifetime
+	SessionLifetime = 24 * time.Hour
+	// RefreshWindow is how long before expiry temporary credentials are renewed
+	RefreshWindow = 5 * time.Minute
+
+	temporaryCredentialLifetime = time.Hour
+)
+
+// ErrNotRefreshable is returned when the long-term key behind a session is not
+// held by this server, for example after a restart
+var ErrNotRefreshable = errors.New("session credentials cannot be refreshed")
+
+// credentialVault keeps long-term keys in memory, keyed by an opaque
+// reference, so temporary credentials can be renewed without the long-term key
+// ever reaching the browser.
+type credentialVault struct {
+	mu      sync.Mutex
+	entries map[string]*vaultEntry
+}
+
+type vaultEntry struct {
+	mu       sync.Mutex
+	longTerm Credentials
+	current  Credentials
+	expires  time.Time
+}
+
+func newCredentialVault() *credentialVault {
+	return &credentialVault{entries: make(map[string]*vaultEntry)}
+}
+
+func (v *credentialVault) put(ref string, entry *vaultEntry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	for key, existing := range v.entries {
+		if now.After(existing.expires) {
+			delete(v.entries, key)
+		}
+	}
+	v.entries[ref] = entry
+}
+
+func (v *credentialVault) get(ref string) (*vaultEntry, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	entry, ok := v.entries[ref]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (v *credentialVault) delete(ref string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.entries, ref)
+}
+
+// WithSTS makes logins with a long-term key store only temporary credentials
+// obtained through AssumeRole. Without it the key is sealed into the session as-is.
+func (s *AuthService) WithSTS(client STSClient) *AuthService {
+	s.sts = client
+	return s
+}
+
+// IssueSessionCredentials returns the credentials to seal into a new session.
+// The long-term key is held for at most the session's maximum lifetime.
+// Service accounts cannot assume a role, so their key is held as it is and the
+// session only gets a reference to it.
+func (s *AuthService) IssueSessionCredentials(ctx context.Context, creds Credentials) (Credentials, error) {
+	if s.sts == nil {
+		return creds, nil
+	}
+
+	temporary, err := s.sts.AssumeRole(ctx, creds, temporaryCredentialLifetime)
+	if errors.Is(err, ErrAssumeRoleDenied) {
+		return s.holdKey(creds)
+	}
+	if err != nil {
+		return Credentials{}, err
+	}
+	ref, err := NewRandomToken(32)
+	if err != nil {
+		return Credentials{}, err
+	}
+	temporary.KeyRef = ref
+	temporary.User = creds.Identity()
+	s.vault.put(ref, &vaultEntry{longTerm: creds, current: temporary, expires: time.Now().Add(s.policy.MaxLifetime)})
+	return temporary, nil
+}
+
+// holdKey keeps a key that cannot be exchanged for temporary credentials in
+// the vault and returns a reference to it that carries no secret
+func (s *AuthService) holdKey(creds Credentials) (Credentials, error) {
+	ref, err := NewRandomToken(32)
+	if err != nil {
+		return Credentials{}, err
+	}
+	s.vault.put(ref, &vaultEntry{longTerm: creds, current: creds, expires: time.Now().Add(s.policy.MaxLifetime)})
+	return Credentials{Endpoint: creds.Endpoint, AccessKey: creds.AccessKey, KeyRef: ref, User: creds.Identity()}, nil
+}
+
+// SessionCredentials returns the credentials requests of a session run with.
+// Sessions that only reference a held key get it from the vault, and cannot
+// continue once the vault has lost it, for example after a restart.
+func (s *AuthService) SessionCredentials(creds Credentials) (Credentials, error) {
+	if creds.KeyRef == "" || creds.SecretKey != "" {
+		return creds, nil
+	}
+	entry, ok := s.vault.get(creds.KeyRef)
+	if !ok {
+		return Credentials{}, ErrNotRefreshable
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	held := entry.current
+	held.KeyRef = creds.KeyRef
+	held.User = creds.User
+	return held, nil
+}
+
+// NeedsRefresh reports whether the credentials are refreshable and close to expiry
+func (s *AuthService) NeedsRefresh(creds Credentials, now time.Time) bool {
+	return creds.KeyRef != "" && s.sts != nil && creds.IsExpired(now.Add(RefreshWindow))
+}
+
+// RefreshCredentials renews the temporary credentials of a session. Concurrent
+// callers share one AssumeRole call.
+func (s *AuthService) RefreshCredentials(ctx context.Context, creds Credentials) (Credentials, error) {
+	if s.sts == nil {
+		return Credentials{}, ErrNotRefreshable
+	}
+	entry, ok := s.vault.get(creds.KeyRef)
+	if !ok {
+		return Credentials{}, ErrNotRefreshable
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if !entry.current.IsExpired(time.Now().Add(RefreshWindow)) {
+		return entry.current, nil
+	}
+
+	temporary, err := s.sts.AssumeRole(ctx, entry.longTerm, temporaryCredentialLifetime)
+	if err != nil {
+		return Credentials{}, err
+	}
+	temporary.KeyRef = creds.KeyRef
+	temporary.User = entry.current.User
+	entry.current = temporary
+	return temporary, nil
+}
+
+// DiscardCredentials forgets the long-term key behind a session
+func (s *AuthService) DiscardCredentials(creds Credentials) {
+	if creds.KeyRef != "" {
+		s.vault.delete(creds.KeyRef)
+	}
+}
+
+// LongTermCredentials returns the access key behind a session, so it can be
+// tried against another cluster. Single sign-on and directory sessions have
+// none, and neither do sessions whose key was lost in a restart.
+func (s *AuthService) LongTermCredentials(creds Credentials) (Credentials, bool) {
+	if creds.KeyRef != "" {
+		entry, ok := s.vault.get(creds.KeyRef)
+		if !ok {
+			return Credentials{}, false
+		}
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		return entry.longTerm, true
+	}
+	if creds.SessionToken == "" && creds.AccessKey != "" {
+		return creds, true
+	}
+	return Credentials{}, false
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stubSTS struct {
+	mu       sync.Mutex
+	calls    int
+	lifetime time.Duration
+}
+
+func (s *stubSTS) AssumeRoleWithWebIdentity(context.Context, string, OIDCToken, string) (Credentials, error) {
+	return Credentials{}, errors.New("not implemented")
+}
+
+func (s *stubSTS) AssumeRoleWithLDAPIdentity(context.Context, string, string, string, time.Duration) (Credentials, error) {
+	return Credentials{}, errors.New("not implemented")
+}
+
+func (s *stubSTS) AssumeRoleWithCertificate(context.Context, string, string, time.Duration) (Credentials, error) {
+	return Credentials{}, errors.New("not implemented")
+}
+
+func (s *stubSTS) AssumeRole(_ context.Context, creds Credentials, _ time.Duration) (Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if creds.SecretKey != "long-term-secret" {
+		return Credentials{}, errors.New("access denied")
+	}
+	return Credentials{
+		Endpoint:     creds.Endpoint,
+		AccessKey:    fmt.Sprintf("TEMP%d", s.calls),
+		SecretKey:    "temp-secret",
+		SessionToken: "token",
+		Expiration:   time.Now().Add(s.lifetime),
+	}, nil
+}
+
+func TestIssueSessionCredentials_WithoutSTSKeepsCredentials(t *testing.T) {
+	svc := NewAuthService()
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "long-term-secret"}
+
+	got, err := svc.IssueSessionCredentials(context.Background(), creds)
+	if err != nil {
+		t.Fatalf("IssueSessionCredentials failed: %v", err)
+	}
+	if got != creds {
+		t.Errorf("expected credentials unchanged, got %+v", got)
+	}
+}
+
+func TestIssueSessionCredentials_StoresOnlyTemporaryCredentials(t *testing.T) {
+	svc := NewAuthService().WithSTS(&stubSTS{lifetime: time.Hour})
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "long-term-secret"}
+
+	got, err := svc.IssueSessionCredentials(context.Background(), creds)
+	if err != nil {
+		t.Fatalf("IssueSessionCredentials failed: %v", err)
+	}
+	if got.SecretKey == creds.SecretKey || got.SessionToken == "" || got.KeyRef == "" {
+		t.Errorf("expected temporary credentials with a key reference, got %+v", got)
+	}
+
+	sealed, err := svc.EncryptCredentials(got)
+	if err != nil {
+		t.Fatalf("EncryptCredentials failed: %v", err)
+	}
+	opened, _ := svc.DecryptCredentials(sealed)
+	if opened.SecretKey == creds.SecretKey {
+		t.Error("long-term secret must not be sealed into the session")
+	}
+}
+
+func TestRefreshCredentials_RenewsAndSharesResult(t *testing.T) {
+	sts := &stubSTS{lifetime: time.Minute} // already inside the refresh window
+	svc := NewAuthService().WithSTS(sts)
+	creds, err := svc.IssueSessionCredentials(context.Background(), Credentials{
+		Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "long-term-secret",
+	})
+	if err != nil {
+		t.Fatalf("IssueSessionCredentials failed: %v", err)
+	}
+	if !svc.NeedsRefresh(creds, time.Now()) {
+		t.Fatal("expected credentials close to expiry to need a refresh")
+	}
+
+	sts.lifetime = time.Hour
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.RefreshCredentials(context.Background(), creds); err != nil {
+				t.Errorf("RefreshCredentials failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sts.calls != 2 {
+		t.Errorf("expected one login and one shared refresh, got %d AssumeRole calls", sts.calls)
+	}
+	refreshed, _ := svc.RefreshCredentials(context.Background(), creds)
+	if refreshed.KeyRef != creds.KeyRef || svc.NeedsRefresh(refreshed, time.Now()) {
+		t.Errorf("unexpected refreshed credentials: %+v", refreshed)
+	}
+}
+
+func TestRefreshCredentials_UnknownOrDiscardedSession(t *testing.T) {
+	svc := NewAuthService().WithSTS(&stubSTS{lifetime: time.Hour})
+	creds, _ := svc.IssueSessionCredentials(context.Background(), Credentials{
+		Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "long-term-secret",
+	})
+
+	svc.DiscardCredentials(creds)
+
+	if _, err := svc.RefreshCredentials(context.Background(), creds); !errors.Is(err, ErrNotRefreshable) {
+		t.Errorf("expected ErrNotRefreshable after discard, got %v", err)
+	}
+	if _, err := svc.RefreshCredentials(context.Background(), Credentials{KeyRef: "unknown"}); !errors.Is(err, ErrNotRefreshable) {
+		t.Errorf("expected ErrNotRefreshable for unknown reference, got %v", err)
+	}
+}
+
+func TestLongTermCredentials(t *testing.T) {
+	svc := NewAuthService().WithSTS(&stubSTS{lifetime: time.Hour})
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "long-term-secret"}
+
+	issued, err := svc.IssueSessionCredentials(context.Background(), creds)
+	if err != nil {
+		t.Fatalf("IssueSessionCredentials failed: %v", err)
+	}
+	if got, ok := svc.LongTermCredentials(issued); !ok || got != creds {
+		t.Errorf("expected the long-term key behind the session, got %+v, %v", got, ok)
+	}
+
+	// Keys sealed as-is (no STS) are their own long-term key
+	if got, ok := NewAuthService().LongTermCredentials(creds); !ok || got != creds {
+		t.Errorf("expected static credentials back, got %+v, %v", got, ok)
+	}
+
+	// Single sign-on credentials and discarded sessions have none
+	sso := Credentials{Endpoint: "localhost:9000", AccessKey: "STS", SecretKey: "s", SessionToken: "token"}
+	if _, ok := svc.LongTermCredentials(sso); ok {
+		t.Error("expected no long-term key for temporary credentials")
+	}
+	svc.DiscardCredentials(issued)
+	if _, ok := svc.LongTermCredentials(issued); ok {
+		t.Error("expected no long-term key after the session was discarded")
+	}
+}
+
+type denyingSTS struct{ stubSTS }
+
+func (s *denyingSTS) AssumeRole(context.Context, Credentials, time.Duration) (Credentials, error) {
+	return Credentials{}, ErrAssumeRoleDenied
+}
+
+func TestIssueSessionCredentials_HoldsKeysThatCannotAssumeRole(t *testing.T) {
+	svc := NewAuthService().WithSTS(&denyingSTS{})
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "svcacct", SecretKey: "service-secret"}
+
+	got, err := svc.IssueSessionCredentials(context.Background(), creds)
+	if err != nil {
+		t.Fatalf("IssueSessionCredentials failed: %v", err)
+	}
+	if got.SecretKey != "" || got.KeyRef == "" {
+		t.Fatalf("expected only a reference to the key, got %+v", got)
+	}
+
+	held, err := svc.SessionCredentials(got)
+	if err != nil || held.SecretKey != "service-secret" || held.KeyRef != got.KeyRef {
+		t.Errorf("SessionCredentials() = %+v, %v", held, err)
+	}
+	if longTerm, ok := svc.LongTermCredentials(got); !ok || longTerm != creds {
+		t.Errorf("LongTermCredentials() = %+v, %v", longTerm, ok)
+	}
+
+	svc.DiscardCredentials(got)
+	if _, err := svc.SessionCredentials(got); !errors.Is(err, ErrNotRefreshable) {
+		t.Errorf("expected a discarded key to end the session, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// sessionKeyID restricts key IDs to characters that cannot clash with the
+// "<id>.<payload>" sealed format
+var sessionKeyID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// SessionKey is one AES-256 key in the keyring
+type SessionKey struct {
+	ID  string
+	Key []byte
+}
+
+// Keyring holds the session keys. New sessions are sealed with the primary
+// (first) key; every key can still open sessions it sealed.
+type Keyring struct {
+	keys []SessionKey
+}
+
+// NewKeyring validates the keys and returns a keyring whose primary key is the first
+func NewKeyring(keys ...SessionKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring needs at least one key")
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !sessionKeyID.MatchString(key.ID) {
+			return nil, fmt.Errorf("invalid session key ID %q: use letters, digits, '-' or '_'", key.ID)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate session key ID %q", key.ID)
+		}
+		seen[key.ID] = true
+		if len(key.Key) != 32 {
+			return nil, fmt.Errorf("session key %q must be 32 bytes, got %d", key.ID, len(key.Key))
+		}
+	}
+	return &Keyring{keys: keys}, nil
+}
+
+// Primary returns the key that seals new sessions
+func (k *Keyring) Primary() SessionKey {
+	return k.keys[0]
+}
+
+// Lookup finds a key by ID
+func (k *Keyring) Lookup(id string) (SessionKey, bool) {
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return SessionKey{}, false
+}
+
+// Keys returns all keys, primary first
+func (k *Keyring) Keys() []SessionKey {
+	return k.keys
+}
+
+// newEphemeralKeyring generates a random key that lives only as long as the process
+func newEphemeralKeyring() *Keyring {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		panic("failed to generate random key")
+	}
+	return &Keyring{keys: []SessionKey{{ID: "ephemeral", Key: key}}}
+}
+
+// ParseKeyring builds a keyring from id:key pairs, primary key first, or
+// from a single key when there are no pairs. It returns nil without error
+// when neither is given.
+func ParseKeyring(entries []string, single string) (*Keyring, error) {
+	if len(entries) > 0 {
+		var keys []SessionKey
+		for _, entry := range entries {
+			id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok {
+				return nil, fmt.Errorf("session key entry %q is not in id:key form", entry)
+			}
+			key, err := decodeSessionKey(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("session key %q: %w", id, err)
+			}
+			keys = append(keys, SessionKey{ID: id, Key: key})
+		}
+		return NewKeyring(keys...)
+	}
+
+	if single != "" {
+		key, err := decodeSessionKey(single)
+		if err != nil {
+			return nil, fmt.Errorf("session key: %w", err)
+		}
+		return NewKeyring(SessionKey{ID: "default", Key: key})
+	}
+
+	return nil, nil
+}
+
+// decodeSessionKey accepts a raw 32-character key or 32 bytes in base64
+func decodeSessionKey(value string) ([]byte, error) {
+	if len(value) == 32 {
+		return []byte(value), nil
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if key, err := encoding.DecodeString(value); err == nil && len(key) == 32 {
+			return key, nil
+		}
+	}
+	return nil, errors.New("must be 32 raw characters or 32 base64-encoded bytes")
+}
+
+// seal encrypts data with the primary key. The result is "<key ID>.<ciphertext>"
+// so the right key can be found after rotation. The purpose is authenticated
+// along with the key ID, so a value sealed for one use cannot be passed off
+// as another (a pending login as a session, say).
+func (k *Keyring) seal(data []byte, purpose string) (string, error) {
+	key := k.Primary()
+	gcm, err := newGCM(key.Key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, data, sealedAAD(key.ID, purpose))
+	return key.ID + "." + base64.URLEncoding.EncodeToString(ciphertext), nil
+}
+
+// open reverses seal with whichever key sealed the value
+func (k *Keyring) open(sealed, purpose string) ([]byte, error) {
+	if id, payload, ok := strings.Cut(sealed, "."); ok {
+		key, found := k.Lookup(id)
+		if !found {
+			return nil, errors.New("value sealed with an unknown key")
+		}
+		return openSealed(key.Key, payload, sealedAAD(key.ID, purpose))
+	}
+	if purpose != "" {
+		return nil, errors.New("malformed sealed value")
+	}
+
+	// Sessions sealed before key IDs existed carry no hint, so try every key
+	var lastErr error
+	for _, key := range k.Keys() {
+		plaintext, err := openSealed(key.Key, sealed, nil)
+		if err == nil {
+			return plaintext, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func sealedAAD(keyID, purpose string) []byte {
+	if purpose == "" {
+		return []byte(keyID)
+	}
+	return []byte(keyID + "/" + purpose)
+}
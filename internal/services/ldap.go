@@ -0,0 +1,21 @@
+package services
+
+import (
+	"strings"
+	"time"
+)
+
+// LDAPConfig controls sign-in with directory credentials through MinIO's
+// AssumeRoleWithLDAPIdentity. The directory itself is configured on MinIO.
+type LDAPConfig struct {
+	Enabled bool
+	// SessionDuration is the requested STS credential lifetime; zero lets MinIO decide
+	SessionDuration time.Duration
+}
+
+// LDAPUsername returns the form of a directory username that IronBuckets keys
+// second factors, roles and approvals on. Directories match names without
+// regard to case or surrounding spaces, so "ALICE " and "alice" are one user.
+func LDAPUsername(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
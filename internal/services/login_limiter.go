@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoginThrottled is returned when a login attempt arrives during a
+// backoff delay or lockout
+var ErrLoginThrottled = errors.New("too many failed login attempts")
+
+// LoginLimitConfig sets the thresholds for login throttling. A zero maximum
+// disables that limit.
+type LoginLimitConfig struct {
+	// MaxFailuresPerIP locks out a client address after this many failures
+	MaxFailuresPerIP int
+	// MaxFailuresPerUser locks out an access key or username after this many failures
+	MaxFailuresPerUser int
+	// BaseDelay is the wait after the first failure; it doubles with each further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay
+	MaxDelay time.Duration
+	// Lockout is how long a lockout lasts, and how long failures are remembered
+	Lockout time.Duration
+}
+
+// DefaultLoginLimitConfig returns the thresholds used when nothing is configured
+func DefaultLoginLimitConfig() LoginLimitConfig {
+	return LoginLimitConfig{
+		MaxFailuresPerIP:   20,
+		MaxFailuresPerUser: 5,
+		BaseDelay:          time.Second,
+		MaxDelay:           30 * time.Second,
+		Lockout:            15 * time.Minute,
+	}
+}
+
+// LoginAttempts is the throttling state of one client address or user
+type LoginAttempts struct {
+	Failures    int       `json:"failures"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	LockedUntil time.Time `json:"lockedUntil,omitzero"`
+}
+
+// LoginAttemptStore holds throttling state. The in-memory store suits a
+// single instance; replicas need a shared implementation.
+type LoginAttemptStore interface {
+	// Get returns the state for key, or the zero value when there is none
+	Get(key string) (LoginAttempts, error)
+	// Put replaces the state for key, which may be dropped after ttl
+	Put(key string, attempts LoginAttempts, ttl time.Duration) error
+	Delete(key string) error
+}
+
+type storedAttempts struct {
+	attempts LoginAttempts
+	expires  time.Time
+}
+
+// MemoryLoginAttemptStore keeps throttling state in process memory
+type MemoryLoginAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]storedAttempts
+}
+
+// NewMemoryLoginAttemptStore creates an empty in-memory store
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{entries: make(map[string]storedAttempts)}
+}
+
+func (m *MemoryLoginAttemptStore) Get(key string) (LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return LoginAttempts{}, nil
+	}
+	return entry.attempts, nil
+}
+
+func (m *MemoryLoginAttemptStore) Put(key string, attempts LoginAttempts, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, entry := range m.entries {
+		if now.After(entry.expires) {
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = storedAttempts{attempts: attempts, expires: now.Add(ttl)}
+	return nil
+}
+
+func (m *MemoryLoginAttemptStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// attemptTimeout is how long an attempt counts as in flight when its outcome
+// is never reported
+const attemptTimeout = time.Minute
+
+// LoginLimiter throttles password logins per client address and per user.
+// Only failed attempts start the backoff, so correct logins can run side by
+// side. Attempts still waiting for MinIO count towards the lockout, so a burst
+// of parallel guesses gets no more tries than the same guesses made in turn.
+type LoginLimiter struct {
+	mu       sync.Mutex
+	config   LoginLimitConfig
+	store    LoginAttemptStore
+	inflight map[string][]time.Time
+	now      func() time.Time
+}
+
+// NewLoginLimiter creates a limiter backed by store
+func NewLoginLimiter(config LoginLimitConfig, store LoginAttemptStore) *LoginLimiter {
+	return &LoginLimiter{config: config, store: store, inflight: make(map[string][]time.Time), now: time.Now}
+}
+
+type loginSubject struct {
+	key         string
+	label       string
+	maxFailures int
+}
+
+func (l *LoginLimiter) subjects(ip, user string) []loginSubject {
+	subjects := []loginSubject{{key: "ip:" + ip, label: "address " + ip, maxFailures: l.config.MaxFailuresPerIP}}
+	if user != "" {
+		subjects = append(subjects, loginSubject{
+			key:         "user:" + strings.ToLower(user),
+			label:       fmt.Sprintf("user %q", user),
+			maxFailures: l.config.MaxFailuresPerUser,
+		})
+	}
+	return subjects
+}
+
+// delay is the backoff after the given number of consecutive failures
+func (l *LoginLimiter) delay(failures int) time.Duration {
+	if failures <= 0 || l.config.BaseDelay <= 0 {
+		return 0
+	}
+	delay := l.config.BaseDelay
+	for i := 1; i < failures && delay < l.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if l.config.MaxDelay > 0 && delay > l.config.MaxDelay {
+		delay = l.config.MaxDelay
+	}
+	return delay
+}
+
+// Allow reports whether a login for user from ip may proceed. When it may
+// not, it returns ErrLoginThrottled and how long the caller should wait. An
+// allowed attempt is in flight until Failed or Succeeded reports its outcome.
+func (l *LoginLimiter) Allow(ip, user string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	subjects := l.subjects(ip, user)
+	var wait time.Duration
+	for _, subject := range subjects {
+		state, err := l.store.Get(subject.key)
+		if err != nil {
+			return 0, err
+		}
+		until := state.LastAttempt.Add(l.delay(state.Failures))
+		if state.LockedUntil.After(until) {
+			until = state.LockedUntil
+		}
+		if until.After(now) && until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+
+		// Once a subject has failed, its attempts run one at a time so each
+		// outcome can start the backoff; until then, attempts in flight
+		// may not add up to more than the lockout threshold
+		if inflight := l.inflightLocked(subject.key, now); inflight > 0 {
+			busy := state.Failures > 0 ||
+				(subject.maxFailures > 0 && inflight >= subject.maxFailures)
+			if busy {
+				wait = max(wait, l.config.BaseDelay, time.Second)
+			}
+		}
+	}
+	if wait > 0 {
+		return wait, ErrLoginThrottled
+	}
+
+	for _, subject := range subjects {
+		l.inflight[subject.key] = append(l.inflight[subject.key], now)
+	}
+	return 0, nil
+}
+
+// inflightLocked counts the attempts on key still waiting for an outcome,
+// forgetting any that were abandoned
+func (l *LoginLimiter) inflightLocked(key string, now time.Time) int {
+	started := l.inflight[key]
+	for len(started) > 0 && now.Sub(started[0]) > attemptTimeout {
+		started = started[1:]
+	}
+	if len(started) == 0 {
+		delete(l.inflight, key)
+		return 0
+	}
+	l.inflight[key] = started
+	return len(started)
+}
+
+// releaseLocked ends the oldest attempt in flight for each subject
+func (l *LoginLimiter) releaseLocked(subjects []loginSubject) {
+	for _, subject := range subjects {
+		if started := l.inflight[subject.key]; len(started) > 1 {
+			l.inflight[subject.key] = started[1:]
+		} else {
+			delete(l.inflight, subject.key)
+		}
+	}
+}
+
+// Failed records a failed attempt, which starts the backoff delay, and locks
+// out any subject that has reached its threshold
+func (l *LoginLimiter) Failed(ip, user string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	subjects := l.subjects(ip, user)
+	l.releaseLocked(subjects)
+	for _, subject := range subjects {
+		state, err := l.store.Get(subject.key)
+		if err != nil {
+			log.Printf("Login: failed to read attempts for %s: %v", subject.label, err)
+			continue
+		}
+		state.Failures++
+		state.LastAttempt = now
+		lock := subject.maxFailures > 0 && state.Failures >= subject.maxFailures && !state.LockedUntil.After(now)
+		if lock {
+			state.LockedUntil = now.Add(l.config.Lockout)
+		}
+		if err := l.store.Put(subject.key, state, l.config.Lockout); err != nil {
+			log.Printf("Login: failed to record attempt for %s: %v", subject.label, err)
+			continue
+		}
+		if lock {
+			log.Printf("Login: locked out %s for %s after %d failed attempts", subject.label, l.config.Lockout, state.Failures)
+		}
+	}
+}
+
+// Succeeded clears the user's failures. Failures from the client address
+// still count towards its own limit.
+func (l *LoginLimiter) Succeeded(ip, user string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked(l.subjects(ip, user))
+	if user != "" {
+		_ = l.store.Delete("user:" + strings.ToLower(user))
+	}
+}
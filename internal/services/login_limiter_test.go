@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(config LoginLimitConfig) (*LoginLimiter, *time.Time) {
+	limiter := NewLoginLimiter(config, NewMemoryLoginAttemptStore())
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestLoginLimiter_BackoffDoublesAfterEachFailure(t *testing.T) {
+	limiter, now := newTestLimiter(LoginLimitConfig{BaseDelay: time.Second, MaxDelay: 4 * time.Second, Lockout: time.Hour})
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if _, err := limiter.Allow("10.0.0.1", "admin"); err != nil {
+			t.Fatalf("expected attempt to be allowed, got %v", err)
+		}
+		limiter.Failed("10.0.0.1", "admin")
+
+		wait, err := limiter.Allow("10.0.0.1", "admin")
+		if !errors.Is(err, ErrLoginThrottled) || wait != want {
+			t.Fatalf("Allow() = %v, %v; want %v, ErrLoginThrottled", wait, err, want)
+		}
+		*now = now.Add(want)
+	}
+}
+
+func TestLoginLimiter_ConcurrentLoginsAreNotThrottled(t *testing.T) {
+	limiter, _ := newTestLimiter(DefaultLoginLimitConfig())
+
+	// Several users behind one address sign in at once; none has failed yet
+	for _, user := range []string{"alice", "bob", "carol"} {
+		if _, err := limiter.Allow("10.0.0.1", user); err != nil {
+			t.Errorf("login for %s should not be throttled, got %v", user, err)
+		}
+	}
+	limiter.Succeeded("10.0.0.1", "alice")
+	if _, err := limiter.Allow("10.0.0.1", "alice"); err != nil {
+		t.Errorf("a successful login should not throttle the next one, got %v", err)
+	}
+}
+
+func TestLoginLimiter_ParallelGuessesCannotPassTheLockout(t *testing.T) {
+	limiter, _ := newTestLimiter(LoginLimitConfig{MaxFailuresPerUser: 3, BaseDelay: time.Second, Lockout: time.Hour})
+
+	// Every guess asks the limiter before any answer from MinIO comes back
+	const guesses = 20
+	var reached atomic.Int32
+	var asked sync.WaitGroup
+	release := make(chan struct{})
+	var done sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		asked.Add(1)
+		done.Add(1)
+		go func(ip string) {
+			defer done.Done()
+			_, err := limiter.Allow(ip, "admin")
+			asked.Done()
+			if err != nil {
+				return
+			}
+			reached.Add(1)
+			<-release
+			limiter.Failed(ip, "admin")
+		}(fmt.Sprintf("10.0.0.%d", i))
+	}
+	asked.Wait()
+	close(release)
+	done.Wait()
+
+	if n := reached.Load(); n > 3 {
+		t.Errorf("%d parallel guesses reached the verifier, want at most 3", n)
+	}
+	if _, err := limiter.Allow("10.0.1.1", "admin"); !errors.Is(err, ErrLoginThrottled) {
+		t.Errorf("expected the user to be locked out, got %v", err)
+	}
+}
+
+func TestLoginLimiter_LocksOutUserAndLogs(t *testing.T) {
+	var logs bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	limiter, now := newTestLimiter(LoginLimitConfig{MaxFailuresPerUser: 3, Lockout: 15 * time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if _, err := limiter.Allow("10.0.0.1", "Admin"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		limiter.Failed("10.0.0.1", "Admin")
+	}
+
+	// Another address cannot keep guessing the same key, whatever its case
+	wait, err := limiter.Allow("10.0.0.2", "admin")
+	if !errors.Is(err, ErrLoginThrottled) || wait != 15*time.Minute {
+		t.Errorf("Allow() = %v, %v; want lockout", wait, err)
+	}
+	if !strings.Contains(logs.String(), `locked out user "Admin" for 15m0s after 3 failed attempts`) {
+		t.Errorf("expected lockout log line, got %q", logs.String())
+	}
+
+	*now = now.Add(15 * time.Minute)
+	if _, err := limiter.Allow("10.0.0.2", "admin"); err != nil {
+		t.Errorf("expected lockout to end, got %v", err)
+	}
+}
+
+func TestLoginLimiter_LocksOutAddressAcrossUsers(t *testing.T) {
+	limiter, _ := newTestLimiter(LoginLimitConfig{MaxFailuresPerIP: 2, MaxFailuresPerUser: 10, Lockout: time.Minute})
+
+	for _, user := range []string{"alice", "bob"} {
+		if _, err := limiter.Allow("10.0.0.1", user); err != nil {
+			t.Fatalf("attempt for %s: %v", user, err)
+		}
+		limiter.Failed("10.0.0.1", user)
+	}
+
+	if _, err := limiter.Allow("10.0.0.1", "carol"); !errors.Is(err, ErrLoginThrottled) {
+		t.Errorf("expected address lockout, got %v", err)
+	}
+	if _, err := limiter.Allow("10.0.0.9", "carol"); err != nil {
+		t.Errorf("other addresses should be unaffected, got %v", err)
+	}
+}
+
+func TestLoginLimiter_SuccessResetsUser(t *testing.T) {
+	limiter, now := newTestLimiter(LoginLimitConfig{MaxFailuresPerUser: 2, BaseDelay: time.Second, Lockout: time.Hour})
+
+	_, _ = limiter.Allow("10.0.0.1", "admin")
+	limiter.Failed("10.0.0.1", "admin")
+	*now = now.Add(time.Second)
+	_, _ = limiter.Allow("10.0.0.1", "admin")
+	limiter.Succeeded("10.0.0.1", "admin")
+
+	*now = now.Add(time.Second)
+	_, _ = limiter.Allow("10.0.0.1", "admin")
+	limiter.Failed("10.0.0.1", "admin")
+	*now = now.Add(time.Second)
+	if _, err := limiter.Allow("10.0.0.1", "admin"); err != nil {
+		t.Errorf("a success should reset the failure count, got %v", err)
+	}
+}
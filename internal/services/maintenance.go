@@ -0,0 +1,65 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMaintenanceMessage is shown when read-only mode is turned on without
+// a message of its own
+const DefaultMaintenanceMessage = "IronBuckets is in read-only mode for maintenance. Browsing and downloads still work, but changes are disabled."
+
+// MaintenanceStatus describes the current read-only mode
+type MaintenanceStatus struct {
+	Enabled bool
+	Message string
+	// By is who turned read-only mode on; empty when it came from config
+	By    string
+	Since time.Time
+}
+
+// MaintenanceMode is a switch that makes IronBuckets read-only, for example
+// during MinIO upgrades. It starts from config and admins can flip it at
+// runtime; runtime changes last until the next restart.
+type MaintenanceMode struct {
+	mu     sync.RWMutex
+	status MaintenanceStatus
+}
+
+// NewMaintenanceMode creates the switch, on or off
+func NewMaintenanceMode(enabled bool, message string) *MaintenanceMode {
+	m := &MaintenanceMode{}
+	if enabled {
+		m.Enable("", message)
+	}
+	return m
+}
+
+// Status returns the current state
+func (m *MaintenanceMode) Status() MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// Enabled reports whether changes are currently refused
+func (m *MaintenanceMode) Enabled() bool {
+	return m.Status().Enabled
+}
+
+// Enable turns read-only mode on. by names the admin doing it.
+func (m *MaintenanceMode) Enable(by, message string) {
+	if message == "" {
+		message = DefaultMaintenanceMessage
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = MaintenanceStatus{Enabled: true, Message: message, By: by, Since: time.Now()}
+}
+
+// Disable turns read-only mode off
+func (m *MaintenanceMode) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = MaintenanceStatus{}
+}
@@ -0,0 +1,20 @@
+package services
+
+import "testing"
+
+func TestMaintenanceModeToggle(t *testing.T) {
+	mode := NewMaintenanceMode(false, "")
+	if mode.Enabled() {
+		t.Fatal("expected read-only mode to start off")
+	}
+
+	mode.Enable("admin", "Upgrading MinIO")
+	if status := mode.Status(); !status.Enabled || status.By != "admin" || status.Message != "Upgrading MinIO" || status.Since.IsZero() {
+		t.Errorf("Status() = %+v after Enable", status)
+	}
+
+	mode.Disable()
+	if mode.Enabled() {
+		t.Error("expected read-only mode to be off after Disable")
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"io"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/minio/madmin-go/v3"
@@ -39,6 +38,7 @@ type ListObjectsResult struct {
 type MinioAdminClient interface {
 	ServerInfo(ctx context.Context, opts ...func(*madmin.ServerInfoOpts)) (madmin.InfoMessage, error)
 	ListUsers(ctx context.Context) (map[string]madmin.UserInfo, error)
+	GetUserInfo(ctx context.Context, name string) (madmin.UserInfo, error)
 	AddUser(ctx context.Context, accessKey, secretKey string) error
 	RemoveUser(ctx context.Context, accessKey string) error
 	SetPolicy(ctx context.Context, policyName, entityName string, isGroup bool) error
@@ -46,6 +46,7 @@ type MinioAdminClient interface {
 	ServiceRestart(ctx context.Context) error
 	DataUsageInfo(ctx context.Context) (madmin.DataUsageInfo, error)
 	GetConfig(ctx context.Context) ([]byte, error)
+	AccountInfo(ctx context.Context, opts madmin.AccountOpts) (madmin.AccountInfo, error)
 
 	// Service Account methods
 	ListServiceAccounts(ctx context.Context, user string) (madmin.ListServiceAccountsResp, error)
@@ -275,38 +276,33 @@ func (c *WrappedMinioClient) SetBucketPolicy(ctx context.Context, bucketName, po
 }
 
 // RealMinioFactory is the production implementation
-type RealMinioFactory struct{}
-
-// ShouldUseSSL determines if SSL should be used based on the endpoint.
-// Returns false for localhost, 127.0.0.1, and docker service names.
-func ShouldUseSSL(endpoint string) bool {
-	return shouldUseSSL(endpoint)
-}
-
-func shouldUseSSL(endpoint string) bool {
-	// Local development endpoints
-	if endpoint == "localhost:9000" || endpoint == "127.0.0.1:9000" {
-		return false
-	}
-	// Docker service names (minio:9000, minio1:9000, minio2:9000, etc.)
-	// Only match simple hostnames without dots (not domain names like minio.example.com)
-	if strings.HasPrefix(endpoint, "minio") && !strings.Contains(strings.Split(endpoint, ":")[0], ".") && strings.Contains(endpoint, ":9000") {
-		return false
-	}
-	return true
+type RealMinioFactory struct {
+	// Clusters supplies the scheme, TLS options, region and bucket lookup
+	// per endpoint. Endpoints it does not know are reached over HTTPS.
+	Clusters *ClusterRegistry
 }
 
+// NewAdminClient connects with the cluster's scheme and TLS options. The
+// admin API always uses path-style requests and madmin has no region
+// setting, so those two options only apply to NewClient.
 func (f *RealMinioFactory) NewAdminClient(creds Credentials) (MinioAdminClient, error) {
+	cluster := f.Clusters.connection(creds.Endpoint)
 	return madmin.NewWithOptions(creds.Endpoint, &madmin.Options{
-		Creds:  credentials.NewStaticV4(creds.AccessKey, creds.SecretKey, ""),
-		Secure: shouldUseSSL(creds.Endpoint),
+		Creds:     credentials.NewStaticV4(creds.AccessKey, creds.SecretKey, creds.SessionToken),
+		Secure:    cluster.Secure,
+		Transport: cluster.transport,
 	})
 }
 
+// NewClient connects with every connection option of the cluster
 func (f *RealMinioFactory) NewClient(creds Credentials) (MinioClient, error) {
+	cluster := f.Clusters.connection(creds.Endpoint)
 	client, err := minio.New(creds.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(creds.AccessKey, creds.SecretKey, creds.SessionToken),
-		Secure: shouldUseSSL(creds.Endpoint),
+		Creds:        credentials.NewStaticV4(creds.AccessKey, creds.SecretKey, creds.SessionToken),
+		Secure:       cluster.Secure,
+		Transport:    cluster.transport,
+		Region:       cluster.Region,
+		BucketLookup: cluster.lookup,
 	})
 	if err != nil {
 		return nil, err
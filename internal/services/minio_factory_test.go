@@ -2,26 +2,33 @@ package services
 
 import "testing"
 
-func TestShouldUseSSL_Localhost(t *testing.T) {
+func TestRealMinioFactoryUsesClusterScheme(t *testing.T) {
+	registry, err := NewClusterRegistry([]Cluster{
+		{Alias: "plain", URL: "storage-internal:9000", Scheme: "http", BucketLookup: "path"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	factory := &RealMinioFactory{Clusters: registry}
+
 	tests := []struct {
 		endpoint string
-		want     bool
+		want     string
 	}{
-		{"localhost:9000", false},
-		{"127.0.0.1:9000", false},
-		{"minio:9000", false},
-		{"play.minio.io:9000", true},
-		{"s3.amazonaws.com", true},
-		{"minio.example.com:9000", true},
-		{"localhost:9001", true}, // Different port
-		{"192.168.1.100:9000", true},
+		{"storage-internal:9000", "http"},
+		{"minio:9000", "https"}, // not in the registry
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.endpoint, func(t *testing.T) {
-			got := shouldUseSSL(tt.endpoint)
-			if got != tt.want {
-				t.Errorf("shouldUseSSL(%q) = %v, want %v", tt.endpoint, got, tt.want)
+			client, err := factory.NewClient(Credentials{Endpoint: tt.endpoint, AccessKey: "admin", SecretKey: "password"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scheme := client.(*WrappedMinioClient).client.EndpointURL().Scheme; scheme != tt.want {
+				t.Errorf("scheme = %s, want %s", scheme, tt.want)
+			}
+			if _, err := factory.NewAdminClient(Credentials{Endpoint: tt.endpoint, AccessKey: "admin", SecretKey: "password"}); err != nil {
+				t.Errorf("NewAdminClient: %v", err)
 			}
 		})
 	}
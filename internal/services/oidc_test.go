@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newTestIssuer(t *testing.T, tokenHandler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+		})
+	})
+	if tokenHandler != nil {
+		mux.HandleFunc("/token", tokenHandler)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPKCEChallenge_RFC7636Vector(t *testing.T) {
+	got := PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got != want {
+		t.Errorf("PKCEChallenge() = %q, want %q", got, want)
+	}
+}
+
+func TestNewRandomToken_IsUnique(t *testing.T) {
+	a, err := NewRandomToken(32)
+	if err != nil {
+		t.Fatalf("NewRandomToken failed: %v", err)
+	}
+	b, _ := NewRandomToken(32)
+	if a == b {
+		t.Error("expected distinct tokens")
+	}
+	if len(a) != 43 {
+		t.Errorf("expected 43 base64url chars, got %d", len(a))
+	}
+}
+
+func TestOIDCProvider_AuthCodeURL(t *testing.T) {
+	issuer := newTestIssuer(t, nil)
+	provider := NewOIDCProvider(OIDCConfig{
+		IssuerURL:   issuer.URL,
+		ClientID:    "ironbuckets",
+		RedirectURL: "http://localhost:8080/oauth/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+
+	raw, err := provider.AuthCodeURL(context.Background(), "state-123", "challenge-abc")
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+
+	u, _ := url.Parse(raw)
+	q := u.Query()
+	if u.Path != "/authorize" {
+		t.Errorf("unexpected path %q", u.Path)
+	}
+	checks := map[string]string{
+		"response_type":         "code",
+		"client_id":             "ironbuckets",
+		"redirect_uri":          "http://localhost:8080/oauth/callback",
+		"scope":                 "openid email",
+		"state":                 "state-123",
+		"code_challenge":        "challenge-abc",
+		"code_challenge_method": "S256",
+	}
+	for key, want := range checks {
+		if got := q.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	issuer := newTestIssuer(t, func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "ironbuckets" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostForm.Get("code") != "auth-code" || r.PostForm.Get("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id_token":     "header.payload.signature",
+			"access_token": "access",
+			"expires_in":   300,
+		})
+	})
+	provider := NewOIDCProvider(OIDCConfig{
+		IssuerURL:    issuer.URL,
+		ClientID:     "ironbuckets",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://localhost:8080/oauth/callback",
+	})
+
+	token, err := provider.Exchange(context.Background(), "auth-code", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if token.IDToken != "header.payload.signature" || token.AccessToken != "access" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	if _, err := provider.Exchange(context.Background(), "wrong-code", "verifier"); err == nil {
+		t.Error("expected error for rejected code")
+	}
+}
+
+func TestOIDCProvider_RejectsIssuerMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://evil.example.com",
+			"authorization_endpoint": "https://evil.example.com/authorize",
+			"token_endpoint":         "https://evil.example.com/token",
+		})
+	}))
+	defer srv.Close()
+
+	provider := NewOIDCProvider(OIDCConfig{IssuerURL: srv.URL, ClientID: "x", RedirectURL: "http://localhost/cb"})
+	if _, err := provider.AuthCodeURL(context.Background(), "s", "c"); err == nil {
+		t.Error("expected issuer mismatch error")
+	}
+}
+
+func TestOIDCToken_Username(t *testing.T) {
+	token := func(claims string) OIDCToken {
+		return OIDCToken{IDToken: "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"}
+	}
+	for claims, want := range map[string]string{
+		`{"sub":"0f2c","preferred_username":"alice"}`: "alice",
+		`{"sub":"0f2c"}`: "0f2c",
+	} {
+		if got, err := token(claims).Username(); err != nil || got != want {
+			t.Errorf("Username() for %s = %q, %v; want %q", claims, got, err, want)
+		}
+	}
+	for _, bad := range []OIDCToken{token(`{}`), {IDToken: "opaque"}, {IDToken: "a.!!.c"}} {
+		if _, err := bad.Username(); err == nil {
+			t.Errorf("expected an error for %q", bad.IDToken)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// PendingLoginLifetime is how long a user has to complete a second factor
+const PendingLoginLifetime = 5 * time.Minute
+
+const pendingLoginPurpose = "pending-login"
+
+// ErrPendingLoginExpired is returned when a pending login is too old or invalid
+var ErrPendingLoginExpired = errors.New("pending login expired")
+
+type pendingLogin struct {
+	Credentials Credentials `json:"credentials"`
+	Expires     time.Time   `json:"expires"`
+}
+
+// SealPendingLogin seals credentials that have passed the password check but
+// still need a second factor. The value cannot be opened as a session.
+func (s *AuthService) SealPendingLogin(creds Credentials) (string, time.Time, error) {
+	expires := time.Now().Add(PendingLoginLifetime)
+	data, err := json.Marshal(pendingLogin{Credentials: creds, Expires: expires})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	sealed, err := s.keyring.seal(data, pendingLoginPurpose)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return sealed, expires, nil
+}
+
+// OpenPendingLogin returns the credentials sealed by SealPendingLogin
+func (s *AuthService) OpenPendingLogin(value string) (Credentials, error) {
+	data, err := s.keyring.open(value, pendingLoginPurpose)
+	if err != nil {
+		return Credentials{}, ErrPendingLoginExpired
+	}
+	var pending pendingLogin
+	if err := json.Unmarshal(data, &pending); err != nil || time.Now().After(pending.Expires) {
+		return Credentials{}, ErrPendingLoginExpired
+	}
+	return pending.Credentials, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"path"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+// Permissions describes what the signed-in account may do, as reported by
+// MinIO's AccountInfo. It only decides what the UI offers; MinIO still
+// enforces every request. A nil or unknown Permissions allows everything, so
+// a MinIO that cannot answer AccountInfo keeps the old behaviour.
+type Permissions struct {
+	known   bool
+	allow   []string
+	deny    []string
+	buckets map[string]madmin.AccountAccess
+}
+
+// accountPolicy is the subset of an IAM policy needed to evaluate actions
+type accountPolicy struct {
+	Statement []struct {
+		Effect string      `json:"Effect"`
+		Action stringOrSet `json:"Action"`
+	} `json:"Statement"`
+}
+
+// stringOrSet accepts an IAM field written as a string or a list of strings
+type stringOrSet []string
+
+func (s *stringOrSet) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = []string{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// NewPermissions builds Permissions from an AccountInfo response
+func NewPermissions(info madmin.AccountInfo) (*Permissions, error) {
+	p := &Permissions{known: true, buckets: make(map[string]madmin.AccountAccess, len(info.Buckets))}
+	if len(info.Policy) > 0 {
+		var policy accountPolicy
+		if err := json.Unmarshal(info.Policy, &policy); err != nil {
+			return nil, err
+		}
+		for _, statement := range policy.Statement {
+			if statement.Effect == "Deny" {
+				p.deny = append(p.deny, statement.Action...)
+			} else if statement.Effect == "Allow" {
+				p.allow = append(p.allow, statement.Action...)
+			}
+		}
+	}
+	for _, bucket := range info.Buckets {
+		p.buckets[bucket.Name] = bucket.Access
+	}
+	return p, nil
+}
+
+// Known reports whether MinIO described the account
+func (p *Permissions) Known() bool {
+	return p != nil && p.known
+}
+
+// Allowed reports whether the account's policy allows an IAM action such as
+// "admin:ListUsers". Resources and conditions are not considered.
+func (p *Permissions) Allowed(action string) bool {
+	if !p.Known() {
+		return true
+	}
+	if matchesAction(p.deny, action) {
+		return false
+	}
+	return matchesAction(p.allow, action)
+}
+
+// Admin reports whether the account can administer the cluster
+func (p *Permissions) Admin() bool {
+	return p.Allowed("admin:ServerInfo")
+}
+
+// CreateBucket reports whether the account can create buckets
+func (p *Permissions) CreateBucket() bool {
+	return p.Allowed("s3:CreateBucket")
+}
+
+// Read reports whether the account can list and download from a bucket
+func (p *Permissions) Read(bucket string) bool {
+	access, ok := p.bucket(bucket)
+	return !ok || access.Read
+}
+
+// Write reports whether the account can change objects in a bucket
+func (p *Permissions) Write(bucket string) bool {
+	access, ok := p.bucket(bucket)
+	return !ok || access.Write
+}
+
+// bucket returns the access AccountInfo reported for a bucket. Buckets it did
+// not list, such as one created since the answer was cached, are unknown and
+// left to MinIO.
+func (p *Permissions) bucket(name string) (madmin.AccountAccess, bool) {
+	if !p.Known() {
+		return madmin.AccountAccess{}, false
+	}
+	access, ok := p.buckets[name]
+	return access, ok
+}
+
+func matchesAction(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == action {
+			return true
+		}
+		if ok, _ := path.Match(pattern, action); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionService looks up and caches Permissions per session
+type PermissionService struct {
+	minioFactory MinioClientFactory
+	cache        *sessionCache[*Permissions]
+	now          func() time.Time
+}
+
+// NewPermissionService creates a service that calls AccountInfo through minioFactory
+func NewPermissionService(minioFactory MinioClientFactory) *PermissionService {
+	return &PermissionService{
+		minioFactory: minioFactory,
+		cache:        newSessionCache[*Permissions](),
+		now:          time.Now,
+	}
+}
+
+// Lookup returns the Permissions cached under key, calling AccountInfo with
+// creds when there are none yet or they are older than a few minutes. When
+// AccountInfo fails, unknown Permissions are cached so MinIO is not asked
+// again on every request.
+func (s *PermissionService) Lookup(ctx context.Context, key string, creds Credentials) *Permissions {
+	now := s.now()
+	if permissions, ok := s.cache.get(key, now); ok {
+		return permissions
+	}
+	permissions := s.fetch(ctx, creds)
+	s.cache.put(key, permissions, now)
+	return permissions
+}
+
+func (s *PermissionService) fetch(ctx context.Context, creds Credentials) *Permissions {
+	mdm, err := s.minioFactory.NewAdminClient(creds)
+	if err != nil {
+		log.Printf("Permissions: failed to connect for %q: %v", creds.Identity(), err)
+		return &Permissions{}
+	}
+	info, err := mdm.AccountInfo(ctx, madmin.AccountOpts{})
+	if err != nil {
+		log.Printf("Permissions: AccountInfo failed for %q, showing every action: %v", creds.Identity(), err)
+		return &Permissions{}
+	}
+	permissions, err := NewPermissions(info)
+	if err != nil {
+		log.Printf("Permissions: cannot read the policy of %q, showing every action: %v", creds.Identity(), err)
+		return &Permissions{}
+	}
+	return permissions
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+type fakeAccountInfo struct {
+	MinioAdminClient
+	info  madmin.AccountInfo
+	err   error
+	calls int
+}
+
+func (f *fakeAccountInfo) AccountInfo(context.Context, madmin.AccountOpts) (madmin.AccountInfo, error) {
+	f.calls++
+	return f.info, f.err
+}
+
+type fakeAccountInfoFactory struct {
+	admin *fakeAccountInfo
+}
+
+func (f *fakeAccountInfoFactory) NewAdminClient(Credentials) (MinioAdminClient, error) {
+	return f.admin, nil
+}
+
+func (f *fakeAccountInfoFactory) NewClient(Credentials) (MinioClient, error) {
+	return nil, errors.New("not used")
+}
+
+func readWriteAccount() madmin.AccountInfo {
+	return madmin.AccountInfo{
+		AccountName: "alice",
+		Policy: json.RawMessage(`{
+			"Version": "2012-10-17",
+			"Statement": [
+				{"Effect": "Allow", "Action": ["s3:Get*", "s3:List*", "s3:PutObject"], "Resource": ["arn:aws:s3:::*"]},
+				{"Effect": "Allow", "Action": "admin:ListUsers"},
+				{"Effect": "Deny", "Action": ["s3:DeleteBucket", "admin:ListUsers"]}
+			]
+		}`),
+		Buckets: []madmin.BucketAccessInfo{
+			{Name: "reports", Access: madmin.AccountAccess{Read: true}},
+			{Name: "uploads", Access: madmin.AccountAccess{Read: true, Write: true}},
+		},
+	}
+}
+
+func TestPermissions_FromAccountInfo(t *testing.T) {
+	p, err := NewPermissions(readWriteAccount())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Known() {
+		t.Fatal("permissions from AccountInfo should be known")
+	}
+	for action, want := range map[string]bool{
+		"s3:GetObject":     true,
+		"s3:ListBucket":    true,
+		"s3:PutObject":     true,
+		"s3:CreateBucket":  false,
+		"s3:DeleteBucket":  false,
+		"admin:ListUsers":  false, // denied
+		"admin:ServerInfo": false,
+	} {
+		if got := p.Allowed(action); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", action, got, want)
+		}
+	}
+	if p.Admin() || p.CreateBucket() {
+		t.Error("account is neither admin nor allowed to create buckets")
+	}
+	if !p.Read("reports") || p.Write("reports") {
+		t.Error("reports should be read-only")
+	}
+	if !p.Read("uploads") || !p.Write("uploads") {
+		t.Error("uploads should be read-write")
+	}
+	if !p.Read("created-since") || !p.Write("created-since") {
+		t.Error("buckets missing from AccountInfo should be left to MinIO")
+	}
+}
+
+func TestPermissions_ConsoleAdmin(t *testing.T) {
+	// MinIO reports the consoleAdmin policy for the root user
+	p, err := NewPermissions(madmin.AccountInfo{
+		Policy: json.RawMessage(`{"Statement": [{"Effect": "Allow", "Action": ["admin:*", "kms:*", "s3:*"], "Resource": ["arn:aws:s3:::*"]}]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Admin() || !p.CreateBucket() || !p.Allowed("admin:ListGroups") {
+		t.Error("consoleAdmin should allow everything")
+	}
+}
+
+func TestPermissions_UnknownAllowsEverything(t *testing.T) {
+	var nilPermissions *Permissions
+	for _, p := range []*Permissions{nilPermissions, {}} {
+		if p.Known() {
+			t.Error("expected unknown permissions")
+		}
+		if !p.Admin() || !p.Read("any") || !p.Write("any") || !p.CreateBucket() {
+			t.Error("unknown permissions should leave decisions to MinIO")
+		}
+	}
+}
+
+func TestPermissionService_CachesPerKey(t *testing.T) {
+	admin := &fakeAccountInfo{info: readWriteAccount()}
+	svc := NewPermissionService(&fakeAccountInfoFactory{admin: admin})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	creds := Credentials{Endpoint: "minio:9000", AccessKey: "alice"}
+
+	first := svc.Lookup(context.Background(), "session-1", creds)
+	second := svc.Lookup(context.Background(), "session-1", creds)
+	if first != second || admin.calls != 1 {
+		t.Errorf("expected one AccountInfo call per session, got %d", admin.calls)
+	}
+
+	svc.Lookup(context.Background(), "session-2", creds)
+	if admin.calls != 2 {
+		t.Errorf("a new session should call AccountInfo, got %d calls", admin.calls)
+	}
+
+	now = now.Add(sessionCacheTTL)
+	svc.Lookup(context.Background(), "session-1", creds)
+	if admin.calls != 3 {
+		t.Errorf("cached permissions should be refreshed after %s, got %d calls", sessionCacheTTL, admin.calls)
+	}
+}
+
+func TestPermissionService_FallsBackWhenAccountInfoFails(t *testing.T) {
+	admin := &fakeAccountInfo{err: errors.New("not implemented")}
+	svc := NewPermissionService(&fakeAccountInfoFactory{admin: admin})
+
+	p := svc.Lookup(context.Background(), "session-1", Credentials{AccessKey: "alice"})
+	if p.Known() || !p.Admin() {
+		t.Error("a failed AccountInfo should leave everything allowed")
+	}
+	svc.Lookup(context.Background(), "session-1", Credentials{AccessKey: "alice"})
+	if admin.calls != 1 {
+		t.Errorf("failures should be cached too, got %d calls", admin.calls)
+	}
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Capability is something a role allows in the console, independent of what
+// the account's MinIO policy allows
+type Capability string
+
+const (
+	// CapabilityBucketsView lists and browses buckets and downloads objects
+	CapabilityBucketsView Capability = "buckets.view"
+	// CapabilityObjectsWrite uploads, deletes, tags and shares objects
+	CapabilityObjectsWrite Capability = "objects.write"
+	// CapabilityBucketsManage creates and deletes buckets and changes their settings
+	CapabilityBucketsManage Capability = "buckets.manage"
+	// CapabilityIAMView lists users, groups, policies and access keys
+	CapabilityIAMView Capability = "iam.view"
+	// CapabilityIAMManage changes users, groups, policies and access keys, and
+	// other users' sessions, tokens and second factors
+	CapabilityIAMManage Capability = "iam.manage"
+	// CapabilityServerView shows server information, drives and logs
+	CapabilityServerView Capability = "server.view"
+	// CapabilityServerRestart restarts the MinIO service
+	CapabilityServerRestart Capability = "server.restart"
+)
+
+// Capabilities lists every capability, in the order they are documented
+var Capabilities = []Capability{
+	CapabilityBucketsView,
+	CapabilityObjectsWrite,
+	CapabilityBucketsManage,
+	CapabilityIAMView,
+	CapabilityIAMManage,
+	CapabilityServerView,
+	CapabilityServerRestart,
+}
+
+// builtinRoles are available without being defined in the roles file
+var builtinRoles = map[string][]Capability{
+	"viewer":   {CapabilityBucketsView},
+	"operator": {CapabilityBucketsView, CapabilityObjectsWrite, CapabilityIAMView, CapabilityServerView},
+	"admin":    Capabilities,
+}
+
+// Role limits what a user can do in IronBuckets. It narrows, and never
+// widens, what their MinIO policy allows. A nil Role allows everything, which
+// is what happens when no roles file is configured.
+type Role struct {
+	Name         string
+	capabilities map[Capability]bool
+}
+
+func newRole(name string, capabilities []Capability) *Role {
+	role := &Role{Name: name, capabilities: make(map[Capability]bool, len(capabilities))}
+	for _, capability := range capabilities {
+		role.capabilities[capability] = true
+	}
+	return role
+}
+
+// Allows reports whether the role includes a capability
+func (r *Role) Allows(capability Capability) bool {
+	return r == nil || r.capabilities[capability]
+}
+
+// RoleMapping assigns a role to users in a MinIO group or whose access key
+// matches a pattern such as "ci-*"
+type RoleMapping struct {
+	Group     string `yaml:"group"`
+	AccessKey string `yaml:"accessKey"`
+	Role      string `yaml:"role"`
+}
+
+// RoleConfig maps users to roles. Mappings are checked in order and the
+// first match wins; users matching none get the default role.
+type RoleConfig struct {
+	// Default is the role of users no mapping matches; "viewer" when empty
+	Default string `yaml:"default"`
+	// Roles defines custom roles by their capabilities
+	Roles    map[string][]Capability `yaml:"roles"`
+	Mappings []RoleMapping           `yaml:"mappings"`
+
+	roles map[string]*Role
+}
+
+// validate checks the roles and mappings and builds the role table
+func (c *RoleConfig) validate() error {
+	if c.Default == "" {
+		c.Default = "viewer"
+	}
+	known := make(map[Capability]bool, len(Capabilities))
+	for _, capability := range Capabilities {
+		known[capability] = true
+	}
+	c.roles = make(map[string]*Role, len(builtinRoles)+len(c.Roles))
+	for name, capabilities := range builtinRoles {
+		c.roles[name] = newRole(name, capabilities)
+	}
+	for name, capabilities := range c.Roles {
+		if _, ok := builtinRoles[name]; ok {
+			return fmt.Errorf("role %q is built in and cannot be redefined", name)
+		}
+		for _, capability := range capabilities {
+			if !known[capability] {
+				return fmt.Errorf("role %q: unknown capability %q", name, capability)
+			}
+		}
+		c.roles[name] = newRole(name, capabilities)
+	}
+	if _, ok := c.roles[c.Default]; !ok {
+		return fmt.Errorf("default role %q is not defined", c.Default)
+	}
+	for i, mapping := range c.Mappings {
+		if (mapping.Group == "") == (mapping.AccessKey == "") {
+			return fmt.Errorf("mapping %d: set exactly one of group or accessKey", i+1)
+		}
+		if _, err := path.Match(mapping.AccessKey, ""); err != nil {
+			return fmt.Errorf("mapping %d: invalid accessKey pattern %q", i+1, mapping.AccessKey)
+		}
+		if _, ok := c.roles[mapping.Role]; !ok {
+			return fmt.Errorf("mapping %d: role %q is not defined", i+1, mapping.Role)
+		}
+	}
+	return nil
+}
+
+// needsGroups reports whether any mapping depends on group membership
+func (c *RoleConfig) needsGroups() bool {
+	for _, mapping := range c.Mappings {
+		if mapping.Group != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the role of a user with the given access key and groups
+func (c *RoleConfig) Resolve(accessKey string, groups []string) *Role {
+	for _, mapping := range c.Mappings {
+		if mapping.Group != "" {
+			for _, group := range groups {
+				if group == mapping.Group {
+					return c.roles[mapping.Role]
+				}
+			}
+			continue
+		}
+		if ok, _ := path.Match(mapping.AccessKey, accessKey); ok {
+			return c.roles[mapping.Role]
+		}
+	}
+	return c.roles[c.Default]
+}
+
+// LoadRoleConfig reads roles from a YAML file of the form
+//
+//	default: viewer
+//	roles:
+//	  oncall: [buckets.view, server.view]
+//	mappings:
+//	  - group: platform-admins
+//	    role: admin
+//	  - accessKey: "ci-*"
+//	    role: operator
+func LoadRoleConfig(filename string) (*RoleConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config RoleConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &config, nil
+}
+
+// RoleService resolves and caches the role of each session
+type RoleService struct {
+	config       *RoleConfig
+	minioFactory MinioClientFactory
+	longTerm     func(Credentials) (Credentials, bool)
+	cache        *sessionCache[*Role]
+	now          func() time.Time
+}
+
+// NewRoleService creates a service that resolves roles from config. Group
+// membership is read with GetUserInfo, using the long-term key behind a
+// session when longTerm returns one, because MinIO only lets users read
+// their own user info with that key.
+func NewRoleService(config *RoleConfig, minioFactory MinioClientFactory, longTerm func(Credentials) (Credentials, bool)) *RoleService {
+	return &RoleService{
+		config:       config,
+		minioFactory: minioFactory,
+		longTerm:     longTerm,
+		cache:        newSessionCache[*Role](),
+		now:          time.Now,
+	}
+}
+
+// Lookup returns the role cached under key, resolving it for creds when
+// there is none yet or it is older than a few minutes
+func (s *RoleService) Lookup(ctx context.Context, key string, creds Credentials) *Role {
+	now := s.now()
+	if role, ok := s.cache.get(key, now); ok {
+		return role
+	}
+	var groups []string
+	if s.config.needsGroups() {
+		groups = s.groups(ctx, creds)
+	}
+	role := s.config.Resolve(creds.Identity(), groups)
+	s.cache.put(key, role, now)
+	return role
+}
+
+// groups returns the MinIO groups of the signed-in user. A failed lookup is
+// logged and treated as no groups, so the user falls back to access-key
+// mappings and the default role rather than gaining one.
+func (s *RoleService) groups(ctx context.Context, creds Credentials) []string {
+	lookup := creds
+	if s.longTerm != nil {
+		if longTerm, ok := s.longTerm(creds); ok {
+			lookup = longTerm
+		}
+	}
+	mdm, err := s.minioFactory.NewAdminClient(lookup)
+	if err != nil {
+		log.Printf("Roles: failed to connect for %q: %v", creds.Identity(), err)
+		return nil
+	}
+	info, err := mdm.GetUserInfo(ctx, creds.Identity())
+	if err != nil {
+		log.Printf("Roles: cannot read the groups of %q, using access-key mappings only: %v", creds.Identity(), err)
+		return nil
+	}
+	return info.MemberOf
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+type fakeUserInfo struct {
+	MinioAdminClient
+	groups []string
+	err    error
+	calls  int
+}
+
+func (f *fakeUserInfo) GetUserInfo(context.Context, string) (madmin.UserInfo, error) {
+	f.calls++
+	return madmin.UserInfo{MemberOf: f.groups}, f.err
+}
+
+type fakeUserInfoFactory struct {
+	admin *fakeUserInfo
+	seen  []Credentials
+}
+
+func (f *fakeUserInfoFactory) NewAdminClient(creds Credentials) (MinioAdminClient, error) {
+	f.seen = append(f.seen, creds)
+	return f.admin, nil
+}
+
+func (f *fakeUserInfoFactory) NewClient(Credentials) (MinioClient, error) {
+	return nil, errors.New("not used")
+}
+
+func writeRoleConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "roles.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testRoles = `
+default: viewer
+roles:
+  oncall: [buckets.view, server.view]
+mappings:
+  - group: platform-admins
+    role: admin
+  - group: oncall
+    role: oncall
+  - accessKey: "ci-*"
+    role: operator
+`
+
+func TestLoadRoleConfig_ResolvesFirstMatch(t *testing.T) {
+	config, err := LoadRoleConfig(writeRoleConfig(t, testRoles))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		accessKey string
+		groups    []string
+		want      string
+	}{
+		{"alice", []string{"oncall", "platform-admins"}, "admin"},
+		{"bob", []string{"oncall"}, "oncall"},
+		{"ci-deploy", nil, "operator"},
+		{"ci-deploy", []string{"oncall"}, "oncall"},
+		{"carol", []string{"finance"}, "viewer"},
+	}
+	for _, tt := range tests {
+		if got := config.Resolve(tt.accessKey, tt.groups); got.Name != tt.want {
+			t.Errorf("Resolve(%q, %v) = %q, want %q", tt.accessKey, tt.groups, got.Name, tt.want)
+		}
+	}
+
+	oncall := config.Resolve("bob", []string{"oncall"})
+	if !oncall.Allows(CapabilityServerView) || oncall.Allows(CapabilityServerRestart) || oncall.Allows(CapabilityBucketsManage) {
+		t.Error("oncall should view the server but not restart it or delete buckets")
+	}
+}
+
+func TestLoadRoleConfig_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown capability": "roles:\n  oncall: [server.reboot]\n",
+		"builtin redefined":  "roles:\n  admin: [buckets.view]\n",
+		"unknown default":    "default: nobody\n",
+		"unknown role":       "mappings:\n  - group: oncall\n    role: nobody\n",
+		"no selector":        "mappings:\n  - role: viewer\n",
+		"two selectors":      "mappings:\n  - group: oncall\n    accessKey: ci-*\n    role: viewer\n",
+		"bad pattern":        "mappings:\n  - accessKey: \"ci-[\"\n    role: viewer\n",
+	}
+	for name, content := range tests {
+		if _, err := LoadRoleConfig(writeRoleConfig(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRole_NilAllowsEverything(t *testing.T) {
+	var role *Role
+	for _, capability := range Capabilities {
+		if !role.Allows(capability) {
+			t.Errorf("a nil role should allow %s", capability)
+		}
+	}
+}
+
+func TestRoleService_ReadsGroupsWithLongTermKey(t *testing.T) {
+	config, err := LoadRoleConfig(writeRoleConfig(t, testRoles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &fakeUserInfo{groups: []string{"oncall"}}
+	factory := &fakeUserInfoFactory{admin: admin}
+	longTerm := Credentials{Endpoint: "minio:9000", AccessKey: "bob", SecretKey: "secret"}
+	svc := NewRoleService(config, factory, func(Credentials) (Credentials, bool) { return longTerm, true })
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	session := Credentials{Endpoint: "minio:9000", AccessKey: "temp", SessionToken: "token", User: "bob"}
+
+	role := svc.Lookup(context.Background(), "session-1", session)
+	if role.Name != "oncall" {
+		t.Fatalf("role = %q, want oncall", role.Name)
+	}
+	if len(factory.seen) != 1 || factory.seen[0] != longTerm {
+		t.Errorf("groups should be read with the long-term key, got %+v", factory.seen)
+	}
+
+	svc.Lookup(context.Background(), "session-1", session)
+	if admin.calls != 1 {
+		t.Errorf("expected the role to be cached per session, got %d calls", admin.calls)
+	}
+	now = now.Add(sessionCacheTTL)
+	svc.Lookup(context.Background(), "session-1", session)
+	if admin.calls != 2 {
+		t.Errorf("cached roles should be refreshed, got %d calls", admin.calls)
+	}
+}
+
+func TestRoleService_FallsBackToDefaultWithoutGroups(t *testing.T) {
+	config, err := LoadRoleConfig(writeRoleConfig(t, testRoles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &fakeUserInfo{err: errors.New("access denied")}
+	svc := NewRoleService(config, &fakeUserInfoFactory{admin: admin}, nil)
+
+	role := svc.Lookup(context.Background(), "session-1", Credentials{AccessKey: "carol"})
+	if role.Name != "viewer" {
+		t.Errorf("role = %q, want the default viewer role", role.Name)
+	}
+	role = svc.Lookup(context.Background(), "session-2", Credentials{AccessKey: "ci-deploy"})
+	if role.Name != "operator" {
+		t.Errorf("role = %q, access-key mappings should still apply", role.Name)
+	}
+}
+
+func TestRoleService_SkipsGroupLookupWithoutGroupMappings(t *testing.T) {
+	config, err := LoadRoleConfig(writeRoleConfig(t, "mappings:\n  - accessKey: \"*\"\n    role: operator\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &fakeUserInfo{}
+	svc := NewRoleService(config, &fakeUserInfoFactory{admin: admin}, nil)
+
+	if role := svc.Lookup(context.Background(), "session-1", Credentials{AccessKey: "alice"}); role.Name != "operator" {
+		t.Errorf("role = %q, want operator", role.Name)
+	}
+	if admin.calls != 0 {
+		t.Error("GetUserInfo should not be called when no mapping uses groups")
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// sessionCacheTTL bounds how long a change in MinIO takes to show in the UI
+const sessionCacheTTL = 5 * time.Minute
+
+// sessionCachePruneSize is the cache size at which expired entries are dropped
+const sessionCachePruneSize = 1024
+
+type sessionCacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// sessionCache holds a value per session for a few minutes, so lookups that
+// call MinIO happen once per session rather than on every request
+type sessionCache[T any] struct {
+	mu      sync.Mutex
+	entries map[string]sessionCacheEntry[T]
+}
+
+func newSessionCache[T any]() *sessionCache[T] {
+	return &sessionCache[T]{entries: make(map[string]sessionCacheEntry[T])}
+}
+
+// get returns the value cached under key if it has not expired at now
+func (c *sessionCache[T]) get(key string, now time.Time) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// put caches value under key from now
+func (c *sessionCache[T]) put(key string, value T, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= sessionCachePruneSize {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = sessionCacheEntry[T]{value: value, expires: now.Add(sessionCacheTTL)}
+}
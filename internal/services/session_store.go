@@ -0,0 +1,189 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or has expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a server-side login record. The credentials are sealed with the
+// session key so a store never holds them in the clear, and ID is the
+// SessionHandle of the cookie value rather than the value itself.
+type Session struct {
+	ID        string    `json:"id"`
+	AccessKey string    `json:"accessKey"`
+	Sealed    string    `json:"sealed"`
+	RemoteIP  string    `json:"remoteIp"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SessionStore persists sessions so they can be listed and revoked
+type SessionStore interface {
+	// Save creates or replaces a session
+	Save(session Session) error
+	Get(id string) (Session, error)
+	Delete(id string) error
+	// List returns unexpired sessions, most recently active first
+	List() ([]Session, error)
+}
+
+// MemorySessionStore keeps sessions in process memory
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore creates an empty in-memory store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+func (m *MemorySessionStore) Save(session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(time.Now())
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *MemorySessionStore) Get(id string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemorySessionStore) List() ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	sessions := make([]Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		if now.Before(session.ExpiresAt) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+func (m *MemorySessionStore) pruneLocked(now time.Time) {
+	for id, session := range m.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// FileSessionStore keeps sessions in memory and writes them to a JSON file on
+// every change, so sessions survive a restart of a single instance
+type FileSessionStore struct {
+	*MemorySessionStore
+	path    string
+	writeMu sync.Mutex
+}
+
+// NewFileSessionStore loads sessions from path, which is created on first write
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	store := &FileSessionStore{MemorySessionStore: NewMemorySessionStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading session file: %w", err)
+	}
+
+	var sessions []Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("parsing session file: %w", err)
+	}
+	migrated := false
+	for _, session := range sessions {
+		// Earlier versions keyed sessions by the cookie value itself
+		if len(session.ID) == legacySessionIDLength {
+			session.ID = SessionHandle(session.ID)
+			migrated = true
+		}
+		store.sessions[session.ID] = session
+	}
+	if migrated {
+		if err := store.flush(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// legacySessionIDLength is the length of a raw 32-byte cookie value, which is
+// what earlier versions wrote as the session ID
+const legacySessionIDLength = 43
+
+func (f *FileSessionStore) Save(session Session) error {
+	if err := f.MemorySessionStore.Save(session); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileSessionStore) Delete(id string) error {
+	if err := f.MemorySessionStore.Delete(id); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+// flush writes the current sessions to disk
+func (f *FileSessionStore) flush() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	sessions, err := f.List()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(f.path, data)
+}
+
+// NewSessionStore builds the store of the given kind ("memory" or "file").
+// It returns nil for an empty kind, when sessions live only in the cookie.
+func NewSessionStore(kind, path string) (SessionStore, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewMemorySessionStore(), nil
+	case "file":
+		return NewFileSessionStore(path)
+	default:
+		return nil, fmt.Errorf("unknown session store %q (want memory or file)", kind)
+	}
+}
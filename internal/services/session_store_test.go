@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemorySessionStore_ExpiredSessionsAreHidden(t *testing.T) {
+	store := NewMemorySessionStore()
+	now := time.Now()
+	_ = store.Save(Session{ID: "live", LastSeen: now, ExpiresAt: now.Add(time.Hour)})
+	_ = store.Save(Session{ID: "dead", LastSeen: now, ExpiresAt: now.Add(-time.Second)})
+
+	if _, err := store.Get("dead"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound for expired session, got %v", err)
+	}
+	sessions, _ := store.List()
+	if len(sessions) != 1 || sessions[0].ID != "live" {
+		t.Errorf("unexpected sessions: %+v", sessions)
+	}
+}
+
+func TestFileSessionStore_SurvivesReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatalf("NewFileSessionStore failed: %v", err)
+	}
+	now := time.Now()
+	if err := store.Save(Session{ID: "a", AccessKey: "alice", Sealed: "sealed", LastSeen: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	_ = store.Save(Session{ID: "b", AccessKey: "bob", LastSeen: now, ExpiresAt: now.Add(time.Hour)})
+	_ = store.Delete("b")
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("session file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600 permissions, got %v", info.Mode().Perm())
+	}
+
+	reloaded, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	session, err := reloaded.Get("a")
+	if err != nil || session.AccessKey != "alice" || session.Sealed != "sealed" {
+		t.Errorf("unexpected session after reload: %+v, %v", session, err)
+	}
+	if _, err := reloaded.Get("b"); !errors.Is(err, ErrSessionNotFound) {
+		t.Error("deleted session should not come back after reload")
+	}
+}
+
+func TestFileSessionStore_MigratesRawIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	value, _ := NewRandomToken(32)
+	legacy := fmt.Sprintf(`[{"id":%q,"accessKey":"alice","expiresAt":%q}]`, value, time.Now().Add(time.Hour).Format(time.RFC3339))
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if session, err := store.Get(SessionHandle(value)); err != nil || session.AccessKey != "alice" {
+		t.Errorf("expected session under its handle, got %+v, %v", session, err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), value) {
+		t.Error("session file still holds the raw cookie value")
+	}
+}
+
+func TestAuthService_SessionStoreLifecycle(t *testing.T) {
+	store := NewMemorySessionStore()
+	svc := NewAuthService().WithSessionStore(store)
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "alice", SecretKey: "secret"}
+
+	value, _, err := svc.CreateSession(creds, SessionClient{RemoteIP: "10.0.0.1", UserAgent: "test"})
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if _, err := store.Get(value); !errors.Is(err, ErrSessionNotFound) {
+		t.Error("store should not be keyed by the cookie value")
+	}
+	stored, _ := store.Get(SessionHandle(value))
+	if strings.Contains(stored.Sealed, "secret") || stored.RemoteIP != "10.0.0.1" {
+		t.Errorf("unexpected stored session: %+v", stored)
+	}
+
+	opened, err := svc.OpenSession(value)
+	if err != nil || opened.SecretKey != "secret" || opened.IssuedAt.IsZero() {
+		t.Fatalf("OpenSession = %+v, %v", opened, err)
+	}
+
+	if err := svc.RevokeSession(value); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking by cookie value should fail, got %v", err)
+	}
+	if err := svc.RevokeSession(stored.ID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if _, err := svc.OpenSession(value); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected revoked session to be gone, got %v", err)
+	}
+}
+
+func TestNewSessionStore(t *testing.T) {
+	if store, err := NewSessionStore("", ""); store != nil || err != nil {
+		t.Errorf("expected no store by default, got %v, %v", store, err)
+	}
+
+	if store, err := NewSessionStore("file", filepath.Join(t.TempDir(), "s.json")); err != nil {
+		t.Errorf("file store failed: %v", err)
+	} else if _, ok := store.(*FileSessionStore); !ok {
+		t.Errorf("expected *FileSessionStore, got %T", store)
+	}
+
+	if _, err := NewSessionStore("redis", ""); err == nil {
+		t.Error("expected error for unknown store")
+	}
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// touchInterval limits how often a session's last activity is written back
+const touchInterval = time.Minute
+
+// ErrSessionExpired is returned when a session passed its idle or absolute limit
+var ErrSessionExpired = errors.New("session expired")
+
+// SessionPolicy bounds how long a session lasts
+type SessionPolicy struct {
+	// IdleTimeout ends a session after this long without activity; zero disables it
+	IdleTimeout time.Duration
+	// MaxLifetime ends a session this long after login, however active it is
+	MaxLifetime time.Duration
+	// WarnBefore is how early the UI warns that the session is about to end
+	WarnBefore time.Duration
+}
+
+// DefaultSessionPolicy keeps sessions for up to a day with no idle limit
+func DefaultSessionPolicy() SessionPolicy {
+	return SessionPolicy{
+		MaxLifetime: SessionLifetime,
+		WarnBefore:  2 * time.Minute,
+	}
+}
+
+// SessionClient describes the browser a session was created from
+type SessionClient struct {
+	RemoteIP  string
+	UserAgent string
+}
+
+// SessionState is what a session cookie (or store record) seals: the
+// credentials plus the timestamps the session policy is enforced against
+type SessionState struct {
+	Credentials
+	IssuedAt time.Time `json:"issuedAt,omitzero"`
+	LastSeen time.Time `json:"lastSeen,omitzero"`
+}
+
+// WithSessionPolicy sets the idle and absolute session limits
+func (s *AuthService) WithSessionPolicy(policy SessionPolicy) *AuthService {
+	s.policy = policy
+	return s
+}
+
+// SessionPolicy returns the limits sessions are held to
+func (s *AuthService) SessionPolicy() SessionPolicy {
+	return s.policy
+}
+
+// SessionExpiry returns when the session ends unless there is further activity
+func (s *AuthService) SessionExpiry(state SessionState) time.Time {
+	expires := state.IssuedAt.Add(s.policy.MaxLifetime)
+	if s.policy.IdleTimeout > 0 && !state.LastSeen.IsZero() {
+		if idle := state.LastSeen.Add(s.policy.IdleTimeout); idle.Before(expires) {
+			expires = idle
+		}
+	}
+	// Credentials that cannot be refreshed end the session when they lapse
+	if state.KeyRef == "" && !state.Expiration.IsZero() && state.Expiration.Before(expires) {
+		expires = state.Expiration
+	}
+	return expires
+}
+
+// WithSessionStore keeps sessions server-side. The cookie then carries only an
+// opaque session ID, and sessions can be listed and revoked.
+func (s *AuthService) WithSessionStore(store SessionStore) *AuthService {
+	s.store = store
+	return s
+}
+
+// HasSessionStore reports whether sessions are kept server-side
+func (s *AuthService) HasSessionStore() bool {
+	return s.store != nil
+}
+
+// SealSession encrypts a session state into a cookie value
+func (s *AuthService) SealSession(state SessionState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return s.seal(data)
+}
+
+// openSealedSession is the inverse of SealSession. Values sealed by
+// EncryptCredentials open too, with zero timestamps.
+func (s *AuthService) openSealedSession(value string) (*SessionState, error) {
+	data, err := s.open(value)
+	if err != nil {
+		return nil, err
+	}
+	var state SessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// CreateSession starts a session and returns the cookie value and its expiry
+func (s *AuthService) CreateSession(creds Credentials, client SessionClient) (string, time.Time, error) {
+	now := time.Now()
+	state := SessionState{Credentials: creds, IssuedAt: now, LastSeen: now}
+	expires := s.SessionExpiry(state)
+
+	sealed, err := s.SealSession(state)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if s.store == nil {
+		return sealed, expires, nil
+	}
+
+	value, err := NewRandomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	err = s.store.Save(Session{
+		ID:        SessionHandle(value),
+		AccessKey: creds.Identity(),
+		Sealed:    sealed,
+		RemoteIP:  client.RemoteIP,
+		UserAgent: client.UserAgent,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: s.absoluteExpiry(state),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return value, expires, nil
+}
+
+// SessionHandle is the public ID of the session behind a cookie value. Stores,
+// the sessions page and revocation only ever see the handle, so reading them
+// is not enough to take over a session.
+func SessionHandle(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// OpenSession resolves a cookie value and enforces the session policy
+func (s *AuthService) OpenSession(value string) (*SessionState, error) {
+	var state *SessionState
+	if s.store == nil {
+		opened, err := s.openSealedSession(value)
+		if err != nil {
+			return nil, err
+		}
+		state = opened
+	} else {
+		session, err := s.store.Get(SessionHandle(value))
+		if err != nil {
+			return nil, err
+		}
+		opened, err := s.openSealedSession(session.Sealed)
+		if err != nil {
+			return nil, err
+		}
+		// The store's record is the authority on activity
+		opened.LastSeen = session.LastSeen
+		state = opened
+	}
+
+	// Sessions sealed without timestamps are adopted from now on; a zero
+	// LastSeen makes the next touch reseal them
+	if state.IssuedAt.IsZero() {
+		state.IssuedAt = time.Now()
+	}
+
+	if !time.Now().Before(s.SessionExpiry(*state)) {
+		s.EndSession(value)
+		return nil, ErrSessionExpired
+	}
+	return state, nil
+}
+
+// TouchSession records activity. It returns false when the last recorded
+// activity is recent enough that nothing needs to be written.
+func (s *AuthService) TouchSession(state *SessionState, now time.Time) bool {
+	if now.Sub(state.LastSeen) < touchInterval {
+		return false
+	}
+	state.LastSeen = now
+	return true
+}
+
+// SaveSession writes a changed session state back and returns the new cookie
+// value and expiry
+func (s *AuthService) SaveSession(value string, state SessionState) (string, time.Time, error) {
+	expires := s.SessionExpiry(state)
+	sealed, err := s.SealSession(state)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if s.store == nil {
+		return sealed, expires, nil
+	}
+
+	session, err := s.store.Get(SessionHandle(value))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	session.Sealed = sealed
+	session.LastSeen = state.LastSeen
+	session.ExpiresAt = s.absoluteExpiry(state)
+	if err := s.store.Save(session); err != nil {
+		return "", time.Time{}, err
+	}
+	return value, expires, nil
+}
+
+// absoluteExpiry is when a session ends regardless of activity
+func (s *AuthService) absoluteExpiry(state SessionState) time.Time {
+	state.LastSeen = time.Time{}
+	return s.SessionExpiry(state)
+}
+
+// EndSession logs a session out
+func (s *AuthService) EndSession(value string) {
+	if s.store == nil {
+		if state, err := s.openSealedSession(value); err == nil {
+			s.DiscardCredentials(state.Credentials)
+		}
+		return
+	}
+	if err := s.RevokeSession(SessionHandle(value)); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		log.Printf("Sessions: failed to end session: %v", err)
+	}
+}
+
+// ListSessions returns all active sessions
+func (s *AuthService) ListSessions() ([]Session, error) {
+	if s.store == nil {
+		return nil, nil
+	}
+	return s.store.List()
+}
+
+// RevokeSession ends a session by its handle. The next request using it is
+// sent to the login page.
+func (s *AuthService) RevokeSession(id string) error {
+	if s.store == nil {
+		return ErrSessionNotFound
+	}
+	session, err := s.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if state, err := s.openSealedSession(session.Sealed); err == nil {
+		s.DiscardCredentials(state.Credentials)
+	}
+	return s.store.Delete(id)
+}
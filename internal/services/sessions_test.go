@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newPolicyTestService(policy SessionPolicy) *AuthService {
+	keyring, _ := NewKeyring(SessionKey{ID: "test", Key: []byte("0123456789abcdef0123456789abcdef")})
+	return NewAuthServiceWithKeyring(keyring).WithSessionPolicy(policy)
+}
+
+func TestSessionExpiry_UsesEarliestLimit(t *testing.T) {
+	svc := newPolicyTestService(SessionPolicy{IdleTimeout: 15 * time.Minute, MaxLifetime: 12 * time.Hour})
+	issued := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		state SessionState
+		want  time.Time
+	}{
+		{"idle limit", SessionState{IssuedAt: issued, LastSeen: issued.Add(time.Hour)}, issued.Add(time.Hour + 15*time.Minute)},
+		{"absolute limit", SessionState{IssuedAt: issued, LastSeen: issued.Add(12 * time.Hour)}, issued.Add(12 * time.Hour)},
+		{"unrefreshable credentials", SessionState{
+			Credentials: Credentials{Expiration: issued.Add(5 * time.Minute)},
+			IssuedAt:    issued, LastSeen: issued,
+		}, issued.Add(5 * time.Minute)},
+		{"refreshable credentials", SessionState{
+			Credentials: Credentials{Expiration: issued.Add(5 * time.Minute), KeyRef: "ref"},
+			IssuedAt:    issued, LastSeen: issued,
+		}, issued.Add(15 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.SessionExpiry(tt.state); !got.Equal(tt.want) {
+				t.Errorf("SessionExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenSession_EnforcesIdleAndAbsoluteLimits(t *testing.T) {
+	svc := newPolicyTestService(SessionPolicy{IdleTimeout: 15 * time.Minute, MaxLifetime: 12 * time.Hour})
+	now := time.Now()
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "password"}
+
+	active, _ := svc.SealSession(SessionState{Credentials: creds, IssuedAt: now.Add(-time.Hour), LastSeen: now.Add(-5 * time.Minute)})
+	if _, err := svc.OpenSession(active); err != nil {
+		t.Errorf("expected active session to open, got %v", err)
+	}
+
+	idle, _ := svc.SealSession(SessionState{Credentials: creds, IssuedAt: now.Add(-time.Hour), LastSeen: now.Add(-16 * time.Minute)})
+	if _, err := svc.OpenSession(idle); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected idle session to expire, got %v", err)
+	}
+
+	old, _ := svc.SealSession(SessionState{Credentials: creds, IssuedAt: now.Add(-13 * time.Hour), LastSeen: now})
+	if _, err := svc.OpenSession(old); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected session past its absolute lifetime to expire, got %v", err)
+	}
+}
+
+func TestTouchSession_IsThrottled(t *testing.T) {
+	svc := newPolicyTestService(DefaultSessionPolicy())
+	now := time.Now()
+
+	recent := &SessionState{LastSeen: now.Add(-10 * time.Second)}
+	if svc.TouchSession(recent, now) {
+		t.Error("expected recent activity not to be rewritten")
+	}
+
+	stale := &SessionState{LastSeen: now.Add(-2 * time.Minute)}
+	if !svc.TouchSession(stale, now) || !stale.LastSeen.Equal(now) {
+		t.Errorf("expected stale session to be touched, got %v", stale.LastSeen)
+	}
+}
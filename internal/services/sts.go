@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ErrAssumeRoleDenied is returned by AssumeRole for identities that may not
+// assume a role, such as service accounts and temporary credentials
+var ErrAssumeRoleDenied = errors.New("identity cannot assume a role")
+
+// STSClient exchanges external identities for temporary MinIO credentials
+type STSClient interface {
+	AssumeRoleWithWebIdentity(ctx context.Context, endpoint string, token OIDCToken, roleARN string) (Credentials, error)
+	AssumeRoleWithLDAPIdentity(ctx context.Context, endpoint, username, password string, duration time.Duration) (Credentials, error)
+	AssumeRole(ctx context.Context, creds Credentials, duration time.Duration) (Credentials, error)
+	AssumeRoleWithCertificate(ctx context.Context, endpoint, name string, duration time.Duration) (Credentials, error)
+}
+
+// RealSTSClient calls the MinIO STS API of the given endpoint
+type RealSTSClient struct {
+	// HTTPClient is optional; http.DefaultClient is used when nil
+	HTTPClient *http.Client
+	// Clusters supplies the scheme and TLS options per endpoint; optional
+	Clusters *ClusterRegistry
+}
+
+// AssumeRoleWithWebIdentity swaps an OpenID Connect token for temporary credentials
+func (s *RealSTSClient) AssumeRoleWithWebIdentity(ctx context.Context, endpoint string, token OIDCToken, roleARN string) (Credentials, error) {
+	return s.assumeRoleWithWebIdentityAt(ctx, s.url(endpoint), endpoint, token, roleARN)
+}
+
+func (s *RealSTSClient) assumeRoleWithWebIdentityAt(ctx context.Context, stsEndpoint, endpoint string, token OIDCToken, roleARN string) (Credentials, error) {
+	provider, err := credentials.NewSTSWebIdentity(stsEndpoint, func() (*credentials.WebIdentityToken, error) {
+		return &credentials.WebIdentityToken{
+			Token:       token.IDToken,
+			AccessToken: token.AccessToken,
+		}, nil
+	}, func(i *credentials.STSWebIdentity) {
+		i.RoleARN = roleARN
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+	return s.retrieve(ctx, endpoint, provider)
+}
+
+// AssumeRoleWithLDAPIdentity swaps directory credentials for temporary credentials
+func (s *RealSTSClient) AssumeRoleWithLDAPIdentity(ctx context.Context, endpoint, username, password string, duration time.Duration) (Credentials, error) {
+	return s.assumeRoleWithLDAPIdentityAt(ctx, s.url(endpoint), endpoint, username, password, duration)
+}
+
+func (s *RealSTSClient) assumeRoleWithLDAPIdentityAt(ctx context.Context, stsEndpoint, endpoint, username, password string, duration time.Duration) (Credentials, error) {
+	var opts []credentials.LDAPIdentityOpt
+	if duration > 0 {
+		opts = append(opts, credentials.LDAPIdentityExpiryOpt(duration))
+	}
+	provider, err := credentials.NewLDAPIdentity(stsEndpoint, username, password, opts...)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return s.retrieve(ctx, endpoint, provider)
+}
+
+// AssumeRole swaps a long-term access key for temporary credentials
+func (s *RealSTSClient) AssumeRole(ctx context.Context, creds Credentials, duration time.Duration) (Credentials, error) {
+	return s.assumeRoleAt(ctx, s.url(creds.Endpoint), creds, duration)
+}
+
+func (s *RealSTSClient) assumeRoleAt(ctx context.Context, stsEndpoint string, creds Credentials, duration time.Duration) (Credentials, error) {
+	provider, err := credentials.NewSTSAssumeRole(stsEndpoint, credentials.STSAssumeRoleOptions{
+		AccessKey:       creds.AccessKey,
+		SecretKey:       creds.SecretKey,
+		DurationSeconds: int(duration.Seconds()),
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+	temporary, err := s.retrieve(ctx, creds.Endpoint, provider)
+	var stsErr credentials.ErrorResponse
+	if errors.As(err, &stsErr) && stsErr.STSError.Code == "AccessDenied" {
+		return Credentials{}, fmt.Errorf("%w: %s", ErrAssumeRoleDenied, stsErr.STSError.Message)
+	}
+	return temporary, err
+}
+
+// AssumeRoleWithCertificate presents the certificate held for name on the
+// endpoint's cluster and returns the temporary credentials MinIO issues for it
+func (s *RealSTSClient) AssumeRoleWithCertificate(ctx context.Context, endpoint, name string, duration time.Duration) (Credentials, error) {
+	cluster := s.Clusters.connection(endpoint)
+	cert, err := cluster.heldCertificate(name)
+	if err != nil {
+		return Credentials{}, err
+	}
+	// The user certificate directory is a TLS option, so the cluster has its own transport
+	transport, ok := cluster.transport.(*http.Transport)
+	if !ok {
+		return Credentials{}, fmt.Errorf("cluster %s has no TLS transport", endpoint)
+	}
+	return s.assumeRoleWithCertificateAt(ctx, s.url(endpoint), endpoint, transport, cert, duration)
+}
+
+func (s *RealSTSClient) assumeRoleWithCertificateAt(ctx context.Context, stsEndpoint, endpoint string, transport *http.Transport, cert tls.Certificate, duration time.Duration) (Credentials, error) {
+	// minio-go adds the certificate to a clone of the transport, so it must be
+	// an *http.Transport and cannot carry the context; a deadline still applies
+	client := &http.Client{Transport: transport}
+	if deadline, ok := ctx.Deadline(); ok {
+		client.Timeout = time.Until(deadline)
+	}
+	opts := []credentials.CertificateIdentityOption{func(i *credentials.STSCertificateIdentity) {
+		i.Client = client
+	}}
+	if duration > 0 {
+		opts = append(opts, credentials.CertificateIdentityWithExpiry(duration))
+	}
+	provider, err := credentials.NewSTSCertificateIdentity(stsEndpoint, cert, opts...)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return s.retrieve(ctx, endpoint, provider)
+}
+
+func (s *RealSTSClient) retrieve(ctx context.Context, endpoint string, provider *credentials.Credentials) (Credentials, error) {
+	value, err := provider.GetWithContext(&credentials.CredContext{Client: s.client(ctx, endpoint)})
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{
+		Endpoint:     endpoint,
+		AccessKey:    value.AccessKeyID,
+		SecretKey:    value.SecretAccessKey,
+		SessionToken: value.SessionToken,
+		Expiration:   value.Expiration,
+	}, nil
+}
+
+// client binds the request context to the HTTP client, since the minio-go
+// STS providers do not accept a context themselves
+func (s *RealSTSClient) client(ctx context.Context, endpoint string) *http.Client {
+	base := s.HTTPClient
+	if base == nil {
+		base = http.DefaultClient
+	}
+	transport := base.Transport
+	if cluster := s.Clusters.connection(endpoint); cluster.transport != nil && s.HTTPClient == nil {
+		transport = cluster.transport
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	bound := *base
+	bound.Transport = contextTransport{ctx: ctx, base: transport}
+	return &bound
+}
+
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// url returns the base URL of the STS API, which MinIO serves on the S3 port
+func (s *RealSTSClient) url(endpoint string) string {
+	return s.Clusters.connection(endpoint).BaseURL()
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSTSResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>TEMPACCESS</AccessKeyId>
+      <SecretAccessKey>TEMPSECRET</SecretAccessKey>
+      <SessionToken>TEMPTOKEN</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`
+
+func TestRealSTSClient_AssumeRoleWithWebIdentity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("Action") != "AssumeRoleWithWebIdentity" || r.PostForm.Get("WebIdentityToken") != "id-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(testSTSResponse))
+	}))
+	defer srv.Close()
+
+	client := &RealSTSClient{}
+	// The test server speaks plain HTTP on a random port, so bypass the TLS heuristic
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	creds, err := client.assumeRoleWithWebIdentityAt(context.Background(), srv.URL, endpoint, OIDCToken{IDToken: "id-token"}, "")
+	if err != nil {
+		t.Fatalf("AssumeRoleWithWebIdentity failed: %v", err)
+	}
+
+	if creds.AccessKey != "TEMPACCESS" || creds.SecretKey != "TEMPSECRET" || creds.SessionToken != "TEMPTOKEN" {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+	if creds.Endpoint != endpoint {
+		t.Errorf("Endpoint = %q, want %q", creds.Endpoint, endpoint)
+	}
+	if !creds.Expiration.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiration: %v", creds.Expiration)
+	}
+}
+
+func TestRealSTSClient_AssumeRoleWithLDAPIdentity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("Action") != "AssumeRoleWithLDAPIdentity" ||
+			r.Form.Get("LDAPUsername") != "alice" || r.Form.Get("LDAPPassword") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Form.Get("DurationSeconds") != "7200" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(strings.ReplaceAll(testSTSResponse, "AssumeRoleWithWebIdentity", "AssumeRoleWithLDAPIdentity")))
+	}))
+	defer srv.Close()
+
+	client := &RealSTSClient{}
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	creds, err := client.assumeRoleWithLDAPIdentityAt(context.Background(), srv.URL, endpoint, "alice", "secret", 2*time.Hour)
+	if err != nil {
+		t.Fatalf("AssumeRoleWithLDAPIdentity failed: %v", err)
+	}
+	if creds.AccessKey != "TEMPACCESS" || creds.SessionToken != "TEMPTOKEN" {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+
+	if _, err := client.assumeRoleWithLDAPIdentityAt(context.Background(), srv.URL, endpoint, "alice", "wrong", 2*time.Hour); err == nil {
+		t.Error("expected error for rejected password")
+	}
+}
+
+func TestRealSTSClient_AssumeRole(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		// AssumeRole is a signed request: the long-term key signs it but is never sent
+		if strings.Contains(r.Header.Get("Authorization"), "Credential=svcacct/") {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><Error><Type></Type><Code>AccessDenied</Code><Message>Access denied</Message></Error></ErrorResponse>`))
+			return
+		}
+		if r.Form.Get("Action") != "AssumeRole" || !strings.Contains(r.Header.Get("Authorization"), "Credential=admin/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(strings.ReplaceAll(testSTSResponse, "AssumeRoleWithWebIdentity", "AssumeRole")))
+	}))
+	defer srv.Close()
+
+	client := &RealSTSClient{}
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	creds, err := client.assumeRoleAt(context.Background(), srv.URL, Credentials{
+		Endpoint: endpoint, AccessKey: "admin", SecretKey: "long-term-secret",
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("AssumeRole failed: %v", err)
+	}
+	if creds.AccessKey != "TEMPACCESS" || creds.SessionToken != "TEMPTOKEN" || creds.Endpoint != endpoint {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+
+	_, err = client.assumeRoleAt(context.Background(), srv.URL, Credentials{
+		Endpoint: endpoint, AccessKey: "svcacct", SecretKey: "service-secret",
+	}, time.Hour)
+	if !errors.Is(err, ErrAssumeRoleDenied) {
+		t.Errorf("expected ErrAssumeRoleDenied for a service account, got %v", err)
+	}
+}
+
+func TestRealSTSClient_AssumeRoleWithCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeClientCertificate(t, dir, "alice")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The certificate authenticates the TLS connection, not the request
+		if r.URL.Query().Get("Action") != "AssumeRoleWithCertificate" ||
+			len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "alice" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("DurationSeconds") != "7200" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(strings.ReplaceAll(testSTSResponse, "AssumeRoleWithWebIdentity", "AssumeRoleWithCertificate")))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	endpoint := strings.TrimPrefix(srv.URL, "https://")
+	cert, err := Cluster{Endpoint: endpoint, TLS: ClusterTLS{UserCertDir: dir}}.heldCertificate("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &RealSTSClient{}
+	transport := srv.Client().Transport.(*http.Transport)
+	creds, err := client.assumeRoleWithCertificateAt(context.Background(), srv.URL, endpoint, transport, cert, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("AssumeRoleWithCertificate failed: %v", err)
+	}
+	if creds.AccessKey != "TEMPACCESS" || creds.SessionToken != "TEMPTOKEN" || creds.Endpoint != endpoint {
+		t.Errorf("unexpected credentials: %+v", creds)
+	}
+	if len(transport.TLSClientConfig.Certificates) != 0 {
+		t.Error("the held certificate must not be added to the shared transport")
+	}
+}
+
+func TestCredentials_IsExpired(t *testing.T) {
+	now := time.Now()
+	if (Credentials{}).IsExpired(now) {
+		t.Error("static credentials should never expire")
+	}
+	if !(Credentials{Expiration: now.Add(-time.Minute)}).IsExpired(now) {
+		t.Error("expected lapsed credentials to be expired")
+	}
+	if (Credentials{Expiration: now.Add(time.Minute)}).IsExpired(now) {
+		t.Error("expected future expiration to be valid")
+	}
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rsc.io/qr"
+)
+
+const (
+	totpPeriod        = 30 * time.Second
+	totpDigits        = 6
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	totpSealPurpose   = "totp"
+)
+
+var (
+	// ErrTOTPNotEnrolled is returned when a user has no second factor
+	ErrTOTPNotEnrolled = errors.New("no second factor enrolled")
+	// ErrInvalidTOTPCode is returned for a wrong, reused or expired code
+	ErrInvalidTOTPCode = errors.New("invalid verification code")
+)
+
+// TOTPMode controls whether a second factor is asked for at login
+type TOTPMode string
+
+const (
+	TOTPOff      TOTPMode = "off"
+	TOTPOptional TOTPMode = "optional"
+	TOTPRequired TOTPMode = "required"
+)
+
+// TOTPConfig configures the TOTP second factor
+type TOTPConfig struct {
+	Mode TOTPMode
+	// Issuer is the account label shown in authenticator apps
+	Issuer string
+	// File is where enrollments are stored
+	File string
+}
+
+// Enabled reports whether the second factor is offered at all
+func (c TOTPConfig) Enabled() bool {
+	return c.Mode == TOTPOptional || c.Mode == TOTPRequired
+}
+
+// ParseTOTPMode reads off, optional or required, in any case; empty is off
+func ParseTOTPMode(value string) (TOTPMode, error) {
+	switch mode := TOTPMode(strings.ToLower(value)); mode {
+	case "":
+		return TOTPOff, nil
+	case TOTPOff, TOTPOptional, TOTPRequired:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown two-factor mode %q (want off, optional or required)", value)
+	}
+}
+
+// TOTPEnrollment is a user's second factor. The secret is sealed with the
+// session keyring and recovery codes are stored as SHA-256 hashes.
+type TOTPEnrollment struct {
+	User          string    `json:"user"`
+	Secret        string    `json:"secret"`
+	RecoveryCodes []string  `json:"recoveryCodes"`
+	EnrolledAt    time.Time `json:"enrolledAt"`
+	// LastStep is the last accepted time step, so a code cannot be replayed
+	LastStep int64 `json:"lastStep"`
+}
+
+// TOTPStore persists enrollments
+type TOTPStore interface {
+	// Get returns ErrTOTPNotEnrolled when the user has no enrollment
+	Get(user string) (TOTPEnrollment, error)
+	Save(enrollment TOTPEnrollment) error
+	Delete(user string) error
+	// List returns enrollments ordered by user
+	List() ([]TOTPEnrollment, error)
+}
+
+// MemoryTOTPStore keeps enrollments in process memory
+type MemoryTOTPStore struct {
+	mu          sync.RWMutex
+	enrollments map[string]TOTPEnrollment
+}
+
+// NewMemoryTOTPStore creates an empty in-memory store
+func NewMemoryTOTPStore() *MemoryTOTPStore {
+	return &MemoryTOTPStore{enrollments: make(map[string]TOTPEnrollment)}
+}
+
+func (m *MemoryTOTPStore) Get(user string) (TOTPEnrollment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	enrollment, ok := m.enrollments[user]
+	if !ok {
+		return TOTPEnrollment{}, ErrTOTPNotEnrolled
+	}
+	return enrollment, nil
+}
+
+func (m *MemoryTOTPStore) Save(enrollment TOTPEnrollment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enrollments[enrollment.User] = enrollment
+	return nil
+}
+
+func (m *MemoryTOTPStore) Delete(user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.enrollments, user)
+	return nil
+}
+
+func (m *MemoryTOTPStore) List() ([]TOTPEnrollment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	enrollments := make([]TOTPEnrollment, 0, len(m.enrollments))
+	for _, enrollment := range m.enrollments {
+		enrollments = append(enrollments, enrollment)
+	}
+	sort.Slice(enrollments, func(i, j int) bool {
+		return enrollments[i].User < enrollments[j].User
+	})
+	return enrollments, nil
+}
+
+// FileTOTPStore keeps enrollments in memory and writes them to a JSON file
+// with 0600 permissions on every change
+type FileTOTPStore struct {
+	*MemoryTOTPStore
+	path    string
+	writeMu sync.Mutex
+}
+
+// NewFileTOTPStore loads enrollments from path, which is created on first write
+func NewFileTOTPStore(path string) (*FileTOTPStore, error) {
+	store := &FileTOTPStore{MemoryTOTPStore: NewMemoryTOTPStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading TOTP file: %w", err)
+	}
+
+	var enrollments []TOTPEnrollment
+	if err := json.Unmarshal(data, &enrollments); err != nil {
+		return nil, fmt.Errorf("parsing TOTP file: %w", err)
+	}
+	for _, enrollment := range enrollments {
+		store.enrollments[enrollment.User] = enrollment
+	}
+	return store, nil
+}
+
+func (f *FileTOTPStore) Save(enrollment TOTPEnrollment) error {
+	if err := f.MemoryTOTPStore.Save(enrollment); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileTOTPStore) Delete(user string) error {
+	if err := f.MemoryTOTPStore.Delete(user); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *FileTOTPStore) flush() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	enrollments, err := f.List()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(enrollments)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file with 0600 permissions and
+// renames it over path, so a crash never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// TOTPService enrolls and verifies RFC 6238 time-based one-time passwords
+type TOTPService struct {
+	mu      sync.Mutex
+	store   TOTPStore
+	keyring *Keyring
+	issuer  string
+	now     func() time.Time
+}
+
+// NewTOTPService creates a TOTP service that seals secrets with keyring
+func NewTOTPService(store TOTPStore, keyring *Keyring, issuer string) *TOTPService {
+	return &TOTPService{store: store, keyring: keyring, issuer: issuer, now: time.Now}
+}
+
+// Enrolled reports whether user has a second factor
+func (t *TOTPService) Enrolled(user string) (bool, error) {
+	_, err := t.store.Get(user)
+	if errors.Is(err, ErrTOTPNotEnrolled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// List returns every enrollment
+func (t *TOTPService) List() ([]TOTPEnrollment, error) {
+	return t.store.List()
+}
+
+// NewSecret generates a random 160-bit secret in base32
+func (t *TOTPService) NewSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+// KeyURI returns the otpauth:// URI authenticator apps import
+func (t *TOTPService) KeyURI(user, secret string) string {
+	label := url.PathEscape(t.issuer + ":" + user)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", t.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// QRCode renders the key URI as a PNG image
+func (t *TOTPService) QRCode(user, secret string) ([]byte, error) {
+	code, err := qr.Encode(t.KeyURI(user, secret), qr.M)
+	if err != nil {
+		return nil, err
+	}
+	code.Scale = 6
+	return code.PNG(), nil
+}
+
+// Enroll stores secret for user once code proves the authenticator app has
+// it, replacing any earlier enrollment. It returns the recovery codes, which
+// are not shown again.
+func (t *TOTPService) Enroll(user, secret, code string) ([]string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(key, code, t.now(), 0)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	sealed, err := t.keyring.seal([]byte(secret), totpSealPurpose)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err = t.store.Save(TOTPEnrollment{
+		User:          user,
+		Secret:        sealed,
+		RecoveryCodes: hashes,
+		EnrolledAt:    t.now(),
+		LastStep:      step,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a code from the user's authenticator app or one of their
+// recovery codes. Each code is accepted once. It reports whether a recovery
+// code was used.
+func (t *TOTPService) Verify(user, code string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	enrollment, err := t.store.Get(user)
+	if err != nil {
+		return false, err
+	}
+
+	if normalized := normalizeRecoveryCode(code); len(normalized) > totpDigits {
+		hash := hashRecoveryCode(normalized)
+		for i, stored := range enrollment.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+				enrollment.RecoveryCodes = append(enrollment.RecoveryCodes[:i:i], enrollment.RecoveryCodes[i+1:]...)
+				return true, t.store.Save(enrollment)
+			}
+		}
+		return false, ErrInvalidTOTPCode
+	}
+
+	secret, err := t.keyring.open(enrollment.Secret, totpSealPurpose)
+	if err != nil {
+		return false, fmt.Errorf("opening TOTP secret: %w", err)
+	}
+	key, err := decodeTOTPSecret(string(secret))
+	if err != nil {
+		return false, err
+	}
+	step, ok := matchTOTP(key, code, t.now(), enrollment.LastStep)
+	if !ok {
+		return false, ErrInvalidTOTPCode
+	}
+	enrollment.LastStep = step
+	// Move secrets sealed with a retired key onto the current primary key
+	if !strings.HasPrefix(enrollment.Secret, t.keyring.Primary().ID+".") {
+		if resealed, err := t.keyring.seal(secret, totpSealPurpose); err == nil {
+			enrollment.Secret = resealed
+		}
+	}
+	return false, t.store.Save(enrollment)
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes user has
+func (t *TOTPService) RecoveryCodesLeft(user string) (int, error) {
+	enrollment, err := t.store.Get(user)
+	if err != nil {
+		return 0, err
+	}
+	return len(enrollment.RecoveryCodes), nil
+}
+
+// Reset removes user's second factor
+func (t *TOTPService) Reset(user string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.store.Get(user); err != nil {
+		return err
+	}
+	return t.store.Delete(user)
+}
+
+// TOTPCode returns the code an authenticator app shows for secret at time t
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, t.Unix()/int64(totpPeriod.Seconds())), nil
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil || len(key) < 10 {
+		return nil, errors.New("invalid TOTP secret")
+	}
+	return key, nil
+}
+
+// matchTOTP accepts code for the current time step or one either side of it,
+// as long as the step is later than lastStep
+func matchTOTP(key []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the HOTP value (RFC 4226) for a time step
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 5)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(raw)
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) == 10 {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"encoding/base32"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestTOTPService(t *testing.T, store TOTPStore) (*TOTPService, *time.Time) {
+	t.Helper()
+	keyring, err := NewKeyring(SessionKey{ID: "test", Key: []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewTOTPService(store, keyring, "IronBuckets")
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	return svc, &now
+}
+
+func TestTOTPCode_RFC6238Vector(t *testing.T) {
+	// RFC 6238 appendix B uses the ASCII secret "12345678901234567890"
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 2000000000: "279037"} {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestTOTPService_EnrollAndVerify(t *testing.T) {
+	store := NewMemoryTOTPStore()
+	svc, now := newTestTOTPService(t, store)
+	secret, _ := svc.NewSecret()
+
+	if _, err := svc.Enroll("admin", secret, "000000"); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Fatalf("expected wrong code to be rejected, got %v", err)
+	}
+
+	code, _ := TOTPCode(secret, *now)
+	recovery, err := svc.Enroll("admin", secret, code)
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+	if len(recovery) != recoveryCodeCount {
+		t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery))
+	}
+
+	stored, _ := store.Get("admin")
+	if strings.Contains(stored.Secret, secret) {
+		t.Error("secret must not be stored in the clear")
+	}
+
+	// The enrollment code cannot be replayed
+	if _, err := svc.Verify("admin", code); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("expected replayed code to be rejected, got %v", err)
+	}
+
+	*now = now.Add(30 * time.Second)
+	next, _ := TOTPCode(secret, *now)
+	if used, err := svc.Verify("admin", next); err != nil || used {
+		t.Errorf("Verify() = %v, %v; want false, nil", used, err)
+	}
+
+	// Codes from one step either side are accepted for clock drift
+	*now = now.Add(90 * time.Second)
+	drifted, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	if _, err := svc.Verify("admin", drifted); err != nil {
+		t.Errorf("expected code from the previous step to be accepted, got %v", err)
+	}
+}
+
+func TestTOTPService_RecoveryCodesWorkOnce(t *testing.T) {
+	svc, now := newTestTOTPService(t, NewMemoryTOTPStore())
+	secret, _ := svc.NewSecret()
+	code, _ := TOTPCode(secret, *now)
+	recovery, _ := svc.Enroll("admin", secret, code)
+
+	// Recovery codes are accepted without the dash and in upper case
+	entered := strings.ToUpper(strings.ReplaceAll(recovery[3], "-", ""))
+	if used, err := svc.Verify("admin", entered); err != nil || !used {
+		t.Fatalf("Verify(recovery) = %v, %v; want true, nil", used, err)
+	}
+	if _, err := svc.Verify("admin", recovery[3]); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("expected used recovery code to be rejected, got %v", err)
+	}
+	if left, _ := svc.RecoveryCodesLeft("admin"); left != recoveryCodeCount-1 {
+		t.Errorf("expected %d codes left, got %d", recoveryCodeCount-1, left)
+	}
+}
+
+func TestTOTPService_Reset(t *testing.T) {
+	svc, now := newTestTOTPService(t, NewMemoryTOTPStore())
+	secret, _ := svc.NewSecret()
+	code, _ := TOTPCode(secret, *now)
+	_, _ = svc.Enroll("admin", secret, code)
+
+	if err := svc.Reset("admin"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if enrolled, _ := svc.Enrolled("admin"); enrolled {
+		t.Error("expected enrollment to be removed")
+	}
+	if err := svc.Reset("admin"); !errors.Is(err, ErrTOTPNotEnrolled) {
+		t.Errorf("expected ErrTOTPNotEnrolled, got %v", err)
+	}
+}
+
+func TestFileTOTPStore_PersistsWithRestrictedPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "totp.json")
+	store, err := NewFileTOTPStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, now := newTestTOTPService(t, store)
+	secret, _ := svc.NewSecret()
+	code, _ := TOTPCode(secret, *now)
+	if _, err := svc.Enroll("admin", secret, code); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600 permissions, got %v", info.Mode().Perm())
+	}
+
+	reloaded, err := NewFileTOTPStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.Get("admin"); err != nil {
+		t.Errorf("expected enrollment to survive a reload, got %v", err)
+	}
+}
+
+func TestTOTPService_VerifiesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "totp.json")
+	const configuredKey = "0123456789abcdef0123456789abcdef"
+	start := func() (*TOTPService, *time.Time) {
+		store, err := NewFileTOTPStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyring, err := ParseKeyring(nil, configuredKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		svc := NewTOTPService(store, keyring, "IronBuckets")
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		svc.now = func() time.Time { return now }
+		return svc, &now
+	}
+
+	svc, now := start()
+	secret, _ := svc.NewSecret()
+	code, _ := TOTPCode(secret, *now)
+	if _, err := svc.Enroll("admin", secret, code); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, now := start()
+	*now = now.Add(30 * time.Second)
+	next, _ := TOTPCode(secret, *now)
+	if _, err := restarted.Verify("admin", next); err != nil {
+		t.Errorf("expected the enrollment to open after a restart, got %v", err)
+	}
+}
+
+func TestPendingLoginCannotBeUsedAsSession(t *testing.T) {
+	keyring, _ := NewKeyring(SessionKey{ID: "test", Key: []byte("0123456789abcdef0123456789abcdef")})
+	svc := NewAuthServiceWithKeyring(keyring)
+	creds := Credentials{Endpoint: "localhost:9000", AccessKey: "admin", SecretKey: "password", User: "admin"}
+
+	pending, _, err := svc.SealPendingLogin(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.OpenSession(pending); err == nil {
+		t.Error("a pending login must not open as a session")
+	}
+	opened, err := svc.OpenPendingLogin(pending)
+	if err != nil || opened.User != "admin" {
+		t.Errorf("OpenPendingLogin() = %+v, %v", opened, err)
+	}
+
+	session, _, _ := svc.CreateSession(creds, SessionClient{})
+	if _, err := svc.OpenPendingLogin(session); err == nil {
+		t.Error("a session must not open as a pending login")
+	}
+}
+
+func TestParseTOTPMode(t *testing.T) {
+	for value, want := range map[string]TOTPMode{"": TOTPOff, "off": TOTPOff, "Required": TOTPRequired, "optional": TOTPOptional} {
+		if mode, err := ParseTOTPMode(value); err != nil || mode != want {
+			t.Errorf("ParseTOTPMode(%q) = %q, %v; want %q", value, mode, err, want)
+		}
+	}
+	if _, err := ParseTOTPMode("sometimes"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WebhookEventType names something that happened in the console
+type WebhookEventType string
+
+const (
+	WebhookBucketCreated       WebhookEventType = "bucket.created"
+	WebhookBucketDeleted       WebhookEventType = "bucket.deleted"
+	WebhookBucketPolicyChanged WebhookEventType = "bucket.policy.changed"
+	// WebhookBucketPolicyPublic is sent instead of bucket.policy.changed when
+	// the new policy lets anonymous users in
+	WebhookBucketPolicyPublic  WebhookEventType = "bucket.policy.public"
+	WebhookUserCreated         WebhookEventType = "user.created"
+	WebhookUserDeleted         WebhookEventType = "user.deleted"
+	WebhookUserEnabled         WebhookEventType = "user.enabled"
+	WebhookUserDisabled        WebhookEventType = "user.disabled"
+	WebhookUserPolicyChanged   WebhookEventType = "user.policy.changed"
+	WebhookGroupCreated        WebhookEventType = "group.created"
+	WebhookGroupMembersAdded   WebhookEventType = "group.members.added"
+	WebhookGroupMembersRemoved WebhookEventType = "group.members.removed"
+	WebhookGroupEnabled        WebhookEventType = "group.enabled"
+	WebhookGroupDisabled       WebhookEventType = "group.disabled"
+	WebhookGroupPolicyChanged  WebhookEventType = "group.policy.changed"
+	WebhookServerRestarted     WebhookEventType = "server.restarted"
+)
+
+// WebhookEventTypes lists every event a webhook can subscribe to
+var WebhookEventTypes = []WebhookEventType{
+	WebhookBucketCreated,
+	WebhookBucketDeleted,
+	WebhookBucketPolicyChanged,
+	WebhookBucketPolicyPublic,
+	WebhookUserCreated,
+	WebhookUserDeleted,
+	WebhookUserEnabled,
+	WebhookUserDisabled,
+	WebhookUserPolicyChanged,
+	WebhookGroupCreated,
+	WebhookGroupMembersAdded,
+	WebhookGroupMembersRemoved,
+	WebhookGroupEnabled,
+	WebhookGroupDisabled,
+	WebhookGroupPolicyChanged,
+	WebhookServerRestarted,
+}
+
+// webhookDeliveryHistory is how many deliveries the delivery log keeps
+const webhookDeliveryHistory = 500
+
+// Webhook is an endpoint notified of console events
+type Webhook struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Secret signs each payload; $VARIABLES are read from the environment
+	Secret string `yaml:"secret"`
+	// Events to send: exact types, prefixes such as "bucket.*", or "*"
+	Events []string `yaml:"events"`
+}
+
+// Wants reports whether the webhook subscribes to eventType
+func (w Webhook) Wants(eventType WebhookEventType) bool {
+	for _, pattern := range w.Events {
+		if pattern == "*" || pattern == string(eventType) {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(string(eventType), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookConfig is the webhooks file
+type WebhookConfig struct {
+	Webhooks []Webhook `yaml:"webhooks"`
+	// Attempts is how many times a delivery is tried before giving up
+	Attempts int `yaml:"attempts"`
+	// Timeout limits each attempt
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LoadWebhookConfig reads and validates a webhooks file
+func LoadWebhookConfig(filename string) (*WebhookConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := WebhookConfig{Attempts: 5, Timeout: 10 * time.Second}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &config, nil
+}
+
+func (c *WebhookConfig) validate() error {
+	if c.Attempts < 1 {
+		return fmt.Errorf("attempts must be at least 1")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	names := make(map[string]bool)
+	for i := range c.Webhooks {
+		hook := &c.Webhooks[i]
+		if hook.Name == "" {
+			return fmt.Errorf("webhook %d has no name", i+1)
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("webhook %q is defined twice", hook.Name)
+		}
+		names[hook.Name] = true
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %q: url must be an http or https URL", hook.Name)
+		}
+		hook.Secret = os.ExpandEnv(hook.Secret)
+		if hook.Secret == "" {
+			return fmt.Errorf("webhook %q: secret is required", hook.Name)
+		}
+		if len(hook.Events) == 0 {
+			return fmt.Errorf("webhook %q: no events", hook.Name)
+		}
+		for _, pattern := range hook.Events {
+			if !validWebhookPattern(pattern) {
+				return fmt.Errorf("webhook %q: unknown event %q", hook.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func validWebhookPattern(pattern string) bool {
+	for _, eventType := range WebhookEventTypes {
+		if (Webhook{Events: []string{pattern}}).Wants(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the JSON payload sent to webhooks
+type WebhookEvent struct {
+	ID      string           `json:"id"`
+	Type    WebhookEventType `json:"type"`
+	Time    time.Time        `json:"time"`
+	Actor   string           `json:"actor"`
+	Cluster string           `json:"cluster"`
+	// Data describes what changed, such as the bucket name
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// NewWebhookEvent describes a change made by creds
+func NewWebhookEvent(eventType WebhookEventType, creds Credentials, data map[string]string) WebhookEvent {
+	return WebhookEvent{
+		Type:    eventType,
+		Actor:   creds.Identity(),
+		Cluster: creds.Endpoint,
+		Data:    data,
+	}
+}
+
+// WebhookDeliveryStatus is where a delivery is
+type WebhookDeliveryStatus string
+
+const (
+	WebhookPending   WebhookDeliveryStatus = "pending"
+	WebhookDelivered WebhookDeliveryStatus = "delivered"
+	WebhookFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery records sending one event to one webhook
+type WebhookDelivery struct {
+	ID       string
+	Webhook  string
+	Event    WebhookEvent
+	Status   WebhookDeliveryStatus
+	Attempts int
+	// ResponseCode is the HTTP status of the last attempt, 0 if it got none
+	ResponseCode int
+	Error        string
+	UpdatedAt    time.Time
+}
+
+// WebhookService sends console events to the configured webhooks. Each
+// payload is signed with HMAC-SHA256 of the webhook's secret, and failed
+// deliveries are retried with exponential backoff in the background. A nil
+// service sends nothing.
+type WebhookService struct {
+	hooks    []Webhook
+	attempts int
+	client   *http.Client
+	backoff  time.Duration
+	sleep    func(time.Duration)
+	now      func() time.Time
+
+	mu         sync.Mutex
+	deliveries []WebhookDelivery
+	wg         sync.WaitGroup
+}
+
+// NewWebhookService creates a sender for the webhooks in config
+func NewWebhookService(config *WebhookConfig) *WebhookService {
+	return &WebhookService{
+		hooks:    config.Webhooks,
+		attempts: config.Attempts,
+		client:   &http.Client{Timeout: config.Timeout},
+		backoff:  time.Second,
+		sleep:    time.Sleep,
+		now:      time.Now,
+	}
+}
+
+// Webhooks returns the configured webhooks
+func (s *WebhookService) Webhooks() []Webhook {
+	return s.hooks
+}
+
+// Emit sends event to every webhook that subscribes to it, without waiting
+// for the deliveries
+func (s *WebhookService) Emit(event WebhookEvent) {
+	if s == nil {
+		return
+	}
+	event.ID = newWebhookID()
+	event.Time = s.now().UTC()
+	for _, hook := range s.hooks {
+		if !hook.Wants(event.Type) {
+			continue
+		}
+		delivery := WebhookDelivery{
+			ID:        newWebhookID(),
+			Webhook:   hook.Name,
+			Event:     event,
+			Status:    WebhookPending,
+			UpdatedAt: event.Time,
+		}
+		s.record(delivery)
+		s.wg.Add(1)
+		go func(hook Webhook, delivery WebhookDelivery) {
+			defer s.wg.Done()
+			s.deliver(hook, delivery)
+		}(hook, delivery)
+	}
+}
+
+// Wait blocks until every delivery in progress has finished
+func (s *WebhookService) Wait() {
+	s.wg.Wait()
+}
+
+// Deliveries returns the delivery log, newest first
+func (s *WebhookService) Deliveries() []WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := make([]WebhookDelivery, len(s.deliveries))
+	for i, delivery := range s.deliveries {
+		deliveries[len(deliveries)-1-i] = delivery
+	}
+	return deliveries
+}
+
+func (s *WebhookService) deliver(hook Webhook, delivery WebhookDelivery) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		delivery.Status, delivery.Error = WebhookFailed, err.Error()
+		s.record(delivery)
+		return
+	}
+
+	backoff := s.backoff
+	for delivery.Attempts < s.attempts {
+		if delivery.Attempts > 0 {
+			s.sleep(backoff)
+			backoff = min(backoff*2, time.Minute)
+		}
+		delivery.Attempts++
+		code, err := s.post(hook, delivery, body)
+		delivery.ResponseCode, delivery.UpdatedAt = code, s.now().UTC()
+		if err == nil {
+			delivery.Status, delivery.Error = WebhookDelivered, ""
+			s.record(delivery)
+			return
+		}
+		delivery.Error = err.Error()
+		// Other client errors will not go away by retrying
+		if code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests {
+			break
+		}
+		s.record(delivery)
+	}
+	delivery.Status = WebhookFailed
+	s.record(delivery)
+	log.Printf("Webhooks: giving up on %s to %q after %d attempts: %s", delivery.Event.Type, hook.Name, delivery.Attempts, delivery.Error)
+}
+
+func (s *WebhookService) post(hook Webhook, delivery WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "IronBuckets-Webhook")
+	req.Header.Set("X-IronBuckets-Event", string(delivery.Event.Type))
+	req.Header.Set("X-IronBuckets-Delivery", delivery.ID)
+	req.Header.Set("X-IronBuckets-Signature", SignWebhookPayload(hook.Secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record adds or updates a delivery in the log
+func (s *WebhookService) record(delivery WebhookDelivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if s.deliveries[i].ID == delivery.ID {
+			s.deliveries[i] = delivery
+			return
+		}
+	}
+	s.deliveries = append(s.deliveries, delivery)
+	if len(s.deliveries) > webhookDeliveryHistory {
+		s.deliveries = s.deliveries[len(s.deliveries)-webhookDeliveryHistory:]
+	}
+}
+
+// SignWebhookPayload returns the X-IronBuckets-Signature header value for
+// body: "sha256=" followed by the hex HMAC-SHA256 of body keyed with secret
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookID() string {
+	idBytes := make([]byte, 8)
+	_, _ = rand.Read(idBytes)
+	return hex.EncodeToString(idBytes)
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeWebhookConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "webhooks.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestWebhookService(hooks ...Webhook) *WebhookService {
+	svc := NewWebhookService(&WebhookConfig{Webhooks: hooks, Attempts: 3, Timeout: time.Second})
+	svc.sleep = func(time.Duration) {}
+	return svc
+}
+
+func TestLoadWebhookConfig(t *testing.T) {
+	t.Setenv("CHATOPS_SECRET", "s3cret")
+	config, err := LoadWebhookConfig(writeWebhookConfig(t, `
+attempts: 3
+timeout: 5s
+webhooks:
+  - name: chatops
+    url: https://hooks.example.com/ironbuckets
+    secret: ${CHATOPS_SECRET}
+    events: [bucket.created, "bucket.policy.*"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Attempts != 3 || config.Timeout != 5*time.Second {
+		t.Errorf("config = %+v", config)
+	}
+	if hook := config.Webhooks[0]; hook.Secret != "s3cret" {
+		t.Errorf("Secret = %q, want it read from the environment", hook.Secret)
+	}
+
+	for name, content := range map[string]string{
+		"unknown event": "webhooks:\n  - {name: a, url: https://x.example, secret: s, events: [bucket.renamed]}\n",
+		"bad url":       "webhooks:\n  - {name: a, url: ftp://x.example, secret: s, events: ['*']}\n",
+		"no secret":     "webhooks:\n  - {name: a, url: https://x.example, events: ['*']}\n",
+		"duplicate":     "webhooks:\n  - {name: a, url: https://x.example, secret: s, events: ['*']}\n  - {name: a, url: https://y.example, secret: s, events: ['*']}\n",
+	} {
+		if _, err := LoadWebhookConfig(writeWebhookConfig(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWebhookWants(t *testing.T) {
+	hook := Webhook{Events: []string{"bucket.policy.*", "user.created"}}
+	for eventType, want := range map[WebhookEventType]bool{
+		WebhookBucketPolicyPublic:  true,
+		WebhookBucketPolicyChanged: true,
+		WebhookUserCreated:         true,
+		WebhookBucketCreated:       false,
+		WebhookUserDeleted:         false,
+	} {
+		if got := hook.Wants(eventType); got != want {
+			t.Errorf("Wants(%s) = %v, want %v", eventType, got, want)
+		}
+	}
+	if !(Webhook{Events: []string{"*"}}).Wants(WebhookServerRestarted) {
+		t.Error("* should match every event")
+	}
+}
+
+func TestWebhookDeliversSignedPayloads(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	svc := newTestWebhookService(
+		Webhook{Name: "chatops", URL: server.URL, Secret: "s3cret", Events: []string{"bucket.*"}},
+		Webhook{Name: "tickets", URL: server.URL, Secret: "other", Events: []string{"user.*"}},
+	)
+	svc.Emit(NewWebhookEvent(WebhookBucketCreated, Credentials{Endpoint: "minio:9000", AccessKey: "admin"}, map[string]string{"bucket": "reports"}))
+	svc.Wait()
+
+	r := <-received
+	if got, want := r.Header.Get("X-IronBuckets-Signature"), SignWebhookPayload("s3cret", body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if !strings.HasPrefix(r.Header.Get("X-IronBuckets-Signature"), "sha256=") {
+		t.Errorf("signature should be prefixed with sha256=")
+	}
+	if r.Header.Get("X-IronBuckets-Event") != "bucket.created" {
+		t.Errorf("event header = %q", r.Header.Get("X-IronBuckets-Event"))
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != WebhookBucketCreated || event.Actor != "admin" || event.Data["bucket"] != "reports" || event.ID == "" {
+		t.Errorf("payload = %+v", event)
+	}
+
+	deliveries := svc.Deliveries()
+	if len(deliveries) != 1 || deliveries[0].Webhook != "chatops" || deliveries[0].Status != WebhookDelivered {
+		t.Errorf("Deliveries() = %+v, want one delivered to chatops only", deliveries)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	svc := newTestWebhookService(Webhook{Name: "chatops", URL: server.URL, Secret: "s", Events: []string{"*"}})
+	var waits []time.Duration
+	svc.sleep = func(d time.Duration) { waits = append(waits, d) }
+	svc.Emit(NewWebhookEvent(WebhookServerRestarted, Credentials{AccessKey: "admin"}, nil))
+	svc.Wait()
+
+	delivery := svc.Deliveries()[0]
+	if delivery.Status != WebhookDelivered || delivery.Attempts != 3 {
+		t.Errorf("delivery = %+v, want delivered on the third attempt", delivery)
+	}
+	if len(waits) != 2 || waits[0] != time.Second || waits[1] != 2*time.Second {
+		t.Errorf("waits = %v, want 1s then 2s", waits)
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("X-IronBuckets-Event") == "user.created" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	svc := newTestWebhookService(Webhook{Name: "chatops", URL: server.URL, Secret: "s", Events: []string{"*"}})
+	svc.Emit(NewWebhookEvent(WebhookServerRestarted, Credentials{AccessKey: "admin"}, nil))
+	svc.Wait()
+	if delivery := svc.Deliveries()[0]; delivery.Status != WebhookFailed || delivery.Attempts != 3 || delivery.ResponseCode != http.StatusServiceUnavailable {
+		t.Errorf("delivery = %+v, want failed after 3 attempts", delivery)
+	}
+
+	calls.Store(0)
+	svc.Emit(NewWebhookEvent(WebhookUserCreated, Credentials{AccessKey: "admin"}, nil))
+	svc.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("a 401 was retried %d times, want no retries", calls.Load()-1)
+	}
+}
+
+func TestNilWebhookServiceSendsNothing(t *testing.T) {
+	var svc *WebhookService
+	svc.Emit(NewWebhookEvent(WebhookBucketCreated, Credentials{}, nil))
+}
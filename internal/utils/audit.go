@@ -0,0 +1,42 @@
+package utils
+
+import "github.com/labstack/echo/v4"
+
+// ContextKeyAudit holds the details handlers add to a request's audit event
+const ContextKeyAudit = "audit"
+
+// AuditDetails are what a handler knows about a change that the request
+// itself does not show
+type AuditDetails struct {
+	Values map[string]string
+	// Error is set when a failure is reported to the user with a 200, such
+	// as a login form error
+	Error string
+}
+
+func auditDetails(c echo.Context) *AuditDetails {
+	details, ok := c.Get(ContextKeyAudit).(*AuditDetails)
+	if !ok {
+		details = &AuditDetails{Values: make(map[string]string)}
+		c.Set(ContextKeyAudit, details)
+	}
+	return details
+}
+
+// SetAuditValue adds key to the parameters of the request's audit event
+func SetAuditValue(c echo.Context, key, value string) {
+	auditDetails(c).Values[key] = value
+}
+
+// SetAuditError records the request as failed even though it succeeds at
+// the HTTP level
+func SetAuditError(c echo.Context, message string) {
+	auditDetails(c).Error = message
+}
+
+// AuditDetailsOf returns the details added with SetAuditValue and
+// SetAuditError, or nil
+func AuditDetailsOf(c echo.Context) *AuditDetails {
+	details, _ := c.Get(ContextKeyAudit).(*AuditDetails)
+	return details
+}
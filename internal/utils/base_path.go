@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ParseBasePath checks the path IronBuckets is served under, such as
+// /storage, and returns it without a trailing slash. "" and "/" serve from
+// the root and return "".
+func ParseBasePath(value string) (string, error) {
+	value = strings.TrimSuffix(value, "/")
+	if value == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(value, "/") || path.Clean(value) != value {
+		return "", fmt.Errorf("base path must look like /storage, got %q", value)
+	}
+	for _, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/-._~", r)) {
+			return "", fmt.Errorf("base path %q may only contain letters, digits and -._~", value)
+		}
+	}
+	return value, nil
+}
+
+// BasePath returns the path IronBuckets is served under, or "" at the root
+func BasePath(c echo.Context) string {
+	base, _ := c.Get(ContextKeyBasePath).(string)
+	return base
+}
+
+// URL turns an application path such as /buckets into the URL the browser
+// uses, by adding the base path
+func URL(c echo.Context, path string) string {
+	return BasePath(c) + path
+}
@@ -0,0 +1,23 @@
+package utils
+
+import "testing"
+
+func TestParseBasePath(t *testing.T) {
+	valid := map[string]string{
+		"":               "",
+		"/":              "",
+		"/storage":       "/storage",
+		"/storage/":      "/storage",
+		"/tools/s3_ui-2": "/tools/s3_ui-2",
+	}
+	for value, want := range valid {
+		if got, err := ParseBasePath(value); err != nil || got != want {
+			t.Errorf("ParseBasePath(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"storage", "/storage//ui", "/a/../b", "/storage?x=1", "/st orage", `/"><script>`} {
+		if _, err := ParseBasePath(value); err == nil {
+			t.Errorf("ParseBasePath(%q): expected an error", value)
+		}
+	}
+}
@@ -6,3 +6,31 @@ const ContextKeyCreds = "creds"
 
 // CookieName is the name of the authentication cookie
 const CookieName = "IronSeal"
+
+// ContextKeySession is the key used to store the *services.SessionState in the echo context
+const ContextKeySession = "session"
+
+// PendingLoginCookieName holds a login that still needs its second factor
+const PendingLoginCookieName = "IronSealMFA"
+
+// ContextKeyAPIToken is the key used to store the *services.APIToken of a
+// request authenticated with a bearer token
+const ContextKeyAPIToken = "apiToken"
+
+// ContextKeyPermissions is the key used to store the *services.Permissions of
+// the signed-in account
+const ContextKeyPermissions = "permissions"
+
+// ContextKeyRole is the key used to store the *services.Role of the
+// signed-in user when roles are configured
+const ContextKeyRole = "role"
+
+// ContextKeyOrigin is the key used to store the resolved Origin of a request
+const ContextKeyOrigin = "origin"
+
+// ContextKeyCSPNonce is the key used to store the request's Content-Security-Policy nonce
+const ContextKeyCSPNonce = "cspNonce"
+
+// ContextKeyBasePath is the key used to store the path IronBuckets is served
+// under, set by the BasePath middleware
+const ContextKeyBasePath = "basePath"
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IsSecureRequest reports whether the request reached us over HTTPS, either
+// directly or through a trusted TLS-terminating proxy
+func IsSecureRequest(c echo.Context) bool {
+	if origin, ok := c.Get(ContextKeyOrigin).(Origin); ok {
+		return origin.Secure
+	}
+	return c.Request().TLS != nil
+}
+
+// SetSessionCookie writes the session cookie. Login, refresh and logout must
+// agree on every attribute or browsers treat them as different cookies.
+func SetSessionCookie(c echo.Context, value string, expires time.Time) {
+	cookie := new(http.Cookie)
+	cookie.Name = CookieName
+	cookie.Value = value
+	cookie.Expires = expires
+	cookie.Path = URL(c, "/")
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteStrictMode
+	cookie.Secure = IsSecureRequest(c)
+	c.SetCookie(cookie)
+}
+
+// ClearSessionCookie expires the session cookie
+func ClearSessionCookie(c echo.Context) {
+	cookie := new(http.Cookie)
+	cookie.Name = CookieName
+	cookie.Value = ""
+	cookie.Expires = time.Now().Add(-1 * time.Hour)
+	cookie.MaxAge = -1
+	cookie.Path = URL(c, "/")
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteStrictMode
+	cookie.Secure = IsSecureRequest(c)
+	c.SetCookie(cookie)
+}
+
+// SetPendingLoginCookie writes the short-lived cookie that carries a login
+// through the second factor step. It is only sent to the login pages.
+func SetPendingLoginCookie(c echo.Context, value string, expires time.Time) {
+	cookie := new(http.Cookie)
+	cookie.Name = PendingLoginCookieName
+	cookie.Value = value
+	cookie.Expires = expires
+	cookie.Path = URL(c, "/login")
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteStrictMode
+	cookie.Secure = IsSecureRequest(c)
+	c.SetCookie(cookie)
+}
+
+// ClearPendingLoginCookie expires the pending login cookie
+func ClearPendingLoginCookie(c echo.Context) {
+	cookie := new(http.Cookie)
+	cookie.Name = PendingLoginCookieName
+	cookie.Value = ""
+	cookie.Expires = time.Now().Add(-1 * time.Hour)
+	cookie.MaxAge = -1
+	cookie.Path = URL(c, "/login")
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteStrictMode
+	cookie.Secure = IsSecureRequest(c)
+	c.SetCookie(cookie)
+}
@@ -0,0 +1,23 @@
+package utils
+
+import "github.com/labstack/echo/v4"
+
+// ContextKeyLayout holds values the page layout needs on every page, such as
+// the current cluster, so each handler does not have to pass them along
+const ContextKeyLayout = "layout"
+
+// SetLayoutValue makes value available to the page layout as .<key>
+func SetLayoutValue(c echo.Context, key string, value interface{}) {
+	values, ok := c.Get(ContextKeyLayout).(map[string]interface{})
+	if !ok {
+		values = make(map[string]interface{})
+		c.Set(ContextKeyLayout, values)
+	}
+	values[key] = value
+}
+
+// LayoutValues returns the values set with SetLayoutValue
+func LayoutValues(c echo.Context) map[string]interface{} {
+	values, _ := c.Get(ContextKeyLayout).(map[string]interface{})
+	return values
+}
@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Origin is where a request really came from, after forwarded headers from
+// trusted proxies have been applied
+type Origin struct {
+	// ClientIP is the address of the browser or script
+	ClientIP string
+	// Secure is true when the client connected over HTTPS
+	Secure bool
+	// Host is the host name the client asked for
+	Host string
+}
+
+// TrustedProxies decides which forwarded headers to believe. Forwarded,
+// X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host are only honoured
+// when the connection comes from one of the configured networks; anyone else
+// could set them to spoof their address or claim HTTPS.
+type TrustedProxies struct {
+	networks []*net.IPNet
+}
+
+// NewTrustedProxies parses a list of CIDR ranges or single addresses
+func NewTrustedProxies(entries []string) (*TrustedProxies, error) {
+	p := &TrustedProxies{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			p.networks = append(p.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		p.networks = append(p.networks, network)
+	}
+	return p, nil
+}
+
+// trusted reports whether addr belongs to a trusted proxy
+func (p *TrustedProxies) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if p == nil || ip == nil {
+		return false
+	}
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve works out the origin of a request. Proxy chains are read from the
+// right, skipping trusted proxies, so the client address is the last hop a
+// trusted proxy vouched for. When a request carries the standard Forwarded
+// header it is used instead of the X-Forwarded-* headers.
+func (p *TrustedProxies) Resolve(req *http.Request) Origin {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	origin := Origin{ClientIP: remote, Secure: req.TLS != nil, Host: req.Host}
+	if !p.trusted(remote) {
+		return origin
+	}
+
+	if values := req.Header.Values("Forwarded"); len(values) > 0 {
+		hops := parseForwarded(values)
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr := hops[i]["for"]
+			if net.ParseIP(addr) == nil {
+				// Obfuscated or "unknown" hops hide the client; keep the last known address
+				break
+			}
+			origin.ClientIP = addr
+			if proto := hops[i]["proto"]; proto != "" {
+				origin.Secure = strings.EqualFold(proto, "https")
+			}
+			if host := hops[i]["host"]; host != "" {
+				origin.Host = host
+			}
+			if !p.trusted(addr) {
+				break
+			}
+		}
+		return origin
+	}
+
+	// The proxy that recorded the client address recorded its scheme and host
+	// at the same position; entries further left came from the client
+	hop, hops := -1, 0
+	if xff := req.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		list := splitList(strings.Join(xff, ","))
+		hops = len(list)
+		for i := len(list) - 1; i >= 0; i-- {
+			if net.ParseIP(list[i]) == nil {
+				break
+			}
+			origin.ClientIP, hop = list[i], i
+			if !p.trusted(list[i]) {
+				break
+			}
+		}
+	}
+	if proto := forwardedValue(req.Header.Values("X-Forwarded-Proto"), hop, hops); proto != "" {
+		origin.Secure = strings.EqualFold(proto, "https")
+	}
+	if host := forwardedValue(req.Header.Values("X-Forwarded-Host"), hop, hops); host != "" {
+		origin.Host = host
+	}
+	return origin
+}
+
+// ValidHost reports whether host is a host name or IP address with an
+// optional port, which is all a Host header may carry
+func ValidHost(host string) bool {
+	name := host
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n > 65535 || strings.Trim(port, "0123456789") != "" {
+			return false
+		}
+		name = h
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		name = host[1 : len(host)-1]
+	} else if strings.Contains(host, ":") {
+		return false
+	}
+	if name == "" {
+		return false
+	}
+	if strings.Contains(host, "[") {
+		// Brackets are only for IPv6 addresses
+		ip := net.ParseIP(name)
+		return ip != nil && ip.To4() == nil
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ClientIP returns the resolved client address. It has the signature of
+// echo.IPExtractor so c.RealIP() uses the same rules.
+func (p *TrustedProxies) ClientIP(req *http.Request) string {
+	return p.Resolve(req).ClientIP
+}
+
+// parseForwarded splits RFC 7239 Forwarded headers into one map per hop
+func parseForwarded(values []string) []map[string]string {
+	var hops []map[string]string
+	for _, element := range splitList(strings.Join(values, ",")) {
+		hop := make(map[string]string)
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			key = strings.ToLower(key)
+			value = strings.Trim(value, `"`)
+			if key == "for" {
+				value = forwardedAddress(value)
+			}
+			hop[key] = value
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// forwardedAddress strips the port and brackets from a Forwarded "for" value
+// such as "[2001:db8::1]:4711" or "192.0.2.60:8080"
+func forwardedAddress(value string) string {
+	if strings.HasPrefix(value, "[") {
+		if end := strings.Index(value, "]"); end > 0 {
+			return value[1:end]
+		}
+		return value
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return host
+	}
+	return value
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// forwardedValue picks the X-Forwarded-Proto or X-Forwarded-Host entry that
+// pairs with X-Forwarded-For entry hop of hops. When the lists do not line up,
+// because a proxy overwrote the header or a client prepended to it, only the
+// rightmost entry, set by the nearest proxy, can be believed.
+func forwardedValue(values []string, hop, hops int) string {
+	items := splitList(strings.Join(values, ","))
+	switch {
+	case len(items) == 0:
+		return ""
+	case hop >= 0 && len(items) == hops:
+		return items[hop]
+	default:
+		return items[len(items)-1]
+	}
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesResolve(t *testing.T) {
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5", " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    Origin
+	}{
+		{
+			name:    "untrusted client cannot spoof",
+			remote:  "203.0.113.9:5000",
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example"},
+			want:    Origin{ClientIP: "203.0.113.9", Host: "console.internal"},
+		},
+		{
+			name:    "trusted proxy",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "console.example.com"},
+			want:    Origin{ClientIP: "198.51.100.7", Secure: true, Host: "console.example.com"},
+		},
+		{
+			name:    "spoofed entries left of the client are ignored",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.3"},
+			want:    Origin{ClientIP: "198.51.100.7", Host: "console.internal"},
+		},
+		{
+			name:    "scheme and host come from the proxy that saw the client",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.3", "X-Forwarded-Proto": "https, https, http", "X-Forwarded-Host": "evil.example, console.example.com, console.internal"},
+			want:    Origin{ClientIP: "198.51.100.7", Secure: true, Host: "console.example.com"},
+		},
+		{
+			name:    "client cannot prepend a scheme",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.example, console.example.com"},
+			want:    Origin{ClientIP: "198.51.100.7", Host: "console.example.com"},
+		},
+		{
+			name:    "single trusted address",
+			remote:  "192.168.1.5:5000",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			want:    Origin{ClientIP: "198.51.100.7", Host: "console.internal"},
+		},
+		{
+			name:    "forwarded header wins",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https;host=console.example.com, for=10.0.0.3`, "X-Forwarded-For": "1.2.3.4"},
+			want:    Origin{ClientIP: "2001:db8::1", Secure: true, Host: "console.example.com"},
+		},
+		{
+			name:    "obfuscated forwarded client",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"Forwarded": "for=_hidden;proto=https"},
+			want:    Origin{ClientIP: "10.0.0.2", Host: "console.internal"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://console.internal/", nil)
+			req.RemoteAddr = tt.remote
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			if got := proxies.Resolve(req); got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "proxy.internal"} {
+		if _, err := NewTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("NewTrustedProxies(%q) should fail", entry)
+		}
+	}
+}
+
+func TestTrustedProxiesNoneConfigured(t *testing.T) {
+	proxies, err := NewTrustedProxies(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if ip := proxies.ClientIP(req); ip != "127.0.0.1" {
+		t.Errorf("ClientIP() = %q, forwarded headers should be ignored without trusted proxies", ip)
+	}
+}
+
+func TestValidHost(t *testing.T) {
+	for _, host := range []string{"console.example.com", "console.example.com:8443", "localhost", "10.0.0.2:80", "[2001:db8::1]", "[2001:db8::1]:443", "minio_1"} {
+		if !ValidHost(host) {
+			t.Errorf("ValidHost(%q) = false, want true", host)
+		}
+	}
+	for _, host := range []string{"", ":443", "evil.example/path", "evil.example:443/x", "a b", "evil.example:http", "evil.example:99999", "2001:db8::1", "[evil.example]", "[10.0.0.2]:80", "evil<script>", "host\r\nX: y", "user@evil.example"} {
+		if ValidHost(host) {
+			t.Errorf("ValidHost(%q) = true, want false", host)
+		}
+	}
+}
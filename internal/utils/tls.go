@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSOptions describe how IronBuckets serves HTTPS
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.0", "1.1", "1.2" or "1.3"
+	MinVersion string
+	// Ciphers are Go cipher suite names for TLS 1.2 and below; empty keeps
+	// Go's defaults. TLS 1.3 suites are not configurable.
+	Ciphers []string
+	// ClientAuth is "none", "optional" or "require"
+	ClientAuth   string
+	ClientCAFile string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion reads a TLS version such as "1.2"
+func ParseTLSVersion(value string) (uint16, error) {
+	version, ok := tlsVersions[value]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", value)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites reads Go cipher suite names, such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Insecure suites are refused.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseClientAuth reads a client certificate mode: none, optional or require
+func ParseClientAuth(value string) (tls.ClientAuthType, error) {
+	switch value {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unknown client certificate mode %q (want none, optional or require)", value)
+	}
+}
+
+// NewServerTLS builds the server TLS configuration. The certificate is served
+// through the returned reloader, so it can be replaced while running.
+func NewServerTLS(opts TLSOptions) (*tls.Config, *CertificateReloader, error) {
+	minVersion, err := ParseTLSVersion(opts.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphers, err := ParseCipherSuites(opts.Ciphers)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientAuth, err := ParseClientAuth(opts.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	reloader, err := NewCertificateReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+		ClientAuth:     clientAuth,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("%s: no certificates found", opts.ClientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+	if clientAuth != tls.NoClientCert && config.ClientCAs == nil {
+		return nil, nil, errors.New("client certificates need a client CA file")
+	}
+	return config, reloader, nil
+}
+
+// CertificateReloader serves a certificate and key from files, and swaps in
+// new ones when the files change. Connections already open keep the
+// certificate they were made with.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertificateReloader loads the certificate and key
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload reads the files again. A bad certificate is reported and the
+// current one kept.
+func (r *CertificateReloader) Reload() error {
+	modTime := r.filesModTime()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// changed reports whether either file was modified since the last reload
+func (r *CertificateReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.filesModTime().Equal(r.modTime)
+}
+
+// filesModTime is the later modification time of the certificate and key
+func (r *CertificateReloader) filesModTime() time.Time {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// Watch reloads the certificate when a value arrives on reload, such as a
+// SIGHUP, and when the files change, checking every interval. Zero interval
+// only reloads on request. It returns when ctx is done.
+func (r *CertificateReloader) Watch(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+		case <-tick:
+			if !r.changed() {
+				continue
+			}
+		}
+		if err := r.Reload(); err != nil {
+			log.Printf("TLS: keeping the current certificate: %v", err)
+			continue
+		}
+		log.Printf("TLS: reloaded certificate from %s", r.certFile)
+	}
+}
+
+// HTTPSRedirect redirects every request to the same host and path over
+// HTTPS on the port of httpsAddr
+func HTTPSRedirect(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && port != "443" {
+			host += ":" + port
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
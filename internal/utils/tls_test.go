@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and key with the given
+// serial number, and returns their paths
+func writeCertificate(t *testing.T, dir string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func servedSerial(t *testing.T, reloader *CertificateReloader) int64 {
+	t.Helper()
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertificateReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, 1)
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, reloader); serial != 1 {
+		t.Fatalf("serial = %d, want 1", serial)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond, nil)
+
+	writeCertificate(t, dir, 2)
+	later := time.Now().Add(time.Second)
+	_ = os.Chtimes(certFile, later, later)
+	deadline := time.Now().Add(2 * time.Second)
+	for servedSerial(t, reloader) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the changed certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCertificateReloaderKeepsCertificateOnBadReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, 1)
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Error("expected an error for a bad key")
+	}
+	if serial := servedSerial(t, reloader); serial != 1 {
+		t.Errorf("serial = %d, the old certificate should still be served", serial)
+	}
+
+	if _, err := NewCertificateReloader(certFile, keyFile); err == nil {
+		t.Error("expected an error when the first load fails")
+	}
+}
+
+func TestNewServerTLS(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir(), 1)
+	config, _, err := NewServerTLS(TLSOptions{
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		MinVersion: "1.3",
+		Ciphers:    []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS13 || len(config.CipherSuites) != 1 || config.ClientAuth != tls.NoClientCert {
+		t.Errorf("unexpected config: %+v", config)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}}}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("a TLS 1.2 client should be refused")
+	}
+
+	if _, _, err := NewServerTLS(TLSOptions{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientAuth: "require"}); err == nil {
+		t.Error("expected an error for client certificates without a CA")
+	}
+	if _, _, err := NewServerTLS(TLSOptions{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientAuth: "optional", ClientCAFile: certFile}); err != nil {
+		t.Errorf("expected the CA file to be accepted: %v", err)
+	}
+}
+
+func TestParseTLSOptions(t *testing.T) {
+	if _, err := ParseTLSVersion("1.4"); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("expected an error for an insecure cipher suite")
+	}
+	if _, err := ParseClientAuth("sometimes"); err == nil {
+		t.Error("expected an error for an unknown client certificate mode")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		addr, host, want string
+	}{
+		{":8443", "console.example.com", "https://console.example.com:8443/buckets?page=2"},
+		{":443", "console.example.com:80", "https://console.example.com/buckets?page=2"},
+		{"0.0.0.0:8443", "[::1]:8080", "https://[::1]:8443/buckets?page=2"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/buckets?page=2", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		HTTPSRedirect(tt.addr).ServeHTTP(rec, req)
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+			t.Errorf("HTTPSRedirect(%q) for %q = %d %q, want %q", tt.addr, tt.host, rec.Code, rec.Header().Get("Location"), tt.want)
+		}
+	}
+}
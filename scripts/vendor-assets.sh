@@ -0,0 +1,35 @@
+#!/bin/sh
+# Vendors the front-end dependencies into internal/assets/static and builds
+# the stylesheet. The results are committed and embedded in the binary, so
+# IronBuckets never loads anything from a CDN at runtime.
+set -eu
+
+HTMX_VERSION=1.9.10
+LUCIDE_VERSION=0.445.0
+ALPINE_VERSION=3.15.0
+INTER_VERSION=5.1.0
+TAILWIND_VERSION=3.4.17
+
+cd "$(dirname "$0")/.."
+static=internal/assets/static
+mkdir -p "$static/vendor" "$static/fonts" "$static/css"
+
+fetch() {
+    echo "Fetching $1"
+    curl -fsSL --retry 3 -o "$2" "$1"
+}
+
+fetch "https://unpkg.com/htmx.org@$HTMX_VERSION/dist/htmx.min.js" "$static/vendor/htmx.min.js"
+fetch "https://unpkg.com/lucide@$LUCIDE_VERSION/dist/umd/lucide.min.js" "$static/vendor/lucide.min.js"
+fetch "https://unpkg.com/@alpinejs/csp@$ALPINE_VERSION/dist/cdn.min.js" "$static/vendor/alpine-csp.min.js"
+for weight in 400 500 600 700; do
+    fetch "https://unpkg.com/@fontsource/inter@$INTER_VERSION/files/inter-latin-$weight-normal.woff2" \
+        "$static/fonts/inter-latin-$weight-normal.woff2"
+done
+
+echo "Building $static/css/app.css"
+npx --yes "tailwindcss@$TAILWIND_VERSION" \
+    -c internal/assets/tailwind.config.js \
+    -i internal/assets/tailwind.css \
+    -o "$static/css/app.css" \
+    --minify
@@ -0,0 +1,12 @@
+// Package views embeds the HTML templates, so the server runs from any
+// working directory. Pages in pages/ render inside layouts/base.html unless
+// they define "base" themselves; each partial in partials/ defines a block
+// named after its file. The renderer finds both by these conventions.
+package views
+
+import "embed"
+
+// FS holds layouts/, pages/ and partials/
+//
+//go:embed layouts pages partials
+var FS embed.FS